@@ -3,7 +3,7 @@
 from __future__ import annotations
 import logging
 from importlib import metadata
-from .api import ExtractionError, to_json, ConversionResult
+from .api import ExtractionError, UnsupportedFormatError, DocumentTooLargeError, to_json, ConversionResult, set_metrics_callback
 from .models import Block, Page, Pages
 
 __all__ = [
@@ -11,8 +11,11 @@ __all__ = [
     "Page",
     "Pages",
     "ExtractionError",
+    "UnsupportedFormatError",
+    "DocumentTooLargeError",
     "to_json",
     "ConversionResult",
+    "set_metrics_callback",
     "__version__",
 ]
 logging.getLogger(__name__).addHandler(logging.NullHandler())
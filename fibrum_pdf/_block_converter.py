@@ -3,6 +3,8 @@
 from __future__ import annotations
 import logging
 import re
+import string
+import unicodedata
 from typing import Any
 
 log = logging.getLogger(__name__)
@@ -17,6 +19,74 @@ STYLES = [
     ("strikeout", "~~"),
     ("subscript", "~"),
 ]
+ENTITY = re.compile(r"&(#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});")
+ATX_HEADING = re.compile(r"#{1,6}(\s|$)")
+UNDERLINE = re.compile(r"(-+|=+)\s*$")
+CLOSING_HASH = re.compile(r"(^|\s)(#+)\s*$")
+
+
+def _escape(text: str, brackets: bool = False, pipes: bool = False) -> str:
+    """escape what markdown would take as inline syntax, as markdown/escape.go."""
+    out = []
+    for i, c in enumerate(text):
+        prev = text[i - 1] if i else ""
+        nxt = text[i + 1] if i + 1 < len(text) else ""
+        if c == "<" and (nxt.isalpha() or nxt in ("/", "!", "?")):
+            out.append("&lt;")
+            continue
+        if c == "&" and ENTITY.match(text, i):
+            out.append("&amp;")
+            continue
+        if (
+            c in "*`"
+            or (c == "\\" and (not nxt or nxt in string.punctuation))
+            or (c == "_" and not (prev.isalnum() and nxt.isalnum()))
+            or (c == "~" and nxt and not nxt.isspace())
+            or (c == "[" and brackets)
+            or (c == "]" and (brackets or nxt in ("(", "[", ":")))
+            or (c == "|" and pipes)
+        ):
+            out.append("\\")
+        out.append(c)
+    return "".join(out)
+
+
+def _escape_lines(text: str) -> str:
+    lines = text.split("\n")
+    for i, ln in enumerate(lines):
+        body = ln.lstrip(" \t")
+        if (
+            ATX_HEADING.match(body)
+            or body.startswith(">")
+            or body.startswith("+ ")
+            or body == "+"
+            or UNDERLINE.match(body)
+        ):
+            lines[i] = ln[: len(ln) - len(body)] + "\\" + body
+    return "\n".join(lines)
+
+
+def _escape_heading(text: str) -> str:
+    text = " ".join(text.split())
+    if m := CLOSING_HASH.search(text):
+        text = text[: m.start(2)] + "\\" + text[m.start(2) :]
+    return text
+
+
+def _code_span(text: str) -> str:
+    fence = "`" * (max((len(r) for r in re.findall(r"`+", text)), default=0) + 1)
+    if text.startswith("`") or text.endswith("`"):
+        return f"{fence} {text} {fence}"
+    return f"{fence}{text}{fence}"
+
+
+def _plain_text(md: str) -> str:
+    entities = {"&lt;": "<", "&amp;": "&"}
+    return re.sub(
+        r"\\([!-/:-@\[-`{-~])|&lt;|&amp;|~~|\*|`|\^",
+        lambda m: m.group(1) or entities.get(m.group(0), ""),
+        md,
+    )
 
 
 def _normalize_bullets(text: str) -> str:
@@ -39,8 +109,11 @@ def _style_span(span: dict[str, Any]) -> str:
         return ""
     if span.get("superscript"):
         s = text.strip()
-        return f"[{s}]" if s.isdigit() or re.match(r"^\d+[,\s\d]*$", s) else f"^{text}^"
-    for key, fmt in STYLES:
+        if s.isdigit() or re.match(r"^\d+[,\s\d]*$", s):
+            return f"[{s}]"
+        return f"^{_escape(text)}^"
+    text = _code_span(text) if span.get("monospace") else _escape(text)
+    for key, fmt in STYLES[1:]:
         if span.get(key):
             text = f"{fmt}{text}{fmt}"
     return text
@@ -54,8 +127,11 @@ def _join_spans(spans: list[dict[str, Any]]) -> str:
         styled = _style_span(span)
         if not styled:
             continue
+        # only styles wrap text in markers; plain text has its own escaped
+        wrapped = any(span.get(key) for key, _ in STYLES)
         if (
             parts
+            and wrapped
             and any(styled.startswith(m) for m in FMT_MARKERS)
             and parts[-1][-1:] not in " \n\t([/"
         ):
@@ -64,7 +140,8 @@ def _join_spans(spans: list[dict[str, Any]]) -> str:
         if i + 1 < len(spans):
             nxt = spans[i + 1].get("text", "")
             if (
-                any(styled.endswith(m) for m in FMT_MARKERS)
+                wrapped
+                and any(styled.endswith(m) for m in FMT_MARKERS)
                 and nxt
                 and nxt[0] not in PUNCT
             ):
@@ -74,8 +151,10 @@ def _join_spans(spans: list[dict[str, Any]]) -> str:
 
 def _cell_text(cell: dict[str, Any]) -> str:
     if spans := cell.get("spans"):
-        return " ".join(s.get("text", "") for s in spans).strip().replace("|", "\\|")
-    return cell.get("text", "").strip().replace("|", "\\|")
+        text = " ".join(s.get("text", "") for s in spans).strip()
+    else:
+        text = cell.get("text", "").strip()
+    return _escape(text, pipes=True).replace("\n", " ")
 
 
 def _table(rows: list[dict[str, Any]]) -> str:
@@ -99,13 +178,23 @@ def _list(block: dict[str, Any], text: str) -> str:
     if items := block.get("items"):
         lines = []
         for item in items:
-            if t := _join_spans(item.get("spans", [])):
+            t = _join_spans(item.get("spans", [])).strip()
+            if marker := item.get("marker"):
+                # the item's text starts with its marker, or "-" in its place
+                for m in (marker, _escape(marker), "-"):
+                    if t.startswith(m):
+                        t = t[len(m) :].strip()
+                        break
+            if t:
                 ind = "  " * item.get("indent", 0)
                 mark = f"{item.get('prefix')} " if item.get("prefix") else "- "
-                lines.append(f"{ind}{mark}{t.strip()}")
+                lines.append(f"{ind}{mark}{_escape_lines(t)}")
         return "\n".join(lines) + "\n" if lines else ""
     return (
-        "\n".join(f"- {ln.strip()}" for ln in text.split("\n") if ln.strip()) + "\n"
+        "\n".join(
+            f"- {_escape_lines(ln.strip())}" for ln in text.split("\n") if ln.strip()
+        )
+        + "\n"
         if text
         else ""
     )
@@ -113,21 +202,57 @@ def _list(block: dict[str, Any], text: str) -> str:
 
 def block_to_markdown(block: dict[str, Any]) -> str:
     typ = block.get("type", "")
-    text = block.get("text", "").strip() or _join_spans(block.get("spans", []))
+    text = block.get("text", "").strip()
+    text = _escape(text) if text else _join_spans(block.get("spans", []))
     if text:
         text = _normalize_bullets(text)
 
     match typ:
         case "heading" if text:
-            return f"{'#' * block.get('level', 1)} {text}\n"
+            return f"{'#' * block.get('level', 1)} {_escape_heading(text)}\n"
         case "paragraph" | "text" if text:
-            return f"{text}\n"
+            return f"{_escape_lines(text)}\n"
         case "table":
             return _table(block.get("rows", []))
-        case "list":
+        case "list" | "references":
             return _list(block, text)
         case "figure":
-            return f"![Figure]({block.get('text', 'figure')})\n"
+            alt = block.get("caption") or block.get("alt") or "Figure"
+            alt = _escape(alt, brackets=True)
+            return f"![{alt}]({block.get('image') or 'figure'})\n"
         case _:
             log.debug("skipping block type=%s", typ)
             return ""
+
+
+def _anchor(text: str) -> str:
+    return "".join(
+        "-" if c == " " else c
+        for c in text.lower()
+        if c in " -_" or c.isalnum() or unicodedata.category(c).startswith("M")
+    )
+
+
+def headings_to_toc(headings: list[dict[str, Any]]) -> str:
+    """nested list of headings linking to their github-style anchors."""
+    entries, seen = [], {}
+    for block in headings:
+        text = (block.get("text") or "").strip() or _plain_text(
+            _join_spans(block.get("spans", []))
+        )
+        text = " ".join(_normalize_bullets(text).split())
+        if not text:
+            continue
+        slug = _anchor(text)
+        if n := seen.get(slug, 0):
+            seen[slug], slug = n + 1, f"{slug}-{n}"
+        else:
+            seen[slug] = 1
+        label = _escape(text, brackets=True)
+        entries.append((max(block.get("level") or 1, 1), label, slug))
+    if not entries:
+        return ""
+    top = min(level for level, _, _ in entries)
+    return "".join(
+        f"{'  ' * (level - top)}- [{label}](#{slug})\n" for level, label, slug in entries
+    )
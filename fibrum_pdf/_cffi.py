@@ -17,7 +17,7 @@ ENV_VAR = "PYMUPDF4LLM_C_LIB"
 def _lib_names() -> tuple[str, ...]:
     match sys.platform:
         case "win32":
-            return ("tomd.dll",)
+            return ("libtomd.dll", "tomd.dll")
         case "darwin":
             return ("libtomd.dylib", "tomd.dylib")
         case _:
@@ -41,6 +41,13 @@ def _search_paths() -> list[Path]:
     return paths
 
 
+def searched_paths() -> list[str]:
+    """where find_library looks, in order, for error messages."""
+    paths = [f"${ENV_VAR}={env}" for env in [os.environ.get(ENV_VAR)] if env]
+    names = ", ".join(_lib_names())
+    return paths + [f"{d}/**/{{{names}}}" for d in _search_paths()]
+
+
 @lru_cache(maxsize=1)
 def find_library() -> Path | None:
     if env := os.environ.get(ENV_VAR):
@@ -48,6 +55,7 @@ def find_library() -> Path | None:
         if p.exists():
             log.debug("library from env: %s", p)
             return p.resolve()
+        log.warning("%s=%s does not exist", ENV_VAR, env)
     for d in _search_paths():
         if not d.exists():
             continue
@@ -56,7 +64,7 @@ def find_library() -> Path | None:
                 if f.is_file():
                     log.debug("found library: %s", f)
                     return f.resolve()
-    log.warning("libtomd not found")
+    log.warning("libtomd not found, searched: %s", "; ".join(searched_paths()))
     return None
 
 
@@ -65,15 +73,27 @@ def get_ffi() -> FFI:
     ffi = FFI()
     ffi.cdef("""
         int pdf_to_json(const char *pdf_path, const char *output_dir);
+        int pdf_to_json_opts(const char *pdf_path, const char *output_dir, const char *options_json);
         char *page_to_json_string(const char *pdf_path, int page_number);
-        void free(void *ptr);
+        void free_string(char *s);
+        typedef void (*pdf_progress_callback)(int done, int total, void *user);
+        typedef void (*pdf_log_callback)(int level, const char *module, const char *message, void *user);
+        typedef void (*pdf_metrics_callback)(const char *name, const char *label, double value, void *user);
+        int pdf_to_json_progress(const char *pdf_path, const char *output_dir, const char *options_json, pdf_progress_callback cb, void *user);
+        void pdf_set_progress_callback(pdf_progress_callback cb, void *user);
+        void pdf_set_metrics_callback(pdf_metrics_callback cb, void *user);
+        void pdf_set_log_callback(pdf_log_callback cb, int level, void *user);
     """)
     return ffi
 
 
 def load_library(path: Path) -> Any:
     log.debug("loading %s", path)
-    if sys.platform != "win32":
+    if sys.platform == "win32":
+        # dependent DLLs are no longer looked up on PATH, so libmupdf.dll next
+        # to libtomd.dll has to be allowed explicitly
+        os.add_dll_directory(str(path.parent))
+    else:
         for mupdf in sorted(path.parent.glob("libmupdf.so.*"), reverse=True) or list(
             path.parent.glob("libmupdf.so")
         ):
@@ -84,4 +104,7 @@ def load_library(path: Path) -> Any:
         return get_ffi().dlopen(str(path))
     except OSError as e:
         log.error("load failed: %s", e)
-        raise RuntimeError(f"failed to load libtomd: {e}") from e
+        raise RuntimeError(
+            f"failed to load libtomd from {path}: {e} - if libmupdf is missing, "
+            "put it next to libtomd or rebuild with 'make libtomd-static'"
+        ) from e
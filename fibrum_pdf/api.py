@@ -3,52 +3,57 @@
 from __future__ import annotations
 import json
 import logging
-import os
-import sys
-import tempfile
-from contextlib import contextmanager
 from functools import lru_cache
 from pathlib import Path
-from typing import Any, Iterator
+from typing import Any, Callable, Iterator
 
-from ._cffi import find_library, load_library
+from ._cffi import find_library, get_ffi, load_library, searched_paths
 from .models import Page, Pages
 
 log = logging.getLogger(__name__)
-_CAPTURE = tempfile.NamedTemporaryFile(mode="w+", delete=False).name
+go_log = logging.getLogger(f"{__package__}.go")
+# the metrics callback set, kept alive while go holds it
+_on_metrics: Any = None
+
+
+@get_ffi().callback("pdf_log_callback")
+def _on_go_log(level: int, module: Any, message: Any, _user: Any) -> None:
+    # go's slog levels are 4 apart from DEBUG = -4, python's 10 apart from 10
+    name = get_ffi().string(module).decode()
+    logger = go_log.getChild(name) if name else go_log
+    logger.log(logging.INFO + level * 10 // 4, get_ffi().string(message).decode(errors="replace"))
 
 
 class ExtractionError(Exception):
     """raised when pdf extraction fails."""
 
 
-@contextmanager
-def _redirect_c_output() -> Iterator[str]:
-    saved = os.dup(1), os.dup(2)
-    fd = os.open(_CAPTURE, os.O_WRONLY | os.O_TRUNC)
-    try:
-        os.dup2(fd, 1)
-        os.dup2(fd, 2)
-        os.close(fd)
-        yield _CAPTURE
-    finally:
-        sys.stdout.flush()
-        sys.stderr.flush()
-        os.dup2(saved[0], 1)
-        os.dup2(saved[1], 2)
-        os.close(saved[0])
-        os.close(saved[1])
+class UnsupportedFormatError(ExtractionError):
+    """raised for a file mupdf cannot open, such as a docx or html page."""
+
+
+class DocumentTooLargeError(ExtractionError):
+    """raised for a file over the max_file_size or max_pages option."""
 
 
 @lru_cache(maxsize=1)
 def _lib(path: Path | None = None):
     p = path or find_library()
     if not p or not p.exists():
+        searched = "\n  ".join(searched_paths())
         raise ExtractionError(
-            "libtomd not found - build with 'make tomd' or set PYMUPDF4LLM_C_LIB"
+            "libtomd not found - build with 'make libtomd' or set "
+            f"PYMUPDF4LLM_C_LIB, searched:\n  {searched}"
         )
     log.info("using library: %s", p)
-    return load_library(p)
+    lib = load_library(p)
+    try:
+        # records below the level set now never reach python
+        level = (go_log.getEffectiveLevel() - logging.INFO) * 4 // 10
+        lib.pdf_set_log_callback(_on_go_log, level, get_ffi().NULL)
+    except AttributeError:
+        log.debug("library predates pdf_set_log_callback, go logs go to stdout")
+    return lib
 
 
 class ConversionResult:
@@ -58,31 +63,70 @@ class ConversionResult:
         self.path = path
         log.debug("result at %s", path)
 
-    def _load(self) -> list[dict[str, Any]]:
+    def _load(self) -> dict[str, Any]:
         with open(self.path, encoding="utf-8") as f:
             return json.load(f)
 
     def collect(self) -> Pages:
-        pages = Pages([Page(p["data"]) for p in self._load()])
+        doc = self._load()
+        pages = Pages([Page(p) for p in doc["pages"]], doc)
         log.info("collected %d pages", len(pages))
         return pages
 
     def __iter__(self) -> Iterator[Page]:
-        for i, p in enumerate(self._load()):
+        for i, p in enumerate(self._load()["pages"]):
             log.debug("page %d", i + 1)
-            yield Page(p["data"])
+            yield Page(p)
 
     def __repr__(self) -> str:
         return f"ConversionResult({self.path})"
 
 
+def set_metrics_callback(
+    callback: Callable[[str, str, float], None] | None,
+    *,
+    lib_path: Path | None = None,
+) -> None:
+    """report measurements of every later conversion to callback.
+
+    callback is called with (name, label, value) as each conversion ends, from
+    go threads and possibly several at once: "pages_processed" with the pages
+    converted without an error, "conversion_seconds" with its duration,
+    "phase_seconds" labelled extract, pages, tables, passes or write, and
+    "errors" labelled with the kind of failure (timeout, damaged, interrupted,
+    too_large, cache, checkpoint, extract, pages, write) with a value of 1. None turns it off.
+    """
+    global _on_metrics
+    lib, ffi = _lib(lib_path), get_ffi()
+    if callback is None:
+        lib.pdf_set_metrics_callback(ffi.NULL, ffi.NULL)
+        _on_metrics = None
+        return
+
+    @ffi.callback("pdf_metrics_callback")
+    def on_metrics(name: Any, label: Any, value: float, _user: Any) -> None:
+        callback(ffi.string(name).decode(), ffi.string(label).decode(), value)
+
+    lib.pdf_set_metrics_callback(on_metrics, ffi.NULL)
+    _on_metrics = on_metrics
+
+
 def to_json(
     pdf_path: str | Path,
     output: str | Path | None = None,
     *,
     lib_path: Path | None = None,
+    progress: Callable[[int, int], None] | None = None,
+    options: dict[str, Any] | None = None,
 ) -> ConversionResult:
-    """extract pdf to json."""
+    """extract pdf to json.
+
+    progress, if given, is called with (pages done, total pages) as pages are
+    processed, from a go thread. conversions in several threads run at once,
+    each reporting its own progress. go's log records go to the fibrum_pdf.go logger.
+    options sets tomd flags by name, e.g. {"pages": "1-3", "max_chars": 0,
+    "tables": False}; lists repeat a flag.
+    """
     pdf = Path(pdf_path).resolve()
     if not pdf.exists():
         raise FileNotFoundError(f"pdf not found: {pdf}")
@@ -91,20 +135,26 @@ def to_json(
     out.parent.mkdir(parents=True, exist_ok=True)
     log.info("extracting %s -> %s", pdf, out)
 
-    with _redirect_c_output() as cap:
-        rc = _lib(lib_path).pdf_to_json(str(pdf).encode(), str(out).encode())
+    lib, ffi = _lib(lib_path), get_ffi()
+    opts = ffi.NULL if options is None else json.dumps(options).encode()
+    on_progress = ffi.NULL
+    if progress is not None:
+        on_progress = ffi.callback("pdf_progress_callback", lambda done, total, _: progress(done, total))
+    rc = lib.pdf_to_json_progress(str(pdf).encode(), str(out).encode(), opts, on_progress, ffi.NULL)
 
     if rc != 0:
-        try:
-            with open(cap) as f:
-                if msg := f.read().strip():
-                    log.error("c output:\n%s", msg)
-        except OSError:
-            pass
-        raise ExtractionError(f"extraction failed (code {rc})")
+        if rc == -2:
+            raise UnsupportedFormatError(
+                f"{pdf.name} is not a supported format, see the fibrum_pdf.go log for its type"
+            )
+        if rc == -3:
+            raise DocumentTooLargeError(
+                f"{pdf.name} is over the size or page limit, see the fibrum_pdf.go log for which"
+            )
+        raise ExtractionError(f"extraction failed (code {rc}), see the fibrum_pdf.go log for why")
 
     log.info("done")
     return ConversionResult(out)
 
 
-__all__ = ["ExtractionError", "to_json", "ConversionResult"]
+__all__ = ["ExtractionError", "UnsupportedFormatError", "DocumentTooLargeError", "to_json", "ConversionResult", "set_metrics_callback"]
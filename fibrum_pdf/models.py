@@ -20,11 +20,39 @@ class Span(BaseModel):
     subscript: bool = False
     link: bool = False
     uri: str | bool | None = None
+    ref: str | bool | None = None
+
+
+class Line(BaseModel):
+    bbox: list[float]
+    text: str
+    font_size: float
+    bold: bool = False
+    italic: bool = False
+    monospace: bool = False
+
+
+class Char(BaseModel):
+    codepoint: int
+    bbox: list[float]
+    origin: list[float]
+    size: float
+    bold: bool = False
+    italic: bool = False
+    monospace: bool = False
+
+    @property
+    def char(self) -> str:
+        return chr(self.codepoint)
 
 
 class TableCell(BaseModel):
     bbox: list[float]
+    row_index: int = 0
+    col_index: int = 0
     spans: list[Span] = []
+    value: str | None = None
+    markdown: str | None = None  # with -cell-markdown
 
 
 class TableRow(BaseModel):
@@ -44,6 +72,23 @@ class Block(BaseModel):
     col_count: int | None = None
     cell_count: int | None = None
     rows: list[TableRow] | None = None
+    alt: str | bool | None = None
+    image: str | None = None
+    caption: str | None = None
+    text_lines: list[Line] | None = None
+    chars: list[Char] | None = None
+    sentences: list[tuple[int, int]] | None = None
+    tokens: int | None = None
+    confidence: float | None = None
+    band: int | None = None
+    column: int | None = None
+    top_down: int | None = None
+    source_page: int = 0
+    block_index: int = 0
+    ordinal: int = 0
+    continued_bbox: list[float] | None = None  # with -join-pages, on the next page
+    suppressed: bool = False  # in a page's suppressed list, with -keep-suppressed
+    suppressed_reason: str | None = None
 
     @cached_property
     def markdown(self) -> str:
@@ -55,7 +100,48 @@ class Block(BaseModel):
 class Page(list[Block]):
     def __init__(self, items: list[Block | dict[str, Any]] | dict[str, Any]):
         super().__init__()
+        self.number: int | None = None
+        self.label: str | None = None
+        self.source: str | None = None
+        self.source_page: int | None = None
+        self.rotation = 0
+        self.skew = 0.0
+        self.width = self.height = 0.0
+        self.units, self.origin = "pt", "top-left"
+        self.bates: str | None = None
+        self.header_text: str | None = None
+        self.footer_text: str | None = None
+        self.fingerprint: dict[str, str] | None = None
+        self.key_values: list[dict[str, Any]] | None = None
+        self.scan: str | None = None
+        self.error: str | None = None
+        self.warnings: list[str] | None = None
+        self.columns: list[dict[str, Any]] | None = None
+        self.order_confidence: float | None = None
+        self.timings_ms: dict[str, float] | None = None
+        self.text: str | None = None
+        self.suppressed: list[Block] = []
         if isinstance(items, dict) and "data" in items:
+            self.number, self.label = items.get("page"), items.get("label")
+            self.source, self.source_page = items.get("source"), items.get("source_page")
+            self.rotation = items.get("rotation", 0)
+            self.skew = items.get("skew", 0.0)
+            self.width, self.height = items.get("width", 0.0), items.get("height", 0.0)
+            self.units, self.origin = items.get("units", "pt"), items.get("origin", "top-left")
+            self.bates = items.get("bates")
+            self.header_text, self.footer_text = items.get("header_text"), items.get("footer_text")
+            self.fingerprint = items.get("fingerprint")
+            self.key_values = items.get("key_values")
+            self.scan = items.get("scan")
+            self.error = items.get("error")
+            self.warnings = items.get("warnings")
+            self.columns = items.get("columns")
+            self.order_confidence = items.get("order_confidence")
+            self.timings_ms = items.get("timings_ms")
+            self.text = items.get("text")
+            self.suppressed = [Block(**b) for b in items.get("suppressed") or []]
+            if items.get("markdown") is not None:
+                self.__dict__["markdown"] = items["markdown"]  # rendered by -page-markdown
             items = items["data"]
         for item in items or []:
             self.append(Block(**item) if isinstance(item, dict) else item)
@@ -70,12 +156,30 @@ class Page(list[Block]):
 
 
 class Pages(list[Page]):
-    def __init__(self, pages: list[Page] | None = None):
+    """the pages of a document, with the fields of the document as a whole."""
+
+    def __init__(self, pages: list[Page] | None = None, document: dict[str, Any] | None = None):
         super().__init__(pages or [])
+        document = document or {}
+        self.schema_version: int | None = document.get("schema_version")
+        self.metadata: dict[str, str] | None = document.get("metadata")
+        self.fingerprint: dict[str, str] | None = document.get("fingerprint")
+        self.layers: list[dict[str, Any]] | None = document.get("layers")
+        self.repaired: bool = document.get("repaired", False)
+        self.fonts: list[dict[str, Any]] | None = document.get("fonts")
+        self.sources: list[dict[str, Any]] | None = document.get("sources")
 
     @cached_property
     def markdown(self) -> str:
         return "\n---\n\n".join(p.markdown for p in self if p.markdown)
 
+    @cached_property
+    def toc(self) -> str:
+        from ._block_converter import headings_to_toc
+
+        return headings_to_toc(
+            [b.model_dump() for p in self for b in p if b.type == "heading"]
+        )
+
     def __repr__(self) -> str:
         return f"Pages([{len(self)} pages])"
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// profiler writes Go CPU and heap profiles for a run. The raw extraction runs
+// in forked C processes, so its time shows up in neither.
+type profiler struct {
+	cpu, mem string
+}
+
+func (p *profiler) flags(fs *flag.FlagSet) {
+	fs.StringVar(&p.cpu, "cpuprofile", "", "write a CPU profile of the run to this file")
+	fs.StringVar(&p.mem, "memprofile", "", "write a heap profile to this file when the run ends")
+}
+
+// start begins CPU profiling; the returned function stops it and writes the
+// heap profile.
+func (p profiler) start() (func() error, error) {
+	var cpuFile *os.File
+	if p.cpu != "" {
+		f, err := os.Create(p.cpu)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpuFile = f
+	}
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return err
+			}
+		}
+		if p.mem == "" {
+			return nil
+		}
+		f, err := os.Create(p.mem)
+		if err != nil {
+			return err
+		}
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+// runBench implements "tomd bench": it converts one PDF n times with the
+// usual conversion flags and reports the time spent in each phase.
+func runBench(args []string) error {
+	opts, prof := defaultConvertOptions, profiler{}
+	fs := flag.NewFlagSet("tomd bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: ./program bench [flags] <input.pdf>")
+		fs.PrintDefaults()
+	}
+	n := fs.Int("n", 5, "number of conversions to run")
+	finish := convertFlags(fs, &opts)
+	prof.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *n < 1 {
+		fs.Usage()
+		return errors.New("bench needs one input and -n of at least 1")
+	}
+	if err := finish(); err != nil {
+		return err
+	}
+	opts.Cache, opts.Checkpoint, opts.Raw = "", "", "" // every run does the full conversion
+
+	dir, err := os.MkdirTemp("", "tomd-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	stop, err := prof.start()
+	if err != nil {
+		return err
+	}
+	runs := make([]phaseTimes, *n)
+	for i := range runs {
+		if runs[i], err = convert(fs.Arg(0), filepath.Join(dir, "out"), opts); err != nil {
+			stop()
+			return err
+		}
+	}
+	if err := stop(); err != nil {
+		return err
+	}
+	return writeBench(os.Stdout, fs.Arg(0), runs)
+}
+
+func writeBench(out io.Writer, pdfPath string, runs []phaseTimes) error {
+	fmt.Fprintf(out, "%s: %d runs\n", filepath.Base(pdfPath), len(runs))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "phase\tmin\tmedian\tmax\t")
+	phases := []struct {
+		name string
+		get  func(phaseTimes) time.Duration
+	}{
+		{"extraction (C)", func(t phaseTimes) time.Duration { return t.Extract }},
+		{"page processing", func(t phaseTimes) time.Duration { return t.Pages }},
+		{"  table detection*", func(t phaseTimes) time.Duration { return t.Tables }},
+		{"document passes", func(t phaseTimes) time.Duration { return t.Passes }},
+		{"serialization", func(t phaseTimes) time.Duration { return t.Write }},
+		{"total", func(t phaseTimes) time.Duration { return t.Total }},
+	}
+	for _, phase := range phases {
+		d := make([]time.Duration, len(runs))
+		for i, run := range runs {
+			d[i] = phase.get(run)
+		}
+		sort.SliceStable(d, func(i, j int) bool { return d[i] < d[j] })
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t\n", phase.name, round(d[0]), round(d[len(d)/2]), round(d[len(d)-1]))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "* summed over page workers, part of page processing")
+	return err
+}
+
+func round(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/diff"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// runDiff implements "tomd diff a b": both sides may be PDFs, which are
+// converted with the default options, or JSON results of earlier runs.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("tomd diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: ./program diff [flags] <a.pdf|a.json> <b.pdf|b.json>")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "write the diff to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("diff needs exactly two inputs")
+	}
+	a, err := loadPages(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadPages(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diff.Compare(a, b))
+}
+
+func loadPages(path string) ([]models.Page, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		tempRawDir, _, err := extractRaw(path, defaultConvertOptions)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tempRawDir)
+		doc, _, err := processPages(tempRawDir, defaultConvertOptions, nil)
+		return doc.Pages, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return diff.ReadJSON(f)
+}
@@ -0,0 +1,194 @@
+//go:build cgo
+
+package main
+
+/*
+#include <stdlib.h>
+
+// done of total pages processed; called from one thread at a time, but not
+// necessarily the one that started the conversion
+typedef void (*pdf_progress_callback)(int done, int total, void* user);
+
+// level is -4 debug, 0 info, 4 warning, 8 error; module is the part of the
+// converter that logged it; both strings are only valid during the call. It
+// may be called from several threads at once.
+typedef void (*pdf_log_callback)(int level, const char* module, const char* message, void* user);
+
+// name is pages_processed, conversion_seconds, phase_seconds or errors, label
+// the phase or kind of error ("" for the others); both strings are only valid
+// during the call. It may be called from several threads at once.
+typedef void (*pdf_metrics_callback)(const char* name, const char* label, double value, void* user);
+
+static void call_progress(pdf_progress_callback cb, int done, int total, void* user) {
+	cb(done, total, user);
+}
+
+static void call_metrics(pdf_metrics_callback cb, const char* name, const char* label, double value, void* user) {
+	cb(name, label, value, user);
+}
+
+static void call_log(pdf_log_callback cb, int level, const char* module, const char* message, void* user) {
+	cb(level, module, message, user);
+}
+*/
+import "C"
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/logger"
+)
+
+// the progress callback set for the whole process, used by conversions
+// without one of their own
+var progress struct {
+	sync.Mutex
+	cb   C.pdf_progress_callback
+	user unsafe.Pointer
+}
+
+// the metrics callback set for the whole process
+var metrics struct {
+	sync.Mutex
+	cb   C.pdf_metrics_callback
+	user unsafe.Pointer
+}
+
+//export pdf_to_json
+func pdf_to_json(pdf_path *C.char, output_file *C.char) C.int {
+	return convertC(pdf_path, output_file, defaultConvertOptions)
+}
+
+// pdf_to_json_opts is pdf_to_json with options_json, a JSON object of the
+// tomd flags to set, such as {"pages": "1-3", "format": "chunks"}; NULL or
+// empty for the defaults. Bad options fail the call before any conversion.
+//
+//export pdf_to_json_opts
+func pdf_to_json_opts(pdf_path *C.char, output_file *C.char, options_json *C.char) C.int {
+	opts, ok := optionsC(options_json)
+	if !ok {
+		return -1
+	}
+	return convertC(pdf_path, output_file, opts)
+}
+
+// pdf_to_json_progress is pdf_to_json_opts reporting the progress of this
+// conversion alone to cb, passing user through, so conversions running at
+// once each have their own; a NULL cb uses pdf_set_progress_callback's.
+//
+//export pdf_to_json_progress
+func pdf_to_json_progress(pdf_path *C.char, output_file *C.char, options_json *C.char, cb C.pdf_progress_callback, user unsafe.Pointer) C.int {
+	opts, ok := optionsC(options_json)
+	if !ok {
+		return -1
+	}
+	if cb != nil {
+		opts.Progress = func(done, total int) { C.call_progress(cb, C.int(done), C.int(total), user) }
+	}
+	return convertC(pdf_path, output_file, opts)
+}
+
+// optionsC reads the options_json of an export, logging why it fails.
+func optionsC(options_json *C.char) (convertOptions, bool) {
+	if options_json == nil || *options_json == 0 {
+		return defaultConvertOptions, true
+	}
+	opts, err := optionsFromJSON([]byte(C.GoString(options_json)))
+	if err != nil {
+		Logger.Error("options error", "err", err)
+		return opts, false
+	}
+	return opts, true
+}
+
+// convertC runs a conversion for the exports, reporting to the progress
+// callback set then unless opts has its own. It returns 0 on success, -2 for a file of a type MuPDF
+// cannot open, as logged, -3 for one over max-file-size or max-pages and -1
+// for any other failure.
+func convertC(pdf_path, output_file *C.char, opts convertOptions) C.int {
+	pdfPath, outputFile := C.GoString(pdf_path), C.GoString(output_file)
+	progress.Lock()
+	if cb, user := progress.cb, progress.user; cb != nil && opts.Progress == nil {
+		opts.Progress = func(done, total int) { C.call_progress(cb, C.int(done), C.int(total), user) }
+	}
+	progress.Unlock()
+	metrics.Lock()
+	if cb := metrics.cb; cb != nil {
+		opts.Metrics = cMetrics{cb, metrics.user}
+	}
+	metrics.Unlock()
+	err := pdfToJson(pdfPath, outputFile, opts)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, bridge.ErrUnsupportedFormat):
+		return -2
+	case errors.Is(err, bridge.ErrTooLarge):
+		return -3
+	}
+	return -1
+}
+
+// pdf_set_progress_callback reports the progress of conversions started after
+// it to cb, passing user through; NULL turns it off.
+//
+//export pdf_set_progress_callback
+func pdf_set_progress_callback(cb C.pdf_progress_callback, user unsafe.Pointer) {
+	progress.Lock()
+	defer progress.Unlock()
+	progress.cb, progress.user = cb, user
+}
+
+// pdf_set_metrics_callback reports measurements of conversions started after
+// it to cb, passing user through; NULL turns it off.
+//
+//export pdf_set_metrics_callback
+func pdf_set_metrics_callback(cb C.pdf_metrics_callback, user unsafe.Pointer) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.cb, metrics.user = cb, user
+}
+
+// cMetrics passes Metrics on to a pdf_metrics_callback.
+type cMetrics struct {
+	cb   C.pdf_metrics_callback
+	user unsafe.Pointer
+}
+
+func (m cMetrics) call(name, label string, value float64) {
+	cname, clabel := C.CString(name), C.CString(label)
+	defer C.free(unsafe.Pointer(cname))
+	defer C.free(unsafe.Pointer(clabel))
+	C.call_metrics(m.cb, cname, clabel, C.double(value), m.user)
+}
+
+func (m cMetrics) PagesProcessed(n int) { m.call("pages_processed", "", float64(n)) }
+func (m cMetrics) PhaseDuration(phase string, d time.Duration) {
+	m.call("phase_seconds", phase, d.Seconds())
+}
+func (m cMetrics) ConversionDuration(d time.Duration) { m.call("conversion_seconds", "", d.Seconds()) }
+func (m cMetrics) Error(kind string)                  { m.call("errors", kind, 1) }
+
+// pdf_set_log_callback sends log records at level and above to cb, passing
+// user through, instead of to stdout and the log file; NULL restores those.
+//
+//export pdf_set_log_callback
+func pdf_set_log_callback(cb C.pdf_log_callback, level C.int, user unsafe.Pointer) {
+	if cb == nil {
+		logger.SetSink(nil, 0)
+		return
+	}
+	logger.SetSink(func(level slog.Level, module, message string) {
+		cmodule, cmessage := C.CString(module), C.CString(message)
+		defer C.free(unsafe.Pointer(cmodule))
+		defer C.free(unsafe.Pointer(cmessage))
+		C.call_log(cb, C.int(level), cmodule, cmessage, user)
+	}, slog.Level(level))
+}
+
+//export free_string
+func free_string(s *C.char) { C.free(unsafe.Pointer(s)) }
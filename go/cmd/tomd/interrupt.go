@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted is returned once the output is written if a SIGINT or
+// SIGTERM stopped the conversion; the pages it had not started are in it with
+// only their number and error.
+var errInterrupted = errors.New("conversion interrupted, output is partial")
+
+// notifyInterrupt returns a channel closed on the first SIGINT or SIGTERM and
+// the code to exit with after it, 128 plus the signal's number, or 0 before
+// one arrives. Conversions then finish the pages in flight, write what they
+// have and clean up; a second signal exits at once.
+func notifyInterrupt() (<-chan struct{}, func() int) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	interrupt := make(chan struct{})
+	var code atomic.Int32
+	go func() {
+		sig := <-sigs
+		code.Store(int32(signalExitCode(sig)))
+		Logger.Warn("interrupted, finishing the pages in flight", "signal", sig)
+		close(interrupt)
+		sig = <-sigs
+		Logger.Warn("interrupted again, exiting", "signal", sig)
+		os.Exit(signalExitCode(sig))
+	}()
+	return interrupt, func() int { return int(code.Load()) }
+}
+
+// signalExitCode is the exit code of a process killed by sig, as shells
+// report it: 130 for SIGINT, 143 for SIGTERM.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// interrupted reports whether interrupt is closed; a nil channel never is.
+func interrupted(interrupt <-chan struct{}) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+		return false
+	}
+}
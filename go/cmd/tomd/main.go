@@ -1,26 +1,40 @@
 package main
 
-/*
-#include <stdlib.h>
-*/
-import "C"
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unsafe"
 
 	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/bundle"
+	"github.com/pymupdf4llm-c/go/internal/cache"
+	"github.com/pymupdf4llm-c/go/internal/checkpoint"
+	"github.com/pymupdf4llm-c/go/internal/chunk"
+	"github.com/pymupdf4llm-c/go/internal/classify"
+	"github.com/pymupdf4llm-c/go/internal/column"
+	"github.com/pymupdf4llm-c/go/internal/config"
 	"github.com/pymupdf4llm-c/go/internal/extractor"
+	"github.com/pymupdf4llm-c/go/internal/geometry"
 	"github.com/pymupdf4llm-c/go/internal/logger"
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/parquet"
+	"github.com/pymupdf4llm-c/go/internal/text"
+	"github.com/pymupdf4llm-c/go/internal/tokens"
 )
 
 var (
@@ -28,72 +42,497 @@ var (
 	Logger   = logger.GetLogger("tomd")
 )
 
-//export pdf_to_json
-func pdf_to_json(pdf_path *C.char, output_file *C.char) C.int {
-	pdfPath, outputFile := C.GoString(pdf_path), C.GoString(output_file)
-	err := pdfToJson(pdfPath, outputFile)
-	if err == nil {
-		return 0
+type convertOptions struct {
+	Extract      bridge.ExtractOptions
+	Page         extractor.Options
+	Format       string
+	SplitPages   bool               // write the output path as a directory of per-page files, see writeSplit
+	PageMarkdown bool               // add each page's Markdown to it, see renderPages
+	PageText     bool               // and its plain text
+	CellMarkdown bool               // add the Markdown of each table cell to it
+	Tokenizer    string             // name registered with the tokens package, "" leaves token counts out
+	Only         []models.BlockType // keep just these block types; empty keeps all
+	Exclude      []models.BlockType
+	Classifier   string // command run as the block classifier, "" for the heuristics alone
+	Markdown     markdown.Options
+
+	// where the run is kept, not what it produces, so not part of the cache key
+	Checkpoint  string        // directory to keep finished pages in so an interrupted run can resume
+	Raw         string        // directory to extract raw pages into and keep, or to convert from without MuPDF
+	Cache       string        // directory of finished outputs keyed by PDF hash and options
+	Timeout     time.Duration // for the whole conversion, 0 for none
+	PageTimeout time.Duration // for each page, 0 for none
+	Report      string        // file to write a runReport to, "" for none
+
+	Progress func(done, total int) // called as each page is processed, one call at a time; nil for none
+	Metrics  Metrics               // told about the conversion as it ends; nil for none
+
+	deadline  time.Time       // set by convert from Timeout
+	interrupt <-chan struct{} // closed by notifyInterrupt on SIGINT or SIGTERM
+}
+
+// cacheKeyOptions is everything besides the PDF's contents that can change
+// the output, including the file name the parquet, bundle and chunk formats
+// record as the source.
+func (o convertOptions) cacheKeyOptions(pdfPath string) any {
+	return struct {
+		Source                               string
+		Extract                              bridge.ExtractOptions
+		Page                                 extractor.Options
+		Format                               string
+		Tokenizer                            string
+		Only                                 []models.BlockType
+		Exclude                              []models.BlockType
+		Classifier                           string
+		Markdown                             markdown.Options
+		PageMarkdown, PageText, CellMarkdown bool
+	}{filepath.Base(pdfPath), o.Extract, o.Page, o.Format, o.Tokenizer, o.Only, o.Exclude, o.Classifier, o.Markdown, o.PageMarkdown, o.PageText, o.CellMarkdown}
+}
+
+var defaultConvertOptions = convertOptions{
+	Extract: bridge.DefaultExtractOptions,
+	Page:    extractor.DefaultOptions,
+	Format:  "json",
+}
+
+// phaseTimes is how long each part of a conversion took. Tables is summed over
+// the page workers, so it can exceed Pages, which is wall time.
+type phaseTimes struct {
+	Extract, Pages, Tables, Passes, Write, Total time.Duration
+}
+
+// errTimedOut is returned once the output is written if any page was given up
+// on; those pages are in it with only their number and error.
+var errTimedOut = errors.New("conversion timed out, output is partial")
+
+// errDamaged is returned instead when a page was given up on because it could
+// not be read even after -repair rebuilt the document.
+var errDamaged = errors.New("document is damaged, output is partial")
+
+// damagedPage is the error of such a page, as the bridge writes it.
+const damagedPage = "page is damaged"
+
+// givenUpError is the error a conversion ends with for page, one with an Error.
+func givenUpError(page models.Page) error {
+	if page.Error == damagedPage {
+		return errDamaged
 	}
-	return -1
+	return errTimedOut
 }
 
-func pdfToJson(pdfPath, outputPath string) error {
+func pdfToJson(pdfPath, outputPath string, opts convertOptions) error {
+	_, err := convert(pdfPath, outputPath, opts)
+	return err
+}
+
+func convert(pdfPath, outputPath string, opts convertOptions) (times phaseTimes, err error) {
 	startTotal := time.Now() // total runtime timer
-	startRaw := time.Now()   // raw data timer
+	if opts.Timeout > 0 {
+		opts.deadline = startTotal.Add(opts.Timeout)
+	}
+	var doc models.Document
+	cacheHit := false
+	if opts.Report != "" {
+		defer func() {
+			if times.Total == 0 { // stopped early
+				times.Total = time.Since(startTotal)
+			}
+			reportErr := writeReport(pdfPath, outputPath, opts, startTotal, times, doc.Pages, cacheHit, err)
+			if reportErr != nil {
+				Logger.Error("report error", "err", reportErr)
+				if err == nil {
+					err = reportErr
+				}
+			}
+		}()
+	}
+	stage := "cache" // what failed, for Metrics
+	if opts.Metrics != nil {
+		defer func() {
+			total := times.Total
+			if total == 0 {
+				total = time.Since(startTotal)
+			}
+			recordMetrics(opts.Metrics, total, times, doc.Pages, stage, err)
+		}()
+	}
 
 	Logger.Info("beginning conversion...")
 	Logger.Debug("paths", "pdf", pdfPath, "output", outputPath)
 
-	tempRawDir, err := bridge.ExtractAllPagesRaw(pdfPath)
+	var cacheKey string
+	if opts.Cache != "" {
+		if cacheKey, err = cache.Key(pdfPath, opts.cacheKeyOptions(pdfPath)); err != nil {
+			Logger.Error("cache key error", "err", err)
+			return times, err
+		}
+		if cacheHit, err = (cache.Cache{Dir: opts.Cache}).Get(cacheKey, outputPath); err != nil {
+			Logger.Error("cache read error", "err", err)
+			return times, err
+		}
+		if cacheHit {
+			Logger.Info("cache hit", "key", cacheKey, "totalTime", time.Since(startTotal))
+			return times, nil
+		}
+	}
+
+	var ckpt *checkpoint.Checkpoint
+	if opts.Checkpoint != "" {
+		stage = "checkpoint"
+		if ckpt, err = checkpoint.Open(opts.Checkpoint, pdfPath, struct {
+			Extract    bridge.ExtractOptions
+			Page       extractor.Options
+			Classifier string
+		}{opts.Extract, opts.Page, opts.Classifier}); err != nil {
+			Logger.Error("checkpoint error", "err", err)
+			return times, err
+		}
+		opts.Extract.OutputDir = ckpt.RawDir()
+	}
+	if opts.Raw != "" {
+		opts.Extract.OutputDir = opts.Raw
+	}
+
+	stage = "extract"
+	tempRawDir, rawElapsed, err := extractRaw(pdfPath, opts)
+	times.Extract = rawElapsed
+	if err != nil {
+		return times, err
+	}
+	if ckpt == nil && opts.Raw == "" {
+		defer os.RemoveAll(tempRawDir)
+	}
+
+	stage = "pages"
+	doc, pageTimes, err := processPages(tempRawDir, opts, ckpt)
+	if err != nil {
+		return times, err
+	}
+	times.Pages, times.Tables, times.Passes = pageTimes.Pages, pageTimes.Tables, pageTimes.Passes
+	renderPages(doc.Pages, opts)
+	if opts.Page.PageTimings {
+		timeSerialization(doc.Pages)
+	}
+
+	stage = "write"
+	startWrite := time.Now()
+	if opts.SplitPages {
+		err = writeSplit(outputPath, filepath.Base(pdfPath), doc, opts.Markdown)
+	} else {
+		err = writeOutput(outputPath, pdfPath, doc, opts)
+	}
+	if err != nil {
+		Logger.Error("write error", "err", err)
+		return times, err
+	}
+	times.Write = time.Since(startWrite)
+	stage = "done"
+	if interrupted(opts.interrupt) {
+		Logger.Error("conversion interrupted", "totalTime", time.Since(startTotal))
+		return times, errInterrupted
+	}
+	for _, page := range doc.Pages {
+		if page.Error != "" {
+			err := givenUpError(page)
+			Logger.Error(err.Error(), "page", page.Number, "err", page.Error, "totalTime", time.Since(startTotal))
+			return times, err
+		}
+	}
+	if cacheKey != "" {
+		if err := (cache.Cache{Dir: opts.Cache}).Put(cacheKey, outputPath); err != nil {
+			Logger.Warn("could not cache output", "err", err)
+		}
+	}
+	if ckpt != nil {
+		if err := ckpt.Remove(); err != nil {
+			Logger.Warn("could not remove checkpoint", "dir", ckpt.Dir, "err", err)
+		}
+	}
+
+	totalElapsed := time.Since(startTotal)
+	times.Total = totalElapsed
+	Logger.Info("raw data extraction", "timeInC", rawElapsed)
+	Logger.Info("high level data extraction", "timeInGo", (totalElapsed - rawElapsed))
+	Logger.Debug("phases", "pages", times.Pages, "tables", times.Tables, "passes", times.Passes, "write", times.Write)
+	Logger.Info("total conversion time", "totalTime", totalElapsed)
+
+	Logger.Info("success")
+	return times, nil
+}
+
+// renderPages sets the Markdown and plain text strings of pages and the
+// Markdown of table cells that opts asks for, so consumers that need them
+// besides the blocks don't render them again.
+func renderPages(pages []models.Page, opts convertOptions) {
+	for i := range pages {
+		if opts.CellMarkdown {
+			for _, b := range pages[i].Data {
+				for _, row := range b.Rows {
+					for c := range row.Cells {
+						row.Cells[c].Markdown = markdown.Cell(row.Cells[c])
+					}
+				}
+			}
+		}
+		if opts.PageMarkdown {
+			pages[i].Markdown = markdown.PageWithOptions(pages[i], opts.Markdown)
+		}
+		if opts.PageText {
+			var parts []string
+			for _, b := range pages[i].Data {
+				if t := strings.TrimSpace(b.Text()); t != "" {
+					parts = append(parts, t)
+				}
+			}
+			pages[i].Text = strings.Join(parts, "\n\n")
+		}
+	}
+}
+
+// timeSerialization sets the Serialize timing of pages that have Timings to
+// how long encoding them as JSON takes.
+func timeSerialization(pages []models.Page) {
+	for i := range pages {
+		if pages[i].Timings == nil {
+			continue
+		}
+		start := time.Now()
+		if _, err := json.Marshal(pages[i]); err != nil {
+			continue // fails again, and is reported, when written
+		}
+		pages[i].Timings.Serialize = models.Milliseconds(time.Since(start))
+	}
+}
+
+// writeOutput writes doc to outputPath in opts.Format. A regular file is
+// written beside it and renamed into place, so a run stopped partway never
+// leaves truncated output that reads as complete.
+func writeOutput(outputPath, pdfPath string, doc models.Document, opts convertOptions) error {
+	path := outputPath
+	if info, err := os.Stat(outputPath); err != nil || info.Mode().IsRegular() {
+		path = outputPath + ".tmp"
+	}
+	outFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	if path != outputPath {
+		defer os.Remove(path) // gone once renamed
+	}
+
+	writer := bufio.NewWriterSize(outFile, 256*1024)
+	switch opts.Format {
+	case "parquet":
+		err = parquet.Write(writer, parquet.BlockColumns(filepath.Base(pdfPath), doc.Pages))
+	case "bundle":
+		err = bundle.WriteWithOptions(writer, pdfPath, doc, opts.Markdown)
+	case "chunks":
+		chunks := chunk.SplitWithOptions(filepath.Base(pdfPath), doc.Pages, opts.Markdown)
+		if opts.Tokenizer != "" {
+			counter, _ := tokens.Lookup(opts.Tokenizer) // already resolved by processPages
+			for i := range chunks {
+				chunks[i].Metadata.Tokens = counter.Count(chunks[i].PageContent)
+			}
+		}
+		enc := json.NewEncoder(writer)
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(chunks)
+	case "pymupdf4llm":
+		enc := json.NewEncoder(writer)
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(chunk.PageChunks(pdfPath, doc, opts.Markdown))
+	default:
+		err = writeJSON(writer, doc)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil || path == outputPath {
+		return err
+	}
+	return os.Rename(path, outputPath)
+}
+
+func extractRaw(pdfPath string, opts convertOptions) (string, time.Duration, error) {
+	startRaw := time.Now() // raw data timer
+	opts.Extract.PageTimeout = opts.PageTimeout
+	if !opts.deadline.IsZero() {
+		opts.Extract.Timeout = max(time.Until(opts.deadline), time.Millisecond)
+	}
+	tempRawDir, err := bridge.ExtractAllPagesRawWithOptions(pdfPath, opts.Extract)
 	rawElapsed := time.Since(startRaw) // record raw extraction time
+	// builds without MuPDF, such as WebAssembly, convert pages extracted before
+	if errors.Is(err, errors.ErrUnsupported) && opts.Raw != "" {
+		if pages, _ := filepath.Glob(filepath.Join(opts.Raw, "page_*.raw")); len(pages) > 0 {
+			Logger.Info("converting pages already extracted", "dir", opts.Raw, "pages", len(pages))
+			return opts.Raw, rawElapsed, nil
+		}
+	}
 	if err != nil {
 		Logger.Error("extraction error", "err", err)
-		return err
+		return "", rawElapsed, err
+	}
+	return tempRawDir, rawElapsed, nil
+}
+
+// documentFontSizes tallies the font sizes of every page extracted, so each
+// is classified by the body size of the whole document; nil if there is no
+// text at all.
+func documentFontSizes(pageFiles []string, numWorkers int) (*extractor.FontSizes, error) {
+	tallies := make([]extractor.FontTally, numWorkers)
+	errs := make([]error, numWorkers)
+	var wg sync.WaitGroup
+	fileChan := make(chan string, numWorkers)
+	for i := range tallies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for file := range fileChan {
+				rawData, err := bridge.ReadRawPage(file)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				tallies[i].Add(rawData)
+			}
+		}(i)
+	}
+	for _, file := range pageFiles {
+		if strings.HasSuffix(file, ".raw") {
+			fileChan <- file
+		}
+	}
+	close(fileChan)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := 1; i < len(tallies); i++ {
+		tallies[0].Merge(&tallies[i])
+	}
+	sizes, ok := tallies[0].Sizes()
+	if !ok {
+		return nil, nil
 	}
-	defer os.RemoveAll(tempRawDir)
+	return &sizes, nil
+}
 
+// processPages turns the raw page files in tempRawDir into the pages of a
+// document and runs the document-level passes over them. Pages already in ckpt are loaded from it,
+// and newly processed ones are added to it; ckpt may be nil. Only the Pages,
+// Tables and Passes times are filled in.
+func processPages(tempRawDir string, opts convertOptions, ckpt *checkpoint.Checkpoint) (models.Document, phaseTimes, error) {
+	var times phaseTimes
+	startPages := time.Now()
+	opts.Page.Timings = &extractor.Timings{}
+	var classifier *classify.Command
+	if opts.Classifier != "" {
+		var err error
+		if classifier, err = classify.Start(opts.Classifier); err != nil {
+			return models.Document{}, times, err
+		}
+		defer classifier.Close()
+		opts.Page.Classifier = classifier
+	}
 	entries, err := os.ReadDir(tempRawDir)
 	if err != nil {
 		Logger.Error("readdir error", "err", err)
-		return err
+		return models.Document{}, times, err
 	}
-	var pageFiles []string
+	var pageFiles []string // page_NNN.raw, or page_NNN.timeout for pages extraction gave up on
 	for _, e := range entries {
-		if strings.HasPrefix(e.Name(), "page_") && strings.HasSuffix(e.Name(), ".raw") {
+		if strings.HasPrefix(e.Name(), "page_") && (strings.HasSuffix(e.Name(), ".raw") || strings.HasSuffix(e.Name(), ".timeout")) {
 			pageFiles = append(pageFiles, filepath.Join(tempRawDir, e.Name()))
 		}
 	}
-	sort.Slice(pageFiles, func(i, j int) bool { return extractPageNum(pageFiles[i]) < extractPageNum(pageFiles[j]) })
-
-	type pageResult struct {
-		pageNum int
-		json    []byte
-		err     error
+	sort.SliceStable(pageFiles, func(i, j int) bool { return extractPageNum(pageFiles[i]) < extractPageNum(pageFiles[j]) })
+	layers, err := documentLayers(tempRawDir, opts.Extract)
+	if err != nil {
+		return models.Document{}, times, err
+	}
+	repaired := bridge.WasRepaired(tempRawDir)
+	if repaired {
+		Logger.Warn("document was damaged and has been repaired, its pages are a best effort")
 	}
-	results := make([]pageResult, len(pageFiles))
+
+	pages := make([]models.Page, len(pageFiles))
+	errs := make([]error, len(pageFiles))
 	numWorkers := runtime.NumCPU()
+	if opts.Extract.Workers > 0 {
+		numWorkers = opts.Extract.Workers
+	}
+	if opts.Page.DocumentFonts {
+		fonts, err := documentFontSizes(pageFiles, numWorkers)
+		if err != nil {
+			return models.Document{}, times, err
+		}
+		opts.Page.Fonts = fonts
+	}
 	var wg sync.WaitGroup
 	pageChan := make(chan int, numWorkers)
+	var progressMu sync.Mutex
+	done := 0
 
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for idx := range pageChan {
-				rawData, err := bridge.ReadRawPage(pageFiles[idx])
-				if err != nil {
-					results[idx] = pageResult{err: err}
-					continue
-				}
-				page := extractor.ExtractPageFromRaw(rawData)
-				pageJSON, err := json.Marshal(page)
-				if err != nil {
-					results[idx] = pageResult{err: err}
-					continue
+				func() {
+					if ckpt != nil {
+						if page, ok := ckpt.Load(pageFiles[idx]); ok {
+							pages[idx] = page
+							return
+						}
+					}
+					if strings.HasSuffix(pageFiles[idx], ".timeout") {
+						reason, _ := os.ReadFile(pageFiles[idx])
+						pages[idx] = timedOutPage(extractPageNum(pageFiles[idx]), string(reason))
+						return
+					}
+					if !opts.deadline.IsZero() && time.Now().After(opts.deadline) {
+						pages[idx] = timedOutPage(extractPageNum(pageFiles[idx]), "document timed out")
+						return
+					}
+					if interrupted(opts.interrupt) {
+						pages[idx] = timedOutPage(extractPageNum(pageFiles[idx]), "conversion interrupted")
+						return
+					}
+					readStart := time.Now()
+					rawData, err := bridge.ReadRawPage(pageFiles[idx])
+					if err != nil {
+						errs[idx] = err
+						return
+					}
+					readTime := time.Since(readStart)
+					page, ok := extractPage(rawData, opts)
+					if !ok {
+						pages[idx] = timedOutPage(rawData.PageNumber, "page timed out")
+						return
+					}
+					if page.Timings != nil {
+						page.Timings.Read = models.Milliseconds(readTime)
+					}
+					pages[idx] = page
+					Logger.Debug("processed page", "page", pages[idx].Number)
+					if ckpt != nil {
+						if err := ckpt.Save(pageFiles[idx], pages[idx]); err != nil {
+							Logger.Warn("could not checkpoint page", "page", pages[idx].Number, "err", err)
+						}
+					}
+				}()
+				if opts.Progress != nil {
+					progressMu.Lock()
+					done++
+					opts.Progress(done, len(pageFiles))
+					progressMu.Unlock()
 				}
-				results[idx] = pageResult{pageNum: page.Number, json: pageJSON}
-				Logger.Debug("processed page", "page", page.Number)
 			}
 		}()
 	}
@@ -103,63 +542,165 @@ func pdfToJson(pdfPath, outputPath string) error {
 	}
 	close(pageChan)
 	wg.Wait()
+	if classifier != nil {
+		if err := classifier.Close(); err != nil {
+			return models.Document{}, times, err
+		}
+	}
 
-	for _, res := range results {
-		if res.err != nil {
-			Logger.Error("processing error", "err", res.err)
-			return res.err
+	for _, err := range errs {
+		if err != nil {
+			Logger.Error("processing error", "err", err)
+			return models.Document{}, times, err
 		}
 	}
+	times.Pages, times.Tables = time.Since(startPages), opts.Page.Timings.Tables()
 
-	outFile, err := os.Create(outputPath)
+	startPasses := time.Now()
+	if opts.Page.BatesNumbers {
+		extractor.ExtractBatesNumbers(pages)
+	}
+	if opts.Page.RunningHeads {
+		extractor.ExtractRunningHeads(pages, opts.Page)
+	}
+	if opts.Page.JoinAcrossPages {
+		extractor.JoinAcrossPages(pages, opts.Page.Spacing)
+	}
+	if opts.Page.StructureReferences {
+		extractor.StructureReferences(pages, opts.Page.Spacing)
+	}
+	if opts.Page.LinkCitations {
+		extractor.LinkCitations(pages)
+	}
+	if opts.Page.Sentences {
+		extractor.AnnotateSentences(pages)
+	}
+	doc := models.Document{SchemaVersion: models.SchemaVersion, Layers: layers, Repaired: repaired, Pages: pages}
+	if opts.Page.PaperMetadata && len(pages) > 0 {
+		doc.Metadata = extractor.DetectPaperMetadata(&pages[0])
+	}
+	if opts.Page.Fingerprints {
+		doc.Fingerprint = extractor.Fingerprints(pages)
+	}
+	if opts.Page.Images.Dedup {
+		extractor.DedupImages(pages)
+	}
+	if len(opts.Only) > 0 || len(opts.Exclude) > 0 {
+		extractor.FilterBlocks(pages, opts.Only, opts.Exclude)
+	}
+	doc.Fonts = extractor.ReportFonts(pages)
+	extractor.NumberBlocks(pages)
+	if opts.Tokenizer != "" {
+		counter, err := tokens.Lookup(opts.Tokenizer)
+		if err != nil {
+			return models.Document{}, times, err
+		}
+		tokens.AnnotateBlocks(pages, counter)
+	}
+	times.Passes = time.Since(startPasses)
+	return doc, times, nil
+}
+
+// documentLayers returns the layers of the document extracted into dir. Layers
+// named in opts that it does not have are an error, as the content meant to be
+// left out, or in, would silently not be.
+func documentLayers(dir string, opts bridge.ExtractOptions) ([]models.Layer, error) {
+	raw, err := bridge.ReadLayers(dir)
 	if err != nil {
-		Logger.Error("output file error", "err", err)
-		return err
+		return nil, err
 	}
-	defer outFile.Close()
+	var layers []models.Layer
+	names := map[string]bool{}
+	for _, l := range raw {
+		layers = append(layers, models.Layer{Name: l.Name, Visible: l.On})
+		names[l.Name] = true
+	}
+	for _, name := range append(slices.Clone(opts.HideLayers), opts.ShowLayers...) {
+		if names[name] {
+			continue
+		}
+		var have []string
+		for _, l := range raw {
+			have = append(have, strconv.Quote(l.Name))
+		}
+		if len(have) == 0 {
+			return nil, fmt.Errorf("no layer %q: the document has no layers", name)
+		}
+		return nil, fmt.Errorf("no layer %q: the document has %s", name, strings.Join(have, ", "))
+	}
+	return layers, nil
+}
 
-	writer := bufio.NewWriterSize(outFile, 256*1024)
-	defer writer.Flush()
+// extractPage runs the Go half of extracting a page, giving up once the page
+// timeout or the conversion's deadline passes. A page given up on is cancelled
+// and stops at its next block or stage rather than running on unseen.
+func extractPage(raw *bridge.RawPageData, opts convertOptions) (models.Page, bool) {
+	timeout := opts.PageTimeout
+	if !opts.deadline.IsZero() && (timeout == 0 || time.Until(opts.deadline) < timeout) {
+		timeout = max(time.Until(opts.deadline), time.Nanosecond)
+	}
+	if timeout == 0 {
+		return extractor.ExtractPageFromRawWithOptions(raw, opts.Page), true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan models.Page, 1)
+	go func() {
+		if page, err := extractor.ExtractPageFromRawContext(ctx, raw, opts.Page); err == nil {
+			done <- page
+		}
+	}()
+	select {
+	case page := <-done:
+		return page, true
+	case <-ctx.Done():
+		return models.Page{}, false
+	}
+}
 
-	if _, err := writer.WriteString("["); err != nil {
-		Logger.Error("write error", "err", err)
+func timedOutPage(number int, reason string) models.Page {
+	Logger.Warn("page timed out", "page", number, "reason", reason)
+	return models.Page{Number: number, Units: models.Units, Origin: models.Origin, Error: reason, Data: []models.Block{}}
+}
+
+// writeJSON writes doc as JSON, its pages one at a time rather than all
+// encoded at once.
+func writeJSON(writer *bufio.Writer, doc models.Document) error {
+	fields := doc
+	fields.Pages = []models.Page{}
+	head, err := json.Marshal(fields)
+	if err != nil {
 		return err
 	}
-	for i, res := range results {
+	// up to the [ of the pages, which are the last field
+	if _, err := writer.Write(head[:len(head)-len("]}")]); err != nil {
+		return err
+	}
+	for i, page := range doc.Pages {
 		if i > 0 {
 			if _, err := writer.WriteString(","); err != nil {
-				Logger.Error("write error", "err", err)
 				return err
 			}
 		}
-		if _, err := writer.Write(res.json); err != nil {
-			Logger.Error("write error", "err", err)
+		pageJSON, err := json.Marshal(page)
+		if err != nil {
 			return err
 		}
-		Logger.Debug("wrote page", "page", res.pageNum)
-	}
-	if _, err := writer.WriteString("]"); err != nil {
-		Logger.Error("write error", "err", err)
-		return err
+		if _, err := writer.Write(pageJSON); err != nil {
+			return err
+		}
+		Logger.Debug("wrote page", "page", page.Number)
 	}
-
-	totalElapsed := time.Since(startTotal)
-	Logger.Info("raw data extraction", "timeInC", rawElapsed)
-	Logger.Info("high level data extraction", "timeInGo", (totalElapsed - rawElapsed))
-	Logger.Info("total conversion time", "totalTime", totalElapsed)
-
-	Logger.Info("success")
-	return nil
+	_, err = writer.WriteString("]}")
+	return err
 }
 
-//export free_string
-func free_string(s *C.char) { C.free(unsafe.Pointer(s)) }
-
 func extractPageNum(filename string) int {
 	base := filepath.Base(filename)
 	base = strings.TrimPrefix(base, "page_")
 	base = strings.TrimSuffix(base, ".raw")
 	base = strings.TrimSuffix(base, ".json")
+	base = strings.TrimSuffix(base, ".timeout")
 	num, _ := strconv.Atoi(base)
 	return num
 }
@@ -170,10 +711,461 @@ func init() {
 	}
 }
 
+func parseArgs(args []string) (convertOptions, profiler, []string, error) {
+	opts, prof := defaultConvertOptions, profiler{}
+	fs := flag.NewFlagSet("tomd", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: ./program [flags] <input.pdf> [output_file]")
+		fs.PrintDefaults()
+	}
+	finish := convertFlags(fs, &opts)
+	prof.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return opts, prof, nil, err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return opts, prof, nil, errors.New("missing input or output path")
+	}
+	return opts, prof, fs.Args(), finish()
+}
+
+// optionsFromJSON reads conversion options from a JSON object keyed by flag
+// name, with _ allowed for -, as pdf_to_json_opts takes them: {"pages": "1-3",
+// "max_chars": 0, "tables": false}. A list gives a repeatable flag each value.
+func optionsFromJSON(data []byte) (convertOptions, error) {
+	opts := defaultConvertOptions
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // 1000000 rather than 1e+06 for integer flags
+	if err := dec.Decode(&fields); err != nil {
+		return opts, fmt.Errorf("invalid options: %w", err)
+	}
+	fs := flag.NewFlagSet("options", flag.ContinueOnError)
+	finish := convertFlags(fs, &opts)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values, ok := fields[name].([]any)
+		if !ok {
+			values = []any{fields[name]}
+		}
+		for _, v := range values {
+			var s string
+			switch v := v.(type) {
+			case string:
+				s = v
+			case json.Number:
+				s = v.String()
+			case bool:
+				s = strconv.FormatBool(v)
+			default:
+				return opts, fmt.Errorf("option %q: want a string, number or boolean", name)
+			}
+			if err := fs.Set(strings.ReplaceAll(name, "_", "-"), s); err != nil {
+				return opts, fmt.Errorf("option %q: %w", name, err)
+			}
+		}
+	}
+	return opts, finish()
+}
+
+// convertFlags defines the conversion flags on fs. The returned function
+// checks them and applies the ones that need converting once fs is parsed.
+func convertFlags(fs *flag.FlagSet, opts *convertOptions) func() error {
+	box := fs.String("box", "crop", "page box to extract within: media, crop, bleed, trim or art")
+	fs.StringVar(&opts.Format, "format", opts.Format, "output format: json, parquet for one row per block, or bundle for a zip of markdown, images, page JSON and a manifest, or chunks for LangChain/LlamaIndex-style records, or pymupdf4llm for the page dicts of its to_markdown(page_chunks=True)")
+	order := fs.String("order", "columns", "reading order strategy: columns or xycut")
+	wordGap := fs.Float64("word-gap", float64(opts.Page.Spacing.WordGap), "gap between glyphs, in average advance widths of the font, that starts a new word in table cells")
+	punctGap := fs.Float64("punct-gap", float64(opts.Page.Spacing.PunctGap), "like -word-gap, next to punctuation and digits")
+	lineJoin := fs.Float64("line-join", float64(opts.Page.Spacing.LineJoin), "gap between lines, in font sizes, below which they are joined with a space instead of a newline")
+	fs.BoolVar(&opts.Page.Spacing.CJKLatinSpace, "cjk-latin-space", opts.Page.Spacing.CJKLatinSpace, "allow a space between CJK and Latin text when the gap calls for one")
+	fs.BoolVar(&opts.Page.Spacing.Reflow, "reflow", opts.Page.Spacing.Reflow, "join lines of a paragraph that only wrapped at the right edge with a space, keeping the breaks of short lines such as addresses and verse")
+	ligatures := fs.Bool("ligatures", true, "expand ligature glyphs (ﬁ, ﬂ, ﬃ) into their letters, each with its own bbox")
+	invisible := fs.String("invisible", opts.Page.Cleanup.Invisible.String(), "zero-width spaces, joiners, directional marks and other invisible controls: keep, strip, or map (zero-width spaces to spaces, joiners kept, the rest dropped)")
+	keepSoftHyphens := fs.Bool("keep-soft-hyphens", false, "keep soft hyphens (U+00AD) in the text instead of joining the words they break")
+	fs.BoolVar(&opts.SplitPages, "split-pages", false, "treat the output path as a directory and write one page_NNNN.json and page_NNNN.md per page there, plus an index.json; needs -format json")
+	fs.BoolVar(&opts.PageMarkdown, "page-markdown", false, "add each page's Markdown to it as markdown, alongside its blocks; needs -format json or bundle")
+	fs.BoolVar(&opts.PageText, "page-text", false, "add each page's plain text to it as text, one block per paragraph; needs -format json or bundle")
+	fs.BoolVar(&opts.CellMarkdown, "cell-markdown", false, "add each table cell's text as it goes in a Markdown table to it as markdown, with pipes escaped and line breaks as <br>; needs -format json or bundle")
+	fs.StringVar(&opts.Tokenizer, "tokens", opts.Tokenizer, "annotate blocks and chunks with token counts from this tokenizer: cl100k (an approximation) or chars")
+	fs.BoolVar(&opts.Page.Sentences, "sentences", opts.Page.Sentences, "annotate text blocks with sentence boundary offsets")
+	fs.StringVar(&opts.Cache, "cache", "", "reuse outputs stored in this directory for PDFs converted before with the same options, and store new ones there")
+	fs.StringVar(&opts.Classifier, "classifier", "", "run this command to classify text blocks: it reads one JSON object of block features per line on stdin and answers each with a JSON object that may set type and level")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "stop after this long (e.g. 5m), writing the pages done and an error entry for each of the rest; 0 for no limit")
+	fs.DurationVar(&opts.PageTimeout, "page-timeout", 0, "give up on a page after this long (e.g. 30s), writing an error entry in its place; 0 for no limit")
+	fs.IntVar(&opts.Extract.MaxChars, "max-chars", opts.Extract.MaxChars, "keep whole text blocks up to this many characters per page, dropping the rest with a warning on the page; 0 for no limit")
+	fs.IntVar(&opts.Extract.MaxEdges, "max-edges", opts.Extract.MaxEdges, "on pages with more ruling lines than this, drop them all and skip table detection, with a warning on the page; 0 for no limit")
+	fs.StringVar(&opts.Extract.Pages, "pages", "", "convert only these pages, as comma-separated numbers and FIRST-LAST ranges where N is the last page (e.g. 1-3,7,N-1)")
+	fs.StringVar(&opts.Extract.Password, "password", "", "open encrypted PDFs with this password")
+	fs.Func("hide-layer", "leave out the content of this optional content group (layer), such as a draft or second-language layer, by name (repeatable)", func(s string) error {
+		opts.Extract.HideLayers = append(opts.Extract.HideLayers, s)
+		return nil
+	})
+	fs.Func("show-layer", "extract the content of this layer, by name, even if the document has it turned off (repeatable)", func(s string) error {
+		opts.Extract.ShowLayers = append(opts.Extract.ShowLayers, s)
+		return nil
+	})
+	fs.BoolVar(&opts.Extract.Repair, "repair", opts.Extract.Repair, "rebuild the cross-reference table of a damaged PDF when a page cannot be read and retry it, marking the document repaired")
+	maxFileSize := fs.String("max-file-size", "0", "refuse input files larger than this, in bytes or with a K, M or G suffix (e.g. 200M); 0 for no limit")
+	fs.IntVar(&opts.Extract.MaxPages, "max-pages", 0, "refuse documents with more pages than this, before extracting any; 0 for no limit")
+	fs.IntVar(&opts.Extract.Workers, "workers", 0, "extract and convert this many pages in parallel; 0 for one per cpu")
+	fs.StringVar(&opts.Checkpoint, "checkpoint", "", "keep finished pages in this directory and resume from it after an interrupted run")
+	fs.StringVar(&opts.Report, "report", "", "write a JSON record of the run to this file: the input's SHA-256, the options, the converter's version, the time taken by each phase and each page's block counts and warnings")
+	fs.StringVar(&opts.Raw, "raw", "", "extract raw page data into this directory and keep it, skipping pages already there; builds without MuPDF (WebAssembly) convert the pages in it instead")
+	fs.BoolVar(&opts.Page.ColumnLabels, "column-labels", opts.Page.ColumnLabels, "label blocks with the band and column reading order put them in, and give each page the x-ranges of its detected columns")
+	fs.BoolVar(&opts.Page.PageTimings, "page-timings", opts.Page.PageTimings, "give each page a timings_ms object with the milliseconds spent reading it, detecting its tables, classifying its text and encoding it as JSON")
+	fs.BoolVar(&opts.Page.OrderConfidence, "order-confidence", opts.Page.OrderConfidence, "give each page a 0-1 order_confidence for how clearly its columns settled the reading order; low where blocks straddle columns or full-width blocks overlap them")
+	fs.BoolVar(&opts.Page.TopDownOrder, "top-down-order", opts.Page.TopDownOrder, "number blocks in plain top-to-bottom order as top_down, as a fallback to the column reading order")
+	fs.BoolVar(&opts.Page.Confidence, "confidence", opts.Page.Confidence, "add a 0-1 confidence to text, heading, list, code and footnote blocks for how clearly the classification heuristics fired")
+	fs.BoolVar(&opts.Markdown.FigurePlaceholders, "figure-placeholders", opts.Markdown.FigurePlaceholders, "in Markdown output (chunks, bundle), write figures as <!-- figure: caption --> comments instead of image links, for text-only pipelines")
+	fs.BoolVar(&opts.Markdown.TOC, "toc", opts.Markdown.TOC, "start the bundle's document.md with a table of contents of the headings, linked to their anchors, for PDFs without an outline; needs -format bundle")
+	tableStyle := fs.String("table-style", opts.Markdown.Tables.String(), "how Markdown output renders tables: pipe, html for <table> elements with rowspan and colspan, grid for Pandoc grid tables, or auto for pipe tables and html for those with merged or multi-line cells")
+	keepListMarkers := fs.Bool("keep-list-markers", false, "start list items with their marker as printed (▪, ➢, a., iv.) in the JSON and Markdown instead of \"- \"; -config list_markers maps markers to Markdown ones")
+	fs.BoolVar(&opts.Page.KeyValues, "key-values", opts.Page.KeyValues, "pair labels with the values beside or below them, as on invoices, receipts and forms, into each page's key_values")
+	fs.BoolVar(&opts.Page.Fingerprints, "fingerprint", opts.Page.Fingerprints, "add layout-insensitive text hashes per page and per document for duplicate detection")
+	minImageWidth := fs.Float64("min-image-width", 0, "drop figures narrower than this many points, such as bullets and rules")
+	minImageHeight := fs.Float64("min-image-height", 0, "drop figures shorter than this many points")
+	minImageArea := fs.Float64("min-image-area", 0, "drop figures covering less than this many square points")
+	imageFormat := fs.String("image-format", "png", "format of saved figure images: png or jpeg")
+	fs.IntVar(&opts.Extract.JPEGQuality, "jpeg-quality", 90, "quality of JPEG figure images, 1-100")
+	imageMaxDPI := fs.Float64("image-max-dpi", 0, "shrink saved figure images drawn at more pixels per inch than this; 0 keeps full resolution")
+	fs.IntVar(&opts.Extract.ImageMaxSize, "image-max-size", 0, "shrink saved figure images whose longer side has more pixels than this; 0 keeps full resolution")
+	fs.BoolVar(&opts.Page.ScanImages, "scan-images", opts.Page.ScanImages, "on scanned pages with an OCR text layer, set the page's scan to the page image instead of writing it as a figure; needs -format bundle")
+	fs.BoolVar(&opts.Page.Images.Dedup, "dedup-images", opts.Page.Images.Dedup, "point figures whose image looks like one earlier in the document at that image, so a repeated logo is saved once")
+	only := fs.String("only", "", "comma-separated block types to keep, dropping the rest (e.g. heading,table)")
+	exclude := fs.String("exclude", "", "comma-separated block types to drop (e.g. footnote,other)")
+	fs.IntVar(&opts.Page.Columns.MaxColumns, "columns", opts.Page.Columns.MaxColumns, "at most this many columns per section, merging across the narrowest gaps; 1 reads every page as a single column")
+	fs.Func("column-ranges", "use these columns instead of detecting them, as [PAGE:]X0-X1,X0-X1,... in points; without PAGE for every page (repeatable)", func(s string) error {
+		page, ranges := 0, s
+		if p, rest, ok := strings.Cut(s, ":"); ok {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid page number %q", p)
+			}
+			page, ranges = n, rest
+		}
+		cols, err := column.ParseRanges(ranges)
+		if err != nil {
+			return err
+		}
+		if page == 0 {
+			opts.Page.Columns.Columns = cols
+			return nil
+		}
+		if opts.Page.PageColumns == nil {
+			opts.Page.PageColumns = map[int][]column.Range{}
+		}
+		opts.Page.PageColumns[page] = cols
+		return nil
+	})
+	fs.Func("table-region", "take this region as a table without detecting it, as [PAGE:]X0,Y0,X1,Y1 in points; without PAGE on every page (repeatable)", func(s string) error {
+		page, region, err := parseRegion(s)
+		if err != nil {
+			return err
+		}
+		if opts.Page.TableRegions == nil {
+			opts.Page.TableRegions = map[int][]geometry.Rect{}
+		}
+		opts.Page.TableRegions[page] = append(opts.Page.TableRegions[page], region)
+		return nil
+	})
+	fs.BoolVar(&opts.Page.DocumentFonts, "document-fonts", opts.Page.DocumentFonts, "classify every page by the font sizes of the whole document, measured in a first pass; =false measures each page on its own")
+	fs.BoolVar(&opts.Page.KeepRedacted, "keep-redacted", opts.Page.KeepRedacted, "extract the text under redaction annotations that were never applied, which is left out by default as it was meant to be removed")
+	fs.BoolVar(&opts.Page.KeepSuppressed, "keep-suppressed", opts.Page.KeepSuppressed, "keep the page numbers, running heads and vertical margin text left out of each page's data in its suppressed list, tagged with why; needs -format json or bundle")
+	fs.BoolVar(&opts.Page.Deskew, "deskew", opts.Page.Deskew, "straighten pages scanned at a slight angle (0.1 to 10 degrees), measured from the slope of their baselines, before extracting them")
+	fs.Func("ignore-region", "leave out everything in this region, such as a stamp or a sidebar the margins miss, as [PAGE:]X0,Y0,X1,Y1 in points; without PAGE on every page (repeatable)", func(s string) error {
+		page, region, err := parseRegion(s)
+		if err != nil {
+			return err
+		}
+		if opts.Page.IgnoreZones == nil {
+			opts.Page.IgnoreZones = map[int][]geometry.Rect{}
+		}
+		opts.Page.IgnoreZones[page] = append(opts.Page.IgnoreZones[page], region)
+		return nil
+	})
+	margins := fs.String("margins", opts.Page.Margins.String(), "header and footer zones where page numbers and running heads are dropped: 1, 2 or 4 comma-separated values in CSS order, in points or with % of the page size")
+	var pageNumbers text.PageNumbers
+	fs.Func("page-number", "also drop text alone in a margin in this form as a page number, a regular expression where {n} is the number, in digits or roman numerals, {total} the page count, such as 'Folio {n}' (repeatable)", func(s string) error {
+		p, err := text.ParsePageNumberPattern(s)
+		pageNumbers = append(pageNumbers, p)
+		return err
+	})
+	fs.Func("page-margins", "like -margins for pages of one size, as SIZE=MARGINS where SIZE is letter, legal, a3, a4, a5 or WIDTHxHEIGHT in points (repeatable)", func(s string) error {
+		pm, err := parsePageMargins(s)
+		opts.Page.PageMargins = append(opts.Page.PageMargins, pm)
+		return err
+	})
+	profile := fs.String("profile", "", "start from thresholds tuned for a class of documents: "+strings.Join(config.ProfileNames(), ", "))
+	configPath := fs.String("config", "", "read heuristic thresholds (heading sizes, paragraph and list gaps, table tolerances, margins) from this JSON or YAML file, over -profile; flags still override it")
+	tables := fs.Bool("tables", !opts.Page.DisableTables, "detect tables; turn off for corpora without tables to save time and keep ruled text as paragraphs")
+	numbers := fs.String("numbers", "", "add the number in each table cell that holds one as value, a plain decimal such as -1234.5 for (1,234.50): auto to tell the decimal mark from each number, point or comma to fix it; empty for none")
+	emptyCells := fs.Bool("empty-cells", !opts.Page.DropEmptyCells, "give every table row a cell per column, with empty placeholders where the grid has no cell; turn off to leave them out and place cells by col_index")
+	fs.BoolVar(&opts.Page.Lines, "lines", opts.Page.Lines, "include each block's lines with their bbox, text and style as text_lines")
+	fs.BoolVar(&opts.Page.Chars, "include-chars", opts.Page.Chars, "include each text block's characters with their codepoint, bbox, origin, size and style as chars; makes the output several times larger")
+	fs.BoolVar(&opts.Page.BatesNumbers, "bates", opts.Page.BatesNumbers, "move Bates numbers stamped in a page corner into the page's bates field")
+	fs.BoolVar(&opts.Page.RunningHeads, "running-heads", opts.Page.RunningHeads, "move short text that recurs in the top or bottom margin of several pages, such as a chapter title or a date, into the page's header_text and footer_text")
+	fs.BoolVar(&opts.Page.JoinAcrossPages, "join-pages", opts.Page.JoinAcrossPages, "join paragraphs and lists that continue onto the next page into one block")
+	fs.BoolVar(&opts.Page.StructureReferences, "references", opts.Page.StructureReferences, "split reference sections into one item per entry")
+	fs.BoolVar(&opts.Page.LinkCitations, "link-citations", opts.Page.LinkCitations, "link superscript markers to their footnote or reference entry")
+	fs.BoolVar(&opts.Page.PaperMetadata, "metadata", opts.Page.PaperMetadata, "detect title, authors and abstract on the first page")
+	return func() error {
+		switch opts.Format {
+		case "json", "parquet", "chunks", "pymupdf4llm":
+		case "bundle":
+			opts.Extract.Images = true
+		default:
+			return fmt.Errorf("unknown output format %q", opts.Format)
+		}
+		opts.Extract.KeepRedacted = opts.Page.KeepRedacted
+		if (opts.PageMarkdown || opts.PageText) && opts.Format != "json" && opts.Format != "bundle" {
+			return errors.New("-page-markdown and -page-text need -format json or bundle")
+		}
+		if opts.CellMarkdown && opts.Format != "json" && opts.Format != "bundle" {
+			return errors.New("-cell-markdown needs -format json or bundle")
+		}
+		if opts.Page.KeepSuppressed && opts.Format != "json" && opts.Format != "bundle" {
+			return errors.New("-keep-suppressed needs -format json or bundle")
+		}
+		if opts.SplitPages && (opts.Format != "json" || opts.Cache != "") {
+			return errors.New("-split-pages needs -format json and cannot be combined with -cache")
+		}
+		if opts.Raw != "" && opts.Checkpoint != "" {
+			return errors.New("-raw and -checkpoint both choose where raw pages go, use one")
+		}
+		if opts.Extract.Workers < 0 {
+			return fmt.Errorf("invalid worker count %d", opts.Extract.Workers)
+		}
+		if opts.Extract.MaxPages < 0 {
+			return fmt.Errorf("invalid page limit %d", opts.Extract.MaxPages)
+		}
+		if err := bridge.CheckPageRanges(opts.Extract.Pages); err != nil {
+			return err
+		}
+		opts.Page.KeepListMarkers, opts.Markdown.KeepListMarkers = *keepListMarkers, *keepListMarkers
+		for _, name := range opts.Extract.HideLayers {
+			if slices.Contains(opts.Extract.ShowLayers, name) {
+				return fmt.Errorf("layer %q is both hidden and shown", name)
+			}
+		}
+		if opts.Markdown.TOC && opts.Format != "bundle" {
+			return errors.New("-toc needs -format bundle, the only output with a whole-document Markdown")
+		}
+		if opts.Page.ScanImages && opts.Format != "bundle" {
+			return errors.New("-scan-images needs -format bundle, the only output that keeps images")
+		}
+		var err error
+		if opts.Extract.MaxFileSize, err = parseByteSize(*maxFileSize); err != nil {
+			return err
+		}
+		if opts.Markdown.Tables, err = markdown.ParseTableStyle(*tableStyle); err != nil {
+			return err
+		}
+		if opts.Extract.PageBox, err = bridge.ParsePageBox(*box); err != nil {
+			return err
+		}
+		if opts.Extract.ImageFormat, err = bridge.ParseImageFormat(*imageFormat); err != nil {
+			return err
+		}
+		if opts.Extract.JPEGQuality < 1 || opts.Extract.JPEGQuality > 100 {
+			return fmt.Errorf("invalid JPEG quality %d (want 1-100)", opts.Extract.JPEGQuality)
+		}
+		opts.Extract.ImageMaxDPI = float32(*imageMaxDPI)
+		if opts.Page.ReadingOrder, err = column.ParseStrategy(*order); err != nil {
+			return err
+		}
+		opts.Page.Spacing.WordGap, opts.Page.Spacing.PunctGap, opts.Page.Spacing.LineJoin = float32(*wordGap), float32(*punctGap), float32(*lineJoin)
+		opts.Extract.SplitLigatures, opts.Page.Cleanup.Ligatures = *ligatures, *ligatures
+		opts.Page.Cleanup.SoftHyphens = !*keepSoftHyphens
+		if opts.Page.Cleanup.Invisible, err = text.ParseInvisible(*invisible); err != nil {
+			return err
+		}
+		opts.Page.DisableTables, opts.Page.DropEmptyCells = !*tables, !*emptyCells
+		switch *numbers {
+		case "":
+		case "auto", "point", "comma":
+			opts.Page.TableNumbers, opts.Page.DecimalMark = true, map[string]rune{"auto": 0, "point": '.', "comma": ','}[*numbers]
+		default:
+			return fmt.Errorf("-numbers %q: want auto, point or comma", *numbers)
+		}
+		opts.Page.Images.MinWidth, opts.Page.Images.MinHeight, opts.Page.Images.MinArea = float32(*minImageWidth), float32(*minImageHeight), float32(*minImageArea)
+		cfg := config.Default
+		if *profile != "" {
+			if cfg, err = config.Profile(*profile); err != nil {
+				return err
+			}
+		}
+		if *configPath != "" {
+			if cfg, err = config.Load(*configPath, cfg); err != nil {
+				return err
+			}
+		}
+		if *profile != "" || *configPath != "" {
+			cfg.Apply(&opts.Page)
+			cfg.ApplyMarkdown(&opts.Markdown)
+		}
+		opts.Page.PageNumbers = append(slices.Clip(opts.Page.PageNumbers), pageNumbers...)
+		marginsSet := *profile == "" && *configPath == ""
+		fs.Visit(func(f *flag.Flag) { marginsSet = marginsSet || f.Name == "margins" })
+		if marginsSet {
+			if opts.Page.Margins, err = text.ParseMargins(*margins); err != nil {
+				return err
+			}
+		}
+		if opts.Only, err = models.ParseBlockTypes(*only); err != nil {
+			return err
+		}
+		if opts.Exclude, err = models.ParseBlockTypes(*exclude); err != nil {
+			return err
+		}
+		if opts.Tokenizer != "" {
+			if _, err = tokens.Lookup(opts.Tokenizer); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+var pageSizes = map[string][2]float32{"letter": {612, 792}, "legal": {612, 1008}, "a3": {842, 1191}, "a4": {595, 842}, "a5": {420, 595}}
+
+func parsePageMargins(s string) (extractor.PageMargins, error) {
+	size, margins, ok := strings.Cut(s, "=")
+	if !ok {
+		return extractor.PageMargins{}, fmt.Errorf("invalid page margins %q (want SIZE=MARGINS)", s)
+	}
+	wh, ok := pageSizes[strings.ToLower(size)]
+	if !ok {
+		w, h, _ := strings.Cut(size, "x")
+		wf, errW := strconv.ParseFloat(w, 32)
+		hf, errH := strconv.ParseFloat(h, 32)
+		if errW != nil || errH != nil {
+			return extractor.PageMargins{}, fmt.Errorf("invalid page size %q (want letter, legal, a3, a4, a5 or WIDTHxHEIGHT)", size)
+		}
+		wh = [2]float32{float32(wf), float32(hf)}
+	}
+	m, err := text.ParseMargins(margins)
+	return extractor.PageMargins{Width: wh[0], Height: wh[1], Margins: m}, err
+}
+
+// parseRegion parses [PAGE:]X0,Y0,X1,Y1, returning page 0 without PAGE.
+func parseRegion(s string) (int, geometry.Rect, error) {
+	page, coords := 0, s
+	if p, rest, ok := strings.Cut(s, ":"); ok {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return 0, geometry.Rect{}, fmt.Errorf("invalid page number %q", p)
+		}
+		page, coords = n, rest
+	}
+	invalid := fmt.Errorf("invalid region %q (want [PAGE:]X0,Y0,X1,Y1 with X0 < X1 and Y0 < Y1)", s)
+	parts := strings.Split(coords, ",")
+	if len(parts) != 4 {
+		return 0, geometry.Rect{}, invalid
+	}
+	var v [4]float32
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return 0, geometry.Rect{}, invalid
+		}
+		v[i] = float32(f)
+	}
+	r := geometry.Rect{X0: v[0], Y0: v[1], X1: v[2], Y1: v[3]}
+	if r.Width() <= 0 || r.Height() <= 0 {
+		return 0, geometry.Rect{}, invalid
+	}
+	return page, r, nil
+}
+
+// parseByteSize parses a byte count with an optional K, M or G suffix for
+// powers of 1024, such as 200M.
+func parseByteSize(s string) (int64, error) {
+	digits, shift := strings.ToUpper(strings.TrimSpace(s)), 0
+	if i := strings.IndexAny(digits, "KMG"); i >= 0 && i == len(digits)-1 {
+		shift = 10 * (strings.IndexByte("KMG", digits[i]) + 1)
+		digits = digits[:i]
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q (want bytes, or a number with K, M or G)", s)
+	}
+	return n << shift, nil
+}
+
+// exit statuses of conversions refused, matching the -2 and -3 convertC
+// returns for them, and of those whose output was written without some
+// pages; any other failure exits with 1
+const (
+	exitUnsupported = 2 // a file MuPDF cannot open
+	exitTooLarge    = 3 // over -max-file-size or -max-pages
+	exitPartial     = 4 // pages given up on for -timeout, -page-timeout or damage
+)
+
+// exitStatus is the exit status of a run that ended with err.
+func exitStatus(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, bridge.ErrUnsupportedFormat):
+		return exitUnsupported
+	case errors.Is(err, bridge.ErrTooLarge):
+		return exitTooLarge
+	case errors.Is(err, errTimedOut), errors.Is(err, errDamaged):
+		return exitPartial
+	}
+	return 1
+}
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: ./program <input.pdf> [output_json]")
-		os.Exit(1)
+	var exitCode func() int
+	defaultConvertOptions.interrupt, exitCode = notifyInterrupt()
+	status := cli(os.Args[1:])
+	os.Exit(max(exitCode(), status)) // after a signal, the output, if written, is partial
+}
+
+// cli runs tomd with args, the command line after the program name, and
+// returns the status to exit with.
+func cli(args []string) int {
+	if len(args) > 0 {
+		var run func([]string) error
+		switch args[0] {
+		case "diff":
+			run = runDiff
+		case "bench":
+			run = runBench
+		case "merge":
+			run = runMerge
+		}
+		if run != nil {
+			if err := run(args[1:]); err != nil {
+				fmt.Println(err)
+				return exitStatus(err)
+			}
+			return 0
+		}
+	}
+	opts, prof, args, err := parseArgs(args)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	stop, err := prof.start()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	convertErr := pdfToJson(args[0], args[1], opts)
+	if convertErr != nil {
+		fmt.Fprintln(os.Stderr, convertErr)
+	}
+	if err := stop(); err != nil {
+		fmt.Println(err)
+		return 1
 	}
-	pdfToJson(os.Args[1], os.Args[2])
+	return exitStatus(convertErr)
 }
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/testutil"
+)
+
+func TestOutputIsDeterministic(t *testing.T) {
+	if testutil.TestDataDir == "" {
+		t.Fatal("could not find project root")
+	}
+	pdfs, err := filepath.Glob(filepath.Join(testutil.TestDataDir, "*.pdf"))
+	if err != nil || len(pdfs) == 0 {
+		t.Fatalf("no test pdfs in %s", testutil.TestDataDir)
+	}
+	opts := defaultConvertOptions
+	opts.Page.Lines, opts.Page.Sentences, opts.Page.Fingerprints = true, true, true
+	opts.Tokenizer = "cl100k"
+
+	dir := t.TempDir()
+	for _, format := range []string{"json", "chunks", "parquet", "bundle", "pymupdf4llm"} {
+		opts := opts
+		opts.Format = format
+		opts.Extract.Images = format == "bundle"
+		for _, pdf := range pdfs {
+			var sums [2][sha256.Size]byte
+			for run := range sums {
+				out := filepath.Join(dir, format+"-"+filepath.Base(pdf))
+				if err := pdfToJson(pdf, out, opts); err != nil {
+					t.Fatalf("%s (%s): %v", filepath.Base(pdf), format, err)
+				}
+				data, err := os.ReadFile(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sums[run] = sha256.Sum256(data)
+			}
+			if sums[0] != sums[1] {
+				t.Errorf("%s (%s): two conversions differ", filepath.Base(pdf), format)
+			}
+		}
+	}
+}
+
+func TestOptionsFromJSON(t *testing.T) {
+	opts, err := optionsFromJSON([]byte(`{"pages": "1-3,N", "max_chars": 2000000, "tables": false, "format": "chunks", "page-margins": ["a4=20", "letter=30"], "max_file_size": "2G", "max_pages": 500, "page_number": "Folio {n}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Extract.Pages != "1-3,N" || opts.Extract.MaxChars != 2_000_000 || !opts.Page.DisableTables || opts.Format != "chunks" || len(opts.Page.PageMargins) != 2 || opts.Extract.MaxFileSize != 2<<30 || opts.Extract.MaxPages != 500 || !opts.Page.PageNumbers.Match("folio 3") || !opts.Page.PageNumbers.Match("3") {
+		t.Errorf("options not applied: %+v", opts)
+	}
+	for _, bad := range []string{`{"no_such_flag": 1}`, `{"pages": "1-"}`, `{"max_chars": 1.5}`, `{"lines": {}}`, `[]`, `{"max_file_size": "2T"}`, `{"max_pages": -1}`, `{"page_number": "Page ({n}"}`} {
+		if _, err := optionsFromJSON([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestMergePages(t *testing.T) {
+	block := models.Block{Type: models.BlockText}
+	a := []models.Page{{Number: 1}, {Number: 2, Data: []models.Block{block, block}}}
+	b := []models.Page{{Number: 3, Label: "iii", Data: []models.Block{block}}}
+	paper := &models.PaperMetadata{Title: "A"}
+	fonts := []models.Font{{Name: "Garamond", Substituted: true, Pages: []int{3}}}
+	merged := mergePages([]string{"dir/a.pdf", "b.pdf"}, []models.Document{
+		{SchemaVersion: models.SchemaVersion, Metadata: paper, Pages: a},
+		{SchemaVersion: models.SchemaVersion, Fonts: fonts, Repaired: true, Pages: b},
+	})
+	at := func(page, index, ordinal int) models.Block {
+		return models.Block{Type: models.BlockText, SourcePage: page, Index: index, Ordinal: ordinal}
+	}
+	want := []models.Page{
+		{Number: 1, Source: "a.pdf", SourcePage: 1},
+		{Number: 2, Source: "a.pdf", SourcePage: 2, Data: []models.Block{at(2, 0, 0), at(2, 1, 1)}},
+		{Number: 3, Source: "b.pdf", SourcePage: 3, Label: "iii", Data: []models.Block{at(3, 0, 2)}},
+	}
+	sources := []models.Source{
+		{File: "a.pdf", FirstPage: 1, PageCount: 2, Metadata: paper},
+		{File: "b.pdf", FirstPage: 3, PageCount: 1, Fonts: fonts, Repaired: true},
+	}
+	if want := (models.Document{SchemaVersion: models.SchemaVersion, Sources: sources, Pages: want}); !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %+v, want %+v", merged, want)
+	}
+}
+
+func TestRunMergeArgs(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "combined.json")
+	missing := filepath.Join(dir, "a.pdf")
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{missing, "b.pdf", "-o", out}, missing + ":"}, // -o after the inputs
+		{[]string{missing, "-o", out, "b.pdf"}, missing + ":"},
+		{[]string{"a.pdf", "-format", "chunks", "b.pdf", "-o", out}, "merge writes json only"},
+		{[]string{"a.pdf", "b.pdf"}, "merge needs -o"},
+		{[]string{"-o", out}, "merge needs -o"},
+	} {
+		err := runMerge(tc.args)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("runMerge(%q) = %v, want %q", tc.args, err, tc.want)
+		}
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("output written for inputs that do not exist")
+	}
+}
+
+func TestCLIExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	html, pdf := filepath.Join(dir, "x.html"), filepath.Join(dir, "x.pdf")
+	if err := os.WriteFile(html, []byte("<!DOCTYPE html><html><body>hi</body></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pdf, []byte("%PDF-1.7"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.json")
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{html, out}, exitUnsupported},
+		{[]string{"-max-file-size", "1", pdf, out}, exitTooLarge},
+		{[]string{filepath.Join(dir, "missing.pdf"), out}, 1},
+		{[]string{html}, 1}, // no output path
+	} {
+		if got := cli(tc.args); got != tc.want {
+			t.Errorf("tomd %q exited with %d, want %d", tc.args, got, tc.want)
+		}
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("output written for input that was refused")
+	}
+	for _, err := range []error{errTimedOut, fmt.Errorf("in.pdf: %w", errDamaged)} {
+		if got := exitStatus(err); got != exitPartial {
+			t.Errorf("exitStatus(%v) = %d, want %d", err, got, exitPartial)
+		}
+	}
+}
+
+func TestCLITimeout(t *testing.T) {
+	dir := t.TempDir()
+	pdf, out := filepath.Join(dir, "in.pdf"), filepath.Join(dir, "out.json")
+	content := "BT /F1 12 Tf 72 720 Td (Given up on) Tj ET"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	if err := os.WriteFile(pdf, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cli([]string{"-page-timeout", "1ns", pdf, out}); got != exitPartial {
+		t.Errorf("timed out conversion exited with %d, want %d", got, exitPartial)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("partial output not written: %v", err)
+	}
+	var doc struct {
+		Pages []struct {
+			Error string `json:"error"`
+		} `json:"pages"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 1 || doc.Pages[0].Error == "" {
+		t.Errorf("pages = %+v, want the one page given up on", doc.Pages)
+	}
+}
+
+func TestWriteSplit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	doc := models.Document{SchemaVersion: models.SchemaVersion, Metadata: &models.PaperMetadata{Title: "Title"}, Pages: []models.Page{
+		{Number: 1, Data: []models.Block{{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "Title"}}}}},
+		{Number: 2, Error: "page timed out", Data: []models.Block{}},
+	}}
+	if err := writeSplit(dir, "doc.pdf", doc, markdown.DefaultOptions); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index splitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Source != "doc.pdf" || index.PageCount != 2 || index.Metadata == nil || index.Pages[0].JSON != "page_0001.json" || index.Pages[1].Error == "" {
+		t.Errorf("unexpected index %+v", index)
+	}
+	md, err := os.ReadFile(filepath.Join(dir, index.Pages[0].Markdown))
+	if err != nil || !strings.Contains(string(md), "# Title") {
+		t.Errorf("page markdown %q, %v", md, err)
+	}
+}
+
+func TestRenderPages(t *testing.T) {
+	pages := []models.Page{{Number: 1, Data: []models.Block{
+		{Type: models.BlockHeading, Level: 2, Spans: []models.Span{{Text: "Title"}}},
+		{Type: models.BlockText, Spans: []models.Span{{Text: "Body "}, {Text: "text.", Style: models.TextStyle{Bold: true}}}},
+	}}}
+	opts := defaultConvertOptions
+	opts.PageMarkdown, opts.PageText = true, true
+	renderPages(pages, opts)
+	if want := "## Title\n\nBody **text.**\n"; pages[0].Markdown != want {
+		t.Errorf("markdown = %q, want %q", pages[0].Markdown, want)
+	}
+	if want := "Title\n\nBody text."; pages[0].Text != want {
+		t.Errorf("text = %q, want %q", pages[0].Text, want)
+	}
+	pages = []models.Page{{Number: 1, Data: []models.Block{
+		{Type: models.BlockTable, Rows: []models.TableRow{{Cells: []models.TableCell{{Spans: []models.Span{{Text: "a|b\nc"}}}, {Col: 1}}}}},
+	}}}
+	opts = defaultConvertOptions
+	opts.CellMarkdown = true
+	renderPages(pages, opts)
+	if cells := pages[0].Data[0].Rows[0].Cells; cells[0].Markdown != `a\|b<br>c` || cells[1].Markdown != "" || pages[0].Markdown != "" {
+		t.Errorf("cell markdown = %q, %q, page markdown %q", cells[0].Markdown, cells[1].Markdown, pages[0].Markdown)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	pdf := filepath.Join(t.TempDir(), "in.pdf")
+	if err := os.WriteFile(pdf, []byte("%PDF-1.7"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pages := []models.Page{
+		{Number: 1, Data: []models.Block{{Type: models.BlockHeading, Length: 5}, {Type: models.BlockText, Length: 40}, {Type: models.BlockText, Length: 12}}, Warnings: []string{"dropped 1 blocks of vertical text"}},
+		timedOutPage(2, "page timed out"),
+	}
+	r, err := newRunReport(pdf, "out.json", defaultConvertOptions, time.Now(), phaseTimes{Pages: 1500 * time.Microsecond}, pages, false, errTimedOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256([]byte("%PDF-1.7")); r.Input.SHA256 != hex.EncodeToString(sum[:]) || r.Input.Size != 8 {
+		t.Errorf("input = %+v", r.Input)
+	}
+	if r.Timings.Pages != 1.5 || r.Error != errTimedOut.Error() || r.Version.Schema != models.SchemaVersion {
+		t.Errorf("timings %+v, error %q, version %+v", r.Timings, r.Error, r.Version)
+	}
+	want := []reportedPage{
+		{Page: 1, Blocks: 3, Types: map[string]int{"heading": 1, "text": 2}, Chars: 57, Warnings: pages[0].Warnings},
+		{Page: 2, Error: "page timed out"},
+	}
+	if !reflect.DeepEqual(r.Pages, want) {
+		t.Errorf("pages = %+v", r.Pages)
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteOutputReplacesWhole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := os.WriteFile(path, []byte("old output"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := models.Document{SchemaVersion: models.SchemaVersion, Metadata: &models.PaperMetadata{Title: "Title"}, Pages: []models.Page{{Number: 1, Data: []models.Block{}}, {Number: 2, Data: []models.Block{}}}}
+	if err := writeOutput(path, "doc.pdf", doc, defaultConvertOptions); err != nil {
+		t.Fatal(err)
+	}
+	var got models.Document
+	if data, err := os.ReadFile(path); err != nil || json.Unmarshal(data, &got) != nil || !reflect.DeepEqual(got, doc) {
+		t.Errorf("output %q, %v", data, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+}
+
+func TestNotifyInterrupt(t *testing.T) {
+	interrupt, exitCode := notifyInterrupt()
+	defer signal.Reset(os.Interrupt, syscall.SIGTERM)
+	if interrupted(interrupt) || exitCode() != 0 {
+		t.Fatal("interrupted before any signal")
+	}
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(syscall.SIGTERM); err != nil {
+		t.Skip("cannot signal the test process:", err)
+	}
+	select {
+	case <-interrupt:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not close the channel")
+	}
+	if code := exitCode(); code != 143 {
+		t.Errorf("exit code %d, want 143", code)
+	}
+}
+
+// metricsLog records Metrics calls as strings.
+type metricsLog []string
+
+func (m *metricsLog) PagesProcessed(n int) { *m = append(*m, fmt.Sprint("pages ", n)) }
+func (m *metricsLog) PhaseDuration(phase string, d time.Duration) {
+	*m = append(*m, fmt.Sprint(phase, " ", d))
+}
+func (m *metricsLog) ConversionDuration(d time.Duration) { *m = append(*m, fmt.Sprint("total ", d)) }
+func (m *metricsLog) Error(kind string)                  { *m = append(*m, "error "+kind) }
+
+func TestRecordMetrics(t *testing.T) {
+	times := phaseTimes{Extract: 1, Pages: 2, Tables: 3, Passes: 4, Write: 5, Total: 15}
+	pages := []models.Page{{Number: 1}, {Number: 2, Error: "page timed out"}}
+	var got metricsLog
+	recordMetrics(&got, times.Total, times, pages, "done", errTimedOut)
+	want := metricsLog{"total 15ns", "error timeout", "pages 1", "extract 1ns", "pages 2ns", "tables 3ns", "passes 4ns", "write 5ns"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("timed out: %q, want %q", got, want)
+	}
+	got = nil
+	recordMetrics(&got, 7, phaseTimes{Extract: 7}, nil, "extract", errors.New("extraction failed"))
+	if want := (metricsLog{"total 7ns", "error extract"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("failed extraction: %q, want %q", got, want)
+	}
+	got = nil
+	err := givenUpError(models.Page{Number: 3, Error: damagedPage})
+	recordMetrics(&got, 9, times, nil, "done", err)
+	if want := (metricsLog{"total 9ns", "error damaged"}); err != errDamaged || !reflect.DeepEqual(got, want) {
+		t.Errorf("damaged page: %v, %q, want %q", err, got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pymupdf4llm-c/go/internal/extractor"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// runMerge implements "tomd merge a.pdf b.pdf -o combined.json": it converts
+// each PDF with the usual conversion flags and writes one document of all
+// their pages, numbered through, each recording the file and page it came from.
+func runMerge(args []string) error {
+	opts := defaultConvertOptions
+	fs := flag.NewFlagSet("tomd merge", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: ./program merge [flags] -o <output.json> <a.pdf> <b.pdf>...")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "write the merged document to this file")
+	finish := convertFlags(fs, &opts)
+	// flag stops at the first input, so parse again after each one to take
+	// flags among and after them, as in merge a.pdf b.pdf -o combined.json
+	var inputs []string
+	for rest := args; ; rest = fs.Args()[1:] {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		inputs = append(inputs, fs.Arg(0))
+	}
+	if len(inputs) < 1 || *output == "" {
+		fs.Usage()
+		return errors.New("merge needs -o and at least one input")
+	}
+	if err := finish(); err != nil {
+		return err
+	}
+	if opts.Format != "json" {
+		return fmt.Errorf("merge writes json only, not %q", opts.Format)
+	}
+	if opts.Cache != "" || opts.Checkpoint != "" || opts.Raw != "" {
+		return errors.New("merge does not support -cache, -checkpoint or -raw")
+	}
+	if opts.Timeout > 0 {
+		opts.deadline = time.Now().Add(opts.Timeout) // for all the inputs together
+	}
+
+	docs := make([]models.Document, len(inputs))
+	for i, pdfPath := range inputs {
+		if interrupted(opts.interrupt) {
+			break // write the inputs already converted
+		}
+		tempRawDir, _, err := extractRaw(pdfPath, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pdfPath, err)
+		}
+		docs[i], _, err = processPages(tempRawDir, opts, nil)
+		os.RemoveAll(tempRawDir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pdfPath, err)
+		}
+	}
+	merged := mergePages(inputs, docs)
+	renderPages(merged.Pages, opts)
+	if opts.Page.PageTimings {
+		timeSerialization(merged.Pages)
+	}
+
+	var err error
+	if opts.SplitPages {
+		err = writeSplit(*output, "", merged, opts.Markdown)
+	} else {
+		err = writeOutput(*output, "", merged, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if interrupted(opts.interrupt) {
+		return errInterrupted
+	}
+	for _, page := range merged.Pages {
+		if page.Error != "" {
+			return givenUpError(page)
+		}
+	}
+	return nil
+}
+
+// mergePages joins the pages of docs, converted from sources, into one
+// document: pages are renumbered from 1 and keep their source file's name and
+// their number in it, and blocks are numbered through the whole document. The
+// fields each doc had as a whole go in its Source record.
+func mergePages(sources []string, docs []models.Document) models.Document {
+	var pages []models.Page
+	var records []models.Source
+	for i, doc := range docs {
+		records = append(records, models.Source{
+			File: filepath.Base(sources[i]), FirstPage: len(pages) + 1, PageCount: len(doc.Pages),
+			Metadata: doc.Metadata, Fingerprint: doc.Fingerprint, Layers: doc.Layers, Fonts: doc.Fonts, Repaired: doc.Repaired,
+		})
+		for _, page := range doc.Pages {
+			page.Source, page.SourcePage = filepath.Base(sources[i]), page.Number
+			page.Number = len(pages) + 1
+			pages = append(pages, page)
+		}
+	}
+	extractor.NumberBlocks(pages)
+	return models.Document{SchemaVersion: models.SchemaVersion, Sources: records, Pages: pages}
+}
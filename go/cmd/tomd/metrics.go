@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// Metrics is told about every conversion as it ends, so a service embedding
+// the converter can feed its own metrics registry: a counter of pages, a
+// histogram of conversion durations and one per phase, and a counter of
+// errors by kind. Conversions running at once call it concurrently.
+type Metrics interface {
+	PagesProcessed(n int)                        // pages converted without an error
+	PhaseDuration(phase string, d time.Duration) // extract, pages, tables, passes or write
+	ConversionDuration(d time.Duration)          // from start to end, failed or not
+	Error(kind string)                           // see errorKind
+}
+
+// recordMetrics reports a conversion that ended with err to m. stage is the
+// phase convert was in; phases are only reported for conversions that got as
+// far as writing, as a cache hit or failure has nothing to compare.
+func recordMetrics(m Metrics, total time.Duration, times phaseTimes, pages []models.Page, stage string, err error) {
+	m.ConversionDuration(total)
+	if err != nil {
+		m.Error(errorKind(err, stage))
+	}
+	if pages == nil || (err != nil && stage != "done") {
+		return
+	}
+	processed := 0
+	for _, page := range pages {
+		if page.Error == "" {
+			processed++
+		}
+	}
+	m.PagesProcessed(processed)
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{{"extract", times.Extract}, {"pages", times.Pages}, {"tables", times.Tables}, {"passes", times.Passes}, {"write", times.Write}} {
+		m.PhaseDuration(phase.name, phase.d)
+	}
+}
+
+// errorKind labels the error a conversion ended with: "timeout", "damaged" or
+// "interrupted" for partial output, "too_large" for input over -max-file-size
+// or -max-pages, otherwise the stage it failed in: "cache", "checkpoint",
+// "extract", "pages" or "write".
+func errorKind(err error, stage string) string {
+	switch {
+	case errors.Is(err, errTimedOut):
+		return "timeout"
+	case errors.Is(err, errDamaged):
+		return "damaged"
+	case errors.Is(err, errInterrupted):
+		return "interrupted"
+	case errors.Is(err, bridge.ErrTooLarge):
+		return "too_large"
+	}
+	return stage
+}
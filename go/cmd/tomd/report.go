@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// runReport is what -report writes: a record of where an output came from,
+// to keep alongside datasets derived from it. Options are those that shape
+// the output, as the cache keys them.
+type runReport struct {
+	Input    reportInput    `json:"input"`
+	Output   string         `json:"output"`
+	Options  any            `json:"options"`
+	Version  reportVersion  `json:"version"`
+	Started  time.Time      `json:"started"`
+	CacheHit bool           `json:"cache_hit,omitempty"` // the output was copied from -cache, with no pages to report
+	Timings  reportTimings  `json:"timings_ms"`
+	Pages    []reportedPage `json:"pages"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type reportInput struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type reportVersion struct {
+	Module   string `json:"module,omitempty"`   // version of the converter's module, "(devel)" for a local build
+	Revision string `json:"revision,omitempty"` // VCS revision it was built from, with "+dirty" for uncommitted changes
+	Go       string `json:"go"`
+	Schema   int    `json:"schema"` // of the JSON output, models.SchemaVersion
+}
+
+// reportTimings are phaseTimes in milliseconds.
+type reportTimings struct {
+	Extract float64 `json:"extract"`
+	Pages   float64 `json:"pages"`
+	Tables  float64 `json:"tables"` // summed over the page workers
+	Passes  float64 `json:"passes"`
+	Write   float64 `json:"write"`
+	Total   float64 `json:"total"`
+}
+
+type reportedPage struct {
+	Page     int            `json:"page"`
+	Blocks   int            `json:"blocks"`
+	Types    map[string]int `json:"types,omitempty"` // blocks by type
+	Chars    int            `json:"chars"`           // of text in the blocks, as their length counts them
+	Warnings []string       `json:"warnings,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// newRunReport describes the conversion of pdfPath to outputPath. pages is
+// nil if the conversion stopped before it had any.
+func newRunReport(pdfPath, outputPath string, opts convertOptions, started time.Time, times phaseTimes, pages []models.Page, cacheHit bool, err error) (runReport, error) {
+	r := runReport{Output: outputPath, Options: opts.cacheKeyOptions(pdfPath), Version: buildVersion(), Started: started, CacheHit: cacheHit, Pages: []reportedPage{}}
+	var hashErr error
+	if r.Input, hashErr = hashInput(pdfPath); hashErr != nil {
+		return r, hashErr
+	}
+	ms := models.Milliseconds
+	r.Timings = reportTimings{ms(times.Extract), ms(times.Pages), ms(times.Tables), ms(times.Passes), ms(times.Write), ms(times.Total)}
+	for _, page := range pages {
+		p := reportedPage{Page: page.Number, Blocks: len(page.Data), Warnings: page.Warnings, Error: page.Error}
+		for _, b := range page.Data {
+			if p.Types == nil {
+				p.Types = map[string]int{}
+			}
+			p.Types[string(b.Type)]++
+			p.Chars += b.Length
+		}
+		r.Pages = append(r.Pages, p)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r, nil
+}
+
+func hashInput(path string) (reportInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return reportInput{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return reportInput{}, err
+	}
+	return reportInput{Path: path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func buildVersion() reportVersion {
+	v := reportVersion{Go: runtime.Version(), Schema: models.SchemaVersion}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	v.Module = info.Main.Version
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision":
+			v.Revision = s.Value + v.Revision
+		case s.Key == "vcs.modified" && s.Value == "true":
+			v.Revision += "+dirty"
+		}
+	}
+	return v
+}
+
+// writeReport writes the report of a conversion to opts.Report.
+func writeReport(pdfPath, outputPath string, opts convertOptions, started time.Time, times phaseTimes, pages []models.Page, cacheHit bool, convErr error) error {
+	r, err := newRunReport(pdfPath, outputPath, opts, started, times, pages, cacheHit, convErr)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(opts.Report, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// splitIndex is the index.json of a -split-pages directory.
+type splitIndex struct {
+	SchemaVersion int                   `json:"schema_version"`   // of the page files
+	Source        string                `json:"source,omitempty"` // the PDF, or none for merged documents whose pages name theirs
+	PageCount     int                   `json:"page_count"`
+	Metadata      *models.PaperMetadata `json:"metadata,omitempty"`
+	Fingerprint   *models.Fingerprint   `json:"fingerprint,omitempty"`
+	Layers        []models.Layer        `json:"layers,omitempty"`
+	Repaired      bool                  `json:"repaired,omitempty"`
+	Fonts         []models.Font         `json:"fonts,omitempty"`
+	Sources       []models.Source       `json:"sources,omitempty"`
+	Pages         []splitIndexPage      `json:"pages"`
+}
+
+type splitIndexPage struct {
+	Number   int    `json:"page"`
+	Label    string `json:"label,omitempty"`
+	JSON     string `json:"json"`
+	Markdown string `json:"markdown"`
+	Blocks   int    `json:"blocks"`
+	Error    string `json:"error,omitempty"`
+}
+
+// writeSplit writes each page of doc to dir as page_NNNN.json, the same object
+// as in the single-file output, and page_NNNN.md, then index.json listing them
+// with the document's own fields. The index is written last, so its presence
+// means the directory is complete.
+func writeSplit(dir, source string, doc models.Document, md markdown.Options) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	index := splitIndex{SchemaVersion: models.SchemaVersion, Source: source, PageCount: len(doc.Pages), Metadata: doc.Metadata, Fingerprint: doc.Fingerprint, Layers: doc.Layers, Repaired: doc.Repaired, Fonts: doc.Fonts, Sources: doc.Sources, Pages: make([]splitIndexPage, len(doc.Pages))}
+	for i, page := range doc.Pages {
+		name := fmt.Sprintf("page_%04d", page.Number)
+		data, err := json.Marshal(page)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0o644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(markdown.PageWithOptions(page, md)), 0o644); err != nil {
+			return err
+		}
+		index.Pages[i] = splitIndexPage{Number: page.Number, Label: page.Label, JSON: name + ".json", Markdown: name + ".md", Blocks: len(page.Data), Error: page.Error}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.json"), data, 0o644)
+}
@@ -2,6 +2,9 @@ module github.com/pymupdf4llm-c/go
 
 go 1.21
 
-require github.com/tidwall/rtree v1.10.0
+require (
+	github.com/ebitengine/purego v0.9.1
+	github.com/tidwall/rtree v1.10.0
+)
 
 require github.com/tidwall/geoindex v1.7.0 // indirect
@@ -1,3 +1,5 @@
+//go:build cgo && !purego
+
 // why do logic in here > just wrapping fz functions via cgo?
 // performance. the thousands of `cgo` calls added up
 // (approx. 3x slower overall)
@@ -6,22 +8,37 @@
 // additionally, the raw 'binary' format is used for performance and less disk usage. json gets very taxing on thousands of chars.
 
 #include "bridge.h"
+#include "compat.h"
+#include <mupdf/pdf.h>
 #include <stdlib.h>
 #include <string.h>
 #include <stdio.h>
-#include <time.h>
-#include <unistd.h>
+#ifndef _WIN32
+#include <signal.h>
+#include <sys/time.h>
 #include <sys/wait.h>
-#include <sys/stat.h>
-#include <sys/types.h>
+#endif
 
 #define EDGE_MIN_LENGTH 3.0
 #define EDGE_MAX_WIDTH 3.0
+#define FIGURE_MIN_SIZE 16.0
+#define METATEXT_MAX_DEPTH 32
+#define PAGE_LABEL_MAX 128
+#define JPEG_DEFAULT_QUALITY 90
+#define ERR_TIMEOUT -6
 
 typedef struct {
     fz_device super;
     edge_array* edges;
-} edge_capture_device;
+    figure_array* figures;
+    fz_rect clip;
+    const char* image_prefix; // NULL unless figure images are saved
+    const extract_options* opts;
+
+    // alt text is nested via begin/end_metatext; entries are NULL for non-alt metatext
+    char* metatext[METATEXT_MAX_DEPTH];
+    int metatext_depth;
+} page_capture_device;
 
 static void mupdf_warning_callback(void* user, const char *message) {
     (void)user;
@@ -34,6 +51,10 @@ static void mupdf_error_callback(void *user, const char *message) {
 }
 
 static void add_edge(edge_array* arr, double x0, double y0, double x1, double y1, char orientation) {
+    if (arr->max > 0 && arr->count >= arr->max) {
+        arr->dropped++;
+        return;
+    }
     if (arr->count >= arr->capacity) {
         int new_cap = arr->capacity == 0 ? 64 : arr->capacity * 2;
         edge* new_items = realloc(arr->items, new_cap * sizeof(edge));
@@ -51,38 +72,211 @@ static void add_edge(edge_array* arr, double x0, double y0, double x1, double y1
     e->orientation = orientation;
 }
 
+static void add_figure(figure_array* arr, fz_rect bbox, const char* alt, const char* image) {
+    if (arr->count >= arr->capacity) {
+        int new_cap = arr->capacity == 0 ? 8 : arr->capacity * 2;
+        ffigure* new_items = realloc(arr->items, new_cap * sizeof(ffigure));
+        if (!new_items)
+            return;
+        arr->items = new_items;
+        arr->capacity = new_cap;
+    }
+
+    ffigure* f = &arr->items[arr->count++];
+    f->bbox_x0 = bbox.x0;
+    f->bbox_y0 = bbox.y0;
+    f->bbox_x1 = bbox.x1;
+    f->bbox_y1 = bbox.y1;
+    f->alt = alt ? strdup(alt) : NULL;
+    f->image = image ? strdup(image) : NULL;
+}
+
+// fz_intersect_rect treats zero-height lines as empty, so clip by hand
+static int clip_to(fz_rect* r, fz_rect clip) {
+    r->x0 = r->x0 > clip.x0 ? r->x0 : clip.x0;
+    r->y0 = r->y0 > clip.y0 ? r->y0 : clip.y0;
+    r->x1 = r->x1 < clip.x1 ? r->x1 : clip.x1;
+    r->y1 = r->y1 < clip.y1 ? r->y1 : clip.y1;
+    return r->x0 <= r->x1 && r->y0 <= r->y1;
+}
+
+static const char* current_alt(page_capture_device* pdev) {
+    int depth = pdev->metatext_depth < METATEXT_MAX_DEPTH ? pdev->metatext_depth : METATEXT_MAX_DEPTH;
+    for (int i = depth - 1; i >= 0; i--)
+        if (pdev->metatext[i])
+            return pdev->metatext[i];
+    return NULL;
+}
+
 static void capture_stroke_path(fz_context* ctx, fz_device* dev, const fz_path* path, const fz_stroke_state* stroke,
                                 fz_matrix ctm, fz_colorspace* cs, const float* color, float alpha, fz_color_params cp) {
     (void)cs; (void)color; (void)alpha; (void)cp;
 
-    edge_capture_device* edev = (edge_capture_device*)dev;
+    page_capture_device* pdev = (page_capture_device*)dev;
     if (stroke && stroke->linewidth > EDGE_MAX_WIDTH)
         return;
 
     fz_rect bbox = fz_bound_path(ctx, path, stroke, ctm);
+    if (!clip_to(&bbox, pdev->clip))
+        return;
     double width = bbox.x1 - bbox.x0;
     double height = bbox.y1 - bbox.y0;
 
     if (height <= EDGE_MAX_WIDTH && width >= EDGE_MIN_LENGTH)
-        add_edge(edev->edges, bbox.x0, bbox.y0, bbox.x1, bbox.y0, 'h');
+        add_edge(pdev->edges, bbox.x0, bbox.y0, bbox.x1, bbox.y0, 'h');
     else if (width <= EDGE_MAX_WIDTH && height >= EDGE_MIN_LENGTH)
-        add_edge(edev->edges, bbox.x0, bbox.y0, bbox.x0, bbox.y1, 'v');
+        add_edge(pdev->edges, bbox.x0, bbox.y0, bbox.x0, bbox.y1, 'v');
 }
 
 static void capture_fill_path(fz_context* ctx, fz_device* dev, const fz_path* path, int even_odd, fz_matrix ctm,
                               fz_colorspace* cs, const float* color, float alpha, fz_color_params cp) {
     (void)even_odd; (void)cs; (void)color; (void)alpha; (void)cp;
 
-    edge_capture_device* edev = (edge_capture_device*)dev;
+    page_capture_device* pdev = (page_capture_device*)dev;
     fz_rect bbox = fz_bound_path(ctx, path, NULL, ctm);
+    if (!clip_to(&bbox, pdev->clip))
+        return;
     double width = bbox.x1 - bbox.x0;
     double height = bbox.y1 - bbox.y0;
 
     if (width > 0 && height > 0) {
-        add_edge(edev->edges, bbox.x0, bbox.y0, bbox.x1, bbox.y0, 'h');
-        add_edge(edev->edges, bbox.x0, bbox.y1, bbox.x1, bbox.y1, 'h');
-        add_edge(edev->edges, bbox.x0, bbox.y0, bbox.x0, bbox.y1, 'v');
-        add_edge(edev->edges, bbox.x1, bbox.y0, bbox.x1, bbox.y1, 'v');
+        add_edge(pdev->edges, bbox.x0, bbox.y0, bbox.x1, bbox.y0, 'h');
+        add_edge(pdev->edges, bbox.x0, bbox.y1, bbox.x1, bbox.y1, 'h');
+        add_edge(pdev->edges, bbox.x0, bbox.y0, bbox.x0, bbox.y1, 'v');
+        add_edge(pdev->edges, bbox.x1, bbox.y0, bbox.x1, bbox.y1, 'v');
+    }
+}
+
+// how much to shrink img, drawn over bbox, to keep it within the pixel and
+// resolution limits; resolution is measured along the longer sides
+static float image_scale(fz_image* img, fz_rect bbox, const extract_options* opts) {
+    float scale = 1;
+    int longer = img->w > img->h ? img->w : img->h;
+    if (opts->image_max_size > 0 && longer > opts->image_max_size)
+        scale = (float)opts->image_max_size / longer;
+    float w = bbox.x1 - bbox.x0, h = bbox.y1 - bbox.y0;
+    float inches = (w > h ? w : h) / 72;
+    if (opts->image_max_dpi > 0 && inches > 0 && longer / inches > opts->image_max_dpi) {
+        float s = opts->image_max_dpi * inches / longer;
+        if (s < scale)
+            scale = s;
+    }
+    return scale;
+}
+
+// composites pix, which must have alpha, over white into a new pixmap without
+// it, since jpeg has no transparency and dropping the premultiplied alpha
+// would leave transparent areas black
+static fz_pixmap* flatten_alpha(fz_context* ctx, fz_pixmap* pix) {
+    int w = fz_pixmap_width(ctx, pix), h = fz_pixmap_height(ctx, pix), n = fz_pixmap_components(ctx, pix);
+    fz_pixmap* out = fz_new_pixmap(ctx, fz_pixmap_colorspace(ctx, pix), w, h, NULL, 0);
+    unsigned char* src = fz_pixmap_samples(ctx, pix);
+    unsigned char* dst = fz_pixmap_samples(ctx, out);
+    ptrdiff_t src_stride = fz_pixmap_stride(ctx, pix), dst_stride = fz_pixmap_stride(ctx, out);
+    for (int y = 0; y < h; y++) {
+        unsigned char* s = src + y * src_stride;
+        unsigned char* d = dst + y * dst_stride;
+        for (int x = 0; x < w; x++, s += n) {
+            for (int c = 0; c < n - 1; c++)
+                *d++ = s[c] + 255 - s[n - 1];
+        }
+    }
+    return out;
+}
+
+// replaces *pix with next, unless next is NULL
+static void swap_pixmap(fz_context* ctx, fz_pixmap** pix, fz_pixmap* next) {
+    if (!next)
+        return;
+    fz_drop_pixmap(ctx, *pix);
+    *pix = next;
+}
+
+// writes img, drawn over bbox, as <prefix>_img_NN.png or .jpg, shrunk to the
+// limits in opts; returns 0 if it could not be encoded
+static int save_image(fz_context* ctx, fz_image* img, fz_rect bbox, const extract_options* opts, const char* prefix,
+                      int index, char* path, size_t size) {
+    fz_pixmap* pix = NULL;
+    fz_buffer* buf = NULL;
+    int saved = 0;
+    int jpeg = opts->image_format == IMAGE_JPEG;
+    fz_var(pix);
+    fz_var(buf);
+    snprintf(path, size, "%s_img_%02d.%s", prefix, index, jpeg ? "jpg" : "png");
+    fz_try(ctx) {
+        float scale = image_scale(img, bbox, opts);
+        if (!jpeg && scale >= 1) {
+            buf = fz_new_buffer_from_image_as_png(ctx, img, fz_default_color_params);
+        } else {
+            pix = fz_get_pixmap_from_image(ctx, img, NULL, NULL, NULL, NULL);
+            if (scale < 1) {
+                int w = fz_pixmap_width(ctx, pix) * scale, h = fz_pixmap_height(ctx, pix) * scale;
+                swap_pixmap(ctx, &pix, fz_scale_pixmap(ctx, pix, 0, 0, w > 0 ? w : 1, h > 0 ? h : 1, NULL));
+            }
+            // both writers take only gray or rgb
+            fz_colorspace* cs = fz_pixmap_colorspace(ctx, pix);
+            if (!cs)
+                fz_throw(ctx, FZ_ERROR_ARGUMENT, "image has no colorspace");
+            if (!fz_colorspace_is_gray(ctx, cs) && !fz_colorspace_is_rgb(ctx, cs))
+                swap_pixmap(ctx, &pix, fz_convert_pixmap(ctx, pix, fz_device_rgb(ctx), NULL, NULL, fz_default_color_params, 1));
+            if (jpeg) {
+                if (fz_pixmap_alpha(ctx, pix))
+                    swap_pixmap(ctx, &pix, flatten_alpha(ctx, pix));
+                int quality = opts->jpeg_quality > 0 ? opts->jpeg_quality : JPEG_DEFAULT_QUALITY;
+                buf = fz_new_buffer_from_pixmap_as_jpeg(ctx, pix, fz_default_color_params, quality, 0);
+            } else {
+                buf = fz_new_buffer_from_pixmap_as_png(ctx, pix, fz_default_color_params);
+            }
+        }
+        fz_save_buffer(ctx, buf, path);
+        saved = 1;
+    }
+    fz_always(ctx) {
+        fz_drop_buffer(ctx, buf);
+        fz_drop_pixmap(ctx, pix);
+    }
+    fz_catch(ctx) {
+        saved = 0;
+    }
+    return saved;
+}
+
+static void capture_fill_image(fz_context* ctx, fz_device* dev, fz_image* img, fz_matrix ctm, float alpha,
+                               fz_color_params cp) {
+    (void)alpha; (void)cp;
+
+    page_capture_device* pdev = (page_capture_device*)dev;
+    fz_rect drawn = fz_transform_rect(fz_unit_rect, ctm);
+    fz_rect bbox = drawn;
+    if (!clip_to(&bbox, pdev->clip))
+        return;
+    if (bbox.x1 - bbox.x0 < FIGURE_MIN_SIZE || bbox.y1 - bbox.y0 < FIGURE_MIN_SIZE)
+        return;
+    char path[600];
+    int saved = pdev->image_prefix && save_image(ctx, img, drawn, pdev->opts, pdev->image_prefix,
+                                                 pdev->figures->count + 1, path, sizeof(path));
+    add_figure(pdev->figures, bbox, current_alt(pdev), saved ? path : NULL);
+}
+
+static void capture_begin_metatext(fz_context* ctx, fz_device* dev, fz_metatext meta, const char* text) {
+    (void)ctx;
+
+    page_capture_device* pdev = (page_capture_device*)dev;
+    if (pdev->metatext_depth < METATEXT_MAX_DEPTH)
+        pdev->metatext[pdev->metatext_depth] = (meta == FZ_METATEXT_ALT && text && *text) ? strdup(text) : NULL;
+    pdev->metatext_depth++;
+}
+
+static void capture_end_metatext(fz_context* ctx, fz_device* dev) {
+    (void)ctx;
+
+    page_capture_device* pdev = (page_capture_device*)dev;
+    if (pdev->metatext_depth == 0)
+        return;
+    pdev->metatext_depth--;
+    if (pdev->metatext_depth < METATEXT_MAX_DEPTH) {
+        free(pdev->metatext[pdev->metatext_depth]);
+        pdev->metatext[pdev->metatext_depth] = NULL;
     }
 }
 
@@ -91,28 +285,48 @@ static void capture_close_device(fz_context* ctx, fz_device* dev) {
 }
 
 static void capture_drop_device(fz_context* ctx, fz_device* dev) {
-    (void)ctx; (void)dev;
+    (void)ctx;
+
+    page_capture_device* pdev = (page_capture_device*)dev;
+    int depth = pdev->metatext_depth < METATEXT_MAX_DEPTH ? pdev->metatext_depth : METATEXT_MAX_DEPTH;
+    for (int i = 0; i < depth; i++)
+        free(pdev->metatext[i]);
+    pdev->metatext_depth = 0;
 }
 
-static int capture_page_edges(fz_context* ctx, fz_page* page, edge_array* edges) {
-    if (!ctx || !page || !edges)
+static int capture_page_content(fz_context* ctx, fz_page* page, fz_matrix ctm, fz_rect clip, edge_array* edges,
+                                figure_array* figures, const char* image_prefix, const extract_options* opts,
+                                fz_cookie* cookie) {
+    if (!ctx || !page || !edges || !figures)
         return ERR_GENERIC;
 
     edges->items = NULL;
     edges->count = 0;
     edges->capacity = 0;
+    edges->max = opts->max_edges;
+    edges->dropped = 0;
+    figures->items = NULL;
+    figures->count = 0;
+    figures->capacity = 0;
 
     fz_device* dev = NULL;
     fz_try(ctx) {
-        edge_capture_device* edev = fz_new_derived_device(ctx, edge_capture_device);
-        dev = &edev->super;
-        edev->edges = edges;
+        page_capture_device* pdev = fz_new_derived_device(ctx, page_capture_device);
+        dev = &pdev->super;
+        pdev->edges = edges;
+        pdev->figures = figures;
+        pdev->clip = clip;
+        pdev->image_prefix = image_prefix;
+        pdev->opts = opts;
         dev->close_device = capture_close_device;
         dev->drop_device = capture_drop_device;
         dev->stroke_path = capture_stroke_path;
         dev->fill_path = capture_fill_path;
+        dev->fill_image = capture_fill_image;
+        dev->begin_metatext = capture_begin_metatext;
+        dev->end_metatext = capture_end_metatext;
 
-        fz_run_page(ctx, page, dev, fz_identity, NULL);
+        fz_run_page(ctx, page, dev, ctm, cookie);
         fz_close_device(ctx, dev);
     }
     fz_always(ctx) {
@@ -132,44 +346,151 @@ static void free_edge_array(edge_array* edges) {
     edges->items = NULL;
     edges->count = 0;
     edges->capacity = 0;
+    edges->max = opts->max_edges;
+    edges->dropped = 0;
+}
+
+static void free_figure_array(figure_array* figures) {
+    if (!figures)
+        return;
+    for (int i = 0; i < figures->count; i++) {
+        free(figures->items[i].alt);
+        free(figures->items[i].image);
+    }
+    free(figures->items);
+    figures->items = NULL;
+    figures->count = 0;
+    figures->capacity = 0;
+}
+
+// the font's advance for the glyph, falling back to the distance to the next
+// pen position and then to the glyph box when the font has no usable cmap
+static float char_advance(fz_context* ctx, fz_stext_char* ch, fz_rect bbox) {
+    if (ch->font) {
+        int gid = fz_encode_character(ctx, ch->font, ch->c);
+        if (gid > 0)
+            return fz_advance_glyph(ctx, ch->font, gid, 0) * ch->size;
+    }
+    if (ch->next) {
+        float dx = ch->next->origin.x - ch->origin.x;
+        if (dx > 0 && dx < ch->size * 2)
+            return dx;
+    }
+    return bbox.x1 - bbox.x0;
+}
+
+static const char* ligature_letters(int c) {
+    switch (c) {
+    case 0xFB00:
+        return "ff";
+    case 0xFB01:
+        return "fi";
+    case 0xFB02:
+        return "fl";
+    case 0xFB03:
+        return "ffi";
+    case 0xFB04:
+        return "ffl";
+    case 0xFB05:
+    case 0xFB06:
+        return "st";
+    default:
+        return NULL;
+    }
 }
 
-static void write_char_data(FILE* out, fz_context* ctx, fz_stext_block* block) {
+// number of raw chars written for ch
+static int char_units(fz_stext_char* ch, int split_ligatures) {
+    const char* letters = split_ligatures ? ligature_letters(ch->c) : NULL;
+    return letters ? (int)strlen(letters) : 1;
+}
+
+// splits a ligature's box, origin and advance evenly between its letters
+static void write_ligature(FILE* out, const fchar* rc, const char* letters) {
+    int n = strlen(letters);
+    float w = (rc->bbox_x1 - rc->bbox_x0) / n, adv = rc->advance / n;
+    for (int i = 0; i < n; i++) {
+        fchar part = *rc;
+        part.codepoint = letters[i];
+        part.bbox_x0 = rc->bbox_x0 + w * i;
+        part.bbox_x1 = part.bbox_x0 + w;
+        part.origin_x = rc->origin_x + adv * i;
+        part.advance = adv;
+        fwrite(&part, sizeof(fchar), 1, out);
+    }
+}
+
+static void write_char_data(FILE* out, fz_context* ctx, fz_stext_block* block, int split_ligatures) {
     for (fz_stext_line* line = block->u.t.first_line; line; line = line->next) {
         for (fz_stext_char* ch = line->first_char; ch; ch = ch->next) {
             fchar rc = {0};
             rc.codepoint = ch->c;
             rc.size = ch->size;
+            rc.origin_x = ch->origin.x;
+            rc.origin_y = ch->origin.y;
 
             fz_rect char_bbox = fz_rect_from_quad(ch->quad);
             rc.bbox_x0 = char_bbox.x0;
             rc.bbox_y0 = char_bbox.y0;
             rc.bbox_x1 = char_bbox.x1;
             rc.bbox_y1 = char_bbox.y1;
+            rc.advance = char_advance(ctx, ch, char_bbox);
 
             rc.is_bold = (ch->font && fz_font_is_bold(ctx, ch->font)) ? 1 : 0;
             rc.is_italic = (ch->font && fz_font_is_italic(ctx, ch->font)) ? 1 : 0;
             rc.is_monospaced = (ch->font && fz_font_is_monospaced(ctx, ch->font)) ? 1 : 0;
 
-            fwrite(&rc, sizeof(fchar), 1, out);
+            const char* letters = split_ligatures ? ligature_letters(ch->c) : NULL;
+            if (letters)
+                write_ligature(out, &rc, letters);
+            else
+                fwrite(&rc, sizeof(fchar), 1, out);
         }
     }
 }
 
-static void count_content(fz_stext_page* stext, int* blocks, int* lines, int* chars) {
+// counts the content of the blocks before end (NULL for all of them)
+static void count_content(fz_stext_page* stext, fz_stext_block* end, int* blocks, int* lines, int* chars,
+                          int split_ligatures) {
     *blocks = *lines = *chars = 0;
-    for (fz_stext_block* block = stext->first_block; block; block = block->next) {
+    for (fz_stext_block* block = stext->first_block; block != end; block = block->next) {
         (*blocks)++;
         if (block->type == FZ_STEXT_BLOCK_TEXT) {
             for (fz_stext_line* line = block->u.t.first_line; line; line = line->next) {
                 (*lines)++;
                 for (fz_stext_char* ch = line->first_char; ch; ch = ch->next)
-                    (*chars)++;
+                    *chars += char_units(ch, split_ligatures);
             }
         }
     }
 }
 
+// returns the first block that would take the page past max_chars, or NULL
+// if it stays within them (or there is no limit), with the chars it leaves
+// out in *dropped
+static fz_stext_block* char_limit(fz_stext_page* stext, int max_chars, int split_ligatures, int* dropped) {
+    *dropped = 0;
+    if (max_chars <= 0)
+        return NULL;
+    int kept = 0;
+    fz_stext_block* end = NULL;
+    for (fz_stext_block* block = stext->first_block; block; block = block->next) {
+        if (block->type != FZ_STEXT_BLOCK_TEXT)
+            continue;
+        int chars = 0;
+        for (fz_stext_line* line = block->u.t.first_line; line; line = line->next)
+            for (fz_stext_char* ch = line->first_char; ch; ch = ch->next)
+                chars += char_units(ch, split_ligatures);
+        if (!end && kept + chars > max_chars)
+            end = block;
+        if (end)
+            *dropped += chars;
+        else
+            kept += chars;
+    }
+    return end;
+}
+
 static int count_links(fz_link* links) {
     int count = 0;
     for (fz_link* l = links; l; l = l->next)
@@ -177,33 +498,302 @@ static int count_links(fz_link* links) {
     return count;
 }
 
-static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num, const char* output_path) {
+#define PAGE_FONTS_MAX 256
+#define FONT_RESOURCE_DEPTH 8
+
+// the fonts the text of a page was drawn with, and what their PDF resources
+// say about them
+typedef struct page_fonts
+{
+    fz_font* used[PAGE_FONTS_MAX];
+    int used_count;
+    ffont found[PAGE_FONTS_MAX];
+    int found_count;
+} page_fonts;
+
+static int font_used(const page_fonts* pf, fz_font* font) {
+    for (int i = 0; i < pf->used_count; i++)
+        if (pf->used[i] == font)
+            return 1;
+    return 0;
+}
+
+// records the fonts of rdb, and of the forms it draws, that were used for
+// text, each once
+static void collect_resource_fonts(fz_context* ctx, pdf_document* doc, pdf_obj* rdb, page_fonts* pf, int depth) {
+    if (!rdb || depth > FONT_RESOURCE_DEPTH || pdf_mark_obj(ctx, rdb))
+        return;
+    fz_try(ctx) {
+        pdf_obj* fonts = pdf_dict_get(ctx, rdb, PDF_NAME(Font));
+        for (int i = 0, n = pdf_dict_len(ctx, fonts); i < n && pf->found_count < PAGE_FONTS_MAX; i++) {
+            pdf_obj* obj = pdf_dict_get_val(ctx, fonts, i);
+            pdf_font_desc* desc = NULL;
+            fz_try(ctx) desc = pdf_load_font(ctx, doc, rdb, obj);
+            fz_catch(ctx) continue;
+            fz_font* font = desc->font;
+            int seen = 0;
+            for (int j = 0; j < pf->found_count && !seen; j++)
+                seen = pf->found[j].font == font;
+            if (font && !seen && font_used(pf, font)) {
+                ffont* f = &pf->found[pf->found_count++];
+                const char* name = pdf_dict_get_name(ctx, obj, PDF_NAME(BaseFont));
+                f->font = font;
+                f->name = strdup(name && *name ? name : pdf_to_name(ctx, pdf_dict_get_key(ctx, fonts, i)));
+                f->embedded = desc->is_embedded || pdf_name_eq(ctx, pdf_dict_get(ctx, obj, PDF_NAME(Subtype)), PDF_NAME(Type3));
+                f->substituted = fz_font_flags(font)->ft_substitute;
+            }
+            pdf_drop_font(ctx, desc);
+        }
+        pdf_obj* xobjects = pdf_dict_get(ctx, rdb, PDF_NAME(XObject));
+        for (int i = 0, n = pdf_dict_len(ctx, xobjects); i < n; i++) {
+            pdf_obj* xobj = pdf_dict_get_val(ctx, xobjects, i);
+            if (pdf_name_eq(ctx, pdf_dict_get(ctx, xobj, PDF_NAME(Subtype)), PDF_NAME(Form)))
+                collect_resource_fonts(ctx, doc, pdf_dict_get(ctx, xobj, PDF_NAME(Resources)), pf, depth + 1);
+        }
+    }
+    fz_always(ctx) pdf_unmark_obj(ctx, rdb);
+    fz_catch(ctx) {
+        // a broken resource dictionary leaves its fonts out of the report
+    }
+}
+
+// finds the fonts the text of page before end was drawn with, for
+// write_page_fonts; none for documents other than PDFs
+static void find_page_fonts(fz_context* ctx, fz_page* page, fz_stext_page* stext, fz_stext_block* end, page_fonts* pf) {
+    for (fz_stext_block* block = stext->first_block; block != end; block = block->next) {
+        if (block->type != FZ_STEXT_BLOCK_TEXT)
+            continue;
+        for (fz_stext_line* line = block->u.t.first_line; line; line = line->next)
+            for (fz_stext_char* ch = line->first_char; ch; ch = ch->next)
+                if (ch->font && pf->used_count < PAGE_FONTS_MAX && !font_used(pf, ch->font))
+                    pf->used[pf->used_count++] = ch->font;
+    }
+    pdf_page* ppage = pdf_page_from_fz_page(ctx, page);
+    if (ppage && pf->used_count > 0)
+        collect_resource_fonts(ctx, ppage->doc, pdf_page_resources(ctx, ppage), pf, 0);
+}
+
+// writes the count of fonts, then for each its name as a length and bytes and
+// whether it was embedded and substituted as a byte each
+static void write_page_fonts(FILE* out, const page_fonts* pf) {
+    fwrite(&pf->found_count, sizeof(int), 1, out);
+    for (int i = 0; i < pf->found_count; i++) {
+        const ffont* f = &pf->found[i];
+        int name_len = f->name ? strlen(f->name) : 0;
+        fwrite(&name_len, sizeof(int), 1, out);
+        if (name_len > 0)
+            fwrite(f->name, 1, name_len, out);
+        fwrite(&f->embedded, 1, 1, out);
+        fwrite(&f->substituted, 1, 1, out);
+    }
+}
+
+static void free_page_fonts(page_fonts* pf) {
+    for (int i = 0; i < pf->found_count; i++)
+        free(pf->found[i].name);
+    pf->found_count = 0;
+}
+
+static int page_rotation(fz_context* ctx, fz_page* page) {
+    pdf_page* pdfpage = pdf_page_from_fz_page(ctx, page);
+    if (!pdfpage)
+        return 0;
+    int rotate = pdf_to_int(ctx, pdf_dict_get_inheritable(ctx, pdfpage->obj, PDF_NAME(Rotate)));
+    rotate = ((rotate % 360) + 360) % 360;
+    return rotate - rotate % 90;
+}
+
+// the areas of page under redaction annotations that have not been applied,
+// so the text there is still in the content: each quad of one, or its rect if
+// it has none, transformed by ctm. NULL with a count of 0 for none.
+static fz_rect* page_redactions(fz_context* ctx, fz_page* page, fz_matrix ctm, int* count) {
+    *count = 0;
+    pdf_page* ppage = pdf_page_from_fz_page(ctx, page);
+    if (!ppage)
+        return NULL;
+    int n = 0;
+    for (pdf_annot* a = pdf_first_annot(ctx, ppage); a; a = pdf_next_annot(ctx, a)) {
+        if (pdf_annot_type(ctx, a) == PDF_ANNOT_REDACT) {
+            int quads = pdf_annot_quad_point_count(ctx, a);
+            n += quads > 0 ? quads : 1;
+        }
+    }
+    if (n == 0)
+        return NULL;
+    fz_rect* rects = fz_malloc_array(ctx, n, fz_rect);
+    for (pdf_annot* a = pdf_first_annot(ctx, ppage); a; a = pdf_next_annot(ctx, a)) {
+        if (pdf_annot_type(ctx, a) != PDF_ANNOT_REDACT)
+            continue;
+        int quads = pdf_annot_quad_point_count(ctx, a);
+        if (quads == 0)
+            rects[(*count)++] = fz_transform_rect(pdf_bound_annot(ctx, a), ctm);
+        for (int i = 0; i < quads; i++)
+            rects[(*count)++] = fz_transform_rect(fz_rect_from_quad(pdf_annot_quad_point(ctx, a, i)), ctm);
+    }
+    return rects;
+}
+
+static int in_zones(fz_rect r, const fz_rect* zones, int count) {
+    float cx = (r.x0 + r.x1) / 2, cy = (r.y0 + r.y1) / 2;
+    for (int i = 0; i < count; i++)
+        if (cx >= zones[i].x0 && cx <= zones[i].x1 && cy >= zones[i].y0 && cy <= zones[i].y1)
+            return 1;
+    return 0;
+}
+
+// unlinks the chars of stext centred in any of zones, as withoutZones does in
+// Go, so the text under unapplied redactions never reaches the raw file. Lines
+// and text blocks shrink to the chars they keep and go if none are left.
+// Returns the raw chars left out.
+static int drop_redacted(fz_stext_page* stext, const fz_rect* zones, int count, int split_ligatures) {
+    int dropped = 0;
+    for (fz_stext_block *block = stext->first_block, *next_block; block; block = next_block) {
+        next_block = block->next;
+        if (block->type != FZ_STEXT_BLOCK_TEXT)
+            continue;
+        int block_changed = 0;
+        fz_rect block_bbox = fz_empty_rect;
+        for (fz_stext_line *line = block->u.t.first_line, *next_line; line; line = next_line) {
+            next_line = line->next;
+            fz_stext_char** link = &line->first_char;
+            fz_stext_char* last = NULL;
+            fz_rect line_bbox = fz_empty_rect;
+            int changed = 0;
+            for (fz_stext_char* ch = line->first_char; ch; ch = ch->next) {
+                fz_rect r = fz_rect_from_quad(ch->quad);
+                if (in_zones(r, zones, count)) {
+                    dropped += char_units(ch, split_ligatures);
+                    changed = 1;
+                    continue;
+                }
+                *link = ch;
+                link = &ch->next;
+                last = ch;
+                line_bbox = fz_union_rect(line_bbox, r);
+            }
+            *link = NULL;
+            line->last_char = last;
+            if (!changed) {
+                block_bbox = fz_union_rect(block_bbox, line->bbox);
+                continue;
+            }
+            block_changed = 1;
+            if (last) {
+                line->bbox = line_bbox;
+                block_bbox = fz_union_rect(block_bbox, line_bbox);
+                continue;
+            }
+            if (line->prev)
+                line->prev->next = line->next;
+            else
+                block->u.t.first_line = line->next;
+            if (line->next)
+                line->next->prev = line->prev;
+            else
+                block->u.t.last_line = line->prev;
+        }
+        if (!block_changed)
+            continue;
+        if (block->u.t.first_line) {
+            block->bbox = block_bbox;
+            continue;
+        }
+        if (block->prev)
+            block->prev->next = block->next;
+        else
+            stext->first_block = block->next;
+        if (block->next)
+            block->next->prev = block->prev;
+        else
+            stext->last_block = block->prev;
+    }
+    return dropped;
+}
+
+// returns ERR_TIMEOUT if cookie was aborted before the page was written
+static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num, const char* output_path,
+                                const extract_options* eopts, fz_cookie* cookie) {
     fz_page* page = NULL;
     fz_stext_page* stext = NULL;
+    fz_device* stext_dev = NULL;
     fz_link* page_links = NULL;
     FILE* out = NULL;
     int status = 0;
     edge_array edges = {0};
+    figure_array figures = {0};
+    fz_rect* redactions = NULL;
+    int redaction_count = 0;
+    page_fonts* fonts = NULL;
+    char tmp_path[520];
 
     fz_try(ctx) {
         page = fz_load_page(ctx, doc, page_num);
-        fz_rect bounds = fz_bound_page(ctx, page);
-
-        capture_page_edges(ctx, page, &edges);
+        // the crop box (or whichever box was asked for) bounds everything we emit,
+        // so printer marks and bleed content outside it never reach the output
+        fz_rect box = fz_bound_page_box(ctx, page, (fz_box_type)eopts->page_box);
+        if (fz_is_empty_rect(box))
+            box = fz_bound_page(ctx, page);
+
+        // fz_run_page already applies /Rotate through the page transform, so the box is in
+        // display orientation; shift it to the origin so every page shares one coordinate space
+        int rotation = page_rotation(ctx, page);
+        fz_matrix ctm = fz_translate(-box.x0, -box.y0);
+        fz_rect bounds = fz_transform_rect(box, ctm);
+
+        // figure images share the raw file's name: page_001.raw -> page_001_img_01.png (or .jpg)
+        char image_prefix[512];
+        snprintf(image_prefix, sizeof(image_prefix), "%.*s", (int)strlen(output_path) - 4, output_path);
+        capture_page_content(ctx, page, ctm, bounds, &edges, &figures, eopts->extract_images ? image_prefix : NULL,
+                             eopts, cookie);
         page_links = fz_load_links(ctx, page);
+        redactions = page_redactions(ctx, page, ctm, &redaction_count);
 
         fz_stext_options opts = {0};
-        opts.flags = FZ_STEXT_CLIP | FZ_STEXT_ACCURATE_BBOXES | FZ_STEXT_COLLECT_STYLES;
-        stext = fz_new_stext_page_from_page(ctx, page, &opts);
+        // without PRESERVE_LIGATURES MuPDF expands ﬁ itself, giving the i no
+        // advance; keep the glyph so write_ligature can share it out, or so it
+        // stays whole when splitting is off
+        opts.flags = FZ_STEXT_CLIP | FZ_STEXT_CLIP_RECT | FZ_STEXT_ACCURATE_BBOXES | FZ_STEXT_COLLECT_STYLES |
+                     FZ_STEXT_PRESERVE_LIGATURES;
+        opts.clip = bounds;
+        stext = fz_new_stext_page(ctx, bounds);
+        stext_dev = fz_new_stext_device(ctx, stext, &opts);
+        fz_run_page(ctx, page, stext_dev, ctm, cookie);
+        fz_close_device(ctx, stext_dev);
+        // an aborted run stops quietly, leaving the page half read
+        if (cookie->abort)
+            fz_throw(ctx, FZ_ERROR_GENERIC, "page timed out");
+
+        int redacted_chars = 0;
+        if (!eopts->keep_redacted && redaction_count > 0)
+            redacted_chars = drop_redacted(stext, redactions, redaction_count, eopts->split_ligatures);
+
+        // pathological pages (millions of glyphs or hairlines) are cut down
+        // here so they cannot exhaust memory further on
+        int dropped_chars, dropped_edges = 0;
+        fz_stext_block* end = char_limit(stext, eopts->max_chars, eopts->split_ligatures, &dropped_chars);
+        if (edges.dropped > 0) {
+            dropped_edges = edges.count + edges.dropped;
+            edges.count = 0;
+        }
+
+        fonts = fz_malloc_struct(ctx, page_fonts);
+        find_page_fonts(ctx, page, stext, end, fonts);
 
         int total_blocks, total_lines, total_chars;
-        count_content(stext, &total_blocks, &total_lines, &total_chars);
+        count_content(stext, end, &total_blocks, &total_lines, &total_chars, eopts->split_ligatures);
         int link_count = count_links(page_links);
 
-        out = fopen(output_path, "wb");
+        // written under a temporary name so an interrupted run never leaves a
+        // truncated page behind for a resumed one to pick up
+        snprintf(tmp_path, sizeof(tmp_path), "%s.tmp", output_path);
+        out = compat_fopen(tmp_path, "wb");
         if (!out)
             fz_throw(ctx, FZ_ERROR_GENERIC, "cannot open output file");
 
+        char label[PAGE_LABEL_MAX] = {0};
+        fz_page_label(ctx, page, label, sizeof(label));
+        int label_len = strlen(label);
+
         int page_number = page_num + 1;
         fwrite(&page_number, sizeof(int), 1, out);
         fwrite(&bounds, sizeof(fz_rect), 1, out);
@@ -212,9 +802,16 @@ static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num,
         fwrite(&total_chars, sizeof(int), 1, out);
         fwrite(&edges.count, sizeof(int), 1, out);
         fwrite(&link_count, sizeof(int), 1, out);
+        fwrite(&figures.count, sizeof(int), 1, out);
+        fwrite(&label_len, sizeof(int), 1, out);
+        if (label_len > 0)
+            fwrite(label, 1, label_len, out);
+        fwrite(&rotation, sizeof(int), 1, out);
+        fwrite(&dropped_chars, sizeof(int), 1, out);
+        fwrite(&dropped_edges, sizeof(int), 1, out);
 
         int line_idx = 0;
-        for (fz_stext_block* block = stext->first_block; block; block = block->next) {
+        for (fz_stext_block* block = stext->first_block; block != end; block = block->next) {
             fblock rb = {0};
             rb.type = block->type;
             rb.bbox_x0 = block->bbox.x0;
@@ -232,7 +829,7 @@ static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num,
         }
 
         int char_idx = 0;
-        for (fz_stext_block* block = stext->first_block; block; block = block->next) {
+        for (fz_stext_block* block = stext->first_block; block != end; block = block->next) {
             if (block->type == FZ_STEXT_BLOCK_TEXT) {
                 for (fz_stext_line* line = block->u.t.first_line; line; line = line->next) {
                     fline rl = {0};
@@ -243,7 +840,7 @@ static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num,
                     rl.char_start = char_idx;
 
                     for (fz_stext_char* ch = line->first_char; ch; ch = ch->next)
-                        rl.char_count++;
+                        rl.char_count += char_units(ch, eopts->split_ligatures);
                     char_idx += rl.char_count;
 
                     fwrite(&rl, sizeof(fline), 1, out);
@@ -251,15 +848,16 @@ static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num,
             }
         }
 
-        for (fz_stext_block* block = stext->first_block; block; block = block->next)
+        for (fz_stext_block* block = stext->first_block; block != end; block = block->next)
             if (block->type == FZ_STEXT_BLOCK_TEXT)
-                write_char_data(out, ctx, block);
+                write_char_data(out, ctx, block, eopts->split_ligatures);
 
         if (edges.count > 0)
             fwrite(edges.items, sizeof(edge), edges.count, out);
 
         for (fz_link* l = page_links; l; l = l->next) {
-            float rect_x0 = l->rect.x0, rect_y0 = l->rect.y0, rect_x1 = l->rect.x1, rect_y1 = l->rect.y1;
+            fz_rect rect = fz_transform_rect(l->rect, ctm);
+            float rect_x0 = rect.x0, rect_y0 = rect.y0, rect_x1 = rect.x1, rect_y1 = rect.y1;
             fwrite(&rect_x0, sizeof(float), 1, out);
             fwrite(&rect_y0, sizeof(float), 1, out);
             fwrite(&rect_x1, sizeof(float), 1, out);
@@ -272,27 +870,258 @@ static int extract_page_to_file(fz_context* ctx, fz_document* doc, int page_num,
                 fwrite(uri, 1, uri_len, out);
         }
 
+        for (int i = 0; i < figures.count; i++) {
+            ffigure* f = &figures.items[i];
+            fwrite(&f->bbox_x0, sizeof(float), 1, out);
+            fwrite(&f->bbox_y0, sizeof(float), 1, out);
+            fwrite(&f->bbox_x1, sizeof(float), 1, out);
+            fwrite(&f->bbox_y1, sizeof(float), 1, out);
+
+            int alt_len = f->alt ? strlen(f->alt) : 0;
+            fwrite(&alt_len, sizeof(int), 1, out);
+            if (alt_len > 0)
+                fwrite(f->alt, 1, alt_len, out);
+
+            int image_len = f->image ? strlen(f->image) : 0;
+            fwrite(&image_len, sizeof(int), 1, out);
+            if (image_len > 0)
+                fwrite(f->image, 1, image_len, out);
+        }
+
+        fwrite(&redaction_count, sizeof(int), 1, out);
+        if (redaction_count > 0)
+            fwrite(redactions, sizeof(fz_rect), redaction_count, out);
+        write_page_fonts(out, fonts);
+        fwrite(&redacted_chars, sizeof(int), 1, out);
+
         fclose(out);
         out = NULL;
+        if (compat_rename(tmp_path, output_path) != 0)
+            fz_throw(ctx, FZ_ERROR_GENERIC, "cannot rename output file");
     }
     fz_always(ctx) {
         if (out)
             fclose(out);
         if (page_links)
             fz_drop_link(ctx, page_links);
+        if (stext_dev)
+            fz_drop_device(ctx, stext_dev);
         if (stext)
             fz_drop_stext_page(ctx, stext);
         if (page)
             fz_drop_page(ctx, page);
         free_edge_array(&edges);
+        free_figure_array(&figures);
+        fz_free(ctx, redactions);
+        if (fonts)
+            free_page_fonts(fonts);
+        fz_free(ctx, fonts);
     }
     fz_catch(ctx) {
-        status = -1;
+        status = cookie->abort ? ERR_TIMEOUT : -1;
     }
     return status;
 }
 
-static int extract_page_range(const char* pdf_path, const char* output_dir, int start, int end) {
+// whether name is one of the lines of names; never for NULL names
+static int name_listed(const char* names, const char* name) {
+    size_t len = strlen(name);
+    for (const char* s = names; s && *s;) {
+        const char* end = strchr(s, '\n');
+        size_t n = end ? (size_t)(end - s) : strlen(s);
+        if (n == len && !memcmp(s, name, n))
+            return 1;
+        s = end ? end + 1 : s + n;
+    }
+    return 0;
+}
+
+// turns the layers in opts->hide_layers off and those in opts->show_layers
+// on, so every page is run with them that way
+static void set_layers(fz_context* ctx, fz_document* doc, const extract_options* opts) {
+    pdf_document* pdoc = pdf_specifics(ctx, doc);
+    if (!pdoc || (!opts->hide_layers && !opts->show_layers))
+        return;
+    int n = pdf_count_layers(ctx, pdoc);
+    for (int i = 0; i < n; i++) {
+        const char* name = pdf_layer_name(ctx, pdoc, i);
+        if (!name)
+            continue;
+        if (name_listed(opts->hide_layers, name))
+            pdf_enable_layer(ctx, pdoc, i, 0);
+        else if (name_listed(opts->show_layers, name))
+            pdf_enable_layer(ctx, pdoc, i, 1);
+    }
+}
+
+// writes the document's layers to dir/layers, a line of "on" or "off", a tab
+// and the name for each, as set_layers left them; nothing for a document
+// without any
+static void write_layers(fz_context* ctx, fz_document* doc, const char* dir) {
+    pdf_document* pdoc = pdf_specifics(ctx, doc);
+    int n = pdoc ? pdf_count_layers(ctx, pdoc) : 0;
+    if (n <= 0)
+        return;
+    char filename[512];
+    snprintf(filename, sizeof(filename), "%s" PATH_SEP "layers", dir);
+    FILE* out = compat_fopen(filename, "wb");
+    if (!out)
+        return;
+    for (int i = 0; i < n; i++) {
+        const char* name = pdf_layer_name(ctx, pdoc, i);
+        fprintf(out, "%s\t", pdf_layer_is_enabled(ctx, pdoc, i) ? "on" : "off");
+        for (const char* c = name ? name : ""; *c; c++)
+            fputc(*c == '\n' || *c == '\t' ? ' ' : *c, out); // lines and fields stay apart
+        fputc('\n', out);
+    }
+    fclose(out);
+}
+
+// leaves a file named too_many_pages in dir holding the document's page count
+// when it is over opts->max_pages, as the only thing extracted
+static void write_too_many_pages(const char* dir, int count) {
+    char filename[512];
+    snprintf(filename, sizeof(filename), "%s" PATH_SEP "too_many_pages", dir);
+    FILE* out = compat_fopen(filename, "wb");
+    if (!out)
+        return;
+    fprintf(out, "%d", count);
+    fclose(out);
+}
+
+// opens path, unlocking it with opts->password if it is encrypted, with its
+// layers set as opts asks
+static fz_document* open_document(fz_context* ctx, const char* path, const extract_options* opts) {
+    fz_document* doc = fz_open_document(ctx, path);
+    const char* password = opts->password;
+    if (fz_needs_password(ctx, doc) && !fz_authenticate_password(ctx, doc, password ? password : "")) {
+        fz_drop_document(ctx, doc);
+        fz_throw(ctx, FZ_ERROR_ARGUMENT, password ? "wrong password" : "document needs a password");
+    }
+    fz_try(ctx) {
+        set_layers(ctx, doc, opts);
+    }
+    fz_catch(ctx) {
+        fz_drop_document(ctx, doc);
+        fz_rethrow(ctx);
+    }
+    return doc;
+}
+
+// the 0-based page numbers ranges picks out of page_count, in order and each
+// once; all of them for NULL. Throws on a malformed ranges.
+static int* select_pages(fz_context* ctx, const char* ranges, int page_count, int* count) {
+    if (ranges && !fz_is_page_range(ctx, ranges))
+        fz_throw(ctx, FZ_ERROR_ARGUMENT, "invalid page ranges: %s", ranges);
+    char* picked = fz_calloc(ctx, page_count, 1);
+    for (int i = 0; !ranges && i < page_count; i++)
+        picked[i] = 1;
+    const char* s = ranges;
+    int a, b;
+    while (s && (s = fz_parse_page_range(ctx, s, &a, &b, page_count))) {
+        for (int i = a < b ? a : b; i <= (a < b ? b : a); i++)
+            if (i >= 1 && i <= page_count)
+                picked[i - 1] = 1;
+    }
+    int* pages = fz_malloc(ctx, page_count * sizeof(int));
+    *count = 0;
+    for (int i = 0; i < page_count; i++)
+        if (picked[i])
+            pages[(*count)++] = i;
+    fz_free(ctx, picked);
+    return pages;
+}
+
+// a share of the pages, extracted by a forked process, or by a thread on
+// Windows where there is no fork
+typedef struct worker {
+    const char* pdf_path;
+    const char* output_dir;
+    const int* pages; // 0-based
+    int count;
+    const extract_options* opts;
+    fz_cookie cookie;                 // aborts the page being extracted
+    volatile long long page_deadline; // compat_now_ms() past which to abort the page; 0 for none
+    volatile int stop;                // set to give up on the remaining pages
+#ifdef _WIN32
+    HANDLE thread;
+#else
+    pid_t pid;
+#endif
+} worker;
+
+#ifndef _WIN32
+// aborted by SIGALRM when a page runs past its timeout. This is the bridge's
+// only global, and it is only set in the single-threaded worker processes,
+// each of which has its own copy.
+static fz_cookie* alarm_cookie;
+
+static void page_timeout_handler(int sig) {
+    (void)sig;
+    if (alarm_cookie)
+        alarm_cookie->abort = 1;
+}
+#endif
+
+// arms the page timeout, or disarms it for 0. Forked workers time their own
+// pages with SIGALRM; threads have theirs checked by wait_workers.
+static void set_page_timer(worker* w, int ms) {
+#ifdef _WIN32
+    w->page_deadline = ms > 0 ? compat_now_ms() + ms : 0;
+#else
+    (void)w;
+    struct itimerval t = {0};
+    t.it_value.tv_sec = ms / 1000;
+    t.it_value.tv_usec = (ms % 1000) * 1000;
+    setitimer(ITIMER_REAL, &t, NULL);
+#endif
+}
+
+// a page_NNN.timeout file stands in for a page given up on, holding the reason
+static void write_timeout_marker(const char* output_dir, int page_number, const char* reason) {
+    char path[512];
+    snprintf(path, sizeof(path), "%s" PATH_SEP "page_%03d.timeout", output_dir, page_number);
+    FILE* f = compat_fopen(path, "w");
+    if (!f)
+        return;
+    fputs(reason, f);
+    fclose(f);
+}
+
+// rebuilds the cross-reference table of a damaged PDF from its objects, as
+// MuPDF does when it cannot read the one in the file; 0 if doc is not a PDF or
+// it failed
+static int repair_document(fz_context* ctx, fz_document* doc) {
+    pdf_document* pdoc = pdf_specifics(ctx, doc);
+    int ok = 0;
+    if (!pdoc)
+        return 0;
+    fz_var(ok);
+    fz_try(ctx) {
+        pdf_repair_xref(ctx, pdoc);
+        ok = 1;
+    }
+    fz_catch(ctx) {
+        fprintf(stderr, "Warning: repair failed: %s\n", fz_caught_message(ctx));
+    }
+    return ok;
+}
+
+// leaves an empty file named repaired in dir if MuPDF had to repair doc, so
+// the parent learns of repairs made in the workers
+static void mark_repaired(fz_context* ctx, fz_document* doc, const char* dir) {
+    pdf_document* pdoc = pdf_specifics(ctx, doc);
+    if (!pdoc || !pdf_was_repaired(ctx, pdoc))
+        return;
+    char path[512];
+    snprintf(path, sizeof(path), "%s" PATH_SEP "repaired", dir);
+    FILE* f = compat_fopen(path, "w");
+    if (f)
+        fclose(f);
+}
+
+static int extract_page_range(worker* w) {
+    const extract_options* opts = w->opts;
     fz_context* ctx = fz_new_context(NULL, NULL, FZ_STORE_UNLIMITED);
     if (!ctx)
         return -1;
@@ -302,17 +1131,50 @@ static int extract_page_range(const char* pdf_path, const char* output_dir, int
 
     fz_document* doc = NULL;
     int status = 0;
+    int repaired = 0; // the xref is only rebuilt once, on the first page that fails
+
+#ifndef _WIN32
+    alarm_cookie = &w->cookie;
+    struct sigaction sa = {0};
+    sa.sa_handler = page_timeout_handler;
+    sa.sa_flags = SA_RESTART;
+    sigaction(SIGALRM, &sa, NULL);
+#endif
 
     fz_try(ctx) {
         fz_register_document_handlers(ctx);
-        doc = fz_open_document(ctx, pdf_path);
-
-        for (int i = start; i < end; i++) {
-            char filename[512];
-            snprintf(filename, sizeof(filename), "%s/page_%03d.raw", output_dir, i + 1);
-            if (extract_page_to_file(ctx, doc, i, filename) != 0)
+        doc = open_document(ctx, w->pdf_path, opts);
+
+        for (int n = 0; n < w->count && !w->stop; n++) {
+            int i = w->pages[n];
+            char filename[512], marker[512];
+            snprintf(filename, sizeof(filename), "%s" PATH_SEP "page_%03d.raw", w->output_dir, i + 1);
+            if (opts->output_dir && compat_exists(filename))
+                continue;
+            // a page that timed out in an earlier run gets another try
+            snprintf(marker, sizeof(marker), "%s" PATH_SEP "page_%03d.timeout", w->output_dir, i + 1);
+            compat_unlink(marker);
+            memset(&w->cookie, 0, sizeof(w->cookie));
+            set_page_timer(w, opts->page_timeout_ms);
+            int rc = extract_page_to_file(ctx, doc, i, filename, opts, &w->cookie);
+            set_page_timer(w, 0);
+            if (rc != 0 && rc != ERR_TIMEOUT && opts->repair && !repaired && repair_document(ctx, doc)) {
+                repaired = 1;
+                memset(&w->cookie, 0, sizeof(w->cookie));
+                set_page_timer(w, opts->page_timeout_ms);
+                rc = extract_page_to_file(ctx, doc, i, filename, opts, &w->cookie);
+                set_page_timer(w, 0);
+            }
+            if (rc == ERR_TIMEOUT) {
+                fprintf(stderr, "Warning: page %d timed out\n", i + 1);
+                write_timeout_marker(w->output_dir, i + 1, w->stop ? "document timed out" : "page timed out");
+            } else if (rc != 0) {
                 fprintf(stderr, "Warning: failed to extract page %d\n", i + 1);
+                if (opts->repair)
+                    write_timeout_marker(w->output_dir, i + 1, "page is damaged");
+            }
         }
+        mark_repaired(ctx, doc, w->output_dir);
     }
     fz_catch(ctx) {
         status = -1;
@@ -324,16 +1186,116 @@ static int extract_page_range(const char* pdf_path, const char* output_dir, int
     return status;
 }
 
-char* extract_all_pages(const char* pdf_path) {
-    if (!pdf_path)
-        return NULL;
+#ifdef _WIN32
+static DWORD WINAPI worker_thread(LPVOID w) {
+    return (DWORD)extract_page_range(w);
+}
+
+static int start_worker(worker* w) {
+    w->thread = CreateThread(NULL, 0, worker_thread, w, 0, NULL);
+    return w->thread ? 0 : -1;
+}
+
+// 1 once the worker has finished, or was never started
+static int worker_done(worker* w, int block) {
+    if (!w->thread)
+        return 1;
+    long long deadline = w->page_deadline;
+    if (deadline && compat_now_ms() >= deadline)
+        w->cookie.abort = 1;
+    if (WaitForSingleObject(w->thread, block ? INFINITE : 0) != WAIT_OBJECT_0)
+        return 0;
+    CloseHandle(w->thread);
+    w->thread = NULL;
+    return 1;
+}
+
+// a thread cannot be killed safely, so its page is aborted through the cookie
+// and it stops before the next one
+static void stop_worker(worker* w) {
+    w->stop = 1;
+    w->cookie.abort = 1;
+    worker_done(w, 1);
+}
+#else
+static int start_worker(worker* w) {
+    pid_t pid = fork();
+    if (pid < 0) {
+        perror("fork");
+        return -1;
+    }
+    if (pid == 0)
+        exit(extract_page_range(w));
+    w->pid = pid;
+    return 0;
+}
+
+// 1 once the worker has finished, or was never started
+static int worker_done(worker* w, int block) {
+    if (w->pid <= 0)
+        return 1;
+    int wstatus;
+    if (waitpid(w->pid, &wstatus, block ? 0 : WNOHANG) == 0)
+        return 0;
+    w->pid = 0;
+    return 1;
+}
+
+static void stop_worker(worker* w) {
+    if (w->pid > 0)
+        kill(w->pid, SIGKILL);
+    worker_done(w, 1);
+}
+#endif
+
+// waits for the workers; past timeout_ms (if not 0) it stops the ones still
+// running and returns 1. It polls when there is a deadline to check, including
+// the page timeouts of worker threads.
+static int wait_workers(worker* workers, int count, int timeout_ms, int page_timeout_ms) {
+    long long start = compat_now_ms();
+    int poll = timeout_ms > 0;
+#ifdef _WIN32
+    poll = poll || page_timeout_ms > 0;
+#else
+    (void)page_timeout_ms;
+#endif
+    for (;;) {
+        int running = 0;
+        for (int i = 0; i < count; i++)
+            running += !worker_done(&workers[i], !poll);
+        if (!running)
+            return 0;
+        if (timeout_ms > 0 && compat_now_ms() - start >= timeout_ms) {
+            for (int i = 0; i < count; i++)
+                stop_worker(&workers[i]);
+            return 1;
+        }
+        compat_sleep_ms(10);
+    }
+}
 
-    char* temp_dir = malloc(256);
-    if (!temp_dir)
+char* extract_all_pages(const char* pdf_path, const extract_options* opts) {
+    if (!pdf_path)
         return NULL;
 
-    snprintf(temp_dir, 256, ".pymupdfllm_c_%ld_%u", (long)time(NULL), (unsigned)getpid());
-    mkdir(temp_dir, 0755);
+    extract_options defaults = {FZ_CROP_BOX, 1, 0, NULL};
+    if (!opts)
+        opts = &defaults;
+
+    char* temp_dir;
+    if (opts->output_dir) {
+        temp_dir = strdup(opts->output_dir);
+        if (!temp_dir)
+            return NULL;
+        compat_mkdir(temp_dir);
+    } else {
+        // mkdtemp picks a name no other conversion, in this process or another, has
+        temp_dir = strdup(".pymupdfllm_c_XXXXXX");
+        if (!temp_dir || !compat_mkdtemp(temp_dir)) {
+            free(temp_dir);
+            return NULL;
+        }
+    }
 
     fz_context* ctx = fz_new_context(NULL, NULL, FZ_STORE_UNLIMITED);
     fz_set_warning_callback(ctx, mupdf_warning_callback, NULL);
@@ -345,82 +1307,128 @@ char* extract_all_pages(const char* pdf_path) {
     }
 
     fz_document* doc = NULL;
-    int page_count = 0;
+    int page_count = 0; // of the pages selected
+    int* pages = NULL;
     int error = 0;
+    int too_many = 0;
 
+    fz_var(doc);
+    fz_var(pages);
+    fz_var(too_many);
     fz_try(ctx) {
         fz_register_document_handlers(ctx);
-        doc = fz_open_document(ctx, pdf_path);
-        page_count = fz_count_pages(ctx, doc);
+        doc = open_document(ctx, pdf_path, opts);
+        int total = fz_count_pages(ctx, doc);
+        if (opts->max_pages > 0 && total > opts->max_pages) {
+            write_too_many_pages(temp_dir, total);
+            too_many = 1;
+        } else {
+            pages = select_pages(ctx, opts->pages, total, &page_count);
+            write_layers(ctx, doc, temp_dir);
+            mark_repaired(ctx, doc, temp_dir);
+        }
     }
     fz_catch(ctx) {
+        fprintf(stderr, "Error: %s\n", fz_caught_message(ctx));
         error = 1;
     }
 
     if (doc)
         fz_drop_document(ctx, doc);
-    fz_drop_context(ctx);
 
+    if (too_many && !error) {
+        fz_drop_context(ctx);
+        return temp_dir;
+    }
     if (error || page_count == 0) {
+        fz_free(ctx, pages);
+        fz_drop_context(ctx);
         free(temp_dir);
         return NULL;
     }
 
-    int num_cores = sysconf(_SC_NPROCESSORS_ONLN);
-    if (num_cores <= 0)
-        num_cores = 4;
+    int num_workers = opts->workers > 0 ? opts->workers : compat_cpu_count();
+    if (num_workers <= 0)
+        num_workers = 4;
 
-    int pages_per_proc = (page_count + num_cores - 1) / num_cores;
-    pid_t* pids = malloc(num_cores * sizeof(pid_t));
-    if (!pids) {
+    int pages_per_proc = (page_count + num_workers - 1) / num_workers;
+    worker* workers = calloc(num_workers, sizeof(worker));
+    if (!workers) {
+        fz_free(ctx, pages);
+        fz_drop_context(ctx);
         free(temp_dir);
         return NULL;
     }
 
-    for (int i = 0; i < num_cores; i++) {
+    for (int i = 0; i < num_workers; i++) {
         int start = i * pages_per_proc;
         int end = (start + pages_per_proc < page_count) ? start + pages_per_proc : page_count;
         if (start >= page_count)
             break;
 
-        pid_t pid = fork();
-        if (pid < 0) {
-            perror("fork");
-            continue;
-        }
-        if (pid == 0) {
-            int rc = extract_page_range(pdf_path, temp_dir, start, end);
-            exit(rc);
-        }
-        pids[i] = pid;
+        worker* w = &workers[i];
+        w->pdf_path = pdf_path;
+        w->output_dir = temp_dir;
+        w->pages = pages + start;
+        w->count = end - start;
+        w->opts = opts;
+        start_worker(w);
     }
 
-    for (int i = 0; i < num_cores; i++) {
-        if (pids[i] > 0) {
-            int wstatus;
-            waitpid(pids[i], &wstatus, 0);
+    // pages the stopped workers never wrote are marked so the output still lists them
+    if (wait_workers(workers, num_workers, opts->timeout_ms, opts->page_timeout_ms)) {
+        fprintf(stderr, "Warning: extraction timed out\n");
+        for (int n = 0; n < page_count; n++) {
+            int i = pages[n];
+            char filename[512], marker[512];
+            snprintf(filename, sizeof(filename), "%s" PATH_SEP "page_%03d.raw", temp_dir, i + 1);
+            snprintf(marker, sizeof(marker), "%s" PATH_SEP "page_%03d.timeout", temp_dir, i + 1);
+            if (!compat_exists(filename) && !compat_exists(marker))
+                write_timeout_marker(temp_dir, i + 1, "document timed out");
         }
     }
 
-    free(pids);
+    free(workers);
+    fz_free(ctx, pages);
+    fz_drop_context(ctx);
     return temp_dir;
 }
 
+void bridge_free(void* p) {
+    free(p);
+}
+
 int read_page(const char* filepath, page_data* out) {
     if (!filepath || !out)
         return -1;
 
     memset(out, 0, sizeof(page_data));
-    FILE* in = fopen(filepath, "rb");
+    FILE* in = compat_fopen(filepath, "rb");
     if (!in)
         return -1;
 
     fz_rect bounds;
-    int edge_count, link_count;
+    int edge_count, link_count, figure_count, label_len;
     if (fread(&out->page_number, sizeof(int), 1, in) != 1 || fread(&bounds, sizeof(fz_rect), 1, in) != 1 ||
         fread(&out->block_count, sizeof(int), 1, in) != 1 || fread(&out->line_count, sizeof(int), 1, in) != 1 ||
         fread(&out->char_count, sizeof(int), 1, in) != 1 || fread(&edge_count, sizeof(int), 1, in) != 1 ||
-        fread(&link_count, sizeof(int), 1, in) != 1) {
+        fread(&link_count, sizeof(int), 1, in) != 1 || fread(&figure_count, sizeof(int), 1, in) != 1 ||
+        fread(&label_len, sizeof(int), 1, in) != 1 || label_len < 0 || label_len >= PAGE_LABEL_MAX) {
+        fclose(in);
+        return -1;
+    }
+
+    out->page_label = malloc(label_len + 1);
+    if (!out->page_label || fread(out->page_label, 1, label_len, in) != (size_t)label_len) {
+        free_page(out);
+        fclose(in);
+        return -1;
+    }
+    out->page_label[label_len] = '\0';
+
+    if (fread(&out->rotation, sizeof(int), 1, in) != 1 || fread(&out->dropped_chars, sizeof(int), 1, in) != 1 ||
+        fread(&out->dropped_edges, sizeof(int), 1, in) != 1) {
+        free_page(out);
         fclose(in);
         return -1;
     }
@@ -431,14 +1439,16 @@ int read_page(const char* filepath, page_data* out) {
     out->page_y1 = bounds.y1;
     out->edge_count = edge_count;
     out->link_count = link_count;
+    out->figure_count = figure_count;
 
     out->blocks = malloc(out->block_count * sizeof(fblock));
     out->lines = malloc(out->line_count * sizeof(fline));
     out->chars = malloc(out->char_count * sizeof(fchar));
     out->edges = malloc(out->edge_count * sizeof(edge));
-    out->links = malloc(out->link_count * sizeof(flink));
+    out->links = calloc(out->link_count, sizeof(flink));
+    out->figures = calloc(out->figure_count, sizeof(ffigure));
 
-    if (!out->blocks || !out->lines || !out->chars || !out->edges || !out->links) {
+    if (!out->blocks || !out->lines || !out->chars || !out->edges || !out->links || !out->figures) {
         free_page(out);
         fclose(in);
         return -1;
@@ -490,6 +1500,86 @@ int read_page(const char* filepath, page_data* out) {
         }
     }
 
+    for (int i = 0; i < figure_count; i++) {
+        ffigure* f = &out->figures[i];
+        int alt_len;
+
+        if (fread(&f->bbox_x0, sizeof(float), 1, in) != 1 || fread(&f->bbox_y0, sizeof(float), 1, in) != 1 ||
+            fread(&f->bbox_x1, sizeof(float), 1, in) != 1 || fread(&f->bbox_y1, sizeof(float), 1, in) != 1 ||
+            fread(&alt_len, sizeof(int), 1, in) != 1) {
+            free_page(out);
+            fclose(in);
+            return -1;
+        }
+
+        if (alt_len > 0) {
+            f->alt = malloc(alt_len + 1);
+            if (!f->alt || fread(f->alt, 1, alt_len, in) != (size_t)alt_len) {
+                free_page(out);
+                fclose(in);
+                return -1;
+            }
+            f->alt[alt_len] = '\0';
+        }
+
+        int image_len;
+        if (fread(&image_len, sizeof(int), 1, in) != 1) {
+            free_page(out);
+            fclose(in);
+            return -1;
+        }
+        if (image_len > 0) {
+            f->image = malloc(image_len + 1);
+            if (!f->image || fread(f->image, 1, image_len, in) != (size_t)image_len) {
+                free_page(out);
+                fclose(in);
+                return -1;
+            }
+            f->image[image_len] = '\0';
+        }
+    }
+
+    // pages extracted before redactions were recorded end here
+    int redaction_count;
+    if (fread(&redaction_count, sizeof(int), 1, in) == 1 && redaction_count > 0) {
+        out->redactions = malloc(redaction_count * sizeof(frect));
+        if (!out->redactions || fread(out->redactions, sizeof(frect), redaction_count, in) != (size_t)redaction_count) {
+            free_page(out);
+            fclose(in);
+            return -1;
+        }
+        out->redaction_count = redaction_count;
+    }
+
+    // and those extracted before fonts were
+    int font_count;
+    if (fread(&font_count, sizeof(int), 1, in) == 1 && font_count > 0) {
+        out->fonts = calloc(font_count, sizeof(ffont));
+        if (!out->fonts) {
+            free_page(out);
+            fclose(in);
+            return -1;
+        }
+        out->font_count = font_count;
+        for (int i = 0; i < font_count; i++) {
+            ffont* f = &out->fonts[i];
+            int name_len;
+            if (fread(&name_len, sizeof(int), 1, in) != 1 || name_len < 0 || !(f->name = malloc(name_len + 1)) ||
+                fread(f->name, 1, name_len, in) != (size_t)name_len || fread(&f->embedded, 1, 1, in) != 1 ||
+                fread(&f->substituted, 1, 1, in) != 1) {
+                free_page(out);
+                fclose(in);
+                return -1;
+            }
+            f->name[name_len] = '\0';
+        }
+    }
+
+    // and those before the text under redactions was left out
+    int redacted_chars;
+    if (fread(&redacted_chars, sizeof(int), 1, in) == 1)
+        out->redacted_chars = redacted_chars;
+
     fclose(in);
     return 0;
 }
@@ -497,6 +1587,7 @@ int read_page(const char* filepath, page_data* out) {
 void free_page(page_data* data) {
     if (!data)
         return;
+    free(data->page_label);
     free(data->blocks);
     free(data->lines);
     free(data->chars);
@@ -506,5 +1597,18 @@ void free_page(page_data* data) {
             free(data->links[i].uri);
         free(data->links);
     }
+    if (data->figures) {
+        for (int i = 0; i < data->figure_count; i++) {
+            free(data->figures[i].alt);
+            free(data->figures[i].image);
+        }
+        free(data->figures);
+    }
+    free(data->redactions);
+    if (data->fonts) {
+        for (int i = 0; i < data->font_count; i++)
+            free(data->fonts[i].name);
+        free(data->fonts);
+    }
     memset(data, 0, sizeof(page_data));
 }
@@ -1,16 +1,17 @@
+// Package bridge extracts raw page data with MuPDF. Extraction is safe to run
+// for several documents at once from different goroutines: each call has its
+// own MuPDF contexts, in worker processes forked for it, and its own temp dir.
 package bridge
 
-/*
-#cgo CFLAGS: -I${SRCDIR} -I${SRCDIR}/../../../mupdf/include
-#cgo LDFLAGS: -L${SRCDIR}/../../../lib/mupdf -lmupdf -lm -lpthread
-
-#include "bridge.h"
-#include <stdlib.h>
-*/
-import "C"
 import (
 	"errors"
-	"unsafe"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/pymupdf4llm-c/go/internal/logger"
 )
@@ -23,6 +24,136 @@ func (r Rect) Width() float32  { return r.X1 - r.X0 }
 func (r Rect) Height() float32 { return r.Y1 - r.Y0 }
 func (r Rect) IsEmpty() bool   { return r.X0 >= r.X1 || r.Y0 >= r.Y1 }
 
+type PageBox int
+
+const (
+	MediaBox PageBox = iota
+	CropBox
+	BleedBox
+	TrimBox
+	ArtBox
+)
+
+var pageBoxNames = map[string]PageBox{"media": MediaBox, "crop": CropBox, "bleed": BleedBox, "trim": TrimBox, "art": ArtBox}
+
+func ParsePageBox(name string) (PageBox, error) {
+	if box, ok := pageBoxNames[strings.TrimSuffix(strings.ToLower(name), "box")]; ok {
+		return box, nil
+	}
+	return CropBox, fmt.Errorf("unknown page box %q (want media, crop, bleed, trim or art)", name)
+}
+
+type ImageFormat int
+
+const (
+	PNG ImageFormat = iota
+	JPEG
+)
+
+var imageFormatNames = map[string]ImageFormat{"png": PNG, "jpeg": JPEG, "jpg": JPEG}
+
+func ParseImageFormat(name string) (ImageFormat, error) {
+	name = strings.ToLower(name)
+	if format, ok := imageFormatNames[name]; ok {
+		return format, nil
+	}
+	if name == "webp" {
+		return PNG, errors.New("webp images are not supported: MuPDF has no WebP encoder (want png or jpeg)")
+	}
+	return PNG, fmt.Errorf("unknown image format %q (want png or jpeg)", name)
+}
+
+var pageRangesPattern = regexp.MustCompile(`^(\d+|N)(-(\d+|N))?(,(\d+|N)(-(\d+|N))?)*$`)
+
+// CheckPageRanges reports whether s is a list of pages for
+// ExtractOptions.Pages, so a typo fails before MuPDF opens the document.
+func CheckPageRanges(s string) error {
+	if s != "" && !pageRangesPattern.MatchString(s) {
+		return fmt.Errorf("invalid page ranges %q (want e.g. 1-3,7,N-1 where N is the last page)", s)
+	}
+	return nil
+}
+
+type ExtractOptions struct {
+	PageBox        PageBox
+	SplitLigatures bool
+	Images         bool   // save figure images in the temp dir, see RawFigure.Image
+	OutputDir      string // extract into this dir and skip pages already there, instead of a new temp dir
+	ImageFormat    ImageFormat
+	JPEGQuality    int      // 1-100; 0 for the default of 90
+	ImageMaxDPI    float32  // shrink images drawn at more pixels per inch than this; 0 for no limit
+	ImageMaxSize   int      // shrink images whose longer side has more pixels than this; 0 for no limit
+	MaxChars       int      // per page, keeping whole text blocks in content order up to it; 0 for no limit
+	MaxEdges       int      // drop every ruling edge of pages with more, skipping their tables; 0 for no limit
+	Pages          string   // page ranges to extract, as "1-3,7,N-1" where N is the last page; "" for all
+	HideLayers     []string // optional content groups to turn off by name, such as a draft or second-language layer
+	ShowLayers     []string // and to turn on, where the document has them off
+	Repair         bool     // rebuild a damaged PDF's xref when a page fails and retry it; pages that still fail get a page_NNN.timeout file saying so
+	KeepRedacted   bool     // write the text under redaction annotations not yet applied into the raw pages instead of leaving it out
+
+	// how long extraction may take, not what it produces, so left out of
+	// cache and checkpoint keys; pages given up on get a page_NNN.timeout file
+	// holding the reason instead of their raw file
+	Timeout     time.Duration `json:"-"` // 0 for no limit
+	PageTimeout time.Duration `json:"-"`
+
+	// also left out of the keys: the password only unlocks the same content,
+	// and kept out of checkpoint files with it
+	Password string `json:"-"`
+	Workers  int    `json:"-"` // pages extracted in parallel; 0 for one per cpu
+
+	// limits for services taking documents from many users, refusing ones
+	// over them with ErrTooLarge before any page is extracted
+	MaxFileSize int64 `json:"-"` // in bytes; 0 for no limit
+	MaxPages    int   `json:"-"` // of the whole document, whatever Pages picks; 0 for no limit
+}
+
+// ErrTooLarge is returned, wrapped with the size or page count and the limit
+// it is over, for documents past ExtractOptions.MaxFileSize or MaxPages.
+var ErrTooLarge = errors.New("document is over the size limit")
+
+var DefaultExtractOptions = ExtractOptions{
+	PageBox:        CropBox,
+	SplitLigatures: true,
+	MaxChars:       1_000_000,
+	MaxEdges:       100_000,
+}
+
+// Layer is an optional content group of a PDF, a layer such as a language or
+// a watermark that viewers can turn on and off.
+type Layer struct {
+	Name string
+	On   bool // as extracted, after ExtractOptions.HideLayers and ShowLayers
+}
+
+// ReadLayers returns the layers of the document extracted into dir, listed in
+// its layers file; none for a document without layers.
+func ReadLayers(dir string) ([]Layer, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "layers"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var layers []Layer
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		state, name, ok := strings.Cut(line, "\t")
+		if !ok || (state != "on" && state != "off") {
+			return nil, fmt.Errorf("corrupt layers file: %q", line)
+		}
+		layers = append(layers, Layer{Name: name, On: state == "on"})
+	}
+	return layers, nil
+}
+
+// WasRepaired reports whether MuPDF had to repair the document extracted into
+// dir, as it does with a broken xref, so its pages are a best effort.
+func WasRepaired(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "repaired"))
+	return err == nil
+}
+
 type Edge struct {
 	X0, Y0, X1, Y1 float64
 	Orientation    byte
@@ -30,12 +161,27 @@ type Edge struct {
 
 type RawPageData struct {
 	PageNumber int
+	PageLabel  string
+	Rotation   int
 	PageBounds Rect
 	Blocks     []RawBlock
 	Lines      []RawLine
 	Chars      []RawChar
 	Edges      []Edge
 	Links      []RawLink
+	Figures    []RawFigure
+	Redactions []Rect // under redaction annotations not yet applied, whose content is still there
+	Fonts      []RawFont
+
+	DroppedChars, DroppedEdges int // left out for being over ExtractOptions.MaxChars and MaxEdges
+	RedactedChars              int // left out for being under Redactions, unless ExtractOptions.KeepRedacted
+}
+
+// RawFont is a font the text of a page was drawn with, from a PDF.
+type RawFont struct {
+	Name        string // its /BaseFont, with the ABCDEF+ prefix of a subset
+	Embedded    bool   // the PDF carries the font program
+	Substituted bool   // it does not, nor is it a standard font, so MuPDF drew the text with a generic one
 }
 
 type RawBlock struct {
@@ -53,69 +199,98 @@ type RawChar struct {
 	Codepoint                      rune
 	Size                           float32
 	BBox                           Rect
+	OriginX, OriginY, Advance      float32
 	IsBold, IsItalic, IsMonospaced bool
 }
 
+// Gap returns the horizontal space between the end of c and the start of next,
+// measured pen to pen when the advance is known and glyph box to glyph box
+// otherwise.
+func (c *RawChar) Gap(next *RawChar) float32 {
+	if c.Advance > 0 && next.Advance > 0 {
+		return next.OriginX - (c.OriginX + c.Advance)
+	}
+	return next.BBox.X0 - c.BBox.X1
+}
+
 type RawLink struct {
 	Rect Rect
 	URI  string
 }
 
+type RawFigure struct {
+	BBox  Rect
+	Alt   string
+	Image string // path of the saved PNG or JPEG, removed along with the temp dir
+}
+
 func ExtractAllPagesRaw(pdfPath string) (string, error) {
-	Logger.Debug("extracting all pages", "pdfPath", pdfPath)
-	cpath := C.CString(pdfPath)
-	defer C.free(unsafe.Pointer(cpath))
-	if ctempdir := C.extract_all_pages(cpath); ctempdir != nil {
-		tempDir := C.GoString(ctempdir)
-		C.free(unsafe.Pointer(ctempdir))
-		Logger.Debug("extraction completed", "tempDir", tempDir)
-		return tempDir, nil
-	}
-	Logger.Error("extraction failed", "pdfPath", pdfPath)
-	return "", errors.New("extraction failed")
+	return ExtractAllPagesRawWithOptions(pdfPath, DefaultExtractOptions)
 }
 
-func ReadRawPage(filepath string) (*RawPageData, error) {
-	Logger.Debug("reading raw page", "filepath", filepath)
-	cpath := C.CString(filepath)
-	defer C.free(unsafe.Pointer(cpath))
-	var rawData C.page_data
-	if C.read_page(cpath, &rawData) != 0 {
-		Logger.Error("failed to read raw page", "filepath", filepath)
-		return nil, errors.New("failed to read raw page")
+func ExtractAllPagesRawWithOptions(pdfPath string, opts ExtractOptions) (string, error) {
+	Logger.Debug("extracting all pages", "pdfPath", pdfPath, "pageBox", opts.PageBox)
+	if err := checkFileSize(pdfPath, opts.MaxFileSize); err != nil {
+		Logger.Error("extraction failed", "pdfPath", pdfPath, "err", err)
+		return "", err
 	}
-	defer C.free_page(&rawData)
-	result := &RawPageData{PageNumber: int(rawData.page_number), PageBounds: Rect{float32(rawData.page_x0), float32(rawData.page_y0), float32(rawData.page_x1), float32(rawData.page_y1)}, Blocks: make([]RawBlock, int(rawData.block_count)), Lines: make([]RawLine, int(rawData.line_count)), Chars: make([]RawChar, int(rawData.char_count)), Edges: make([]Edge, int(rawData.edge_count)), Links: make([]RawLink, int(rawData.link_count))}
-	Logger.Debug("page data loaded", "pageNum", result.PageNumber, "blocks", len(result.Blocks), "chars", len(result.Chars), "edges", len(result.Edges))
-	if rawData.block_count > 0 {
-		cBlocks := (*[1 << 20]C.fblock)(unsafe.Pointer(rawData.blocks))[:rawData.block_count:rawData.block_count]
-		for i := range result.Blocks {
-			result.Blocks[i] = RawBlock{Type: uint8(cBlocks[i]._type), BBox: Rect{float32(cBlocks[i].bbox_x0), float32(cBlocks[i].bbox_y0), float32(cBlocks[i].bbox_x1), float32(cBlocks[i].bbox_y1)}, LineStart: int(cBlocks[i].line_start), LineCount: int(cBlocks[i].line_count)}
-		}
+	if err := CheckFormat(pdfPath); err != nil {
+		Logger.Error("extraction failed", "pdfPath", pdfPath, "err", err)
+		return "", err
 	}
-	if rawData.line_count > 0 {
-		cLines := (*[1 << 20]C.fline)(unsafe.Pointer(rawData.lines))[:rawData.line_count:rawData.line_count]
-		for i := range result.Lines {
-			result.Lines[i] = RawLine{BBox: Rect{float32(cLines[i].bbox_x0), float32(cLines[i].bbox_y0), float32(cLines[i].bbox_x1), float32(cLines[i].bbox_y1)}, CharStart: int(cLines[i].char_start), CharCount: int(cLines[i].char_count)}
-		}
+	tempDir, err := extractAllPages(pdfPath, opts)
+	if err == nil {
+		err = checkPageCount(tempDir, opts)
 	}
-	if rawData.char_count > 0 {
-		cChars := (*[1 << 28]C.fchar)(unsafe.Pointer(rawData.chars))[:rawData.char_count:rawData.char_count]
-		for i := range result.Chars {
-			result.Chars[i] = RawChar{Codepoint: rune(cChars[i].codepoint), Size: float32(cChars[i].size), BBox: Rect{float32(cChars[i].bbox_x0), float32(cChars[i].bbox_y0), float32(cChars[i].bbox_x1), float32(cChars[i].bbox_y1)}, IsBold: cChars[i].is_bold != 0, IsItalic: cChars[i].is_italic != 0, IsMonospaced: cChars[i].is_monospaced != 0}
-		}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return "", err // a build without MuPDF, for the caller to handle
 	}
-	if rawData.edge_count > 0 {
-		cEdges := (*[1 << 20]C.edge)(unsafe.Pointer(rawData.edges))[:rawData.edge_count:rawData.edge_count]
-		for i := range result.Edges {
-			result.Edges[i] = Edge{float64(cEdges[i].x0), float64(cEdges[i].y0), float64(cEdges[i].x1), float64(cEdges[i].y1), byte(cEdges[i].orientation)}
-		}
+	if err != nil {
+		Logger.Error("extraction failed", "pdfPath", pdfPath, "err", err)
+		return "", err
 	}
-	if rawData.link_count > 0 {
-		cLinks := (*[1 << 20]C.flink)(unsafe.Pointer(rawData.links))[:rawData.link_count:rawData.link_count]
-		for i := range result.Links {
-			result.Links[i] = RawLink{Rect: Rect{float32(cLinks[i].rect_x0), float32(cLinks[i].rect_y0), float32(cLinks[i].rect_x1), float32(cLinks[i].rect_y1)}, URI: C.GoString(cLinks[i].uri)}
-		}
+	Logger.Debug("extraction completed", "tempDir", tempDir)
+	return tempDir, nil
+}
+
+func checkFileSize(path string, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= limit {
+		return nil // a missing file is for extraction to report
+	}
+	return fmt.Errorf("%w: %s is %d bytes, over the limit of %d", ErrTooLarge, path, info.Size(), limit)
+}
+
+// checkPageCount returns an ErrTooLarge if extraction into dir stopped at the
+// page count, removing dir unless it was opts.OutputDir.
+func checkPageCount(dir string, opts ExtractOptions) error {
+	data, err := os.ReadFile(filepath.Join(dir, "too_many_pages"))
+	if err != nil {
+		return nil
+	}
+	if opts.OutputDir == "" {
+		os.RemoveAll(dir)
+	} else {
+		os.Remove(filepath.Join(dir, "too_many_pages"))
 	}
+	return fmt.Errorf("%w: the document has %s pages, over the limit of %d", ErrTooLarge, strings.TrimSpace(string(data)), opts.MaxPages)
+}
+
+// milliseconds rounds d up, so a tiny timeout is not taken for none.
+func milliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+func ReadRawPage(filepath string) (*RawPageData, error) {
+	Logger.Debug("reading raw page", "filepath", filepath)
+	result, err := readPage(filepath)
+	if err != nil {
+		Logger.Error("failed to read raw page", "filepath", filepath)
+		return nil, err
+	}
+	Logger.Debug("page data loaded", "pageNum", result.PageNumber, "blocks", len(result.Blocks), "chars", len(result.Chars), "edges", len(result.Edges))
 	return result, nil
 }
@@ -18,13 +18,61 @@ typedef struct edge_array
     edge* items;
     int count;
     int capacity;
+    int max;     // edges past this many are only counted in dropped; 0 for no limit
+    int dropped;
 } edge_array;
-char* extract_all_pages(const char* pdf_path);
+// images drawn on the page, with /Alt text from structure tags when present
+typedef struct ffigure
+{
+    float bbox_x0, bbox_y0, bbox_x1, bbox_y1;
+    char* alt;
+    char* image; // image file written next to the page's raw file, NULL unless images are extracted
+} ffigure;
+typedef struct figure_array
+{
+    ffigure* items;
+    int count;
+    int capacity;
+} figure_array;
+// page box used as the extraction area; values match fz_box_type
+typedef struct extract_options
+{
+    int page_box;
+    int split_ligatures; // emit ﬁ, ﬂ, ﬃ... as their letters, each with a share of the glyph box
+    int extract_images;  // save each figure's image alongside the raw page data
+    const char* output_dir; // write pages here, skipping ones already present, instead of a new temp dir
+    int image_format;       // IMAGE_PNG or IMAGE_JPEG
+    int jpeg_quality;       // 1-100, 0 for the default
+    float image_max_dpi;    // shrink images drawn at more pixels per inch than this; 0 for no limit
+    int image_max_size;     // shrink images whose longer side has more pixels than this; 0 for no limit
+    int timeout_ms;         // stop after this long, keeping the pages done; 0 for no limit
+    int page_timeout_ms;    // give up on a page after this long; 0 for no limit
+    int max_chars;          // keep whole text blocks up to this many chars per page; 0 for no limit
+    int max_edges;          // drop every ruling edge of a page with more than this many; 0 for no limit
+    const char* pages;      // page ranges to extract, as "1-3,7,N-1" (N is the last page); NULL for all
+    const char* password;   // for encrypted documents; NULL for none
+    int workers;            // pages extracted in parallel; 0 for one per cpu
+    const char* hide_layers; // names of optional content groups to turn off, one per line; NULL for none
+    const char* show_layers; // and to turn on
+    int repair;              // rebuild the xref of a damaged PDF and retry pages that fail, marking those that still do
+    int max_pages;           // extract nothing from documents with more pages, see write_too_many_pages; 0 for no limit
+    int keep_redacted;       // write the text under unapplied redaction annotations instead of leaving it out
+} extract_options;
+#define IMAGE_PNG 0
+#define IMAGE_JPEG 1
+char* extract_all_pages(const char* pdf_path, const extract_options* opts);
+
+// frees what extract_all_pages returns, with the allocator of the library that
+// made it; on Windows that need not be the caller's
+void bridge_free(void* p);
+
 typedef struct fchar
 {
     int codepoint;
     float size;
     float bbox_x0, bbox_y0, bbox_x1, bbox_y1;
+    float origin_x, origin_y; // pen position on the baseline
+    float advance;            // horizontal advance width in points
     uint8_t is_bold;
     uint8_t is_italic;
     uint8_t is_monospaced;
@@ -47,9 +95,25 @@ typedef struct flink
     float rect_x0, rect_y0, rect_x1, rect_y1;
     char* uri;
 } flink;
+typedef struct frect
+{
+    float x0, y0, x1, y1;
+} frect;
+// a font the text of a page was drawn with
+typedef struct ffont
+{
+    char* name;          // its /BaseFont, as "ABCDEF+Calibri" for a subset
+    uint8_t embedded;    // the PDF carries the font program
+    uint8_t substituted; // it does not, nor is it one of the standard fonts, so MuPDF drew it with a generic one
+    fz_font* font;       // while the page is extracted; NULL when read back
+} ffont;
 typedef struct page_data
 {
     int page_number;
+    char* page_label;
+    int rotation; // original /Rotate, geometry is already in display orientation
+    int dropped_chars; // over extract_options.max_chars
+    int dropped_edges; // over extract_options.max_edges
     float page_x0, page_y0, page_x1, page_y1;
     fblock* blocks;
     int block_count;
@@ -61,6 +125,13 @@ typedef struct page_data
     int edge_count;
     flink* links;
     int link_count;
+    ffigure* figures;
+    int figure_count;
+    frect* redactions; // areas marked for redaction but not yet redacted
+    int redaction_count;
+    int redacted_chars; // left out for being under them, unless extract_options.keep_redacted
+    ffont* fonts;
+    int font_count;
 } page_data;
 int read_page(const char* filepath, page_data* out);
 void free_page(page_data* data);
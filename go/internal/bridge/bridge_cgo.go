@@ -0,0 +1,121 @@
+//go:build cgo && !purego
+
+package bridge
+
+/*
+#cgo CFLAGS: -I${SRCDIR} -I${SRCDIR}/../../../mupdf/include
+
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+func extractAllPages(pdfPath string, opts ExtractOptions) (string, error) {
+	cpath := C.CString(pdfPath)
+	defer C.free(unsafe.Pointer(cpath))
+	copts := C.extract_options{page_box: C.int(opts.PageBox), image_format: C.int(opts.ImageFormat), jpeg_quality: C.int(opts.JPEGQuality), image_max_dpi: C.float(opts.ImageMaxDPI), image_max_size: C.int(opts.ImageMaxSize)}
+	if opts.SplitLigatures {
+		copts.split_ligatures = 1
+	}
+	if opts.Images {
+		copts.extract_images = 1
+	}
+	copts.timeout_ms, copts.page_timeout_ms = C.int(milliseconds(opts.Timeout)), C.int(milliseconds(opts.PageTimeout))
+	copts.max_chars, copts.max_edges = C.int(opts.MaxChars), C.int(opts.MaxEdges)
+	copts.workers = C.int(opts.Workers)
+	if opts.Repair {
+		copts.repair = 1
+	}
+	copts.max_pages = C.int(opts.MaxPages)
+	if opts.KeepRedacted {
+		copts.keep_redacted = 1
+	}
+	for _, s := range []struct {
+		value string
+		field **C.char
+	}{{opts.OutputDir, &copts.output_dir}, {opts.Pages, &copts.pages}, {opts.Password, &copts.password}, {strings.Join(opts.HideLayers, "\n"), &copts.hide_layers}, {strings.Join(opts.ShowLayers, "\n"), &copts.show_layers}} {
+		if s.value != "" {
+			*s.field = C.CString(s.value)
+			defer C.free(unsafe.Pointer(*s.field))
+		}
+	}
+	if ctempdir := C.extract_all_pages(cpath, &copts); ctempdir != nil {
+		tempDir := C.GoString(ctempdir)
+		C.free(unsafe.Pointer(ctempdir))
+		return tempDir, nil
+	}
+	return "", errors.New("extraction failed")
+}
+
+func readPage(filepath string) (*RawPageData, error) {
+	cpath := C.CString(filepath)
+	defer C.free(unsafe.Pointer(cpath))
+	var rawData C.page_data
+	if C.read_page(cpath, &rawData) != 0 {
+		return nil, errors.New("failed to read raw page")
+	}
+	defer C.free_page(&rawData)
+	result := &RawPageData{PageNumber: int(rawData.page_number), PageLabel: C.GoString(rawData.page_label), Rotation: int(rawData.rotation), DroppedChars: int(rawData.dropped_chars), DroppedEdges: int(rawData.dropped_edges), RedactedChars: int(rawData.redacted_chars), PageBounds: Rect{float32(rawData.page_x0), float32(rawData.page_y0), float32(rawData.page_x1), float32(rawData.page_y1)}, Blocks: make([]RawBlock, int(rawData.block_count)), Lines: make([]RawLine, int(rawData.line_count)), Chars: make([]RawChar, int(rawData.char_count)), Edges: make([]Edge, int(rawData.edge_count)), Links: make([]RawLink, int(rawData.link_count)), Figures: make([]RawFigure, int(rawData.figure_count))}
+	if rawData.block_count > 0 {
+		cBlocks := (*[1 << 20]C.fblock)(unsafe.Pointer(rawData.blocks))[:rawData.block_count:rawData.block_count]
+		for i := range result.Blocks {
+			result.Blocks[i] = RawBlock{Type: uint8(cBlocks[i]._type), BBox: Rect{float32(cBlocks[i].bbox_x0), float32(cBlocks[i].bbox_y0), float32(cBlocks[i].bbox_x1), float32(cBlocks[i].bbox_y1)}, LineStart: int(cBlocks[i].line_start), LineCount: int(cBlocks[i].line_count)}
+		}
+	}
+	if rawData.line_count > 0 {
+		cLines := (*[1 << 20]C.fline)(unsafe.Pointer(rawData.lines))[:rawData.line_count:rawData.line_count]
+		for i := range result.Lines {
+			result.Lines[i] = RawLine{BBox: Rect{float32(cLines[i].bbox_x0), float32(cLines[i].bbox_y0), float32(cLines[i].bbox_x1), float32(cLines[i].bbox_y1)}, CharStart: int(cLines[i].char_start), CharCount: int(cLines[i].char_count)}
+		}
+	}
+	if rawData.char_count > 0 {
+		cChars := (*[1 << 28]C.fchar)(unsafe.Pointer(rawData.chars))[:rawData.char_count:rawData.char_count]
+		for i := range result.Chars {
+			result.Chars[i] = RawChar{Codepoint: rune(cChars[i].codepoint), Size: float32(cChars[i].size), BBox: Rect{float32(cChars[i].bbox_x0), float32(cChars[i].bbox_y0), float32(cChars[i].bbox_x1), float32(cChars[i].bbox_y1)}, OriginX: float32(cChars[i].origin_x), OriginY: float32(cChars[i].origin_y), Advance: float32(cChars[i].advance), IsBold: cChars[i].is_bold != 0, IsItalic: cChars[i].is_italic != 0, IsMonospaced: cChars[i].is_monospaced != 0}
+		}
+	}
+	if rawData.edge_count > 0 {
+		cEdges := (*[1 << 20]C.edge)(unsafe.Pointer(rawData.edges))[:rawData.edge_count:rawData.edge_count]
+		for i := range result.Edges {
+			result.Edges[i] = Edge{float64(cEdges[i].x0), float64(cEdges[i].y0), float64(cEdges[i].x1), float64(cEdges[i].y1), byte(cEdges[i].orientation)}
+		}
+	}
+	if rawData.link_count > 0 {
+		cLinks := (*[1 << 20]C.flink)(unsafe.Pointer(rawData.links))[:rawData.link_count:rawData.link_count]
+		for i := range result.Links {
+			result.Links[i] = RawLink{Rect: Rect{float32(cLinks[i].rect_x0), float32(cLinks[i].rect_y0), float32(cLinks[i].rect_x1), float32(cLinks[i].rect_y1)}, URI: C.GoString(cLinks[i].uri)}
+		}
+	}
+	if rawData.figure_count > 0 {
+		cFigures := (*[1 << 20]C.ffigure)(unsafe.Pointer(rawData.figures))[:rawData.figure_count:rawData.figure_count]
+		for i := range result.Figures {
+			result.Figures[i] = RawFigure{BBox: Rect{float32(cFigures[i].bbox_x0), float32(cFigures[i].bbox_y0), float32(cFigures[i].bbox_x1), float32(cFigures[i].bbox_y1)}}
+			if cFigures[i].alt != nil {
+				result.Figures[i].Alt = C.GoString(cFigures[i].alt)
+			}
+			if cFigures[i].image != nil {
+				result.Figures[i].Image = C.GoString(cFigures[i].image)
+			}
+		}
+	}
+	if rawData.redaction_count > 0 {
+		cRects := (*[1 << 20]C.frect)(unsafe.Pointer(rawData.redactions))[:rawData.redaction_count:rawData.redaction_count]
+		result.Redactions = make([]Rect, len(cRects))
+		for i, r := range cRects {
+			result.Redactions[i] = Rect{float32(r.x0), float32(r.y0), float32(r.x1), float32(r.y1)}
+		}
+	}
+	if rawData.font_count > 0 {
+		cFonts := (*[1 << 20]C.ffont)(unsafe.Pointer(rawData.fonts))[:rawData.font_count:rawData.font_count]
+		result.Fonts = make([]RawFont, len(cFonts))
+		for i, f := range cFonts {
+			result.Fonts[i] = RawFont{Name: C.GoString(f.name), Embedded: f.embedded != 0, Substituted: f.substituted != 0}
+		}
+	}
+	return result, nil
+}
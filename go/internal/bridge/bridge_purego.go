@@ -0,0 +1,245 @@
+//go:build (!cgo || purego) && !wasip1
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// LibraryEnv names the bridge library to load when built without cgo or with
+// the purego tag. The library is bridge.c built as a shared library against
+// MuPDF; see BUILD.md.
+const LibraryEnv = "FIBRUM_BRIDGE_LIB"
+
+// the C structs in bridge.h, laid out the same way
+type (
+	cExtractOptions struct {
+		PageBox, SplitLigatures, ExtractImages int32
+		OutputDir                              *byte
+		ImageFormat, JPEGQuality               int32
+		ImageMaxDPI                            float32
+		ImageMaxSize, TimeoutMS, PageTimeoutMS int32
+		MaxChars, MaxEdges                     int32
+		Pages, Password                        *byte
+		Workers                                int32
+		HideLayers, ShowLayers                 *byte
+		Repair, MaxPages, KeepRedacted         int32
+	}
+	cEdge struct {
+		X0, Y0, X1, Y1 float64
+		Orientation    byte
+	}
+	cFigure struct {
+		BBox       [4]float32
+		Alt, Image *byte
+	}
+	cChar struct {
+		Codepoint                      int32
+		Size                           float32
+		BBox                           [4]float32
+		OriginX, OriginY, Advance      float32
+		IsBold, IsItalic, IsMonospaced uint8
+	}
+	cLine struct {
+		BBox                 [4]float32
+		CharStart, CharCount int32
+	}
+	cBlock struct {
+		Type                 uint8
+		BBox                 [4]float32
+		LineStart, LineCount int32
+	}
+	cLink struct {
+		Rect [4]float32
+		URI  *byte
+	}
+	cFont struct {
+		Name                  *byte
+		Embedded, Substituted uint8
+		Font                  uintptr // the fz_font while extracting; unused
+	}
+	cPageData struct {
+		PageNumber                           int32
+		PageLabel                            *byte
+		Rotation, DroppedChars, DroppedEdges int32
+		PageBounds                           [4]float32
+		Blocks                               *cBlock
+		BlockCount                           int32
+		Lines                                *cLine
+		LineCount                            int32
+		Chars                                *cChar
+		CharCount                            int32
+		Edges                                *cEdge
+		EdgeCount                            int32
+		Links                                *cLink
+		LinkCount                            int32
+		Figures                              *cFigure
+		FigureCount                          int32
+		Redactions                           *[4]float32
+		RedactionCount                       int32
+		RedactedChars                        int32
+		Fonts                                *cFont
+		FontCount                            int32
+	}
+)
+
+var lib struct {
+	once            sync.Once
+	err             error
+	extractAllPages func(pdfPath string, opts *cExtractOptions) *byte
+	readPage        func(path string, out *cPageData) int32
+	freePage        func(data *cPageData)
+	free            func(p *byte)
+}
+
+// libraryPaths is where the bridge library is looked for, in order: $LibraryEnv,
+// then by name on the dynamic loader's search path, then next to the executable.
+func libraryPaths() []string {
+	name := "libfibrum_bridge.so"
+	switch runtime.GOOS {
+	case "darwin":
+		name = "libfibrum_bridge.dylib"
+	case "windows":
+		name = "fibrum_bridge.dll"
+	}
+	var paths []string
+	if env := os.Getenv(LibraryEnv); env != "" {
+		paths = append(paths, env)
+	}
+	paths = append(paths, name)
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exe), name), filepath.Join(filepath.Dir(exe), "lib", name))
+	}
+	return paths
+}
+
+func loadLibrary() error {
+	lib.once.Do(func() {
+		var handle uintptr
+		var errs []string
+		for _, path := range libraryPaths() {
+			h, err := openLibrary(path)
+			if err == nil {
+				handle = h
+				Logger.Debug("loaded bridge library", "path", path)
+				break
+			}
+			errs = append(errs, err.Error()) // both loaders name the path
+		}
+		if handle == 0 {
+			lib.err = fmt.Errorf("bridge library not found (set %s), tried:\n  %s", LibraryEnv, strings.Join(errs, "\n  "))
+			return
+		}
+		purego.RegisterLibFunc(&lib.extractAllPages, handle, "extract_all_pages")
+		purego.RegisterLibFunc(&lib.readPage, handle, "read_page")
+		purego.RegisterLibFunc(&lib.freePage, handle, "free_page")
+		purego.RegisterLibFunc(&lib.free, handle, "bridge_free")
+	})
+	return lib.err
+}
+
+func extractAllPages(pdfPath string, opts ExtractOptions) (string, error) {
+	if err := loadLibrary(); err != nil {
+		return "", err
+	}
+	copts := cExtractOptions{PageBox: int32(opts.PageBox), ImageFormat: int32(opts.ImageFormat), JPEGQuality: int32(opts.JPEGQuality), ImageMaxDPI: opts.ImageMaxDPI, ImageMaxSize: int32(opts.ImageMaxSize)}
+	if opts.SplitLigatures {
+		copts.SplitLigatures = 1
+	}
+	if opts.Images {
+		copts.ExtractImages = 1
+	}
+	copts.TimeoutMS, copts.PageTimeoutMS = int32(milliseconds(opts.Timeout)), int32(milliseconds(opts.PageTimeout))
+	copts.MaxChars, copts.MaxEdges = int32(opts.MaxChars), int32(opts.MaxEdges)
+	copts.OutputDir, copts.Pages, copts.Password = cString(opts.OutputDir), cString(opts.Pages), cString(opts.Password)
+	copts.Workers = int32(opts.Workers)
+	if opts.Repair {
+		copts.Repair = 1
+	}
+	copts.MaxPages = int32(opts.MaxPages)
+	if opts.KeepRedacted {
+		copts.KeepRedacted = 1
+	}
+	copts.HideLayers, copts.ShowLayers = cString(strings.Join(opts.HideLayers, "\n")), cString(strings.Join(opts.ShowLayers, "\n"))
+	ctempdir := lib.extractAllPages(pdfPath, &copts)
+	runtime.KeepAlive(&copts)
+	if ctempdir == nil {
+		return "", errors.New("extraction failed")
+	}
+	defer lib.free(ctempdir)
+	return goString(ctempdir), nil
+}
+
+func readPage(filepath string) (*RawPageData, error) {
+	if err := loadLibrary(); err != nil {
+		return nil, err
+	}
+	var raw cPageData
+	if lib.readPage(filepath, &raw) != 0 {
+		return nil, errors.New("failed to read raw page")
+	}
+	defer lib.freePage(&raw)
+	rect := func(r [4]float32) Rect { return Rect{r[0], r[1], r[2], r[3]} }
+	result := &RawPageData{PageNumber: int(raw.PageNumber), PageLabel: goString(raw.PageLabel), Rotation: int(raw.Rotation), DroppedChars: int(raw.DroppedChars), DroppedEdges: int(raw.DroppedEdges), RedactedChars: int(raw.RedactedChars), PageBounds: rect(raw.PageBounds)}
+	result.Blocks = make([]RawBlock, raw.BlockCount)
+	for i, b := range unsafe.Slice(raw.Blocks, raw.BlockCount) {
+		result.Blocks[i] = RawBlock{Type: b.Type, BBox: rect(b.BBox), LineStart: int(b.LineStart), LineCount: int(b.LineCount)}
+	}
+	result.Lines = make([]RawLine, raw.LineCount)
+	for i, l := range unsafe.Slice(raw.Lines, raw.LineCount) {
+		result.Lines[i] = RawLine{BBox: rect(l.BBox), CharStart: int(l.CharStart), CharCount: int(l.CharCount)}
+	}
+	result.Chars = make([]RawChar, raw.CharCount)
+	for i, c := range unsafe.Slice(raw.Chars, raw.CharCount) {
+		result.Chars[i] = RawChar{Codepoint: rune(c.Codepoint), Size: c.Size, BBox: rect(c.BBox), OriginX: c.OriginX, OriginY: c.OriginY, Advance: c.Advance, IsBold: c.IsBold != 0, IsItalic: c.IsItalic != 0, IsMonospaced: c.IsMonospaced != 0}
+	}
+	result.Edges = make([]Edge, raw.EdgeCount)
+	for i, e := range unsafe.Slice(raw.Edges, raw.EdgeCount) {
+		result.Edges[i] = Edge{e.X0, e.Y0, e.X1, e.Y1, e.Orientation}
+	}
+	result.Links = make([]RawLink, raw.LinkCount)
+	for i, l := range unsafe.Slice(raw.Links, raw.LinkCount) {
+		result.Links[i] = RawLink{Rect: rect(l.Rect), URI: goString(l.URI)}
+	}
+	result.Figures = make([]RawFigure, raw.FigureCount)
+	for i, f := range unsafe.Slice(raw.Figures, raw.FigureCount) {
+		result.Figures[i] = RawFigure{BBox: rect(f.BBox), Alt: goString(f.Alt), Image: goString(f.Image)}
+	}
+	for _, r := range unsafe.Slice(raw.Redactions, raw.RedactionCount) {
+		result.Redactions = append(result.Redactions, rect(r))
+	}
+	for _, f := range unsafe.Slice(raw.Fonts, raw.FontCount) {
+		result.Fonts = append(result.Fonts, RawFont{Name: goString(f.Name), Embedded: f.Embedded != 0, Substituted: f.Substituted != 0})
+	}
+	return result, nil
+}
+
+// cString is a NUL-terminated copy of s, or nil for "".
+func cString(s string) *byte {
+	if s == "" {
+		return nil
+	}
+	b := append([]byte(s), 0)
+	return &b[0]
+}
+
+// goString copies the NUL-terminated C string at p; nil is "".
+func goString(p *byte) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for *(*byte)(unsafe.Add(unsafe.Pointer(p), n)) != 0 {
+		n++
+	}
+	return string(unsafe.Slice(p, n))
+}
@@ -1,9 +1,19 @@
 package bridge
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -155,3 +165,341 @@ func TestExtractAndAnalyze(t *testing.T) {
 		t.Error("no words extracted")
 	}
 }
+
+// TestConcurrentExtraction runs several extractions of the same PDF at once,
+// as a service converting documents in parallel would, and checks each gets
+// its own temp dir with the same pages as a lone run. Run it with -race.
+func TestConcurrentExtraction(t *testing.T) {
+	if testPdfPath == "" {
+		t.Fatal("could not find project root (.root file)")
+	}
+	charCounts := func(dir string) ([]int, error) {
+		files, err := filepath.Glob(filepath.Join(dir, "page_*.raw"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		counts := make([]int, len(files))
+		for i, f := range files {
+			page, err := ReadRawPage(f)
+			if err != nil {
+				return nil, err
+			}
+			counts[i] = len(page.Chars)
+		}
+		return counts, nil
+	}
+
+	dir, err := ExtractAllPagesRaw(testPdfPath)
+	if err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	want, err := charCounts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const runs = 8
+	dirs := make([]string, runs)
+	errs := make([]error, runs)
+	counts := make([][]int, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if dirs[i], errs[i] = ExtractAllPagesRaw(testPdfPath); errs[i] == nil {
+				counts[i], errs[i] = charCounts(dirs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{dir: true}
+	for i := 0; i < runs; i++ {
+		if dirs[i] != "" {
+			defer os.RemoveAll(dirs[i])
+		}
+		if errs[i] != nil {
+			t.Errorf("run %d: %v", i, errs[i])
+			continue
+		}
+		if seen[dirs[i]] {
+			t.Errorf("run %d shares temp dir %s", i, dirs[i])
+		}
+		seen[dirs[i]] = true
+		if !slices.Equal(counts[i], want) {
+			t.Errorf("run %d extracted %v chars per page, want %v", i, counts[i], want)
+		}
+	}
+}
+
+// The Go decoder used without MuPDF must read back exactly what the C one does.
+func TestDecodeRawPageMatchesReadRawPage(t *testing.T) {
+	if testPdfPath == "" {
+		t.Fatal("could not find project root (.root file)")
+	}
+	opts := DefaultExtractOptions
+	opts.Images = true
+	dir, err := ExtractAllPagesRawWithOptions(testPdfPath, opts)
+	if err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files, _ := filepath.Glob(filepath.Join(dir, "page_*.raw"))
+	if len(files) == 0 {
+		t.Fatal("no raw pages extracted")
+	}
+	for _, file := range files {
+		want, err := ReadRawPage(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readRawFile(file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: DecodeRawPage differs from ReadRawPage", filepath.Base(file))
+		}
+
+		data, _ := os.ReadFile(file)
+		if _, err := DecodeRawPage(bytes.NewReader(data[:len(data)-1])); err == nil {
+			t.Errorf("%s: truncated page decoded without error", filepath.Base(file))
+		}
+	}
+}
+
+func TestDecodeRawPageFonts(t *testing.T) {
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	write(int32(1))
+	write([4]float32{0, 0, 612, 792})
+	write([10]int32{}) // no blocks, lines, chars, edges, links or figures, no label, rotation or dropped content
+	write(int32(0))    // no redactions
+	header := buf.Len()
+	write(int32(2))
+	for _, f := range []struct {
+		name  string
+		flags [2]uint8
+	}{{"ABCDEF+Calibri", [2]uint8{1, 0}}, {"Garamond", [2]uint8{0, 1}}} {
+		write(int32(len(f.name)))
+		buf.WriteString(f.name)
+		write(f.flags)
+	}
+	fonts := buf.Len()
+	write(int32(7)) // chars left out under redactions
+	page, err := DecodeRawPage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []RawFont{{"ABCDEF+Calibri", true, false}, {"Garamond", false, true}}; !reflect.DeepEqual(page.Fonts, want) {
+		t.Errorf("fonts = %+v, want %+v", page.Fonts, want)
+	}
+	if page.RedactedChars != 7 {
+		t.Errorf("redacted chars = %d, want 7", page.RedactedChars)
+	}
+	if page, err := DecodeRawPage(bytes.NewReader(buf.Bytes()[:fonts])); err != nil || len(page.Fonts) != 2 || page.RedactedChars != 0 {
+		t.Errorf("page from before redacted chars were counted: %v, %+v", err, page)
+	}
+	if page, err := DecodeRawPage(bytes.NewReader(buf.Bytes()[:header])); err != nil || page.Fonts != nil {
+		t.Errorf("page from before fonts were recorded: %v, %+v", err, page)
+	}
+}
+
+// writePDF writes a one-page PDF drawing content with font as /F1.
+func writePDF(t *testing.T, content, font string) string {
+	t.Helper()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		font,
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSplitLigatures(t *testing.T) {
+	// "office" set with Helvetica's fi glyph
+	pdf := writePDF(t, "BT /F1 24 Tf 72 700 Td (of\x80ce) Tj ET",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [128 /fi] >> >>")
+	for _, split := range []bool{true, false} {
+		opts := DefaultExtractOptions
+		opts.SplitLigatures = split
+		dir, err := ExtractAllPagesRawWithOptions(pdf, opts)
+		if err != nil {
+			t.Fatalf("extraction failed: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		page, err := ReadRawPage(filepath.Join(dir, "page_001.raw"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var text []rune
+		for _, ch := range page.Chars {
+			text = append(text, ch.Codepoint)
+		}
+		if !split {
+			if string(text) != "o\ufb01ce" {
+				t.Errorf("without splitting: text = %q", string(text))
+			}
+			continue
+		}
+		if string(text) != "office" {
+			t.Fatalf("split: text = %q", string(text))
+		}
+		f, i := page.Chars[2], page.Chars[3]
+		if f.Advance <= 0 || f.Advance != i.Advance || f.BBox.X1 != i.BBox.X0 || i.OriginX <= f.OriginX {
+			t.Errorf("ligature halves f %+v, i %+v", f, i)
+		}
+	}
+}
+
+// skewedPage is a page of lines of text whose baselines slope by degrees.
+func skewedPage(degrees float64) *RawPageData {
+	p := &RawPageData{PageBounds: Rect{X1: 612, Y1: 792}}
+	t := math.Tan(degrees * math.Pi / 180)
+	for l := 0; l < 5; l++ {
+		line := RawLine{CharStart: len(p.Chars)}
+		for c := 0; c < 60; c++ {
+			x := 72 + float64(c)*6
+			y := 100 + float64(l)*14 + (x-72)*t
+			p.Chars = append(p.Chars, RawChar{Codepoint: 'a', Size: 10, BBox: Rect{float32(x), float32(y - 8), float32(x + 6), float32(y + 2)}, OriginX: float32(x), OriginY: float32(y), Advance: 6})
+			line.BBox = union(line.BBox, p.Chars[len(p.Chars)-1].BBox)
+		}
+		if l == 0 {
+			line.BBox = p.Chars[line.CharStart].BBox
+		}
+		line.CharCount = len(p.Chars) - line.CharStart
+		p.Lines = append(p.Lines, line)
+	}
+	p.Blocks = []RawBlock{{BBox: Rect{72, 92, 432, 180}, LineCount: len(p.Lines)}}
+	p.Edges = []Edge{{X0: 72, Y0: 200, X1: 432, Y1: 200, Orientation: 'h'}}
+	return p
+}
+
+func TestReadLayers(t *testing.T) {
+	dir := t.TempDir()
+	if layers, err := ReadLayers(dir); layers != nil || err != nil {
+		t.Errorf("without a layers file: %v, %v", layers, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "layers"), []byte("on\tEnglish\noff\tFran\u00e7ais\non\t\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layers, err := ReadLayers(dir)
+	want := []Layer{{"English", true}, {"Fran\u00e7ais", false}, {"", true}}
+	if err != nil || !reflect.DeepEqual(layers, want) {
+		t.Errorf("got %v, %v, want %v", layers, err, want)
+	}
+	os.WriteFile(filepath.Join(dir, "layers"), []byte("English\n"), 0o644)
+	if _, err := ReadLayers(dir); err == nil {
+		t.Error("no error for a corrupt file")
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	dir := t.TempDir()
+	zipOf := func(names ...string) string {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for _, name := range names {
+			f, _ := w.Create(name)
+			if name == "mimetype" {
+				f.Write([]byte("application/epub+zip"))
+			}
+		}
+		w.Close()
+		return buf.String()
+	}
+	for _, tc := range []struct{ name, content, want string }{
+		{"paper.pdf", "\n%PDF-1.7\n", ""},
+		{"unknown.bin", "\x00\x01\x02", ""},
+		{"book.epub", zipOf("mimetype", "OEBPS/content.opf"), ""},
+		{"comic.cbz", zipOf("001.jpg", "002.jpg"), ""},
+		{"report.docx", zipOf("[Content_Types].xml", "word/document.xml"), "a Word document (DOCX)"},
+		{"files.zip", zipOf("notes.txt"), "a ZIP archive"},
+		{"page.html", "\ufeff  <!DOCTYPE html><html>", "an HTML page"},
+		{"old.doc", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "a Microsoft Office 97-2003 document (DOC, XLS or PPT)"},
+		{"empty.pdf", "", "an empty file"},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := CheckFormat(path)
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+		} else if !errors.Is(err, ErrUnsupportedFormat) || !strings.Contains(err.Error(), " is "+tc.want+", supported formats are PDF") {
+			t.Errorf("%s: %v, want %s", tc.name, err, tc.want)
+		}
+	}
+	if err := CheckFormat(filepath.Join(dir, "missing.pdf")); err != nil {
+		t.Errorf("missing file: %v, left for extraction to report", err)
+	}
+}
+
+func TestCheckFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := os.WriteFile(path, make([]byte, 2048), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, limit := range []int64{0, 2048, 4096} {
+		if err := checkFileSize(path, limit); err != nil {
+			t.Errorf("limit %d: %v", limit, err)
+		}
+	}
+	err := checkFileSize(path, 1024)
+	if !errors.Is(err, ErrTooLarge) || !strings.Contains(err.Error(), "is 2048 bytes, over the limit of 1024") {
+		t.Errorf("limit 1024: %v", err)
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	raw := skewedPage(2)
+	got, angle := Deskew(raw)
+	if math.Abs(angle*180/math.Pi-2) > 0.01 {
+		t.Fatalf("angle = %v degrees, want 2", angle*180/math.Pi)
+	}
+	for i, line := range got.Lines {
+		first, last := got.Chars[line.CharStart], got.Chars[line.CharStart+line.CharCount-1]
+		if math.Abs(float64(first.OriginY-last.OriginY)) > 0.01 {
+			t.Errorf("line %d baseline runs from y %v to %v", i, first.OriginY, last.OriginY)
+		}
+		if h := line.BBox.Y1 - line.BBox.Y0; h > 10.01 {
+			t.Errorf("line %d is %v tall, want 10", i, h)
+		}
+	}
+	if e := got.Edges[0]; e.Y0 != e.Y1 || e.X1-e.X0 != 360 {
+		t.Errorf("edge = %+v, want it horizontal and as long", e)
+	}
+	if raw.Chars[59].OriginY == got.Chars[59].OriginY {
+		t.Error("raw page modified")
+	}
+	if straight, angle := Deskew(skewedPage(0)); angle != 0 || straight.Chars[0] != skewedPage(0).Chars[0] {
+		t.Errorf("straight page turned by %v", angle)
+	}
+	if _, angle := Deskew(skewedPage(30)); angle != 0 {
+		t.Errorf("page set at 30 degrees turned by %v", angle)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build wasip1
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WebAssembly builds carry only the Go half of the pipeline: MuPDF and the C
+// bridge are not in them, so pages are extracted by a native build into a raw
+// directory and converted from there.
+
+func extractAllPages(pdfPath string, opts ExtractOptions) (string, error) {
+	return "", fmt.Errorf("extracting pages needs MuPDF, which WebAssembly builds do not include: %w", errors.ErrUnsupported)
+}
+
+func readPage(filepath string) (*RawPageData, error) {
+	return readRawFile(filepath)
+}
@@ -0,0 +1,159 @@
+// the file system, clock and cpu calls the bridge makes, for POSIX and Windows.
+// paths are UTF-8 throughout, as MuPDF takes them; on Windows they are widened
+// to UTF-16 for the _w* CRT calls so names outside the ANSI code page work.
+#ifndef COMPAT_H
+#define COMPAT_H
+
+#include <errno.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#ifdef _WIN32
+
+#define WIN32_LEAN_AND_MEAN
+#include <windows.h>
+#include <direct.h>
+#include <io.h>
+#include <wchar.h>
+
+#define PATH_SEP "\\"
+
+// a malloc'd UTF-16 copy of s, NULL on failure
+static wchar_t* widen(const char* s) {
+    int n = MultiByteToWideChar(CP_UTF8, 0, s, -1, NULL, 0);
+    if (n <= 0)
+        return NULL;
+    wchar_t* w = malloc(n * sizeof(wchar_t));
+    if (w && !MultiByteToWideChar(CP_UTF8, 0, s, -1, w, n)) {
+        free(w);
+        return NULL;
+    }
+    return w;
+}
+
+static FILE* compat_fopen(const char* path, const char* mode) {
+    wchar_t* wpath = widen(path);
+    wchar_t* wmode = widen(mode);
+    FILE* f = wpath && wmode ? _wfopen(wpath, wmode) : NULL;
+    free(wpath);
+    free(wmode);
+    return f;
+}
+
+static int compat_exists(const char* path) {
+    wchar_t* w = widen(path);
+    int exists = w && _waccess(w, 0) == 0;
+    free(w);
+    return exists;
+}
+
+static int compat_unlink(const char* path) {
+    wchar_t* w = widen(path);
+    int rc = w ? _wunlink(w) : -1;
+    free(w);
+    return rc;
+}
+
+// unlike POSIX rename, replacing an existing file has to be asked for
+static int compat_rename(const char* from, const char* to) {
+    wchar_t* wfrom = widen(from);
+    wchar_t* wto = widen(to);
+    int rc = wfrom && wto && MoveFileExW(wfrom, wto, MOVEFILE_REPLACE_EXISTING) ? 0 : -1;
+    free(wfrom);
+    free(wto);
+    return rc;
+}
+
+static int compat_mkdir(const char* path) {
+    wchar_t* w = widen(path);
+    int rc = w ? _wmkdir(w) : -1;
+    free(w);
+    return rc;
+}
+
+// mkdtemp: fills in the trailing XXXXXX of tmpl and creates that directory,
+// trying other names while they are taken
+static char* compat_mkdtemp(char* tmpl) {
+    static const char letters[] = "abcdefghijklmnopqrstuvwxyz0123456789";
+    size_t len = strlen(tmpl);
+    if (len < 6 || strcmp(tmpl + len - 6, "XXXXXX") != 0)
+        return NULL;
+    unsigned seed = (unsigned)GetTickCount64() ^ (unsigned)GetCurrentProcessId() << 16 ^ (unsigned)GetCurrentThreadId();
+    for (int attempt = 0; attempt < 100; attempt++) {
+        for (int i = 0; i < 6; i++) {
+            seed = seed * 1103515245 + 12345;
+            tmpl[len - 6 + i] = letters[(seed >> 16) % (sizeof(letters) - 1)];
+        }
+        if (compat_mkdir(tmpl) == 0)
+            return tmpl;
+        if (errno != EEXIST)
+            return NULL;
+    }
+    return NULL;
+}
+
+static int compat_cpu_count(void) {
+    SYSTEM_INFO info;
+    GetSystemInfo(&info);
+    return (int)info.dwNumberOfProcessors;
+}
+
+static long long compat_now_ms(void) {
+    return (long long)GetTickCount64();
+}
+
+static void compat_sleep_ms(int ms) {
+    Sleep(ms);
+}
+
+#else
+
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <time.h>
+#include <unistd.h>
+
+#define PATH_SEP "/"
+
+static FILE* compat_fopen(const char* path, const char* mode) {
+    return fopen(path, mode);
+}
+
+static int compat_exists(const char* path) {
+    return access(path, F_OK) == 0;
+}
+
+static int compat_unlink(const char* path) {
+    return unlink(path);
+}
+
+static int compat_rename(const char* from, const char* to) {
+    return rename(from, to);
+}
+
+static int compat_mkdir(const char* path) {
+    return mkdir(path, 0755);
+}
+
+static char* compat_mkdtemp(char* tmpl) {
+    return mkdtemp(tmpl);
+}
+
+static int compat_cpu_count(void) {
+    return (int)sysconf(_SC_NPROCESSORS_ONLN);
+}
+
+static long long compat_now_ms(void) {
+    struct timespec now;
+    clock_gettime(CLOCK_MONOTONIC, &now);
+    return (long long)now.tv_sec * 1000 + now.tv_nsec / 1000000;
+}
+
+static void compat_sleep_ms(int ms) {
+    usleep(ms * 1000);
+}
+
+#endif
+
+#endif // COMPAT_H
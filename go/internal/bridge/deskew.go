@@ -0,0 +1,138 @@
+package bridge
+
+import (
+	"math"
+	"sort"
+)
+
+// Skews below minSkew are left alone, so pages that are straight to the eye
+// keep their coordinates; above maxSkew text is set at an angle on purpose.
+const (
+	minSkew = 0.1 * math.Pi / 180
+	maxSkew = 10 * math.Pi / 180
+)
+
+// Deskew straightens a page scanned at a slight angle, whose sloping baselines
+// break line grouping and table detection. The skew is the median slope of
+// the baselines of its lines of text, weighted by their length in chars; the
+// page is turned back by it about its centre. Chars, links, figures and ruling
+// lines keep their size and orientation and move with their centre; lines and
+// text blocks are rebuilt around their chars. It returns a copy of p and the
+// angle in radians, clockwise as y grows downwards, or p itself and 0 if the
+// page is straight or its skew can't be told.
+func Deskew(p *RawPageData) (*RawPageData, float64) {
+	angle := estimateSkew(p)
+	if math.Abs(angle) < minSkew || math.Abs(angle) > maxSkew {
+		return p, 0
+	}
+	sin, cos := math.Sincos(angle)
+	cx, cy := float64(p.PageBounds.X0+p.PageBounds.X1)/2, float64(p.PageBounds.Y0+p.PageBounds.Y1)/2
+	turn := func(x, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		return cx + dx*cos + dy*sin, cy - dx*sin + dy*cos
+	}
+	move := func(r Rect) Rect {
+		x, y := turn(float64(r.X0+r.X1)/2, float64(r.Y0+r.Y1)/2)
+		w, h := float64(r.X1-r.X0)/2, float64(r.Y1-r.Y0)/2
+		return Rect{float32(x - w), float32(y - h), float32(x + w), float32(y + h)}
+	}
+
+	out := *p
+	out.Chars = make([]RawChar, len(p.Chars))
+	for i, ch := range p.Chars {
+		ch.BBox = move(ch.BBox)
+		x, y := turn(float64(ch.OriginX), float64(ch.OriginY))
+		ch.OriginX, ch.OriginY = float32(x), float32(y)
+		out.Chars[i] = ch
+	}
+	out.Lines = make([]RawLine, len(p.Lines))
+	for i, line := range p.Lines {
+		if line.CharCount == 0 {
+			line.BBox = move(line.BBox)
+		} else {
+			line.BBox = out.Chars[line.CharStart].BBox
+			for _, ch := range out.Chars[line.CharStart+1 : line.CharStart+line.CharCount] {
+				line.BBox = union(line.BBox, ch.BBox)
+			}
+		}
+		out.Lines[i] = line
+	}
+	out.Blocks = make([]RawBlock, len(p.Blocks))
+	for i, block := range p.Blocks {
+		if block.Type != 0 || block.LineCount == 0 {
+			block.BBox = move(block.BBox)
+		} else {
+			block.BBox = out.Lines[block.LineStart].BBox
+			for _, line := range out.Lines[block.LineStart+1 : block.LineStart+block.LineCount] {
+				block.BBox = union(block.BBox, line.BBox)
+			}
+		}
+		out.Blocks[i] = block
+	}
+	out.Edges = make([]Edge, len(p.Edges))
+	for i, e := range p.Edges {
+		x, y := turn((e.X0+e.X1)/2, (e.Y0+e.Y1)/2)
+		w, h := (e.X1-e.X0)/2, (e.Y1-e.Y0)/2
+		out.Edges[i] = Edge{x - w, y - h, x + w, y + h, e.Orientation}
+	}
+	out.Links = make([]RawLink, len(p.Links))
+	for i, l := range p.Links {
+		l.Rect = move(l.Rect)
+		out.Links[i] = l
+	}
+	out.Figures = make([]RawFigure, len(p.Figures))
+	for i, f := range p.Figures {
+		f.BBox = move(f.BBox)
+		out.Figures[i] = f
+	}
+	return &out, angle
+}
+
+// estimateSkew is the weighted median slope of the baselines of p's lines
+// long enough to tell, or 0 if fewer than three are.
+func estimateSkew(p *RawPageData) float64 {
+	type slope struct {
+		angle  float64
+		weight int
+	}
+	var slopes []slope
+	total := 0
+	for _, line := range p.Lines {
+		var n int
+		var sx, sy, sxx, sxy float64
+		var minX, maxX, size float64 = math.Inf(1), math.Inf(-1), 0
+		for _, ch := range p.Chars[line.CharStart : line.CharStart+line.CharCount] {
+			if ch.Codepoint == 0 || ch.Codepoint == ' ' || ch.Advance <= 0 {
+				continue
+			}
+			x, y := float64(ch.OriginX), float64(ch.OriginY)
+			n++
+			sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+			minX, maxX, size = math.Min(minX, x), math.Max(maxX, x), size+float64(ch.Size)
+		}
+		if n < 5 || maxX-minX < 3*size/float64(n) {
+			continue
+		}
+		den := float64(n)*sxx - sx*sx
+		if den == 0 {
+			continue
+		}
+		slopes = append(slopes, slope{math.Atan((float64(n)*sxy - sx*sy) / den), n})
+		total += n
+	}
+	if len(slopes) < 3 {
+		return 0
+	}
+	sort.Slice(slopes, func(i, j int) bool { return slopes[i].angle < slopes[j].angle })
+	seen := 0
+	for _, s := range slopes {
+		if seen += s.weight; 2*seen >= total {
+			return s.angle
+		}
+	}
+	return 0
+}
+
+func union(a, b Rect) Rect {
+	return Rect{min(a.X0, b.X0), min(a.Y0, b.Y0), max(a.X1, b.X1), max(a.Y1, b.Y1)}
+}
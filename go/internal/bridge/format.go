@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned, wrapped with the type detected, for files
+// MuPDF cannot open, such as Word documents or web pages, rather than letting
+// extraction fail without saying why.
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// SupportedFormats are the types of files MuPDF opens.
+var SupportedFormats = []string{"PDF", "XPS", "EPUB", "CBZ", "PNG", "JPEG", "TIFF", "GIF", "BMP"}
+
+// CheckFormat returns an ErrUnsupportedFormat naming the type of the file at
+// path if it is one MuPDF cannot open. Files of no type it knows are left for
+// MuPDF to try, as it repairs PDFs whose header is missing.
+func CheckFormat(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil // for extraction to report
+	}
+	defer f.Close()
+	head := make([]byte, 1024)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil
+	}
+	kind := sniffFormat(head[:n])
+	if kind == "ZIP" {
+		kind = zipFormat(f)
+	}
+	if kind == "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s, supported formats are %s", ErrUnsupportedFormat, path, kind, strings.Join(SupportedFormats, ", "))
+}
+
+// sniffFormat names what the first bytes of a file say it is, if that is not
+// something MuPDF opens: "" for a supported or unknown type, "ZIP" for an
+// archive whose entries tell.
+func sniffFormat(head []byte) string {
+	text := bytes.ToLower(bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n"))
+	switch {
+	case len(head) == 0:
+		return "an empty file"
+	case bytes.Contains(head, []byte("%PDF")):
+		return ""
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "ZIP"
+	case bytes.HasPrefix(head, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		return "a Microsoft Office 97-2003 document (DOC, XLS or PPT)"
+	case bytes.HasPrefix(head, []byte("{\\rtf")):
+		return "an RTF document"
+	case bytes.HasPrefix(text, []byte("<!doctype html")), bytes.HasPrefix(text, []byte("<html")), bytes.HasPrefix(text, []byte("<?xml")) && bytes.Contains(text, []byte("<html")):
+		return "an HTML page"
+	}
+	return ""
+}
+
+// zipFormat names the kind of ZIP archive f is, by its entries: "" for the
+// XPS, EPUB and CBZ files MuPDF opens.
+func zipFormat(f *os.File) string {
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	r, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return "" // a PDF with a stray header, or a damaged archive for MuPDF to judge
+	}
+	images := 0
+	for _, file := range r.File {
+		switch name := file.Name; {
+		case strings.HasPrefix(name, "word/"):
+			return "a Word document (DOCX)"
+		case strings.HasPrefix(name, "xl/"):
+			return "an Excel workbook (XLSX)"
+		case strings.HasPrefix(name, "ppt/"):
+			return "a PowerPoint presentation (PPTX)"
+		case strings.HasSuffix(strings.ToLower(name), ".fdseq"), name == "mimetype" && zipEntryIs(file, "application/epub+zip"):
+			return ""
+		case name == "mimetype" && zipEntryIs(file, "application/vnd.oasis.opendocument."):
+			return "an OpenDocument file (ODT, ODS or ODP)"
+		}
+		switch strings.ToLower(path.Ext(file.Name)) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".jp2", ".jxr":
+			images++
+		}
+	}
+	if images > 0 {
+		return "" // a comic book archive
+	}
+	return "a ZIP archive"
+}
+
+// zipEntryIs reports whether the entry's content starts with prefix.
+func zipEntryIs(file *zip.File, prefix string) bool {
+	rc, err := file.Open()
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	content := make([]byte, len(prefix))
+	_, err = io.ReadFull(rc, content)
+	return err == nil && string(content) == prefix
+}
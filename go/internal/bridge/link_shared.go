@@ -0,0 +1,6 @@
+//go:build cgo && !purego && !static
+
+package bridge
+
+// #cgo LDFLAGS: -L${SRCDIR}/../../../lib/mupdf -lmupdf -lm -lpthread
+import "C"
@@ -0,0 +1,10 @@
+//go:build cgo && !purego && static
+
+package bridge
+
+// Built with -tags static, MuPDF is linked into the binary or shared library
+// from the archives `make mupdf-static` puts in lib/mupdf, so nothing has to be
+// found at runtime.
+
+// #cgo LDFLAGS: ${SRCDIR}/../../../lib/mupdf/libmupdf.a ${SRCDIR}/../../../lib/mupdf/libmupdf-third.a -lm -lpthread
+import "C"
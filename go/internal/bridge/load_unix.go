@@ -0,0 +1,9 @@
+//go:build (!cgo || purego) && !windows && !wasip1
+
+package bridge
+
+import "github.com/ebitengine/purego"
+
+func openLibrary(path string) (uintptr, error) {
+	return purego.Dlopen(path, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+}
@@ -0,0 +1,31 @@
+//go:build (!cgo || purego) && windows
+
+package bridge
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var loadLibraryEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LoadLibraryExW")
+
+// openLibrary loads the DLL with its own directory searched for its
+// dependencies, so a libmupdf.dll next to it is found without touching PATH.
+func openLibrary(path string) (uintptr, error) {
+	const searchDLLLoadDir, searchDefaultDirs = 0x100, 0x1000
+	flags := uintptr(searchDefaultDirs)
+	if filepath.IsAbs(path) {
+		flags |= searchDLLLoadDir
+	}
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	h, _, err := loadLibraryEx.Call(uintptr(unsafe.Pointer(name)), 0, flags)
+	if h == 0 {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// the raw page file format, as bridge.c writes it: its structs dumped in the
+// host's byte order (little-endian everywhere the bridge is built), padding
+// included, so it is read back here field by field for builds without the C
+// side (see DecodeRawPage).
+type (
+	rawBlock struct {
+		Type                 uint8
+		_                    [3]byte
+		BBox                 [4]float32
+		LineStart, LineCount int32
+	}
+	rawLine struct {
+		BBox                 [4]float32
+		CharStart, CharCount int32
+	}
+	rawChar struct {
+		Codepoint                      int32
+		Size                           float32
+		BBox                           [4]float32
+		OriginX, OriginY, Advance      float32
+		IsBold, IsItalic, IsMonospaced uint8
+		_                              byte
+	}
+	rawEdge struct {
+		X0, Y0, X1, Y1 float64
+		Orientation    byte
+		_              [7]byte
+	}
+)
+
+// rawLabelMax is PAGE_LABEL_MAX in bridge.c.
+const rawLabelMax = 128
+
+// DecodeRawPage reads a page_NNN.raw file written by the bridge without going
+// through C, giving what ReadRawPage does. It lets builds without MuPDF, such as
+// WebAssembly, convert pages extracted elsewhere.
+func DecodeRawPage(r io.Reader) (*RawPageData, error) {
+	d := rawDecoder{r: r}
+	var header struct {
+		PageNumber int32
+		Bounds     [4]float32
+		Blocks     int32
+		Lines      int32
+		Chars      int32
+		Edges      int32
+		Links      int32
+		Figures    int32
+	}
+	d.read(&header)
+	label := d.string(rawLabelMax)
+	var trailer struct{ Rotation, DroppedChars, DroppedEdges int32 }
+	d.read(&trailer)
+	if d.err != nil {
+		return nil, d.err
+	}
+	page := &RawPageData{
+		PageNumber:   int(header.PageNumber),
+		PageLabel:    label,
+		Rotation:     int(trailer.Rotation),
+		DroppedChars: int(trailer.DroppedChars),
+		DroppedEdges: int(trailer.DroppedEdges),
+		PageBounds:   rawRect(header.Bounds),
+	}
+
+	blocks := make([]rawBlock, d.count(header.Blocks))
+	lines := make([]rawLine, d.count(header.Lines))
+	chars := make([]rawChar, d.count(header.Chars))
+	edges := make([]rawEdge, d.count(header.Edges))
+	d.read(blocks)
+	d.read(lines)
+	d.read(chars)
+	d.read(edges)
+	page.Blocks = make([]RawBlock, len(blocks))
+	for i, b := range blocks {
+		page.Blocks[i] = RawBlock{Type: b.Type, BBox: rawRect(b.BBox), LineStart: int(b.LineStart), LineCount: int(b.LineCount)}
+	}
+	page.Lines = make([]RawLine, len(lines))
+	for i, l := range lines {
+		page.Lines[i] = RawLine{BBox: rawRect(l.BBox), CharStart: int(l.CharStart), CharCount: int(l.CharCount)}
+	}
+	page.Chars = make([]RawChar, len(chars))
+	for i, c := range chars {
+		page.Chars[i] = RawChar{Codepoint: rune(c.Codepoint), Size: c.Size, BBox: rawRect(c.BBox), OriginX: c.OriginX, OriginY: c.OriginY, Advance: c.Advance, IsBold: c.IsBold != 0, IsItalic: c.IsItalic != 0, IsMonospaced: c.IsMonospaced != 0}
+	}
+	page.Edges = make([]Edge, len(edges))
+	for i, e := range edges {
+		page.Edges[i] = Edge{e.X0, e.Y0, e.X1, e.Y1, e.Orientation}
+	}
+
+	page.Links = make([]RawLink, d.count(header.Links))
+	for i := range page.Links {
+		var rect [4]float32
+		d.read(&rect)
+		page.Links[i] = RawLink{Rect: rawRect(rect), URI: d.string(-1)}
+	}
+	page.Figures = make([]RawFigure, d.count(header.Figures))
+	for i := range page.Figures {
+		var bbox [4]float32
+		d.read(&bbox)
+		alt := d.string(-1)
+		page.Figures[i] = RawFigure{BBox: rawRect(bbox), Alt: alt, Image: d.string(-1)}
+	}
+	// pages extracted before redactions were recorded end here
+	var redactions int32
+	if d.err == nil {
+		if err := binary.Read(d.r, binary.LittleEndian, &redactions); err != nil && err != io.EOF {
+			d.err = fmt.Errorf("truncated raw page: %w", err)
+		}
+	}
+	for i := 0; i < d.count(redactions); i++ {
+		var rect [4]float32
+		d.read(&rect)
+		page.Redactions = append(page.Redactions, rawRect(rect))
+	}
+	// and those before fonts were
+	var fonts int32
+	if d.err == nil {
+		if err := binary.Read(d.r, binary.LittleEndian, &fonts); err != nil && err != io.EOF {
+			d.err = fmt.Errorf("truncated raw page: %w", err)
+		}
+	}
+	for i := 0; i < d.count(fonts); i++ {
+		name := d.string(-1)
+		var flags struct{ Embedded, Substituted uint8 }
+		d.read(&flags)
+		page.Fonts = append(page.Fonts, RawFont{Name: name, Embedded: flags.Embedded != 0, Substituted: flags.Substituted != 0})
+	}
+	// and those before the text under redactions was left out
+	var redacted int32
+	if d.err == nil {
+		if err := binary.Read(d.r, binary.LittleEndian, &redacted); err != nil && err != io.EOF {
+			d.err = fmt.Errorf("truncated raw page: %w", err)
+		}
+	}
+	page.RedactedChars = int(redacted)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return page, nil
+}
+
+// readRawFile decodes the raw page file at path with DecodeRawPage.
+func readRawFile(path string) (*RawPageData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeRawPage(bufio.NewReader(f))
+}
+
+func rawRect(r [4]float32) Rect { return Rect{r[0], r[1], r[2], r[3]} }
+
+// rawDecoder reads little-endian values, keeping the first error so the
+// caller checks once.
+type rawDecoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *rawDecoder) read(v any) {
+	if d.err != nil {
+		return
+	}
+	if err := binary.Read(d.r, binary.LittleEndian, v); err != nil {
+		d.err = fmt.Errorf("truncated raw page: %w", err)
+	}
+}
+
+// count checks a length from the file before anything is allocated for it.
+func (d *rawDecoder) count(n int32) int {
+	if n < 0 && d.err == nil {
+		d.err = errors.New("corrupt raw page: negative count")
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// string reads a length-prefixed string, of fewer than limit bytes if limit > 0.
+func (d *rawDecoder) string(limit int) string {
+	var n int32
+	d.read(&n)
+	if d.err == nil && limit > 0 && int(n) >= limit {
+		d.err = errors.New("corrupt raw page: label too long")
+	}
+	buf := make([]byte, d.count(n))
+	if d.err == nil {
+		if _, err := io.ReadFull(d.r, buf); err != nil {
+			d.err = fmt.Errorf("truncated raw page: %w", err)
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,137 @@
+package bundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type Manifest struct {
+	SchemaVersion int                   `json:"schema_version"` // of the page files, see models.SchemaVersion
+	Source        string                `json:"source"`
+	SourceSHA256  string                `json:"source_sha256"`
+	CreatedBy     string                `json:"created_by"`
+	PageCount     int                   `json:"page_count"`
+	Metadata      *models.PaperMetadata `json:"metadata,omitempty"`
+	Fingerprint   *models.Fingerprint   `json:"fingerprint,omitempty"`
+	Layers        []models.Layer        `json:"layers,omitempty"`
+	Repaired      bool                  `json:"repaired,omitempty"`
+	Fonts         []models.Font         `json:"fonts,omitempty"`
+	Files         []File                `json:"files"`
+}
+
+// Write packs a converted document into a zip archive holding document.md,
+// one pages/page_NNN.json per page, the figure images under images/ and a
+// manifest.json listing the SHA-256 of every file and of the source PDF.
+// Figures sharing an image, as after extractor.DedupImages, share its file.
+// Figure blocks and the scans of scanned pages are pointed at their image
+// inside the archive, so doc's pages are modified in place.
+func Write(out io.Writer, pdfPath string, doc models.Document) error {
+	return WriteWithOptions(out, pdfPath, doc, markdown.DefaultOptions)
+}
+
+// WriteWithOptions is Write with document.md rendered with md.
+func WriteWithOptions(out io.Writer, pdfPath string, doc models.Document, md markdown.Options) error {
+	pages := doc.Pages
+	sourceHash, err := hashFile(pdfPath)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	manifest := Manifest{SchemaVersion: models.SchemaVersion, Source: filepath.Base(pdfPath), SourceSHA256: sourceHash, CreatedBy: "fibrum-pdf", PageCount: len(pages), Metadata: doc.Metadata, Fingerprint: doc.Fingerprint, Layers: doc.Layers, Repaired: doc.Repaired, Fonts: doc.Fonts, Files: []File{}}
+	add := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, File{Path: name, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))})
+		return nil
+	}
+
+	images := map[string]string{} // saved image to its path in the archive, for figures sharing one
+	bundleImage := func(path *string) error {
+		if name, ok := images[*path]; ok {
+			*path = name
+			return nil
+		}
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return err
+		}
+		name := "images/" + filepath.Base(*path)
+		images[*path], *path = name, name
+		return add(name, data)
+	}
+	for p := range pages {
+		if pages[p].Scan != "" {
+			if err := bundleImage(&pages[p].Scan); err != nil {
+				return err
+			}
+		}
+		for b := range pages[p].Data {
+			block := &pages[p].Data[b]
+			if block.Type != models.BlockFigure || block.Image == "" {
+				continue
+			}
+			if err := bundleImage(&block.Image); err != nil {
+				return err
+			}
+		}
+	}
+	for _, page := range pages {
+		data, err := json.Marshal(page)
+		if err != nil {
+			return err
+		}
+		if err := add(fmt.Sprintf("pages/page_%03d.json", page.Number), data); err != nil {
+			return err
+		}
+	}
+	if err := add("document.md", []byte(markdown.DocumentWithOptions(pages, md))); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,60 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "doc.pdf")
+	img := filepath.Join(dir, "page_001_img_01.png")
+	os.WriteFile(pdf, []byte("%PDF-1.7"), 0o644)
+	os.WriteFile(img, []byte("png bytes"), 0o644)
+	pages := []models.Page{{Number: 1, Data: []models.Block{
+		{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "Title"}}},
+		{Type: models.BlockFigure, Image: img},
+	}}, {Number: 2, Scan: img, Data: []models.Block{
+		{Type: models.BlockFigure, Image: img},
+	}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, pdf, models.Document{Pages: pages}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if got, want := files["document.md"], "# Title\n\n![Figure](images/page_001_img_01.png)\n\n---\n\n![Figure](images/page_001_img_01.png)\n"; got != want {
+		t.Errorf("document.md = %q, want %q", got, want)
+	}
+	if files["images/page_001_img_01.png"] != "png bytes" {
+		t.Errorf("image not bundled")
+	}
+	var page2 struct{ Scan string }
+	if err := json.Unmarshal([]byte(files["pages/page_002.json"]), &page2); err != nil || page2.Scan != "images/page_001_img_01.png" {
+		t.Errorf("page 2 scan = %q (%v), want the bundled image", page2.Scan, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != "doc.pdf" || m.PageCount != 2 || len(m.Files) != 4 || len(m.SourceSHA256) != 64 {
+		t.Errorf("manifest = %+v", m)
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+)
+
+// Cache stores finished conversion outputs in a directory, one file per key.
+type Cache struct {
+	Dir string
+}
+
+// Key identifies a conversion by the PDF's contents, the options that shape
+// the output and the build of the converter, so upgrading invalidates entries
+// made by an older version. opts may be any JSON-encodable value.
+func Key(pdfPath string, opts any) (string, error) {
+	f, err := os.Open(pdfPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	pdfHash := sha256.New()
+	if _, err := io.Copy(pdfHash, f); err != nil {
+		return "", err
+	}
+	optsJSON, err := json.Marshal(struct {
+		Options any
+		Build   string
+	}{opts, Build()})
+	if err != nil {
+		return "", err
+	}
+	optsHash := sha256.Sum256(optsJSON)
+	return hex.EncodeToString(pdfHash.Sum(nil)) + "-" + hex.EncodeToString(optsHash[:8]), nil
+}
+
+// Build identifies the converter binary: its module version and the VCS
+// revision it was built from, and whether the tree was modified.
+func Build() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	id := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+			id += " " + s.Value
+		}
+	}
+	return id
+}
+
+func (c Cache) path(key string) string { return filepath.Join(c.Dir, key) }
+
+// Get copies the entry for key to dst and reports whether there was one.
+func (c Cache) Get(key, dst string) (bool, error) {
+	if _, err := os.Stat(c.path(key)); err != nil {
+		return false, nil
+	}
+	return true, copyFile(c.path(key), dst)
+}
+
+// Put stores a copy of src under key. Conversions of the same PDF running at
+// once each write their own temp file, and the last to finish wins.
+func (c Cache) Put(key, src string) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.path(key))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
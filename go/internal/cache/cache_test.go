@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "doc.pdf")
+	os.WriteFile(pdf, []byte("%PDF-1.7"), 0o644)
+
+	k1, err := Key(pdf, map[string]any{"format": "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := Key(pdf, map[string]any{"format": "parquet"})
+	if k1 == k2 {
+		t.Error("different options should give different keys")
+	}
+
+	c := Cache{Dir: filepath.Join(dir, "cache")}
+	out := filepath.Join(dir, "out.json")
+	if hit, err := c.Get(k1, out); hit || err != nil {
+		t.Fatalf("empty cache hit=%v err=%v", hit, err)
+	}
+	os.WriteFile(out, []byte(`[{"page":1}]`), 0o644)
+	if err := c.Put(k1, out); err != nil {
+		t.Fatal(err)
+	}
+	again := filepath.Join(dir, "again.json")
+	if hit, err := c.Get(k1, again); !hit || err != nil {
+		t.Fatalf("hit=%v err=%v", hit, err)
+	}
+	if data, _ := os.ReadFile(again); string(data) != `[{"page":1}]` {
+		t.Errorf("cached output = %q", data)
+	}
+}
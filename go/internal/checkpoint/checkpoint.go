@@ -0,0 +1,125 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pymupdf4llm-c/go/internal/cache"
+	"github.com/pymupdf4llm-c/go/internal/logger"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+var Logger = logger.GetLogger("checkpoint")
+
+const keyFile = "checkpoint.json"
+
+// Checkpoint keeps the raw and processed pages of a conversion in a directory
+// so an interrupted run can pick up where it stopped. It is tied to one PDF and
+// one set of options; opening it for anything else starts it over.
+type Checkpoint struct {
+	Dir string
+}
+
+type key struct {
+	PDF     string `json:"pdf_sha256"`
+	Options string `json:"options_sha256"`
+	Build   string `json:"build"` // raw pages from another build may be laid out differently
+}
+
+// Open resumes the checkpoint in dir if it was made for the same PDF contents
+// and options by the same build, and otherwise clears it. opts may be any
+// JSON-encodable value holding the options that affect page output.
+func Open(dir, pdfPath string, opts any) (*Checkpoint, error) {
+	pdfHash, err := hashFile(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	optsHash := sha256.Sum256(optsJSON)
+	want, err := json.Marshal(key{pdfHash, hex.EncodeToString(optsHash[:]), cache.Build()})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{Dir: dir}
+	if have, err := os.ReadFile(filepath.Join(dir, keyFile)); err == nil && bytes.Equal(have, want) {
+		Logger.Info("resuming from checkpoint", "dir", dir, "pages", c.count())
+		return c, nil
+	} else if err == nil {
+		Logger.Info("checkpoint is for another PDF or options, starting over", "dir", dir)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.RawDir(), 0o755); err != nil {
+		return nil, err
+	}
+	return c, os.WriteFile(filepath.Join(dir, keyFile), want, 0o644)
+}
+
+// RawDir is where the raw page data is extracted to.
+func (c *Checkpoint) RawDir() string { return filepath.Join(c.Dir, "raw") }
+
+func (c *Checkpoint) pagePath(rawFile string) string {
+	return filepath.Join(c.Dir, filepath.Base(rawFile)+".gob")
+}
+
+// Load returns the processed page stored for the given raw page file.
+func (c *Checkpoint) Load(rawFile string) (models.Page, bool) {
+	var page models.Page
+	f, err := os.Open(c.pagePath(rawFile))
+	if err != nil {
+		return page, false
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&page); err != nil {
+		Logger.Warn("unreadable checkpoint page, redoing it", "file", f.Name(), "err", err)
+		return models.Page{}, false
+	}
+	return page, true
+}
+
+// Save records page as done. The file is renamed into place so a crash never
+// leaves a partial page behind.
+func (c *Checkpoint) Save(rawFile string, page models.Page) error {
+	path := c.pagePath(rawFile)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(page); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Remove deletes the checkpoint once the conversion has finished.
+func (c *Checkpoint) Remove() error { return os.RemoveAll(c.Dir) }
+
+func (c *Checkpoint) count() int {
+	matches, _ := filepath.Glob(filepath.Join(c.Dir, "*.gob"))
+	return len(matches)
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,67 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestCheckpointResumes(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "doc.pdf")
+	os.WriteFile(pdf, []byte("%PDF-1.7 one"), 0o644)
+	ckptDir := filepath.Join(dir, "ckpt")
+	opts := map[string]any{"box": "crop"}
+
+	c, err := Open(ckptDir, pdf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := models.Page{Number: 2, Label: "ii", Data: []models.Block{{Type: models.BlockText, Spans: []models.Span{{Text: "hi", Style: models.TextStyle{Bold: true}, URI: "https://x"}}}}}
+	raw := filepath.Join(c.RawDir(), "page_002.raw")
+	if err := c.Save(raw, page); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(ckptDir, pdf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := c.Load(raw)
+	if !ok || !reflect.DeepEqual(got, page) {
+		t.Fatalf("resumed page = %+v, %v", got, ok)
+	}
+
+	var k key
+	data, _ := os.ReadFile(filepath.Join(ckptDir, keyFile))
+	json.Unmarshal(data, &k)
+	k.Build = "v0.0.1 older"
+	data, _ = json.Marshal(k)
+	os.WriteFile(filepath.Join(ckptDir, keyFile), data, 0o644)
+	if c, err = Open(ckptDir, pdf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Load(raw); ok {
+		t.Error("a checkpoint from another build should be discarded")
+	}
+	c.Save(raw, page)
+
+	c, err = Open(ckptDir, pdf, map[string]any{"box": "media"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Load(raw); ok {
+		t.Error("changing options should discard the checkpoint")
+	}
+	c.Save(raw, page)
+	os.WriteFile(pdf, []byte("%PDF-1.7 two"), 0o644)
+	if c, _ = Open(ckptDir, pdf, map[string]any{"box": "media"}); c != nil {
+		if _, ok := c.Load(raw); ok {
+			t.Error("changing the PDF should discard the checkpoint")
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// Chunk has the shape of a LangChain Document and a LlamaIndex node:
+// page_content with the text and a flat metadata object.
+type Chunk struct {
+	PageContent string   `json:"page_content"`
+	Metadata    Metadata `json:"metadata"`
+}
+
+type Metadata struct {
+	Source      string        `json:"source"`
+	Page        int           `json:"page"`
+	HeadingPath []string      `json:"heading_path"`
+	BlockTypes  []string      `json:"block_types"`
+	BBoxes      []models.BBox `json:"bboxes"`
+	Ordinals    []int         `json:"ordinals"`              // of the blocks in the document, see models.Block
+	HeaderText  string        `json:"header_text,omitempty"` // of the page, see models.Page
+	FooterText  string        `json:"footer_text,omitempty"`
+	Tokens      int           `json:"tokens,omitempty"`
+}
+
+type heading struct {
+	level int
+	text  string
+}
+
+// Split cuts the document into one chunk per section per page: a new chunk
+// starts at every heading and at every page break. Each chunk carries the
+// titles of the headings it sits under, outermost first.
+func Split(source string, pages []models.Page) []Chunk {
+	return SplitWithOptions(source, pages, markdown.DefaultOptions)
+}
+
+// SplitWithOptions is Split with the chunks' Markdown rendered with md.
+func SplitWithOptions(source string, pages []models.Page, md markdown.Options) []Chunk {
+	var (
+		chunks []Chunk
+		path   []heading
+		cur    *Chunk
+		parts  []string
+	)
+	flush := func() {
+		if cur != nil && len(parts) > 0 {
+			cur.PageContent = strings.Join(parts, "\n")
+			chunks = append(chunks, *cur)
+		}
+		cur, parts = nil, nil
+	}
+	for _, page := range pages {
+		flush()
+		for _, b := range page.Data {
+			content := markdown.ContentWithOptions(b, md)
+			if content == "" {
+				continue
+			}
+			if b.Type == models.BlockHeading {
+				flush()
+				for len(path) > 0 && path[len(path)-1].level >= b.Level {
+					path = path[:len(path)-1]
+				}
+				path = append(path, heading{b.Level, strings.TrimSpace(spansText(b.Spans))})
+			}
+			if cur == nil {
+				titles := make([]string, len(path))
+				for i, h := range path {
+					titles[i] = h.text
+				}
+				cur = &Chunk{Metadata: Metadata{Source: source, Page: page.Number, HeadingPath: titles, HeaderText: page.HeaderText, FooterText: page.FooterText}}
+			}
+			parts = append(parts, content)
+			cur.Metadata.BlockTypes = append(cur.Metadata.BlockTypes, string(b.Type))
+			cur.Metadata.BBoxes = append(cur.Metadata.BBoxes, b.BBox)
+			cur.Metadata.Ordinals = append(cur.Metadata.Ordinals, b.Ordinal)
+		}
+	}
+	flush()
+	return chunks
+}
+
+func spansText(spans []models.Span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
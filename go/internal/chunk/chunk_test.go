@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func headingBlock(level int, text string) models.Block {
+	return models.Block{Type: models.BlockHeading, Level: level, Spans: []models.Span{{Text: text}}}
+}
+
+func para(text string) models.Block {
+	return models.Block{Type: models.BlockText, Spans: []models.Span{{Text: text}}}
+}
+
+func TestSplit(t *testing.T) {
+	pages := []models.Page{
+		{Number: 1, Data: []models.Block{headingBlock(1, "Guide"), para("intro"), headingBlock(2, "Setup"), para("install it")}},
+		{Number: 2, HeaderText: "Guide", Data: []models.Block{para("more setup"), headingBlock(2, "Usage"), para("run it")}},
+	}
+	chunks := Split("guide.pdf", pages)
+	want := []struct {
+		content string
+		page    int
+		path    []string
+		types   []string
+	}{
+		{"# Guide\nintro", 1, []string{"Guide"}, []string{"heading", "text"}},
+		{"## Setup\ninstall it", 1, []string{"Guide", "Setup"}, []string{"heading", "text"}},
+		{"more setup", 2, []string{"Guide", "Setup"}, []string{"text"}},
+		{"## Usage\nrun it", 2, []string{"Guide", "Usage"}, []string{"heading", "text"}},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i, w := range want {
+		c := chunks[i]
+		if c.PageContent != w.content || c.Metadata.Page != w.page || !reflect.DeepEqual(c.Metadata.HeadingPath, w.path) || !reflect.DeepEqual(c.Metadata.BlockTypes, w.types) {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, w)
+		}
+		if c.Metadata.Source != "guide.pdf" || len(c.Metadata.BBoxes) != len(w.types) || (c.Metadata.HeaderText == "Guide") != (w.page == 2) {
+			t.Errorf("chunk %d metadata = %+v", i, c.Metadata)
+		}
+	}
+}
+
+func TestPageChunks(t *testing.T) {
+	doc := models.Document{Metadata: &models.PaperMetadata{Title: "Guide", Authors: "A. Author"}, Pages: []models.Page{
+		{Number: 1, Data: []models.Block{headingBlock(1, "Guide"), para("intro")}},
+		{Number: 2, Data: []models.Block{
+			{Type: models.BlockTable, BBox: models.BBox{72, 100, 540, 200}, RowCount: 3, ColCount: 2},
+			{Type: models.BlockFigure, BBox: models.BBox{72, 300, 300, 400}},
+		}},
+	}}
+	chunks := PageChunks("/data/guide.pdf", doc, markdown.DefaultOptions)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	data, err := json.Marshal(chunks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first map[string]any
+	if err := json.Unmarshal(data, &first); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"metadata", "toc_items", "tables", "images", "graphics", "text", "words"} {
+		if _, ok := first[key]; !ok {
+			t.Errorf("no %q in %s", key, data)
+		}
+	}
+	meta := first["metadata"].(map[string]any)
+	if meta["title"] != "Guide" || meta["file_path"] != "/data/guide.pdf" || meta["page_count"] != 2.0 || meta["page"] != 1.0 {
+		t.Errorf("metadata = %v", meta)
+	}
+	if toc := first["toc_items"].([]any); len(toc) != 1 || !reflect.DeepEqual(toc[0], []any{1.0, "Guide", 1.0}) {
+		t.Errorf("toc_items = %v", toc)
+	}
+	if first["text"] != "# Guide\n\nintro\n" {
+		t.Errorf("text = %q", first["text"])
+	}
+	second := chunks[1]
+	if second.Metadata.Title != "Guide" || second.Metadata.Page != 2 || len(second.TOCItems) != 0 {
+		t.Errorf("second page metadata %+v, toc %v", second.Metadata, second.TOCItems)
+	}
+	if len(second.Tables) != 1 || second.Tables[0].Rows != 3 || second.Tables[0].Columns != 2 || len(second.Images) != 1 || second.Images[0].BBox[1] != 300 {
+		t.Errorf("tables %+v, images %+v", second.Tables, second.Images)
+	}
+}
@@ -0,0 +1,94 @@
+package chunk
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// PageChunk has the layout of the page dicts pymupdf4llm's
+// to_markdown(page_chunks=True) returns, so its consumers can read this
+// output unchanged. Graphics and words are always empty.
+type PageChunk struct {
+	Metadata PageMetadata `json:"metadata"`
+	TOCItems []TOCItem    `json:"toc_items"`
+	Tables   []PageTable  `json:"tables"`
+	Images   []PageImage  `json:"images"`
+	Graphics []any        `json:"graphics"`
+	Text     string       `json:"text"`
+	Words    []any        `json:"words"`
+}
+
+// PageMetadata is PyMuPDF's document metadata with the file and page added.
+// The PDF's own information dictionary is not extracted, so only the title
+// and author detected on the first page are filled in.
+type PageMetadata struct {
+	Format       string `json:"format"`
+	Title        string `json:"title"`
+	Author       string `json:"author"`
+	Subject      string `json:"subject"`
+	Keywords     string `json:"keywords"`
+	Creator      string `json:"creator"`
+	Producer     string `json:"producer"`
+	CreationDate string `json:"creationDate"`
+	ModDate      string `json:"modDate"`
+	Trapped      string `json:"trapped"`
+	Encryption   any    `json:"encryption"`
+	FilePath     string `json:"file_path"`
+	PageCount    int    `json:"page_count"`
+	Page         int    `json:"page"`
+}
+
+// TOCItem is an entry of the table of contents on a page, written as
+// [level, title, page] as PyMuPDF's get_toc has them. Without the PDF's
+// outline, these are the headings extracted from the page.
+type TOCItem struct {
+	Level int
+	Title string
+	Page  int
+}
+
+func (t TOCItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{t.Level, t.Title, t.Page})
+}
+
+type PageTable struct {
+	BBox    models.BBox `json:"bbox"`
+	Rows    int         `json:"rows"`
+	Columns int         `json:"columns"`
+}
+
+type PageImage struct {
+	Number int         `json:"number"`
+	BBox   models.BBox `json:"bbox"`
+}
+
+// PageChunks returns one PageChunk per page of doc, converted from path, with
+// the page's Markdown rendered with md.
+func PageChunks(path string, doc models.Document, md markdown.Options) []PageChunk {
+	pages := doc.Pages
+	meta := PageMetadata{FilePath: path, PageCount: len(pages)}
+	if doc.Metadata != nil {
+		meta.Title, meta.Author = doc.Metadata.Title, doc.Metadata.Authors
+	}
+	chunks := make([]PageChunk, len(pages))
+	for i, page := range pages {
+		c := PageChunk{Metadata: meta, TOCItems: []TOCItem{}, Tables: []PageTable{}, Images: []PageImage{}, Graphics: []any{}, Words: []any{}}
+		c.Metadata.Page = page.Number
+		for _, b := range page.Data {
+			switch b.Type {
+			case models.BlockHeading:
+				c.TOCItems = append(c.TOCItems, TOCItem{b.Level, strings.TrimSpace(spansText(b.Spans)), page.Number})
+			case models.BlockTable:
+				c.Tables = append(c.Tables, PageTable{b.BBox, b.RowCount, b.ColCount})
+			case models.BlockFigure:
+				c.Images = append(c.Images, PageImage{len(c.Images), b.BBox})
+			}
+		}
+		c.Text = markdown.PageWithOptions(page, md)
+		chunks[i] = c
+	}
+	return chunks
+}
@@ -0,0 +1,132 @@
+// Package classify runs an external program as an extractor.Classifier, so a
+// model trained on a corpus can decide block types without a fork of the
+// extractor.
+package classify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pymupdf4llm-c/go/internal/extractor"
+	"github.com/pymupdf4llm-c/go/internal/logger"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+var Logger = logger.GetLogger("classify")
+
+// request is one line written to the program: the block's features with the
+// type and heading level the heuristics chose.
+type request struct {
+	extractor.Features
+	Type  models.BlockType `json:"type"`
+	Level int              `json:"level,omitempty"`
+}
+
+// response is the line the program answers with. Fields it leaves out keep
+// the heuristics' choice, so {} changes nothing.
+type response struct {
+	Type  models.BlockType `json:"type"`
+	Level *int             `json:"level"`
+}
+
+// Command is a Classifier backed by a long-running process. It writes one JSON
+// object per text block to the process's stdin and reads one JSON object per
+// line back from its stdout. Calls are serialized. Once the process fails,
+// every block keeps the heuristics' type and Close reports the failure.
+type Command struct {
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+	enc  *json.Encoder
+	out  *bufio.Scanner
+	err  error
+	done bool
+}
+
+// Start runs command, split on spaces into the program and its arguments.
+// The program's stderr goes to ours.
+func Start(command string) (*Command, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty classifier command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start classifier: %w", err)
+	}
+	c := &Command{cmd: cmd, in: in, out: bufio.NewScanner(out)}
+	c.enc = json.NewEncoder(in)
+	c.enc.SetEscapeHTML(false)
+	c.out.Buffer(make([]byte, 64*1024), 16<<20)
+	return c, nil
+}
+
+func (c *Command) Classify(f extractor.Features, typ models.BlockType, level int) (models.BlockType, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || c.done {
+		return typ, level
+	}
+	resp, err := c.roundTrip(request{f, typ, level})
+	if err != nil {
+		c.err = fmt.Errorf("classifier: %w", err)
+		Logger.Error("classifier failed, keeping heuristic types from here on", "page", f.Page, "err", err)
+		return typ, level
+	}
+	if resp.Type != "" {
+		typ = resp.Type
+	}
+	if resp.Level != nil {
+		level = *resp.Level
+	}
+	return typ, level
+}
+
+func (c *Command) roundTrip(req request) (response, error) {
+	var resp response
+	if err := c.enc.Encode(req); err != nil {
+		return resp, err
+	}
+	if !c.out.Scan() {
+		if err := c.out.Err(); err != nil {
+			return resp, err
+		}
+		return resp, io.ErrUnexpectedEOF
+	}
+	if err := json.Unmarshal(c.out.Bytes(), &resp); err != nil {
+		return resp, fmt.Errorf("bad response %q: %w", c.out.Text(), err)
+	}
+	return resp, nil
+}
+
+// Close ends the process's input, waits for it to exit and returns the first
+// error the classifier ran into.
+func (c *Command) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return c.err
+	}
+	c.done = true
+	c.in.Close()
+	if err := c.cmd.Wait(); err != nil && c.err == nil {
+		c.err = fmt.Errorf("classifier: %w", err)
+	}
+	return c.err
+}
@@ -0,0 +1,72 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/extractor"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// script writes a shell script that answers each request line with the output
+// of body, which sees the request as $line.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "classifier.sh")
+	src := "#!/bin/sh\nwhile IFS= read -r line; do\n" + body + "\ndone\n"
+	if err := os.WriteFile(path, []byte(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommand(t *testing.T) {
+	c, err := Start(script(t, `case "$line" in
+  *'"text":"Figure 1'*) echo '{"type":"text"}' ;;
+  *'"bold_ratio":1'*) echo '{"type":"heading","level":2}' ;;
+  *) echo '{}' ;;
+esac`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		f         extractor.Features
+		typ       models.BlockType
+		level     int
+		wantTyp   models.BlockType
+		wantLevel int
+	}{
+		{extractor.Features{Text: "Figure 1: results"}, models.BlockHeading, 3, models.BlockText, 3},
+		{extractor.Features{Text: "Methods", BoldRatio: 1}, models.BlockText, 0, models.BlockHeading, 2},
+		{extractor.Features{Text: "plain"}, models.BlockList, 0, models.BlockList, 0},
+	}
+	for _, tt := range tests {
+		typ, level := c.Classify(tt.f, tt.typ, tt.level)
+		if typ != tt.wantTyp || level != tt.wantLevel {
+			t.Errorf("%q: got %s/%d, want %s/%d", tt.f.Text, typ, level, tt.wantTyp, tt.wantLevel)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	c, err := Start(script(t, `echo 'not json'`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if typ, _ := c.Classify(extractor.Features{Text: "x"}, models.BlockText, 0); typ != models.BlockText {
+			t.Errorf("type after failure = %s, want the heuristic one", typ)
+		}
+	}
+	if err := c.Close(); err == nil || !strings.Contains(err.Error(), "bad response") {
+		t.Errorf("Close() = %v, want the bad response reported", err)
+	}
+	if _, err := Start(""); err == nil {
+		t.Error("empty command started")
+	}
+}
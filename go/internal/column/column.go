@@ -1,6 +1,8 @@
 package column
 
 import (
+	"sort"
+
 	"github.com/pymupdf4llm-c/go/internal/geometry"
 	"github.com/pymupdf4llm-c/go/internal/models"
 )
@@ -12,27 +14,99 @@ const (
 
 type columnRange struct{ x0, x1 float32 }
 
+// Range is a column's horizontal extent on the page.
+type Range struct{ X0, X1 float32 }
+
+// Options override what the column detector finds, for layouts such as forms
+// and slides that it gets wrong.
+type Options struct {
+	MaxColumns int       // merge columns across their narrowest gaps down to this many; 1 forces a single column, 0 leaves them
+	Columns    []Range   // use these columns, left to right, instead of detecting them
+	Breaks     []float32 // y of full-width elements that are not blocks, such as rules, where a new band starts
+}
+
 type BlockWithColumn interface {
 	GetBBox() models.BBox
 	SetColumnIndex(idx int)
+	SetBandIndex(idx int)
 }
 
-func DetectAndAssignColumns(blocks []BlockWithColumn, bodyFontSize float32) {
+// DetectAndAssignColumns splits the page into horizontal bands at full-width
+// blocks and detects columns in each band separately, so a page that switches
+// between single- and multi-column sections keeps each section's own layout.
+// Blocks should be ordered by band, then column. It returns the columns of
+// each band, left to right, which are nil for bands of a single column; blocks
+// in a column get its 1-based index, the rest 0.
+func DetectAndAssignColumns(blocks []BlockWithColumn, bodyFontSize float32) [][]Range {
+	return DetectAndAssignColumnsWithOptions(blocks, bodyFontSize, Options{})
+}
+
+func DetectAndAssignColumnsWithOptions(blocks []BlockWithColumn, bodyFontSize float32, opts Options) [][]Range {
 	if len(blocks) == 0 {
-		return
+		return nil
 	}
 	minX, maxX := findBlockBounds(blocks)
 	pageWidth := maxX - minX
-	if pageWidth < 50 {
+	if pageWidth < 50 || opts.MaxColumns == 1 {
 		assignAllToColumn(blocks, 0)
-		return
+		assignAllToBand(blocks, 0)
+		return [][]Range{nil}
 	}
-	columns := detectColumns(blocks, minX, maxX, pageWidth, bodyFontSize)
-	if len(columns) <= 1 {
-		assignAllToColumn(blocks, 0)
-		return
+	var explicit []columnRange
+	for _, r := range opts.Columns {
+		explicit = append(explicit, columnRange{r.X0, r.X1})
+	}
+	bands := splitIntoBands(blocks, pageWidth*0.5, opts.Breaks)
+	ranges := make([][]Range, len(bands))
+	for band, region := range bands {
+		assignAllToBand(region, band)
+		columns := explicit
+		if columns == nil {
+			columns = capColumns(detectColumns(region, minX, maxX, pageWidth, bodyFontSize), opts.MaxColumns)
+		}
+		if len(columns) <= 1 {
+			assignAllToColumn(region, 0)
+			continue
+		}
+		assignBlocksToColumns(region, columns)
+		for _, c := range columns {
+			ranges[band] = append(ranges[band], Range{c.x0, c.x1})
+		}
 	}
-	assignBlocksToColumns(blocks, columns)
+	return ranges
+}
+
+// splitIntoBands cuts the page at blocks wider than wideThreshold, which get
+// a band of their own, and at breaks, so columns are never read across them.
+func splitIntoBands(blocks []BlockWithColumn, wideThreshold float32, breaks []float32) [][]BlockWithColumn {
+	sorted := append([]BlockWithColumn(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].GetBBox().Y0() < sorted[j].GetBBox().Y0() })
+	breaks = append([]float32(nil), breaks...)
+	sort.Slice(breaks, func(i, j int) bool { return breaks[i] < breaks[j] })
+	var bands [][]BlockWithColumn
+	var current []BlockWithColumn
+	for _, b := range sorted {
+		for len(breaks) > 0 && breaks[0] <= b.GetBBox().Y0() {
+			if len(current) > 0 {
+				bands = append(bands, current)
+				current = nil
+			}
+			breaks = breaks[1:]
+		}
+		if b.GetBBox().Width() > wideThreshold {
+			if len(current) > 0 {
+				bands = append(bands, current)
+				current = nil
+			}
+			bands = append(bands, []BlockWithColumn{b})
+			continue
+		}
+		current = append(current, b)
+	}
+	if len(current) > 0 {
+		bands = append(bands, current)
+	}
+	return bands
 }
 
 func detectColumns(blocks []BlockWithColumn, minX, maxX, pageWidth, bodyFontSize float32) []columnRange {
@@ -87,6 +161,22 @@ func detectColumns(blocks []BlockWithColumn, minX, maxX, pageWidth, bodyFontSize
 	return columns
 }
 
+// capColumns merges the columns either side of the narrowest gap until at
+// most max are left.
+func capColumns(columns []columnRange, max int) []columnRange {
+	for max > 0 && len(columns) > max {
+		narrowest := 0
+		for i := 1; i+1 < len(columns); i++ {
+			if columns[i+1].x0-columns[i].x1 < columns[narrowest+1].x0-columns[narrowest].x1 {
+				narrowest = i
+			}
+		}
+		columns[narrowest].x1 = columns[narrowest+1].x1
+		columns = append(columns[:narrowest+1], columns[narrowest+2:]...)
+	}
+	return columns
+}
+
 func assignBlocksToColumns(blocks []BlockWithColumn, columns []columnRange) {
 	for _, b := range blocks {
 		bbox := b.GetBBox()
@@ -124,3 +214,9 @@ func assignAllToColumn(blocks []BlockWithColumn, col int) {
 		b.SetColumnIndex(col)
 	}
 }
+
+func assignAllToBand(blocks []BlockWithColumn, band int) {
+	for _, b := range blocks {
+		b.SetBandIndex(band)
+	}
+}
@@ -0,0 +1,87 @@
+package column
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestDetectAndAssignColumnsPerBand(t *testing.T) {
+	intro := &testBlock{name: "intro", bbox: models.BBox{72, 72, 540, 150}}
+	left := &testBlock{name: "left", bbox: models.BBox{72, 170, 290, 400}}
+	right := &testBlock{name: "right", bbox: models.BBox{320, 170, 540, 400}}
+	figure := &testBlock{name: "figure", bbox: models.BBox{72, 420, 540, 520}}
+	narrow := &testBlock{name: "narrow", bbox: models.BBox{72, 540, 250, 600}}
+	ranges := DetectAndAssignColumns([]BlockWithColumn{right, narrow, figure, left, intro}, 10)
+	if len(ranges) != 4 || ranges[0] != nil || len(ranges[1]) != 2 || ranges[2] != nil || ranges[3] != nil {
+		t.Fatalf("ranges = %v, want two columns in the second of four bands", ranges)
+	}
+	if l, r := ranges[1][0], ranges[1][1]; l.X0 != 72 || l.X1 < 285 || l.X1 > 290 || r.X0 < 315 || r.X0 > 320 || r.X1 != 540 {
+		t.Errorf("columns = %v, want about 72-290 and 320-540", ranges[1])
+	}
+
+	tests := []struct {
+		b         *testBlock
+		band, col int
+	}{
+		{intro, 0, 0},
+		{left, 1, 1},
+		{right, 1, 2},
+		{figure, 2, 0},
+		{narrow, 3, 0},
+	}
+	for _, tc := range tests {
+		if tc.b.band != tc.band || tc.b.col != tc.col {
+			t.Errorf("%s: band %d col %d, want band %d col %d", tc.b.name, tc.b.band, tc.b.col, tc.band, tc.col)
+		}
+	}
+}
+
+func TestDetectAndAssignColumnsWithOptions(t *testing.T) {
+	newBlocks := func() []*testBlock {
+		return []*testBlock{
+			{name: "a", bbox: models.BBox{72, 100, 200, 400}},
+			{name: "b", bbox: models.BBox{230, 100, 360, 400}},
+			{name: "c", bbox: models.BBox{400, 100, 540, 400}},
+		}
+	}
+	run := func(opts Options) []int {
+		blocks := newBlocks()
+		in := make([]BlockWithColumn, len(blocks))
+		for i, b := range blocks {
+			in[i] = b
+		}
+		DetectAndAssignColumnsWithOptions(in, 10, opts)
+		cols := make([]int, len(blocks))
+		for i, b := range blocks {
+			cols[i] = b.col
+		}
+		return cols
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []int
+	}{
+		{"detected", Options{}, []int{1, 2, 3}},
+		{"single", Options{MaxColumns: 1}, []int{0, 0, 0}},
+		{"capped", Options{MaxColumns: 2}, []int{1, 1, 2}}, // a and b are closest
+		{"explicit", Options{Columns: []Range{{72, 370}, {380, 540}}}, []int{1, 1, 2}},
+	}
+	for _, tc := range tests {
+		if got := run(tc.opts); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: columns %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	got, err := ParseRanges("310-540, 72-300")
+	if err != nil || len(got) != 2 || got[0] != (Range{72, 300}) || got[1] != (Range{310, 540}) {
+		t.Errorf("ParseRanges = %v, %v", got, err)
+	}
+	if _, err := ParseRanges("300-72"); err == nil {
+		t.Error("reversed range should fail")
+	}
+}
@@ -0,0 +1,159 @@
+package column
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+type Strategy int
+
+const (
+	StrategyColumns Strategy = iota
+	StrategyXYCut
+)
+
+var strategyNames = map[string]Strategy{"columns": StrategyColumns, "xycut": StrategyXYCut}
+
+func ParseStrategy(name string) (Strategy, error) {
+	if s, ok := strategyNames[strings.ReplaceAll(strings.ToLower(name), "-", "")]; ok {
+		return s, nil
+	}
+	return StrategyColumns, fmt.Errorf("unknown reading order %q (want columns or xycut)", name)
+}
+
+// ParseRanges reads comma-separated column ranges such as "72-300,310-540".
+func ParseRanges(s string) ([]Range, error) {
+	var out []Range
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, ok := strings.Cut(strings.TrimSpace(part), "-")
+		x0, err0 := strconv.ParseFloat(lo, 32)
+		x1, err1 := strconv.ParseFloat(hi, 32)
+		if !ok || err0 != nil || err1 != nil || x1 <= x0 {
+			return nil, fmt.Errorf("invalid column range %q (want X0-X1 in points)", part)
+		}
+		out = append(out, Range{float32(x0), float32(x1)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].X0 < out[j].X0 })
+	return out, nil
+}
+
+func (s Strategy) String() string {
+	for name, v := range strategyNames {
+		if v == s {
+			return name
+		}
+	}
+	return "columns"
+}
+
+type interval struct {
+	lo, hi float32
+	idx    int
+}
+
+// OrderXYCut returns blocks in reading order by recursively cutting the page along
+// the widest whitespace gap, horizontal or vertical. Blocks that end up in a
+// vertical strip get that strip's 1-based column index, everything else gets 0.
+func OrderXYCut(blocks []BlockWithColumn, bodyFontSize float32) []BlockWithColumn {
+	if len(blocks) == 0 {
+		return blocks
+	}
+	minXGap := geometry.Max32(bodyFontSize*1.2, 10)
+	assignAllToColumn(blocks, 0)
+	return xyCut(blocks, minXGap, make([]BlockWithColumn, 0, len(blocks)))
+}
+
+func xyCut(blocks []BlockWithColumn, minXGap float32, order []BlockWithColumn) []BlockWithColumn {
+	if len(blocks) <= 1 {
+		return append(order, blocks...)
+	}
+	rows := splitAlong(blocks, func(b models.BBox) (float32, float32) { return b.Y0(), b.Y1() }, 0.5)
+	cols := splitAlong(blocks, func(b models.BBox) (float32, float32) { return b.X0(), b.X1() }, minXGap)
+	switch {
+	case len(cols.groups) > 1 && (len(rows.groups) <= 1 || cols.widest() >= rows.widest()):
+		// every vertical gap is a gutter spanning the whole region, so cut at all of them
+		for c, group := range cols.groups {
+			assignAllToColumn(group, c+1)
+		}
+		for _, group := range cols.groups {
+			order = xyCut(group, minXGap, order)
+		}
+	case len(rows.groups) > 1:
+		// only cut at the widest horizontal gap; an aligned paragraph break across
+		// two columns must not split them before the gutter is found
+		w := rows.widestIdx()
+		var top, bottom []BlockWithColumn
+		for g, group := range rows.groups {
+			if g <= w {
+				top = append(top, group...)
+			} else {
+				bottom = append(bottom, group...)
+			}
+		}
+		order = xyCut(top, minXGap, order)
+		order = xyCut(bottom, minXGap, order)
+	default:
+		sorted := append([]BlockWithColumn(nil), blocks...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			bi, bj := sorted[i].GetBBox(), sorted[j].GetBBox()
+			if geometry.Abs32(bi.Y0()-bj.Y0()) > 2.0 {
+				return bi.Y0() < bj.Y0()
+			}
+			return bi.X0() < bj.X0()
+		})
+		order = append(order, sorted...)
+	}
+	return order
+}
+
+type cut struct {
+	groups [][]BlockWithColumn
+	gaps   []float32 // gaps[i] separates groups[i] and groups[i+1]
+}
+
+func (c cut) widestIdx() int {
+	best := 0
+	for i, g := range c.gaps {
+		if g > c.gaps[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func (c cut) widest() float32 {
+	if len(c.gaps) == 0 {
+		return 0
+	}
+	return c.gaps[c.widestIdx()]
+}
+
+// splitAlong projects blocks onto one axis and splits them at every gap of at
+// least minGap, returning the groups in axis order.
+func splitAlong(blocks []BlockWithColumn, span func(models.BBox) (float32, float32), minGap float32) cut {
+	ivs := make([]interval, len(blocks))
+	for i, b := range blocks {
+		lo, hi := span(b.GetBBox())
+		ivs[i] = interval{lo, hi, i}
+	}
+	sort.SliceStable(ivs, func(i, j int) bool { return ivs[i].lo < ivs[j].lo })
+	var c cut
+	current := []BlockWithColumn{blocks[ivs[0].idx]}
+	reach := ivs[0].hi
+	for _, iv := range ivs[1:] {
+		if gap := iv.lo - reach; gap >= minGap {
+			c.groups = append(c.groups, current)
+			c.gaps = append(c.gaps, gap)
+			current = nil
+		}
+		current = append(current, blocks[iv.idx])
+		reach = geometry.Max32(reach, iv.hi)
+	}
+	c.groups = append(c.groups, current)
+	return c
+}
@@ -0,0 +1,97 @@
+package column
+
+import (
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+type testBlock struct {
+	name      string
+	bbox      models.BBox
+	col, band int
+}
+
+func (b *testBlock) GetBBox() models.BBox   { return b.bbox }
+func (b *testBlock) SetColumnIndex(idx int) { b.col = idx }
+func (b *testBlock) SetBandIndex(idx int)   { b.band = idx }
+
+func names(blocks []BlockWithColumn) []string {
+	out := make([]string, len(blocks))
+	for i, b := range blocks {
+		out[i] = b.(*testBlock).name
+	}
+	return out
+}
+
+func TestOrderXYCutAbstractAboveTwoColumns(t *testing.T) {
+	blocks := []BlockWithColumn{
+		&testBlock{name: "right1", bbox: models.BBox{320, 200, 540, 300}},
+		&testBlock{name: "left2", bbox: models.BBox{72, 310, 290, 400}},
+		&testBlock{name: "title", bbox: models.BBox{72, 72, 540, 100}},
+		&testBlock{name: "left1", bbox: models.BBox{72, 200, 290, 300}},
+		&testBlock{name: "abstract", bbox: models.BBox{72, 120, 540, 180}},
+		&testBlock{name: "right2", bbox: models.BBox{320, 310, 540, 400}},
+	}
+	got := names(OrderXYCut(blocks, 10))
+	want := []string{"title", "abstract", "left1", "left2", "right1", "right2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	for _, b := range blocks {
+		tb := b.(*testBlock)
+		switch tb.name {
+		case "title", "abstract":
+			if tb.col != 0 {
+				t.Errorf("%s: column %d, want 0", tb.name, tb.col)
+			}
+		case "left1", "left2":
+			if tb.col != 1 {
+				t.Errorf("%s: column %d, want 1", tb.name, tb.col)
+			}
+		case "right1", "right2":
+			if tb.col != 2 {
+				t.Errorf("%s: column %d, want 2", tb.name, tb.col)
+			}
+		}
+	}
+}
+
+func TestOrderXYCutSidebar(t *testing.T) {
+	blocks := []BlockWithColumn{
+		&testBlock{name: "sidebar", bbox: models.BBox{440, 72, 540, 700}},
+		&testBlock{name: "body2", bbox: models.BBox{72, 300, 400, 500}},
+		&testBlock{name: "body1", bbox: models.BBox{72, 72, 400, 280}},
+	}
+	got := names(OrderXYCut(blocks, 10))
+	want := []string{"body1", "body2", "sidebar"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Strategy
+		ok    bool
+	}{
+		{"columns", StrategyColumns, true},
+		{"xycut", StrategyXYCut, true},
+		{"XY-Cut", StrategyXYCut, true},
+		{"bogus", StrategyColumns, false},
+	}
+	for _, tc := range tests {
+		got, err := ParseStrategy(tc.input)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseStrategy(%q) = %v, %v", tc.input, got, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package config loads the heuristic thresholds of extraction from a file, so
+// they can be tuned for a corpus without rebuilding.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/extractor"
+	"github.com/pymupdf4llm-c/go/internal/markdown"
+	"github.com/pymupdf4llm-c/go/internal/table"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+// Config gathers the thresholds extraction works with. A file only needs the
+// fields it changes; the rest keep their defaults.
+type Config struct {
+	Margins     text.Margins           `json:"margins"`      // as for -margins, e.g. "8%,0"
+	PageNumbers text.PageNumbers       `json:"page_numbers"` // as for -page-number, e.g. ["{n}", "Page {n} of {total}"]; a list replaces the defaults
+	Text        extractor.Heuristics   `json:"text"`
+	Tables      table.Thresholds       `json:"tables"`
+	Bullets     extractor.BulletGlyphs `json:"bullets"`
+	// ListMarkers are the Markdown markers list items are rendered with, by
+	// their marker as printed or form of numbering, as markdown.Options has
+	// them. Extraction does not use them; see ApplyMarkdown.
+	ListMarkers map[string]string `json:"list_markers"`
+}
+
+// Default is the configuration extraction uses without a file.
+var Default = Config{
+	Margins:     extractor.DefaultOptions.Margins,
+	PageNumbers: extractor.DefaultOptions.PageNumbers,
+	Text:        extractor.DefaultOptions.Heuristics,
+	Tables:      extractor.DefaultOptions.Tables,
+	Bullets:     extractor.DefaultOptions.Cleanup.Bullets,
+}
+
+// Load reads a configuration from a JSON file, or from YAML if the name ends
+// in .yaml or .yml, over base. Only the subset of YAML a config needs is
+// understood: nested mappings, scalars, [flow, lists] and comments. Unknown
+// keys are an error so that typos don't go unnoticed.
+func Load(path string, base Config) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	cfg := base
+	// lists in the file replace those of base rather than writing over them
+	cfg.Bullets.Glyphs, cfg.Bullets.Monospace = slices.Clone(base.Bullets.Glyphs), slices.Clone(base.Bullets.Monospace)
+	cfg.ListMarkers = maps.Clone(base.ListMarkers)
+	cfg.PageNumbers = slices.Clone(base.PageNumbers)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if lang := cfg.Text.CapsHeadingLanguage; lang != "" && !slices.Contains(text.CapsLanguages(), lang) {
+		return Config{}, fmt.Errorf("%s: caps_heading_language %q: want one of %s", path, lang, strings.Join(text.CapsLanguages(), ", "))
+	}
+	for marker, style := range cfg.ListMarkers {
+		if !slices.Contains(markdown.ListStyles, style) {
+			return Config{}, fmt.Errorf("%s: list_markers %q: %q is not a Markdown list marker, want one of %s", path, marker, style, strings.Join(markdown.ListStyles, " "))
+		}
+	}
+	return cfg, nil
+}
+
+// ApplyMarkdown sets the list markers in opts.
+func (c Config) ApplyMarkdown(opts *markdown.Options) {
+	opts.ListMarkers = c.ListMarkers
+}
+
+// Apply sets the thresholds in opts.
+func (c Config) Apply(opts *extractor.Options) {
+	opts.Margins, opts.Heuristics, opts.Tables, opts.Cleanup.Bullets = c.Margins, c.Text, c.Tables, c.Bullets
+	opts.PageNumbers = c.PageNumbers
+}
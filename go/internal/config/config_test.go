@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"scans.json": `{"margins": "10%,0", "text": {"heading_size": 1.4, "heading_levels": [20, 16, 13]}, "tables": {"max_ruling_edges": 500}, "bullets": {"glyphs": ["\uf0a8"]}, "list_markers": {"➢": "*", "i.": "1."}, "page_numbers": ["{n}", "Folio {n}"]}`,
+		"scans.yaml": `# tuned for scanned reports
+margins: "10%,0"
+text:
+  heading_size: 1.4   # larger than usual
+  heading_levels: [20, 16, 13]
+
+tables:
+  max_ruling_edges: 500
+bullets:
+  glyphs: ["\uf0a8"]        # Wingdings' open box
+list_markers:
+  "➢": "*"
+  i.: "1."                   # roman numerals become an ordered list
+page_numbers: ["{n}", "Folio {n}"]
+`,
+	}
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, name, data), Default)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (text.Margins{Top: text.Margin{Value: 10, Percent: true}, Bottom: text.Margin{Value: 10, Percent: true}}); cfg.Margins != want {
+				t.Errorf("margins = %v, want %v", cfg.Margins, want)
+			}
+			if cfg.Text.HeadingSize != 1.4 || cfg.Text.HeadingLevels != [3]float32{20, 16, 13} {
+				t.Errorf("text = %+v", cfg.Text)
+			}
+			if cfg.Tables.MaxRulingEdges != 500 {
+				t.Errorf("max_ruling_edges = %d, want 500", cfg.Tables.MaxRulingEdges)
+			}
+			if !reflect.DeepEqual(cfg.Bullets.Glyphs, []string{"\uf0a8"}) || len(cfg.Bullets.Monospace) != 2 || len(Default.Bullets.Glyphs) < 2 || Default.Bullets.Glyphs[0] != "·" {
+				t.Errorf("bullets = %q, default %q", cfg.Bullets, Default.Bullets)
+			}
+			if !reflect.DeepEqual(cfg.ListMarkers, map[string]string{"➢": "*", "i.": "1."}) {
+				t.Errorf("list_markers = %q", cfg.ListMarkers)
+			}
+			if len(cfg.PageNumbers) != 2 || !cfg.PageNumbers.Match("folio xii") || cfg.PageNumbers.Match("Page 3 of 10") {
+				t.Errorf("page_numbers = %q", cfg.PageNumbers)
+			}
+			if cfg.Text.ParagraphGap != Default.Text.ParagraphGap || cfg.Tables.SnapTol != Default.Tables.SnapTol {
+				t.Error("fields missing from the file lost their defaults")
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"typo.json", `{"text": {"heading_sise": 1.4}}`, "heading_sise"},
+		{"typo.yml", "text:\n  heading_sise: 1.4\n", "heading_sise"},
+		{"indent.yaml", "text:\n  heading_size: 1.4\n    paragraph_gap: 2\n", "line 3"},
+		{"list.yaml", "text:\n  - heading_size\n", "line 2"},
+		{"margins.yaml", "margins: 5 percent\n", "invalid margin"},
+		{"language.yaml", "text:\n  caps_heading_language: nl\n", "de, en, fr"},
+		{"markers.yaml", "list_markers:\n  i.: 1.\n", "list_markers"},
+		{"pages.json", `{"page_numbers": ["Page ({n}"]}`, "invalid page number pattern"},
+	}
+	for _, tt := range tests {
+		_, err := Load(writeFile(t, tt.name, tt.data), Default)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	for _, name := range ProfileNames() {
+		cfg, err := Profile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(cfg, Default) {
+			t.Errorf("profile %s changes nothing", name)
+		}
+	}
+	slides, _ := Profile("Slides")
+	if slides.Margins != (text.Margins{}) {
+		t.Errorf("slides margins = %v, want none so titles are kept", slides.Margins)
+	}
+	if _, err := Profile("novel"); err == nil || !strings.Contains(err.Error(), "academic") {
+		t.Errorf("unknown profile: err = %v, want the known ones listed", err)
+	}
+}
+
+func TestLoadOverProfile(t *testing.T) {
+	legal, _ := Profile("legal")
+	cfg, err := Load(writeFile(t, "c.yaml", "text:\n  list_item_gap: 3\n"), legal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Text.ListItemGap != 3 || cfg.Text.CapsHeadingMaxChars != legal.Text.CapsHeadingMaxChars || cfg.Margins != legal.Margins {
+		t.Errorf("file over legal profile = %+v", cfg)
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+func percent(top, side float32) text.Margins {
+	return text.Margins{Top: text.Margin{Value: top, Percent: true}, Bottom: text.Margin{Value: top, Percent: true}, Left: text.Margin{Value: side, Percent: true}, Right: text.Margin{Value: side, Percent: true}}
+}
+
+// profiles adjust Default for a class of documents.
+var profiles = map[string]func(*Config){
+	// Papers set section headings barely larger than the body, often just in
+	// bold, and keep running heads close to the edge.
+	"academic": func(c *Config) {
+		c.Margins = percent(6, 0)
+		c.Text.HeadingSize = 1.15
+		c.Text.BoldHeadingMaxChars = 100
+		c.Text.HeadingLevels = [3]float32{16, 13, 11}
+	},
+	// Contracts and filings shout their boilerplate in capitals, which must not
+	// become headings, and space out their numbered clauses.
+	"legal": func(c *Config) {
+		c.Margins = percent(10, 0)
+		c.Text.CapsHeadingMaxChars = 80
+		c.Text.CapsHeadingMaxWords = 8
+		c.Text.BoldHeadingMaxChars = 120
+		c.Text.ListItemGap = 2
+		c.Text.ListBreakGap = 3.5
+	},
+	// Statements stack tables close together, run them the full height of
+	// the page and rule them finely.
+	"financial": func(c *Config) {
+		c.Margins = percent(6, 0)
+		c.Tables.MinCell = 0.003
+		c.Tables.SplitGap = 0.05
+		c.Tables.RowTol = 0.01
+		c.Tables.MaxWidth = 0.99
+		c.Tables.MaxHeight = 0.98
+		c.Text.TableOverlap = 0.7
+	},
+	// Slides have titles at the very top, which margins would drop, large type
+	// and widely spaced bullets.
+	"slides": func(c *Config) {
+		c.Margins = text.Margins{}
+		c.Text.HeadingSize = 1.5
+		c.Text.HeadingLevels = [3]float32{32, 24, 20}
+		c.Text.ParagraphGap = 2
+		c.Text.ListItemGap = 2.5
+		c.Text.ListBreakGap = 4
+	},
+	// Manuals nest their headings deeply, space out their steps and put long
+	// text in table cells.
+	"manual": func(c *Config) {
+		c.Text.HeadingLevels = [3]float32{16, 13, 11}
+		c.Text.ListItemGap = 2
+		c.Tables.MaxCellHeight = 0.4
+	},
+}
+
+// ProfileNames lists the profiles in alphabetical order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns Default tuned for the named class of documents.
+func Profile(name string) (Config, error) {
+	tune, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown profile %q (want %s)", name, strings.Join(ProfileNames(), ", "))
+	}
+	cfg := Default
+	tune(&cfg)
+	return cfg, nil
+}
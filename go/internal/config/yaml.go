@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	num, indent int
+	key, value  string
+}
+
+// yamlToJSON converts block mappings of scalars and flow lists to JSON. It is
+// no general YAML parser; anything beyond that is reported as an error.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(stripComment(raw), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: want key: value", i+1)
+		}
+		lines = append(lines, yamlLine{i + 1, len(line) - len(trimmed), unquote(strings.TrimSpace(key)), strings.TrimSpace(value)})
+	}
+	m, rest, err := yamlMapping(lines, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].num)
+	}
+	return json.Marshal(m)
+}
+
+// yamlMapping reads the lines indented by indent into a map and returns the
+// lines after them.
+func yamlMapping(lines []yamlLine, indent int) (map[string]any, []yamlLine, error) {
+	m := map[string]any{}
+	for len(lines) > 0 && lines[0].indent == indent {
+		l := lines[0]
+		lines = lines[1:]
+		if _, dup := m[l.key]; dup {
+			return nil, nil, fmt.Errorf("line %d: duplicate key %q", l.num, l.key)
+		}
+		if l.value != "" {
+			v, err := yamlValue(l.value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", l.num, err)
+			}
+			m[l.key] = v
+			continue
+		}
+		if len(lines) == 0 || lines[0].indent <= indent {
+			m[l.key] = nil
+			continue
+		}
+		child, rest, err := yamlMapping(lines, lines[0].indent)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[l.key], lines = child, rest
+	}
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, nil, fmt.Errorf("line %d: unexpected indentation", lines[0].num)
+	}
+	return m, lines, nil
+}
+
+func yamlValue(s string) (any, error) {
+	if !strings.HasPrefix(s, "[") {
+		return yamlScalar(s), nil
+	}
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %q", s)
+	}
+	list := []any{}
+	if inner := strings.TrimSpace(s[1 : len(s)-1]); inner != "" {
+		for _, item := range strings.Split(inner, ",") {
+			list = append(list, yamlScalar(strings.TrimSpace(item)))
+		}
+	}
+	return list, nil
+}
+
+func yamlScalar(s string) any {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null", "~":
+		return nil
+	}
+	if q := unquote(s); q != s {
+		return q
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// unquote strips quotes, and decodes the escapes of double-quoted strings
+// such as "\uF0B7".
+func unquote(s string) string {
+	if q, err := strconv.Unquote(s); err == nil && s[0] == '"' {
+		return q
+	}
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// stripComment drops a # comment, which starts a line or follows a space,
+// outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
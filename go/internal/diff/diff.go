@@ -0,0 +1,252 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// Pairs of removed and added blocks of the same type count as one changed
+// block when at least this share of their words match.
+const changedSimilarity = 0.5
+
+type Location struct {
+	Page  int         `json:"page"`
+	Index int         `json:"index"`
+	BBox  models.BBox `json:"bbox"`
+}
+
+type Segment struct {
+	Op   string `json:"op"` // "=", "-" or "+"
+	Text string `json:"text"`
+}
+
+type Change struct {
+	Op    string    `json:"op"` // "added", "removed" or "changed"
+	Type  string    `json:"type"`
+	A     *Location `json:"a,omitempty"`
+	B     *Location `json:"b,omitempty"`
+	Text  string    `json:"text,omitempty"`
+	Words []Segment `json:"words,omitempty"`
+}
+
+type Summary struct {
+	Unchanged int `json:"unchanged"`
+	Changed   int `json:"changed"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+}
+
+type Result struct {
+	Summary Summary  `json:"summary"`
+	Changes []Change `json:"changes"`
+}
+
+type entry struct {
+	loc  Location
+	typ  string
+	text string
+	key  string
+}
+
+func flatten(pages []models.Page) []entry {
+	var out []entry
+	for _, p := range pages {
+		for i, b := range p.Data {
+			text := strings.Join(strings.Fields(b.Text()), " ")
+			out = append(out, entry{Location{p.Number, i, b.BBox}, string(b.Type), text, string(b.Type) + "\x00" + text})
+		}
+	}
+	return out
+}
+
+// Compare lines up the blocks of two extractions in reading order and reports
+// the ones that were added, removed or changed. Blocks are compared by type
+// and whitespace-normalised text, so a block that only moved on the page is
+// unchanged; changed blocks carry a word-level diff of their text.
+func Compare(a, b []models.Page) Result {
+	ea, eb := flatten(a), flatten(b)
+	ka, kb := make([]string, len(ea)), make([]string, len(eb))
+	for i, e := range ea {
+		ka[i] = e.key
+	}
+	for i, e := range eb {
+		kb[i] = e.key
+	}
+
+	res := Result{Changes: []Change{}}
+	var removed, added []entry
+	flush := func() {
+		res.Changes = append(res.Changes, pairChanges(removed, added, &res.Summary)...)
+		removed, added = nil, nil
+	}
+	for _, op := range edits(ka, kb) {
+		switch op.kind {
+		case '=':
+			flush()
+			res.Summary.Unchanged++
+		case '-':
+			removed = append(removed, ea[op.a])
+		case '+':
+			added = append(added, eb[op.b])
+		}
+	}
+	flush()
+	return res
+}
+
+// pairChanges matches removed blocks with added blocks of the same type and
+// similar text, in order, and reports the rest as plain removals and additions.
+func pairChanges(removed, added []entry, sum *Summary) []Change {
+	var out []Change
+	next := 0
+	for _, r := range removed {
+		match := -1
+		for j := next; j < len(added); j++ {
+			if added[j].typ == r.typ && similarity(r.text, added[j].text) >= changedSimilarity {
+				match = j
+				break
+			}
+		}
+		if match < 0 {
+			loc := r.loc
+			out = append(out, Change{Op: "removed", Type: r.typ, A: &loc, Text: r.text})
+			sum.Removed++
+			continue
+		}
+		for _, a := range added[next:match] {
+			loc := a.loc
+			out = append(out, Change{Op: "added", Type: a.typ, B: &loc, Text: a.text})
+			sum.Added++
+		}
+		la, lb := r.loc, added[match].loc
+		out = append(out, Change{Op: "changed", Type: r.typ, A: &la, B: &lb, Words: Words(r.text, added[match].text)})
+		sum.Changed++
+		next = match + 1
+	}
+	for _, a := range added[next:] {
+		loc := a.loc
+		out = append(out, Change{Op: "added", Type: a.typ, B: &loc, Text: a.text})
+		sum.Added++
+	}
+	return out
+}
+
+// similarity is the Dice coefficient of the two texts' words.
+func similarity(a, b string) float64 {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	if len(wa)+len(wb) == 0 {
+		return 1
+	}
+	counts := map[string]int{}
+	for _, w := range wa {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range wb {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wa)+len(wb))
+}
+
+// Words diffs two texts word by word, merging runs of the same operation.
+func Words(a, b string) []Segment {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	var out []Segment
+	for _, op := range edits(wa, wb) {
+		word := ""
+		switch op.kind {
+		case '=', '-':
+			word = wa[op.a]
+		case '+':
+			word = wb[op.b]
+		}
+		if n := len(out); n > 0 && out[n-1].Op == string(op.kind) {
+			out[n-1].Text += " " + word
+			continue
+		}
+		out = append(out, Segment{Op: string(op.kind), Text: word})
+	}
+	return out
+}
+
+type jsonSpan struct {
+	Text string `json:"text"`
+}
+
+type jsonBlock struct {
+	Type  string      `json:"type"`
+	BBox  models.BBox `json:"bbox"`
+	Spans []jsonSpan  `json:"spans"`
+	Items []struct {
+		Spans  []jsonSpan `json:"spans"`
+		Prefix any        `json:"prefix"`
+	} `json:"items"`
+	Rows []struct {
+		Cells []struct {
+			Spans []jsonSpan `json:"spans"`
+		} `json:"cells"`
+	} `json:"rows"`
+}
+
+type jsonPage struct {
+	Number int         `json:"page"`
+	Data   []jsonBlock `json:"data"`
+}
+
+// ReadJSON loads the parts of an extraction result the diff looks at: block
+// types, boxes and text. Results written before the document object, a bare
+// array of pages, are read too.
+func ReadJSON(r io.Reader) ([]models.Page, error) {
+	var doc json.RawMessage
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var raw []jsonPage
+	if trimmed := bytes.TrimSpace(doc); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(doc, &raw); err != nil {
+			return nil, err
+		}
+	} else {
+		var obj struct {
+			Pages []jsonPage `json:"pages"`
+		}
+		if err := json.Unmarshal(doc, &obj); err != nil {
+			return nil, err
+		}
+		raw = obj.Pages
+	}
+	spans := func(js []jsonSpan) []models.Span {
+		out := make([]models.Span, len(js))
+		for i, s := range js {
+			out[i] = models.Span{Text: s.Text}
+		}
+		return out
+	}
+	pages := make([]models.Page, len(raw))
+	for p, rp := range raw {
+		pages[p] = models.Page{Number: rp.Number, Data: make([]models.Block, len(rp.Data))}
+		for i, rb := range rp.Data {
+			b := models.Block{Type: models.BlockType(rb.Type), BBox: rb.BBox, Spans: spans(rb.Spans)}
+			for _, item := range rb.Items {
+				prefix, _ := item.Prefix.(string)
+				b.Items = append(b.Items, models.ListItem{Spans: spans(item.Spans), Prefix: prefix})
+			}
+			for _, row := range rb.Rows {
+				var tr models.TableRow
+				for _, cell := range row.Cells {
+					tr.Cells = append(tr.Cells, models.TableCell{Spans: spans(cell.Spans)})
+				}
+				b.Rows = append(b.Rows, tr)
+			}
+			pages[p].Data[i] = b
+		}
+	}
+	return pages, nil
+}
@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestEditsAreMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		s := make([]string, rng.Intn(12))
+		for i := range s {
+			s[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+		var gotA, gotB []string
+		same := 0
+		for _, e := range edits(a, b) {
+			switch e.kind {
+			case '=':
+				if a[e.a] != b[e.b] {
+					t.Fatalf("%v -> %v: '=' on different items", a, b)
+				}
+				gotA, gotB, same = append(gotA, a[e.a]), append(gotB, b[e.b]), same+1
+			case '-':
+				gotA = append(gotA, a[e.a])
+			case '+':
+				gotB = append(gotB, b[e.b])
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("%v -> %v: script does not rebuild both sides", a, b)
+		}
+		if want := lcs(a, b); same != want {
+			t.Fatalf("%v -> %v: kept %d items, LCS is %d", a, b, same, want)
+		}
+	}
+}
+
+func para(text string) models.Block {
+	return models.Block{Type: models.BlockText, Spans: []models.Span{{Text: text}}}
+}
+
+func TestCompare(t *testing.T) {
+	a := []models.Page{{Number: 1, Data: []models.Block{
+		{Type: models.BlockHeading, Spans: []models.Span{{Text: "Terms"}}},
+		para("Payment is due within thirty days of delivery."),
+		para("This clause is removed entirely."),
+	}}}
+	b := []models.Page{{Number: 1, Data: []models.Block{
+		{Type: models.BlockHeading, Spans: []models.Span{{Text: "Terms"}}},
+		para("Payment is due within forty five days of delivery."),
+	}}, {Number: 2, Data: []models.Block{para("A brand new appendix.")}}}
+
+	res := Compare(a, b)
+	if want := (Summary{Unchanged: 1, Changed: 1, Added: 1, Removed: 1}); res.Summary != want {
+		t.Fatalf("summary = %+v, want %+v", res.Summary, want)
+	}
+	changed := res.Changes[0]
+	if changed.Op != "changed" || changed.A.Page != 1 || changed.B.Index != 1 {
+		t.Errorf("first change = %+v", changed)
+	}
+	wantWords := []Segment{{"=", "Payment is due within"}, {"-", "thirty"}, {"+", "forty five"}, {"=", "days of delivery."}}
+	if !reflect.DeepEqual(changed.Words, wantWords) {
+		t.Errorf("words = %+v", changed.Words)
+	}
+	ops := []string{res.Changes[1].Op, res.Changes[2].Op}
+	if !reflect.DeepEqual(ops, []string{"removed", "added"}) || res.Changes[2].B.Page != 2 {
+		t.Errorf("remaining changes = %+v", res.Changes[1:])
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	in := `[{"page":3,"data":[{"type":"list","bbox":[1,2,3,4],"items":[{"spans":[{"text":"one","link":false}],"prefix":"1.","indent":0}]},
+		{"type":"table","bbox":[0,0,1,1],"rows":[{"bbox":[0,0,1,1],"cells":[{"bbox":[0,0,1,1],"spans":[{"text":"a"}]},{"bbox":[0,0,1,1],"spans":[{"text":"b"}]}]}]}]}]`
+	for _, doc := range []string{`{"schema_version":1,"pages":` + in + `}`, in} {
+		pages, err := ReadJSON(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pages[0].Number != 3 || pages[0].Data[0].Text() != "1. one" || pages[0].Data[1].Text() != "a | b" {
+			t.Errorf("pages = %+v", pages)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package diff
+
+type edit struct {
+	kind byte // '=', '-' (a[a] removed) or '+' (b[b] added)
+	a, b int
+}
+
+// edits returns a shortest edit script turning a into b (Myers' algorithm).
+// Only the diagonals reached so far are kept per step, so memory grows with
+// the square of the number of differences rather than with the input size.
+func edits(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out []edit
+	for i := 0; i < prefix; i++ {
+		out = append(out, edit{'=', i, i})
+	}
+	for _, e := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		out = append(out, edit{e.kind, e.a + prefix, e.b + prefix})
+	}
+	for i := suffix; i > 0; i-- {
+		out = append(out, edit{'=', len(a) - i, len(b) - i})
+	}
+	return out
+}
+
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	limit := n + m
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[limit-d:limit+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[limit+k-1] < v[limit+k+1]) {
+				x = v[limit+k+1]
+			} else {
+				x = v[limit+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[limit+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, x, y int) []edit {
+	var rev []edit
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d] // furthest x per diagonal after step d-1, offset by d
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && vd[d+k-1] < vd[d+k+1]) {
+			prevK = k + 1
+		}
+		prevX := vd[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			rev = append(rev, edit{'=', x, y})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, edit{'+', x, y})
+		} else {
+			x--
+			rev = append(rev, edit{'-', x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		rev = append(rev, edit{'=', x, y})
+	}
+	out := make([]edit, len(rev))
+	for i, e := range rev {
+		out[len(rev)-1-i] = e
+	}
+	return out
+}
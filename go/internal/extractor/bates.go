@@ -0,0 +1,92 @@
+package extractor
+
+import (
+	"sort"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+type batesHit struct {
+	page, block int
+	value       string
+	number      int
+}
+
+// ExtractBatesNumbers finds a Bates stamp that appears in the same corner of
+// most pages with one prefix and increasing numbers, records it on each page
+// and removes the stamp block from the page's content.
+func ExtractBatesNumbers(pages []models.Page) {
+	groups := map[string][]batesHit{}
+	for p := range pages {
+		seen := map[string]bool{}
+		for b, block := range pages[p].Data {
+			if block.Type == models.BlockTable || block.Type == models.BlockFigure || block.Lines > 2 || block.Length > 60 {
+				continue
+			}
+			zone := batesZone(block.BBox, pages[p].Bounds)
+			if zone == "" {
+				continue
+			}
+			value, prefix, number := text.ParseBates(spansText(block.Spans))
+			if key := prefix + "|" + zone; value != "" && !seen[key] {
+				seen[key] = true
+				groups[key] = append(groups[key], batesHit{p, b, value, number})
+			}
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // ties go to the same group on every run
+	var best []batesHit
+	for _, key := range keys {
+		if hits := groups[key]; len(hits) > len(best) && increasing(hits) {
+			best = hits
+		}
+	}
+	if len(best) == 0 || (len(pages) > 1 && (len(best) < 2 || len(best)*5 < len(pages)*3)) {
+		return
+	}
+	Logger.Debug("found bates numbers", "pages", len(best), "first", best[0].value)
+	for _, hit := range best {
+		page := &pages[hit.page]
+		page.Bates = hit.value
+		page.Data = append(page.Data[:hit.block], page.Data[hit.block+1:]...)
+	}
+}
+
+// batesZone names the page corner or edge a block sits in, or "" when it is
+// outside the top and bottom margins.
+func batesZone(b, page models.BBox) string {
+	if page.IsEmpty() {
+		return ""
+	}
+	margin, third := page.Height()*0.12, page.Width()/3
+	var zone string
+	switch {
+	case b.Y1() <= page.Y0()+margin:
+		zone = "top"
+	case b.Y0() >= page.Y1()-margin:
+		zone = "bottom"
+	default:
+		return ""
+	}
+	switch centre := (b.X0() + b.X1()) / 2; {
+	case centre < page.X0()+third:
+		return zone + "-left"
+	case centre > page.X1()-third:
+		return zone + "-right"
+	}
+	return zone + "-centre"
+}
+
+func increasing(hits []batesHit) bool {
+	for i := 1; i < len(hits); i++ {
+		if hits[i].number <= hits[i-1].number {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// LinkCitations gives footnotes and numbered reference entries an ID and sets
+// Ref on every superscript number in the text that points at one. A marker
+// resolves to a footnote on its own page first, then to the next footnote with
+// that number (endnotes), then to the reference entry.
+func LinkCitations(pages []models.Page) {
+	type note struct {
+		page int
+		id   string
+	}
+	notes := map[string][]note{}
+	refs := map[string]string{}
+	for p := range pages {
+		for b := range pages[p].Data {
+			block := &pages[p].Data[b]
+			switch block.Type {
+			case models.BlockFootnote:
+				if n := noteNumber(block.Spans); n != "" {
+					block.ID = "fn-" + strconv.Itoa(pages[p].Number) + "-" + n
+					notes[n] = append(notes[n], note{pages[p].Number, block.ID})
+				}
+			case models.BlockReferences:
+				for i := range block.Items {
+					item := &block.Items[i]
+					if n := strings.Trim(item.Prefix, "[]."); n != "" && isDigits(n) {
+						item.ID = "ref-" + n
+						if _, ok := refs[n]; !ok {
+							refs[n] = item.ID
+						}
+					}
+				}
+			}
+		}
+	}
+	resolve := func(page int, n string) string {
+		for _, fn := range notes[n] {
+			if fn.page == page {
+				return fn.id
+			}
+		}
+		for _, fn := range notes[n] {
+			if fn.page > page {
+				return fn.id
+			}
+		}
+		return refs[n]
+	}
+	linked := 0
+	link := func(page int, spans []models.Span) {
+		for i := range spans {
+			s := &spans[i]
+			if !s.Style.Superscript {
+				continue
+			}
+			var ids []string
+			for _, n := range strings.FieldsFunc(s.Text, func(r rune) bool { return r == ',' || r == ' ' }) {
+				if id := resolve(page, n); isDigits(n) && id != "" {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) > 0 {
+				s.Ref = strings.Join(ids, ",")
+				linked++
+			}
+		}
+	}
+	for p := range pages {
+		num := pages[p].Number
+		for b := range pages[p].Data {
+			block := &pages[p].Data[b]
+			if block.Type == models.BlockFootnote || block.Type == models.BlockReferences {
+				continue
+			}
+			link(num, block.Spans)
+			for i := range block.Items {
+				link(num, block.Items[i].Spans)
+			}
+			for r := range block.Rows {
+				for c := range block.Rows[r].Cells {
+					link(num, block.Rows[r].Cells[c].Spans)
+				}
+			}
+		}
+	}
+	Logger.Debug("linked citations", "footnotes", len(notes), "references", len(refs), "markers", linked)
+}
+
+// noteNumber returns the number a footnote opens with, either as a superscript
+// or as plain digits followed by a space or period.
+func noteNumber(spans []models.Span) string {
+	if len(spans) == 0 {
+		return ""
+	}
+	first := strings.TrimSpace(spans[0].Text)
+	if spans[0].Style.Superscript {
+		if isDigits(first) && len(first) <= 3 {
+			return first
+		}
+		return ""
+	}
+	i := 0
+	for i < len(first) && i < 3 && first[i] >= '0' && first[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(first) && (first[i] == ' ' || (first[i] == '.' && first[i+1] == ' ')) {
+		return first[:i]
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
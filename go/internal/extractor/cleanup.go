@@ -3,6 +3,7 @@ package extractor
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/pymupdf4llm-c/go/internal/models"
 	"github.com/pymupdf4llm-c/go/internal/text"
@@ -14,6 +15,18 @@ type CleanupOpts struct {
 	Trim           bool
 	BrokenUnicode  bool
 	BrokenBullets  bool
+	Ligatures      bool
+	SoftHyphens    bool           // resolve soft hyphens (U+00AD) instead of keeping them
+	Invisible      text.Invisible // what to do with zero-width spaces, joiners, directional marks and controls
+	Bullets        BulletGlyphs
+}
+
+// BulletGlyphs are what bullets come out as in PDFs whose bullet font has no
+// usable Unicode mapping. With BrokenBullets, a block that starts with one of
+// them followed by a space and some text becomes a list item.
+type BulletGlyphs struct {
+	Glyphs    []string `json:"glyphs"`    // in any font
+	Monospace []string `json:"monospace"` // only alone in a monospace span, as they are also letters
 }
 
 var DefaultCleanup = CleanupOpts{
@@ -22,39 +35,107 @@ var DefaultCleanup = CleanupOpts{
 	Trim:           true,
 	BrokenUnicode:  true,
 	BrokenBullets:  true,
+	Ligatures:      true,
+	SoftHyphens:    true,
+	Invisible:      text.InvisibleMap,
+	Bullets:        DefaultBulletGlyphs,
+}
+
+var DefaultBulletGlyphs = BulletGlyphs{
+	// Symbol's bullet read as a middle dot or left in the private use area,
+	// Wingdings' squares, diamond, arrowhead, check mark and boxes left in the
+	// private use area or read as the Latin-1 letter at their code
+	Glyphs: []string{"·", "§", "\uF0B7", "\uF0A7", "\uF076", "\uF0D8", "\uF0FC", "\uF06E", "\uF071", "Ø", "ü"},
+	// Courier New's "o", Word's second-level bullet
+	Monospace: []string{"o", "O"},
 }
 
-func CleanupPage(blocks []models.Block) {
-	convertBulletBlocksToLists(&blocks)
+func CleanupPage(blocks []models.Block) []models.Block {
+	return CleanupPageWithOptions(blocks, DefaultCleanup)
+}
+
+func CleanupPageWithOptions(blocks []models.Block, opts CleanupOpts) []models.Block {
+	if opts.BrokenBullets {
+		blocks = convertBulletBlocksToLists(blocks, opts.Bullets)
+	}
 
 	for i := range blocks {
 		block := &blocks[i]
 		switch block.Type {
 		case models.BlockText, models.BlockHeading, models.BlockFootnote, models.BlockOther, models.BlockCode:
-			cleanupSpans(block.Spans, DefaultCleanup)
+			cleanupSpans(block.Spans, opts)
 			for j := range block.Items {
-				cleanupSpans(block.Items[j].Spans, DefaultCleanup)
+				cleanupSpans(block.Items[j].Spans, opts)
 			}
 		case models.BlockTable:
 			for j := range block.Rows {
 				for k := range block.Rows[j].Cells {
-					cleanupSpans(block.Rows[j].Cells[k].Spans, DefaultCleanup)
+					cleanupSpans(block.Rows[j].Cells[k].Spans, opts)
 				}
 			}
 		case models.BlockList:
 			for j := range block.Items {
-				cleanupSpans(block.Items[j].Spans, DefaultCleanup)
+				cleanupSpans(block.Items[j].Spans, opts)
 			}
 		}
 	}
+	return blocks
 }
 
 func cleanupSpans(spans []models.Span, opts CleanupOpts) {
+	if opts.SoftHyphens {
+		resolveSoftHyphens(spans)
+	}
 	for i := range spans {
 		spans[i].Text = cleanupSpanText(spans[i].Text, opts)
 	}
 }
 
+// resolveSoftHyphens removes the soft hyphens (U+00AD) from spans, which mark
+// where a word may be broken and break tokenizers when left in. Where the word
+// carries on after one, across a line break or in a later span, its halves are
+// joined; at the end of the spans, where it carries on elsewhere, such as on
+// the next page, it becomes the hyphen it was shown as; anywhere else it is
+// dropped.
+func resolveSoftHyphens(spans []models.Span) {
+	for i := range spans {
+		for {
+			head, rest, ok := strings.Cut(spans[i].Text, "\u00AD")
+			if !ok {
+				break
+			}
+			if after := strings.TrimLeftFunc(rest, unicode.IsSpace); after != "" {
+				if startsWithLetter(after) {
+					rest = after
+				}
+				spans[i].Text = head + rest
+				continue
+			}
+			j := i + 1
+			for j < len(spans) && strings.TrimSpace(spans[j].Text) == "" {
+				j++
+			}
+			switch {
+			case j == len(spans):
+				spans[i].Text = head + "-" + rest
+			case startsWithLetter(strings.TrimLeftFunc(spans[j].Text, unicode.IsSpace)):
+				spans[i].Text = head
+				for k := i + 1; k < j; k++ {
+					spans[k].Text = ""
+				}
+				spans[j].Text = strings.TrimLeftFunc(spans[j].Text, unicode.IsSpace)
+			default:
+				spans[i].Text = head + rest
+			}
+		}
+	}
+}
+
+func startsWithLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
+
 func cleanupSpanText(input string, opts CleanupOpts) string {
 	if input == "" {
 		return ""
@@ -65,6 +146,12 @@ func cleanupSpanText(input string, opts CleanupOpts) string {
 		input = strings.ReplaceAll(input, "\uFFFD", "")
 	}
 
+	input = text.SanitizeInvisible(input, opts.Invisible)
+
+	if opts.Ligatures {
+		input = text.ExpandLigatures(input)
+	}
+
 	if opts.Normalize {
 		input = strings.ReplaceAll(input, "-\n", "")
 		input = text.NormalizeText(input)
@@ -83,99 +170,83 @@ func cleanupSpanText(input string, opts CleanupOpts) string {
 	return input
 }
 
-func convertBulletBlocksToLists(blocks *[]models.Block) {
-	if blocks == nil || len(*blocks) == 0 {
-		return
-	}
-
-	i := 0
-	for i < len(*blocks) {
-		block := &(*blocks)[i]
-
-		if shouldConvertToList(block) {
-
-			listItem := convertBlockToListItem(block)
-
-			mergedPrev := false
-			mergedNext := false
-
-			if i > 0 && (*blocks)[i-1].Type == models.BlockList {
-
-				(*blocks)[i-1].Items = append((*blocks)[i-1].Items, listItem)
-
-				*blocks = append((*blocks)[:i], (*blocks)[i+1:]...)
-				mergedPrev = true
-			}
-
-			if !mergedPrev && i+1 < len(*blocks) && (*blocks)[i+1].Type == models.BlockList {
-
-				(*blocks)[i+1].Items = append([]models.ListItem{listItem}, (*blocks)[i+1].Items...)
-
-				*blocks = append((*blocks)[:i], (*blocks)[i+1:]...)
-				mergedNext = true
-			}
-
-			if !mergedPrev && !mergedNext {
-				block.Type = models.BlockList
-				block.Items = []models.ListItem{listItem}
-				block.Spans = nil
-				i++
-			}
+func convertBulletBlocksToLists(blocks []models.Block, bullets BulletGlyphs) []models.Block {
+	out := blocks[:0]
+	for i := 0; i < len(blocks); i++ {
+		block := blocks[i]
+		spans, ok := bulletItemSpans(&block, bullets)
+		if !ok {
+			out = append(out, block)
+			continue
+		}
 
-		} else {
-			i++
+		listItem := models.ListItem{Spans: spans, ListType: "bulleted"}
+		switch {
+		case len(out) > 0 && out[len(out)-1].Type == models.BlockList:
+			prev := &out[len(out)-1]
+			prev.Items = append(prev.Items, listItem)
+		case i+1 < len(blocks) && blocks[i+1].Type == models.BlockList:
+			next := &blocks[i+1]
+			next.Items = append([]models.ListItem{listItem}, next.Items...)
+		default:
+			block.Type = models.BlockList
+			block.Items = []models.ListItem{listItem}
+			block.Spans = nil
+			out = append(out, block)
 		}
 	}
+	return out
 }
 
-func shouldConvertToList(block *models.Block) bool {
-	if block == nil || len(block.Spans) < 2 {
-		return false
+// bulletItemSpans returns the spans of block after its bullet, if it starts
+// with one of bullets followed by text that is not a number, as in "§ 12".
+func bulletItemSpans(block *models.Block, bullets BulletGlyphs) ([]models.Span, bool) {
+	if block.Type == models.BlockList || block.Type == models.BlockTable || len(block.Spans) == 0 {
+		return nil, false
 	}
 
-	firstSpan := block.Spans[0]
-	if !firstSpan.Style.Monospace {
-		return false
-	}
-
-	if !isOnlyBulletChar(firstSpan.Text) {
-		return false
+	first := block.Spans[0]
+	lead := strings.TrimLeftFunc(first.Text, unicode.IsSpace)
+	if first.Style.Monospace && len(block.Spans) > 1 {
+		for _, glyph := range bullets.Monospace {
+			if strings.TrimSpace(lead) == glyph {
+				return itemText(block.Spans[1:])
+			}
+		}
 	}
 
-	secondSpan := block.Spans[1]
-	return hasASCIIText(secondSpan.Text)
-}
-
-func isOnlyBulletChar(text string) bool {
-	hasO := false
-	for _, r := range text {
-		if unicode.IsSpace(r) {
+	for _, glyph := range bullets.Glyphs {
+		rest, ok := strings.CutPrefix(lead, glyph)
+		if !ok || glyph == "" {
 			continue
 		}
-		if r != 'o' && r != 'O' {
-			return false
+		if rest == "" {
+			return itemText(block.Spans[1:])
 		}
-		hasO = true
-	}
-	return hasO
-}
-
-func hasASCIIText(text string) bool {
-	for _, r := range text {
-		if r >= 32 && r <= 126 && !unicode.IsSpace(r) {
-			return true
+		if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) {
+			continue
+		}
+		spans := append([]models.Span(nil), block.Spans...)
+		spans[0].Text = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if spans[0].Text == "" {
+			spans = spans[1:]
 		}
+		return itemText(spans)
 	}
-	return false
+	return nil, false
 }
 
-func convertBlockToListItem(block *models.Block) models.ListItem {
-	spans := block.Spans[1:]
-
-	return models.ListItem{
-		Spans:    spans,
-		ListType: "bulleted",
-		Indent:   0,
-		Prefix:   "",
+func itemText(spans []models.Span) ([]models.Span, bool) {
+	for _, span := range spans {
+		for _, r := range span.Text {
+			switch {
+			case unicode.IsSpace(r):
+			case unicode.IsLetter(r):
+				return spans, true
+			default:
+				return nil, false
+			}
+		}
 	}
+	return nil, false
 }
@@ -0,0 +1,391 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+// FilterBlocks drops every block whose type is not in only (when only is not
+// empty) or is in exclude. Run it after the other passes, which may rely on
+// the blocks it removes.
+func FilterBlocks(pages []models.Page, only, exclude []models.BlockType) {
+	has := func(types []models.BlockType, t models.BlockType) bool {
+		for _, u := range types {
+			if u == t {
+				return true
+			}
+		}
+		return false
+	}
+	for p := range pages {
+		kept := pages[p].Data[:0]
+		for _, b := range pages[p].Data {
+			if (len(only) == 0 || has(only, b.Type)) && !has(exclude, b.Type) {
+				kept = append(kept, b)
+			}
+		}
+		pages[p].Data = kept
+	}
+}
+
+// NumberBlocks records where every block is: the page it came from, its index
+// on it and its ordinal in the document, so blocks keep their place when the
+// output is split, chunked or merged. Run it after FilterBlocks, so the
+// numbers are those of the blocks written. Suppressed blocks, being outside
+// the data, only get their page.
+func NumberBlocks(pages []models.Page) {
+	ordinal := 0
+	for p := range pages {
+		source := pages[p].Number
+		if pages[p].SourcePage > 0 {
+			source = pages[p].SourcePage
+		}
+		for i := range pages[p].Data {
+			b := &pages[p].Data[i]
+			b.SourcePage, b.Index, b.Ordinal = source, i, ordinal
+			ordinal++
+		}
+		for i := range pages[p].Suppressed {
+			pages[p].Suppressed[i].SourcePage = source
+		}
+	}
+}
+
+// JoinAcrossPages merges a block that ends one page with the block that starts
+// the next when they are visibly the same paragraph or list: matching font
+// size, style and indentation, and a sentence that doesn't end at the page
+// break. The merged block keeps the bbox on its first page and records the
+// text it took from the next in ContinuedBBox.
+func JoinAcrossPages(pages []models.Page, sp text.Spacing) {
+	for i := 0; i+1 < len(pages); i++ {
+		prev, next := &pages[i], &pages[i+1]
+		if len(prev.Data) == 0 || len(next.Data) == 0 {
+			continue
+		}
+		if joinBlocks(&prev.Data[len(prev.Data)-1], &next.Data[0], sp) {
+			Logger.Debug("joined block across pages", "from", prev.Number, "to", next.Number)
+			next.Data = next.Data[1:]
+		}
+	}
+}
+
+func joinBlocks(a, b *models.Block, sp text.Spacing) bool {
+	if geometry.Abs32(a.FontSize-b.FontSize) > 0.5 {
+		return false
+	}
+	aligned := geometry.Abs32(a.BBox.X0()-b.BBox.X0()) <= a.FontSize*1.5
+	length := a.Length + b.Length
+	switch {
+	case a.Type == models.BlockText && b.Type == models.BlockText:
+		if !aligned || !sameStyle(a.Spans, b.Spans) || !continuesSentence(spansText(a.Spans), spansText(b.Spans)) {
+			return false
+		}
+		var delta int
+		a.Spans, delta = appendContinuation(a.Spans, b.Spans, sp)
+		length += delta
+	case a.Type == models.BlockList && b.Type == models.BlockList:
+		if len(a.Items) == 0 || len(b.Items) == 0 || !aligned {
+			return false
+		}
+		last, first := a.Items[len(a.Items)-1], b.Items[0]
+		if last.ListType != first.ListType || last.Indent != first.Indent || !sameStyle(last.Spans, first.Spans) {
+			return false
+		}
+		a.Items = append(a.Items, b.Items...)
+		length++ // the line break between the items
+	case a.Type == models.BlockList && b.Type == models.BlockText:
+		if len(a.Items) == 0 || b.BBox.X0() <= a.BBox.X0()+1.0 || text.StartsWithBullet(spansText(b.Spans)) {
+			return false
+		}
+		last := &a.Items[len(a.Items)-1]
+		if !sameStyle(last.Spans, b.Spans) || !continuesSentence(spansText(last.Spans), spansText(b.Spans)) {
+			return false
+		}
+		var delta int
+		last.Spans, delta = appendContinuation(last.Spans, b.Spans, sp)
+		length += delta
+	default:
+		return false
+	}
+	a.Length = length
+	a.Lines += b.Lines
+	a.ContinuedBBox = b.BBox
+	return true
+}
+
+// sameStyle reports whether text ending in spans and text starting with more
+// are set alike, bold, italic and monospaced or not.
+func sameStyle(spans, more []models.Span) bool {
+	if len(spans) == 0 || len(more) == 0 {
+		return false
+	}
+	a, b := spans[len(spans)-1].Style, more[0].Style
+	return a.Bold == b.Bold && a.Italic == b.Italic && a.Monospace == b.Monospace
+}
+
+func continuesSentence(prev, next string) bool {
+	prev, next = strings.TrimSpace(prev), strings.TrimSpace(next)
+	if prev == "" || next == "" || text.EndsWithPunctuation(prev) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(next)
+	return unicode.IsLower(r) || (text.IsCJK(r) && !unicode.IsPunct(r))
+}
+
+// appendContinuation joins more onto spans, dropping the hyphen of a word
+// broken at the join or putting a space between them where sp calls for one,
+// and returns how many characters that added, or removed if negative.
+func appendContinuation(spans, more []models.Span, sp text.Spacing) ([]models.Span, int) {
+	if len(spans) == 0 || len(more) == 0 {
+		return append(spans, more...), 0
+	}
+	before := text.CountUnicodeChars(spansText(spans)) + text.CountUnicodeChars(spansText(more))
+	more = append([]models.Span(nil), more...)
+	last := &spans[len(spans)-1]
+	if trimmed := strings.TrimRight(last.Text, " "); strings.HasSuffix(trimmed, "-") {
+		last.Text = strings.TrimSuffix(trimmed, "-")
+	} else if end, _ := utf8.DecodeLastRuneInString(trimmed); !text.JoinsWithoutSpace(end, firstRuneOf(more[0].Text), sp) {
+		more[0].Text = " " + more[0].Text
+	}
+	if last.Style == more[0].Style && last.URI == more[0].URI {
+		last.Text += more[0].Text
+		more = more[1:]
+	}
+	spans = append(spans, more...)
+	return spans, text.CountUnicodeChars(spansText(spans)) - before
+}
+
+// AnnotateSentences records the sentence boundaries of every text, heading and
+// footnote block as rune offsets into the concatenated span text.
+func AnnotateSentences(pages []models.Page) {
+	for p := range pages {
+		for b := range pages[p].Data {
+			switch block := &pages[p].Data[b]; block.Type {
+			case models.BlockText, models.BlockHeading, models.BlockFootnote:
+				block.Sentences = text.SplitSentences(spansText(block.Spans))
+			}
+		}
+	}
+}
+
+func firstRuneOf(s string) rune {
+	r, _ := utf8.DecodeRuneInString(strings.TrimSpace(s))
+	return r
+}
+
+func spansText(spans []models.Span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+var referenceHeadings = map[string]bool{
+	"references": true, "reference list": true, "bibliography": true,
+	"works cited": true, "literature cited": true, "cited literature": true,
+}
+
+// StructureReferences turns the blocks under a "References" or "Bibliography"
+// heading into references blocks with one item per entry. Numbered entries
+// ([12] or 12.) keep their number as the item prefix. Entries broken across
+// blocks are joined with sp.
+func StructureReferences(pages []models.Page, sp text.Spacing) {
+	st := refState{spacing: sp}
+	for p := range pages {
+		pages[p].Data = st.structurePage(pages[p].Data)
+	}
+}
+
+type refState struct {
+	inSection bool
+	numbered  bool
+	prev      *models.Block // last references block, receives continuations of its final entry
+	spacing   text.Spacing
+}
+
+func (st *refState) structurePage(blocks []models.Block) []models.Block {
+	out := make([]models.Block, 0, len(blocks))
+	carried := st.prev // on an earlier page, so text continuing it lies outside its bbox
+	var refs *models.Block
+	flush := func() {
+		if refs != nil && len(refs.Items) > 0 {
+			out = append(out, *refs)
+			st.prev = &out[len(out)-1]
+		}
+		refs = nil
+	}
+	for _, b := range blocks {
+		if isReferencesHeading(b) {
+			flush()
+			st.inSection, st.numbered, st.prev, carried = true, false, nil, nil
+			out = append(out, b)
+			continue
+		}
+		if b.Type == models.BlockHeading {
+			st.inSection = false
+		}
+		if !st.inSection || (b.Type != models.BlockText && b.Type != models.BlockList) {
+			flush()
+			out = append(out, b)
+			continue
+		}
+		if refs == nil {
+			refs = &models.Block{Type: models.BlockReferences, FontSize: b.FontSize, Band: b.Band, Column: b.Column, TopDown: b.TopDown}
+		}
+		entries := [][]models.Span{b.Spans}
+		if b.Type == models.BlockList {
+			entries = entries[:0]
+			for _, item := range b.Items {
+				entries = append(entries, item.Spans)
+			}
+		}
+		var target *models.Block
+		for _, spans := range entries {
+			target = st.addEntries(refs, spans)
+			if target == carried {
+				target.ContinuedBBox = target.ContinuedBBox.Union(b.BBox)
+			} else {
+				target.BBox = target.BBox.Union(b.BBox)
+			}
+			target.Length = text.CountUnicodeChars(target.Text())
+		}
+		if target != nil {
+			target.Lines += b.Lines
+		}
+	}
+	flush()
+	return out
+}
+
+// addEntries adds the reference entries in spans to refs, or to the last
+// entry of refs or of the references block before it when spans continue
+// it, and returns the block it added to.
+func (st *refState) addEntries(refs *models.Block, spans []models.Span) *models.Block {
+	prefix := referenceMarker(spansText(spans))
+	if prefix == "" {
+		target := refs
+		if len(target.Items) == 0 && st.prev != nil {
+			target = st.prev
+		}
+		if st.numbered && len(target.Items) > 0 {
+			last := &target.Items[len(target.Items)-1]
+			last.Spans, _ = appendContinuation(last.Spans, trimSpans(spans, 0), st.spacing)
+			return target
+		}
+		refs.Items = append(refs.Items, models.ListItem{Spans: trimSpans(spans, 0), ListType: "reference"})
+		return refs
+	}
+	st.numbered = true
+	for len(spans) > 0 {
+		entry, rest := spans, []models.Span(nil)
+		if off := nextReferenceMarker(spansText(spans), prefix); off > 0 {
+			entry, rest = splitSpansAt(spans, off)
+		}
+		refs.Items = append(refs.Items, models.ListItem{Spans: trimSpans(entry, len(prefix)), ListType: "reference", Prefix: prefix})
+		spans = rest
+		prefix = referenceMarker(spansText(spans))
+	}
+	return refs
+}
+
+func isReferencesHeading(b models.Block) bool {
+	if b.Type != models.BlockHeading && (b.Type != models.BlockText || b.Lines > 1) {
+		return false
+	}
+	fields := strings.Fields(strings.ToLower(spansText(b.Spans)))
+	if len(fields) > 1 && strings.Trim(fields[0], "0123456789.ivx") == "" {
+		fields = fields[1:]
+	}
+	return referenceHeadings[strings.TrimRight(strings.Join(fields, " "), ":")]
+}
+
+// referenceMarker returns the leading "[12]", "[Smi04]" or "12." of a
+// reference entry, or "" if there is none.
+func referenceMarker(s string) string {
+	s = strings.TrimLeft(s, " \t\n")
+	if strings.HasPrefix(s, "[") {
+		if j := strings.IndexByte(s, ']'); j > 1 && j <= 12 && !strings.ContainsAny(s[1:j], " \t\n") {
+			return s[:j+1]
+		}
+		return ""
+	}
+	i := 0
+	for i < len(s) && i < 4 && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(s) && s[i] == '.' && unicode.IsSpace(rune(s[i+1])) {
+		return s[:i+1]
+	}
+	return ""
+}
+
+// nextReferenceMarker finds where the entry numbered after prefix starts in s,
+// so a block holding several entries can be split without breaking on inline
+// numbers. It returns -1 for unnumbered labels or when there is no next entry.
+func nextReferenceMarker(s, prefix string) int {
+	n, err := strconv.Atoi(strings.Trim(prefix, "[]."))
+	if err != nil {
+		return -1
+	}
+	next := strconv.Itoa(n+1) + "."
+	if strings.HasPrefix(prefix, "[") {
+		next = "[" + strconv.Itoa(n+1) + "]"
+	}
+	for from := len(s) - len(strings.TrimLeft(s, " \t\n")) + len(prefix); ; {
+		i := strings.Index(s[from:], next)
+		if i < 0 {
+			return -1
+		}
+		at := from + i
+		if at > 0 && unicode.IsSpace(rune(s[at-1])) {
+			return at
+		}
+		from = at + len(next)
+	}
+}
+
+func splitSpansAt(spans []models.Span, off int) ([]models.Span, []models.Span) {
+	for i, s := range spans {
+		if off < len(s.Text) {
+			before := append(append([]models.Span(nil), spans[:i]...), models.Span{Text: s.Text[:off], Style: s.Style, URI: s.URI})
+			after := append([]models.Span{{Text: s.Text[off:], Style: s.Style, URI: s.URI}}, spans[i+1:]...)
+			return before, after
+		}
+		off -= len(s.Text)
+	}
+	return spans, nil
+}
+
+// trimSpans drops the first skip bytes of leading-space-trimmed text along with
+// surrounding whitespace and any spans left empty.
+func trimSpans(spans []models.Span, skip int) []models.Span {
+	out := make([]models.Span, 0, len(spans))
+	for _, s := range spans {
+		if len(out) == 0 {
+			s.Text = strings.TrimLeft(s.Text, " \t\n")
+			if skip > 0 {
+				n := min(skip, len(s.Text))
+				s.Text, skip = strings.TrimLeft(s.Text[n:], " \t\n"), skip-n
+			}
+			if s.Text == "" {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	for len(out) > 0 {
+		last := &out[len(out)-1]
+		if last.Text = strings.TrimRight(last.Text, " \t\n"); last.Text != "" {
+			break
+		}
+		out = out[:len(out)-1]
+	}
+	return out
+}
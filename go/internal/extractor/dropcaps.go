@@ -0,0 +1,63 @@
+package extractor
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+// mergeDropCaps puts decorative initials back at the start of their paragraph.
+// A drop cap arrives as a block of its own holding one letter, set two to four
+// lines of body text tall, whose top lines up with a text block starting just
+// to its right; it would otherwise pass for a heading and leave the first word
+// of the paragraph without its first letter.
+func mergeDropCaps(blocks []*blockInfo, bodySize float32) []*blockInfo {
+	out := blocks[:0]
+	for i, b := range blocks {
+		if p := dropCapParagraph(blocks, i, bodySize); p != nil {
+			letter := strings.TrimSpace(b.Text)
+			if len(p.Spans) > 0 {
+				p.Spans = slices.Clone(p.Spans)
+				p.Spans[0].Text = letter + strings.TrimLeftFunc(p.Spans[0].Text, unicode.IsSpace)
+			}
+			if len(p.Lines) > 0 {
+				p.Lines = slices.Clone(p.Lines)
+				p.Lines[0].Text = letter + p.Lines[0].Text
+			}
+			p.Chars = append(slices.Clone(b.Chars), p.Chars...)
+			p.BBox = p.BBox.Union(b.BBox)
+			p.Text = text.NormalizeText(letter + p.Text)
+			p.TextChars = text.CountUnicodeChars(p.Text)
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// dropCapParagraph returns the paragraph blocks[i] is the drop cap of, or nil
+// if it is none.
+func dropCapParagraph(blocks []*blockInfo, i int, bodySize float32) *blockInfo {
+	b := blocks[i]
+	letter := []rune(strings.TrimSpace(b.Text))
+	if (b.Type != models.BlockHeading && b.Type != models.BlockText) || len(letter) != 1 || !unicode.IsLetter(letter[0]) {
+		return nil
+	}
+	if lines := b.AvgFontSize / (bodySize * 1.2); lines < 1.5 || lines > 4.5 {
+		return nil
+	}
+	for j, p := range blocks {
+		if j == i || p.Type != models.BlockText || p.AvgFontSize > bodySize*1.2 {
+			continue
+		}
+		gap := p.BBox.X0() - b.BBox.X1()
+		if gap > -1 && gap < 2*bodySize && geometry.Abs32(p.BBox.Y0()-b.BBox.Y0()) < bodySize*1.5 {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package extractor
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// demoteInlineBold turns headings found only by being bold back into text
+// where the blocks around them, in reading order, show them to be emphasis
+// within the body: a product name or lead-in that MuPDF set apart from the
+// rest of its line or paragraph. It takes h.BoldHeadingContext of these signs:
+//   - the block shares a line with other text
+//   - it starts in lowercase, or the text above it in its column ends
+//     mid-sentence with no more than a line's gap between them
+//   - the text below it in its column starts in lowercase
+//   - it is indented past the text below it without being centred over it
+func demoteInlineBold(blocks []*blockInfo, h Heuristics) {
+	if h.BoldHeadingContext <= 0 {
+		return
+	}
+	for i, info := range blocks {
+		if info.Type != models.BlockHeading || !info.BoldHeading {
+			continue
+		}
+		if inlineSigns(blocks, i, h) >= h.BoldHeadingContext {
+			info.Type, info.HeadingLevel, info.BoldHeading, info.Confidence = models.BlockText, 0, false, 0.6
+		}
+	}
+}
+
+func inlineSigns(blocks []*blockInfo, i int, h Heuristics) int {
+	info, size := blocks[i], blocks[i].AvgFontSize
+	signs := 0
+	for j, other := range blocks {
+		if j != i && isBodyText(other) && other.ColIdx == info.ColIdx && other.BandIdx == info.BandIdx && sharesLine(info.BBox, other.BBox, size) {
+			signs++
+			break
+		}
+	}
+
+	first, _ := utf8.DecodeRuneInString(info.Text)
+	prev, next := columnNeighbour(blocks, i, -1), columnNeighbour(blocks, i, 1)
+	switch {
+	case unicode.IsLower(first):
+		signs++
+	case prev != nil && endsMidSentence(prev.Text) && info.BBox.Y0()-prev.BBox.Y1() < size*h.ParagraphGap:
+		signs++
+	}
+
+	if next != nil {
+		if r, _ := utf8.DecodeRuneInString(next.Text); unicode.IsLower(r) {
+			signs++
+		}
+		centred := geometry.Abs32((info.BBox.X0()+info.BBox.X1())/2-(next.BBox.X0()+next.BBox.X1())/2) < size
+		if info.BBox.X0()-next.BBox.X0() > size && !centred {
+			signs++
+		}
+	}
+	return signs
+}
+
+func isBodyText(b *blockInfo) bool {
+	return b.Type == models.BlockText || b.Type == models.BlockList || b.Type == models.BlockFootnote
+}
+
+// columnNeighbour is the closest body text block before (dir -1) or after
+// (dir 1) blocks[i] in its column, if nothing else comes between them.
+func columnNeighbour(blocks []*blockInfo, i, dir int) *blockInfo {
+	for j := i + dir; j >= 0 && j < len(blocks); j += dir {
+		b := blocks[j]
+		if b.ColIdx != blocks[i].ColIdx || b.BandIdx != blocks[i].BandIdx {
+			continue
+		}
+		if isBodyText(b) {
+			return b
+		}
+		return nil
+	}
+	return nil
+}
+
+// sharesLine reports whether b sits just beside a on one of its lines: their
+// vertical extents overlap by most of a line and they are less than two font
+// sizes apart horizontally.
+func sharesLine(a, b models.BBox, size float32) bool {
+	overlapY := min(a.Y1(), b.Y1()) - max(a.Y0(), b.Y0())
+	gapX := max(b.X0()-a.X1(), a.X0()-b.X1())
+	return overlapY > size*0.6 && gapX > -1 && gapX < size*2
+}
+
+func endsMidSentence(s string) bool {
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(s, unicode.IsSpace))
+	return unicode.IsLetter(last) || last == ','
+}
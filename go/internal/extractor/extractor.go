@@ -1,9 +1,15 @@
 package extractor
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pymupdf4llm-c/go/internal/bridge"
 	"github.com/pymupdf4llm-c/go/internal/column"
@@ -16,18 +22,220 @@ import (
 
 var Logger = logger.GetLogger("extractor")
 
+type Options struct {
+	ReadingOrder        column.Strategy
+	Columns             column.Options          // overrides for column detection; with xycut, any override switches to it
+	PageColumns         map[int][]column.Range  // explicit column ranges by page number, taking precedence over Columns
+	TableRegions        map[int][]geometry.Rect // known tables by page number, 0 for every page, taken without detection
+	IgnoreZones         map[int][]geometry.Rect // regions left out entirely by page number, 0 for every page
+	Deskew              bool                    // straighten pages scanned at a slight angle, see bridge.Deskew
+	KeepRedacted        bool                    // extract the text under redaction annotations not yet applied instead of leaving it out
+	KeepListMarkers     bool                    // start list items with their bullet as printed rather than "- "
+	KeepSuppressed      bool                    // keep the page numbers, running heads and vertical margin text left out of Data in each page's Suppressed
+	DocumentFonts       bool                    // classify with the font sizes of the whole document, measured by the caller into Fonts
+	Fonts               *FontSizes              // of the whole document, used instead of each page's own when set
+	JoinAcrossPages     bool                    // merge paragraphs and lists that run onto the next page, see JoinAcrossPages
+	StructureReferences bool
+	LinkCitations       bool
+	PaperMetadata       bool
+	BatesNumbers        bool
+	RunningHeads        bool // move text recurring in the top and bottom margins to each page's HeaderText and FooterText, see ExtractRunningHeads
+	Lines               bool
+	Chars               bool // include every character of text blocks, for building layout models on
+	Spacing             text.Spacing
+	Cleanup             CleanupOpts
+	Sentences           bool
+	Fingerprints        bool
+	Confidence          bool             // report how confidently each text block was classified
+	ColumnLabels        bool             // label blocks with their band and column and report each page's columns
+	OrderConfidence     bool             // report how clearly columns settled each page's reading order
+	TopDownOrder        bool             // number blocks in plain top-to-bottom order besides
+	PageTimings         bool             // record the time spent on tables and classification in each page's Timings
+	KeyValues           bool             // pair form labels with their values
+	DisableTables       bool             // skip table detection; ruled text comes out as ordinary blocks
+	DropEmptyCells      bool             // leave the empty gaps out of table rows, see table.Options
+	TableNumbers        bool             // set the Value of table cells holding a number
+	DecimalMark         rune             // of those numbers, '.' or ','; 0 tells from each number
+	Images              ImageFilter      // which figures to keep
+	ScanImages          bool             // set the scan of a scanned page as its Scan instead of a figure
+	Margins             text.Margins     // zones where page numbers and running heads are dropped
+	PageNumbers         text.PageNumbers // forms of the page numbers dropped from them
+	PageMargins         []PageMargins    // overrides Margins for pages of particular sizes
+	Heuristics          Heuristics
+	Tables              table.Thresholds
+	Classifier          Classifier `json:"-"` // has the last word on the type of text blocks; nil leaves it to the heuristics
+
+	Timings *Timings `json:"-"` // nil skips the bookkeeping
+}
+
+// Timings adds up the time spent in parts of page extraction over every page
+// extracted with the same Options. It is safe for concurrent use.
+type Timings struct {
+	tables atomic.Int64
+}
+
+// Tables is the time spent detecting tables, summed over pages.
+func (t *Timings) Tables() time.Duration { return time.Duration(t.tables.Load()) }
+
+var DefaultOptions = Options{
+	ReadingOrder:  column.StrategyColumns,
+	LinkCitations: true,
+	PaperMetadata: true,
+	BatesNumbers:  true,
+	RunningHeads:  true,
+	DocumentFonts: true,
+	Spacing:       text.DefaultSpacing,
+	Cleanup:       DefaultCleanup,
+	Margins:       text.DefaultMargins,
+	PageNumbers:   text.DefaultPageNumbers,
+	Heuristics:    DefaultHeuristics,
+	Tables:        table.DefaultThresholds,
+}
+
+// Heuristics are the thresholds for splitting raw blocks and classifying them.
+// Gaps are in multiples of the font size.
+type Heuristics struct {
+	HeadingSize           float32    `json:"heading_size"`             // of the page's median font size: short blocks this large are headings
+	HeadingMaxChars       int        `json:"heading_max_chars"`        // longest heading recognised by its size
+	CapsHeadingMaxChars   int        `json:"caps_heading_max_chars"`   // longest all-caps heading
+	CapsHeadingMinLetters int        `json:"caps_heading_min_letters"` // capitals an all-caps heading needs, not counting acronyms such as GMBH or LLC
+	CapsHeadingMaxWords   int        `json:"caps_heading_max_words"`   // longest all-caps heading in words
+	CapsHeadingLanguage   string     `json:"caps_heading_language"`    // "de", "en" or "fr" to discount only that language's acronyms; "" for all of them
+	BoldHeadingRatio      float32    `json:"bold_heading_ratio"`       // share of bold chars that makes a short block a heading
+	BoldHeadingMaxChars   int        `json:"bold_heading_max_chars"`   // longest heading recognised by being bold
+	BoldHeadingContext    int        `json:"bold_heading_context"`     // signs of inline emphasis from the surrounding text that turn a bold heading back into text; 0 never does
+	HeadingLevels         [3]float32 `json:"heading_levels"`           // font sizes in points from which headings are levels 1, 2 and 3; below, 4
+	ParagraphGap          float32    `json:"paragraph_gap"`            // gap between lines that starts a new block
+	BoldParagraphGap      float32    `json:"bold_paragraph_gap"`       // the same where a bold first line gives way to regular text
+	ParagraphMergeGap     float32    `json:"paragraph_merge_gap"`      // gap between text blocks of the same style and column below which they are one paragraph; 0 keeps them apart
+	ListItemGap           float32    `json:"list_item_gap"`            // gap above unbulleted text that stops it continuing a list item
+	ListBreakGap          float32    `json:"list_break_gap"`           // gap between bulleted blocks, if also over 20pt, that ends a list
+	TableOverlap          float32    `json:"table_overlap"`            // share of a text block's area within a table that drops it
+	FootnoteRuleWidth     float32    `json:"footnote_rule_width"`      // of the page width: the longest rule taken for the one above footnotes; 0 ignores rules
+}
+
+var DefaultHeuristics = Heuristics{
+	HeadingSize:           1.25,
+	HeadingMaxChars:       160,
+	CapsHeadingMaxChars:   200,
+	CapsHeadingMinLetters: 4,
+	CapsHeadingMaxWords:   12,
+	BoldHeadingRatio:      0.8,
+	BoldHeadingMaxChars:   80,
+	BoldHeadingContext:    1,
+	HeadingLevels:         [3]float32{18, 14, 12},
+	ParagraphGap:          1.5,
+	BoldParagraphGap:      1.2,
+	ParagraphMergeGap:     0.5,
+	ListItemGap:           1.5,
+	ListBreakGap:          2.5,
+	TableOverlap:          0.85,
+	FootnoteRuleWidth:     0.5,
+}
+
+// Features describe a text block to a Classifier.
+type Features struct {
+	Page           int         `json:"page"`
+	PageBounds     models.BBox `json:"page_bounds"`
+	BBox           models.BBox `json:"bbox"`
+	Text           string      `json:"text"`
+	Chars          int         `json:"chars"`
+	Lines          int         `json:"lines"`
+	FontSize       float32     `json:"font_size"`
+	MedianFontSize float32     `json:"median_font_size"` // of all text on the page
+	BoldRatio      float32     `json:"bold_ratio"`
+	ItalicRatio    float32     `json:"italic_ratio"`
+	MonoRatio      float32     `json:"mono_ratio"`
+	Confidence     float32     `json:"confidence"` // of the heuristics' choice
+}
+
+// Classifier overrides the type the heuristics gave a text block. It is passed
+// their choice, with the heading level for headings, and returns the type and
+// level to use. Text blocks can only become text, heading, list, code,
+// footnote or other; anything else is ignored. It must be safe for concurrent
+// use, as pages are extracted in parallel.
+type Classifier interface {
+	Classify(f Features, typ models.BlockType, level int) (models.BlockType, int)
+}
+
+type ClassifierFunc func(f Features, typ models.BlockType, level int) (models.BlockType, int)
+
+func (fn ClassifierFunc) Classify(f Features, typ models.BlockType, level int) (models.BlockType, int) {
+	return fn(f, typ, level)
+}
+
+func reclassify(c Classifier, info *blockInfo, raw *bridge.RawPageData, medianSize float32) {
+	typ, level := c.Classify(Features{
+		Page:           raw.PageNumber,
+		PageBounds:     models.BBox{raw.PageBounds.X0, raw.PageBounds.Y0, raw.PageBounds.X1, raw.PageBounds.Y1},
+		BBox:           info.BBox,
+		Text:           info.Text,
+		Chars:          info.TextChars,
+		Lines:          info.LineCount,
+		FontSize:       info.AvgFontSize,
+		MedianFontSize: medianSize,
+		BoldRatio:      info.BoldRatio,
+		ItalicRatio:    info.ItalicRatio,
+		MonoRatio:      info.MonoRatio,
+		Confidence:     info.Confidence,
+	}, info.Type, info.HeadingLevel)
+	if typ == info.Type && level == info.HeadingLevel {
+		return
+	}
+	// Once overridden, the heuristics' confidence no longer applies.
+	info.BoldHeading = false
+	switch typ {
+	case models.BlockHeading:
+		info.Type, info.HeadingLevel, info.Confidence = typ, geometry.Clamp(level, 1, 6), 0
+	case models.BlockText, models.BlockList, models.BlockCode, models.BlockFootnote, models.BlockOther:
+		info.Type, info.HeadingLevel, info.Confidence = typ, 0, 0
+	default:
+		Logger.Warn("classifier returned a type text blocks cannot have", "type", typ, "page", raw.PageNumber)
+	}
+}
+
+// tableRegions are the TableRegions for every page followed by those for
+// page, in a slice of their own.
+func (o Options) tableRegions(page int) []geometry.Rect {
+	return append(append([]geometry.Rect(nil), o.TableRegions[0]...), o.TableRegions[page]...)
+}
+
+// PageMargins applies Margins to pages of the given size in points, either way
+// up, give or take 2pt.
+type PageMargins struct {
+	Width, Height float32
+	Margins       text.Margins
+}
+
+func (o Options) marginsFor(page bridge.Rect) text.Margins {
+	w, h := page.X1-page.X0, page.Y1-page.Y0
+	near := func(a, b float32) bool { return geometry.Abs32(a-b) <= 2 }
+	for _, pm := range o.PageMargins {
+		if (near(w, pm.Width) && near(h, pm.Height)) || (near(w, pm.Height) && near(h, pm.Width)) {
+			return pm.Margins
+		}
+	}
+	return o.Margins
+}
+
 type blockInfo struct {
-	Text, Prefix                                   string
+	Text, Prefix, Alt, Image                       string
 	BBox                                           models.BBox
 	Type                                           models.BlockType
 	AvgFontSize, BoldRatio, ItalicRatio, MonoRatio float32
+	Confidence                                     float32
 	TextChars, LineCount, HeadingLevel, ColIdx     int
+	BandIdx, TableIdx                              int
+	BoldHeading                                    bool // a heading only for being short and bold
 	Spans                                          []models.Span
 	ListItems                                      []models.ListItem
+	Lines                                          []models.Line
+	Chars                                          []models.Char
 }
 
 func (b *blockInfo) GetBBox() models.BBox   { return b.BBox }
 func (b *blockInfo) SetColumnIndex(idx int) { b.ColIdx = idx }
+func (b *blockInfo) SetBandIndex(idx int)   { b.BandIdx = idx }
 
 type fontStats struct {
 	counts     [128]int
@@ -45,6 +253,37 @@ func (f *fontStats) add(size float32) {
 	f.totalChars++
 }
 
+func (f *fontStats) merge(o *fontStats) {
+	for i, c := range o.counts {
+		f.counts[i] += c
+	}
+	f.totalSize += o.totalSize
+	f.totalChars += o.totalChars
+}
+
+// FontSizes are the font sizes classification goes by: the body size, the
+// most common, and the median.
+type FontSizes struct{ Body, Median float32 }
+
+// FontTally counts font sizes over many pages, so pages that are mostly
+// headings or tables can be classified by the body size of the whole document
+// rather than their own. Pages can be counted in tallies of their own and
+// merged.
+type FontTally struct{ stats fontStats }
+
+func (t *FontTally) Add(raw *bridge.RawPageData) {
+	for _, ch := range raw.Chars {
+		t.stats.add(ch.Size)
+	}
+}
+
+func (t *FontTally) Merge(o *FontTally) { t.stats.merge(&o.stats) }
+
+// Sizes are the font sizes of the pages counted, or false if they had no text.
+func (t *FontTally) Sizes() (FontSizes, bool) {
+	return FontSizes{Body: t.stats.mode(), Median: t.stats.median()}, t.stats.totalChars > 0
+}
+
 func (f *fontStats) mode() float32 {
 	if f.totalChars == 0 {
 		return 12.0
@@ -74,82 +313,221 @@ func (f *fontStats) median() float32 {
 	return float32(f.totalSize / float64(f.totalChars))
 }
 
-func classifyBlock(info *blockInfo, medianSize float32) {
-	headingThreshold, tLen, txt := medianSize*1.25, info.TextChars, info.Text
+// classifyBlock decides a text block's type and sets Confidence to how clearly
+// the deciding rules fired: 1 is certain, 0.5 a coin toss.
+func classifyBlock(info *blockInfo, medianSize float32, h Heuristics) {
+	headingThreshold, tLen, txt := medianSize*h.HeadingSize, info.TextChars, info.Text
 	if info.LineCount > 1 && text.StartsWithBullet(txt) {
-		info.Type = models.BlockList
+		info.Type, info.Confidence = models.BlockList, 0.95
 		return
 	}
-	fontBased := info.AvgFontSize >= headingThreshold && tLen > 0 && tLen <= 160
+	fontBased := info.AvgFontSize >= headingThreshold && tLen > 0 && tLen <= h.HeadingMaxChars
 	numericOrKeyword := text.StartsWithNumericHeading(txt) || text.StartsWithHeadingKeyword(txt)
-	heading := fontBased || numericOrKeyword || (text.IsAllCaps(txt) && tLen > 0 && tLen <= 200)
+	caps := tLen > 0 && tLen <= h.CapsHeadingMaxChars && text.IsCapsHeading(txt, text.CapsHeading{MinLetters: h.CapsHeadingMinLetters, MaxWords: h.CapsHeadingMaxWords, Language: h.CapsHeadingLanguage})
+	heading := fontBased || numericOrKeyword || caps
 	if fontBased && info.BoldRatio >= 0.35 {
 		heading = true
 	}
-	if !heading && info.BoldRatio >= 0.8 && tLen > 0 && tLen <= 80 && info.LineCount <= 2 {
+	bold := !heading && info.BoldRatio >= h.BoldHeadingRatio && tLen > 0 && tLen <= h.BoldHeadingMaxChars && info.LineCount <= 2
+	if bold {
 		heading = true
 	}
-	if heading && text.EndsWithPunctuation(txt) && !fontBased && !numericOrKeyword {
-		heading = false
+	info.BoldHeading = bold
+	punctuated := heading && text.EndsWithPunctuation(txt) && !fontBased && !numericOrKeyword
+	if punctuated {
+		heading, info.BoldHeading = false, false
 	}
 	if heading {
 		info.Type, info.HeadingLevel = models.BlockHeading, 4
-		if info.AvgFontSize >= 18.0 {
-			info.HeadingLevel = 1
-		} else if info.AvgFontSize >= 14.0 {
-			info.HeadingLevel = 2
-		} else if info.AvgFontSize >= 12.0 {
-			info.HeadingLevel = 3
+		for i, size := range h.HeadingLevels {
+			if info.AvgFontSize >= size {
+				info.HeadingLevel = i + 1
+				break
+			}
+		}
+		// The strongest signal sets the confidence and every other one that
+		// agrees halves the remaining doubt.
+		var signals []float32
+		if fontBased {
+			signals = append(signals, 0.6+0.35*unit((info.AvgFontSize/headingThreshold-1)/0.3))
+			if info.BoldRatio >= 0.35 {
+				signals = append(signals, 0.5)
+			}
+		}
+		if numericOrKeyword {
+			signals = append(signals, 0.8)
+		}
+		if caps {
+			signals = append(signals, 0.55)
+		}
+		if bold {
+			signals = append(signals, 0.5+0.25*unit((info.BoldRatio-h.BoldHeadingRatio)/(1-h.BoldHeadingRatio)))
+		}
+		sort.SliceStable(signals, func(i, j int) bool { return signals[i] > signals[j] })
+		info.Confidence = signals[0]
+		for _, s := range signals[1:] {
+			info.Confidence += (1 - info.Confidence) * s / 2
 		}
 		return
 	}
 	if text.StartsWithBullet(txt) {
-		info.Type = models.BlockList
+		info.Type, info.Confidence = models.BlockList, 0.85
 	} else if tLen == 0 {
-		info.Type = models.BlockOther
+		info.Type, info.Confidence = models.BlockOther, 1
 	} else {
+		// Body text is less certain the closer it came to passing for a
+		// heading: nearly heading-sized, short and bold, or a heading
+		// rejected for its punctuation.
 		info.Type = models.BlockText
+		nearMiss := unit((info.AvgFontSize/headingThreshold - 0.85) / 0.15)
+		if tLen <= h.BoldHeadingMaxChars && h.BoldHeadingRatio > 0 {
+			nearMiss = max(nearMiss, 0.8*unit(info.BoldRatio/h.BoldHeadingRatio))
+		}
+		if punctuated {
+			nearMiss = max(nearMiss, 0.6)
+		}
+		if tLen > h.HeadingMaxChars {
+			nearMiss /= 2
+		}
+		info.Confidence = 0.95 - 0.45*nearMiss
+	}
+}
+
+func unit(x float32) float32 {
+	if !(x > 0) { // NaN too
+		return 0
 	}
+	return min(1, x)
 }
 
-func finalizeBlockInfo(info *blockInfo, pageBounds bridge.Rect) {
+// Why finalizeBlockInfo or ExtractRunningHeads found a block not to be
+// content, as models.Block gives it for the blocks of a page's Suppressed.
+const (
+	suppressedPageNumber  = "page_number"
+	suppressedRunningHead = "running_head"
+	suppressedRunningFoot = "running_foot" // found by ExtractRunningHeads
+	suppressedVertical    = "vertical_text"
+)
+
+// finalizeBlockInfo empties blocks that are not content: vertical text down
+// a margin, such as an arXiv identifier, page numbers and running heads. It
+// returns why it emptied the block, or "" if it did not.
+func finalizeBlockInfo(info *blockInfo, pageBounds bridge.Rect, margins text.Margins, numbers text.PageNumbers) string {
 	if info == nil {
-		return
+		return ""
 	}
-	if w, h := info.BBox.Width(), info.BBox.Height(); w < 30.0 && h > 200.0 {
+	reason := ""
+	pageBBox := [4]float32{pageBounds.X0, pageBounds.Y0, pageBounds.X1, pageBounds.Y1}
+	switch {
+	case info.BBox.Width() < 30.0 && info.BBox.Height() > 200.0:
+		reason = suppressedVertical
+	case !margins.Contains(info.BBox, pageBBox) || info.TextChars == 0 || info.TextChars >= 200:
+	case numbers.Match(info.Text):
+		reason = suppressedPageNumber
+	case margins.InTop(info.BBox, pageBBox) && (info.Type == models.BlockHeading || text.IsAllCaps(info.Text)) && info.AvgFontSize < 18.0:
+		reason = suppressedRunningHead
+	}
+	if reason != "" {
 		info.Text, info.TextChars, info.Spans = "", 0, nil
 	}
-	pageBBox := [4]float32{pageBounds.X0, pageBounds.Y0, pageBounds.X1, pageBounds.Y1}
-	if text.IsInMarginArea(info.BBox, pageBBox, 0.08) && info.TextChars > 0 && info.TextChars < 200 {
-		if text.IsLonePageNumber(info.Text) || (info.BBox.Y0() < pageBounds.Y0+(pageBounds.Y1-pageBounds.Y0)*0.08 && (info.Type == models.BlockHeading || text.IsAllCaps(info.Text)) && info.AvgFontSize < 18.0) {
-			info.Text, info.TextChars, info.Spans = "", 0, nil
-		}
+	return reason
+}
+
+// newBlock is the block of text info was made into.
+func newBlock(info *blockInfo, opts Options) models.Block {
+	block := models.Block{Type: info.Type, BBox: info.BBox, Length: info.TextChars, Level: info.HeadingLevel, FontSize: info.AvgFontSize, Lines: info.LineCount, Spans: info.Spans, Items: info.ListItems, TextLines: info.Lines, Chars: info.Chars}
+	if opts.Confidence {
+		block.Confidence = float32(math.Round(float64(info.Confidence)*100) / 100)
 	}
+	labelColumn(&block, info, opts)
+	return block
 }
 
 func ExtractPageFromRaw(raw *bridge.RawPageData) models.Page {
+	return ExtractPageFromRawWithOptions(raw, DefaultOptions)
+}
+
+func ExtractPageFromRawWithOptions(raw *bridge.RawPageData, opts Options) models.Page {
+	page, _ := ExtractPageFromRawContext(context.Background(), raw, opts)
+	return page
+}
+
+// ExtractPageFromRawContext is ExtractPageFromRawWithOptions giving up with
+// ctx's error once ctx is done. It checks between the stages of the page and
+// between its blocks, so a page given up on stops using its worker soon after.
+func ExtractPageFromRawContext(ctx context.Context, raw *bridge.RawPageData, opts Options) (models.Page, error) {
 	Logger.Debug("extracting page", "pageNum", raw.PageNumber, "blocks", len(raw.Blocks), "chars", len(raw.Chars))
+	raw, redaction := redact(raw, opts.KeepRedacted)
+	var skew float64
+	if opts.Deskew {
+		raw, skew = bridge.Deskew(raw)
+	}
+	if zones := opts.ignoreZones(raw.PageNumber); len(zones) > 0 {
+		raw = withoutZones(raw, zones)
+	}
+	if err := ctx.Err(); err != nil {
+		return models.Page{}, err
+	}
 	stats := &fontStats{}
 	for _, ch := range raw.Chars {
 		stats.add(ch.Size)
 	}
 	bodySize, medianSize := stats.mode(), stats.median()
+	if opts.Fonts != nil {
+		bodySize, medianSize = opts.Fonts.Body, opts.Fonts.Median
+	}
 	Logger.Debug("font stats", "bodySize", bodySize, "medianSize", medianSize)
-	var allBlocks []*blockInfo
-	var tableBlocks []models.Block
-	if tblBlocks := table.ExtractAndConvertTables(raw); len(tblBlocks) > 0 {
-		Logger.Debug("extracted tables", "count", len(tblBlocks))
-		tableBlocks = tblBlocks
-		for i := range tblBlocks {
-			allBlocks = append(allBlocks, &blockInfo{Type: models.BlockTable, BBox: tblBlocks[i].BBox})
+	// Table detection only reads the page, so it runs alongside the text
+	// blocks and a page heavy in both takes as long as the slower of the two.
+	tablesDone := make(chan []models.Block, 1)
+	var tableWarnings []string
+	var tableTime time.Duration // read once tablesDone has been received from
+	go func() {
+		if opts.DisableTables {
+			tablesDone <- nil
+			return
 		}
-	}
+		tableStart := time.Now()
+		tblBlocks := table.ExtractAndConvertTablesContext(ctx, raw, table.Options{Spacing: opts.Spacing, Thresholds: opts.Tables, DropEmptyCells: opts.DropEmptyCells, Numbers: opts.TableNumbers, DecimalMark: opts.DecimalMark, Regions: opts.tableRegions(raw.PageNumber), Warnings: &tableWarnings})
+		tableTime = time.Since(tableStart)
+		if opts.Timings != nil {
+			opts.Timings.tables.Add(int64(tableTime))
+		}
+		tablesDone <- tblBlocks
+	}()
+	classifyStart := time.Now()
 	var textBlocks []*blockInfo
 	for _, rawBlock := range raw.Blocks {
+		if err := ctx.Err(); err != nil {
+			return models.Page{}, err // the tables finish into their buffered channel, or stop too
+		}
 		if rawBlock.Type == 0 {
-			textBlocks = append(textBlocks, splitAndProcessBlock(raw, &rawBlock, medianSize)...)
+			textBlocks = append(textBlocks, splitAndProcessBlock(raw, &rawBlock, medianSize, opts)...)
+		}
+	}
+	textBlocks = mergeDropCaps(textBlocks, bodySize)
+	classifyTime := time.Since(classifyStart)
+	var allBlocks []*blockInfo
+	tableBlocks := <-tablesDone
+	if err := ctx.Err(); err != nil {
+		return models.Page{}, err
+	}
+	if len(tableBlocks) > 0 {
+		Logger.Debug("extracted tables", "count", len(tableBlocks))
+		for i := range tableBlocks {
+			allBlocks = append(allBlocks, &blockInfo{Type: models.BlockTable, BBox: tableBlocks[i].BBox, TableIdx: i})
 		}
 	}
+	scan := -1
+	if opts.ScanImages {
+		scan = scanFigure(raw)
+	}
+	for i, fig := range raw.Figures {
+		if i == scan || !opts.Images.keeps(fig.BBox) {
+			continue
+		}
+		allBlocks = append(allBlocks, &blockInfo{Type: models.BlockFigure, BBox: models.BBox{fig.BBox.X0, fig.BBox.Y0, fig.BBox.X1, fig.BBox.Y1}, Alt: fig.Alt, Image: fig.Image})
+	}
 	for _, tb := range textBlocks {
 		tbRect := geometry.Rect{X0: tb.BBox[0], Y0: tb.BBox[1], X1: tb.BBox[2], Y1: tb.BBox[3]}
 		if tbRect.Area() <= 0 {
@@ -159,7 +537,7 @@ func ExtractPageFromRaw(raw *bridge.RawPageData) models.Page {
 		for _, b := range allBlocks {
 			if b.Type == models.BlockTable {
 				tableRect := geometry.Rect{X0: b.BBox[0], Y0: b.BBox[1], X1: b.BBox[2], Y1: b.BBox[3]}
-				if tbRect.IntersectArea(tableRect)/tbRect.Area() > 0.85 {
+				if tbRect.IntersectArea(tableRect)/tbRect.Area() > opts.Heuristics.TableOverlap {
 					overlaps = true
 					break
 				}
@@ -169,43 +547,265 @@ func ExtractPageFromRaw(raw *bridge.RawPageData) models.Page {
 			allBlocks = append(allBlocks, tb)
 		}
 	}
+	var columns [][]column.Range
+	var orderConf *float32
 	if len(allBlocks) > 0 {
 		colBlocks := make([]column.BlockWithColumn, len(allBlocks))
 		for i, b := range allBlocks {
 			colBlocks[i] = b
 		}
-		column.DetectAndAssignColumns(colBlocks, bodySize)
-		sortBlocks(allBlocks)
+		colOpts := opts.Columns
+		if ranges, ok := opts.PageColumns[raw.PageNumber]; ok {
+			colOpts.Columns = ranges
+		}
+		colOpts.Breaks = bandBreaks(raw, allBlocks, scan, opts.Images)
+		switch {
+		case opts.ReadingOrder == column.StrategyXYCut && colOpts.MaxColumns == 0 && colOpts.Columns == nil:
+			for i, b := range column.OrderXYCut(colBlocks, bodySize) {
+				allBlocks[i] = b.(*blockInfo)
+			}
+		default:
+			columns = column.DetectAndAssignColumnsWithOptions(colBlocks, bodySize, colOpts)
+			sortBlocks(allBlocks)
+			if opts.OrderConfidence {
+				c := orderConfidence(allBlocks, columns)
+				orderConf = &c
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return models.Page{}, err
 	}
-	var finalBlocks []models.Block
-	tableIdx := 0
+	demoteInlineBold(allBlocks, opts.Heuristics)
+	var finalBlocks, suppressed []models.Block
+	margins := opts.marginsFor(raw.PageBounds)
+	rules := footnoteRules(raw, allBlocks, bodySize, opts.Heuristics)
+	vertical := 0
 	for i := 0; i < len(allBlocks); i++ {
+		if err := ctx.Err(); err != nil {
+			return models.Page{}, err
+		}
 		info := allBlocks[i]
 		if info.Type == models.BlockTable {
-			if tableIdx < len(tableBlocks) {
-				finalBlocks = append(finalBlocks, tableBlocks[tableIdx])
-				tableIdx++
-			}
+			finalBlocks = append(finalBlocks, tableBlocks[info.TableIdx])
+			labelColumn(&finalBlocks[len(finalBlocks)-1], info, opts)
+			continue
+		}
+		if info.Type == models.BlockFigure {
+			finalBlocks = append(finalBlocks, models.Block{Type: info.Type, BBox: info.BBox, Alt: info.Alt, Image: info.Image})
+			labelColumn(&finalBlocks[len(finalBlocks)-1], info, opts)
 			continue
 		}
-		if info.Type == models.BlockList {
-			info, i = mergeListBlocks(allBlocks, i)
+		switch info.Type {
+		case models.BlockText:
+			info, i = mergeParagraphBlocks(allBlocks, i, opts.Heuristics, opts.Spacing)
+		case models.BlockList:
+			info, i = mergeListBlocks(allBlocks, i, opts.Heuristics, opts.KeepListMarkers)
+		}
+		content := *info
+		if reason := finalizeBlockInfo(info, raw.PageBounds, margins, opts.PageNumbers); reason != "" && text.HasVisibleContent(content.Text) {
+			if reason == suppressedVertical {
+				vertical++
+			}
+			if opts.KeepSuppressed {
+				block := newBlock(&content, opts)
+				block.Suppressed = reason
+				suppressed = append(suppressed, block)
+			}
+		}
+		if info.Type == models.BlockText && isFootnote(info, bodySize, raw.PageBounds, rules) {
+			info.Type, info.Confidence = models.BlockFootnote, 0.85
 		}
-		finalizeBlockInfo(info, raw.PageBounds)
 		if (info.Type == models.BlockList && len(info.ListItems) > 0) || text.HasVisibleContent(info.Text) {
-			finalBlocks = append(finalBlocks, models.Block{Type: info.Type, BBox: info.BBox, Length: info.TextChars, Level: info.HeadingLevel, FontSize: info.AvgFontSize, Lines: info.LineCount, Spans: info.Spans, Items: info.ListItems})
+			finalBlocks = append(finalBlocks, newBlock(info, opts))
 		}
 	}
 
-	CleanupPage(finalBlocks)
+	finalBlocks = CleanupPageWithOptions(finalBlocks, opts.Cleanup)
+	captionFigures(finalBlocks)
+	clipBlocksToPage(finalBlocks, raw.PageBounds)
+	clipBlocksToPage(suppressed, raw.PageBounds)
+	if opts.TopDownOrder {
+		rankTopDown(finalBlocks)
+	}
 	Logger.Debug("page extraction complete", "pageNum", raw.PageNumber, "finalBlocks", len(finalBlocks))
 
-	return models.Page{Number: raw.PageNumber, Data: finalBlocks}
+	page := models.Page{Number: raw.PageNumber, Label: raw.PageLabel, Rotation: raw.Rotation, Width: raw.PageBounds.Width(), Height: raw.PageBounds.Height(), Units: models.Units, Origin: models.Origin, Data: finalBlocks, Bounds: models.BBox{raw.PageBounds.X0, raw.PageBounds.Y0, raw.PageBounds.X1, raw.PageBounds.Y1}}
+	if scan >= 0 {
+		page.Scan = raw.Figures[scan].Image
+	}
+	page.OrderConfidence = orderConf
+	page.Suppressed = suppressed
+	page.Fonts = pageFonts(raw)
+	if opts.PageTimings {
+		page.Timings = &models.PageTimings{Tables: models.Milliseconds(tableTime), Classify: models.Milliseconds(classifyTime)}
+	}
+	page.Skew = float32(math.Round(skew*180/math.Pi*100) / 100)
+	if opts.ColumnLabels {
+		for band, cols := range columns {
+			for i, c := range cols {
+				page.Columns = append(page.Columns, models.Column{Band: band + 1, Index: i + 1, X0: c.X0, X1: c.X1})
+			}
+		}
+	}
+	if raw.DroppedChars > 0 {
+		page.Warnings = append(page.Warnings, fmt.Sprintf("page has too many characters: dropped the last %d", raw.DroppedChars))
+	}
+	if raw.DroppedEdges > 0 {
+		page.Warnings = append(page.Warnings, fmt.Sprintf("page has too many ruling lines (%d): skipped table detection", raw.DroppedEdges))
+	}
+	if redaction != "" {
+		page.Warnings = append(page.Warnings, redaction)
+	}
+	page.Warnings = append(page.Warnings, textWarnings(raw, opts.Cleanup.Bullets)...)
+	page.Warnings = append(page.Warnings, tableWarnings...)
+	if vertical > 0 {
+		page.Warnings = append(page.Warnings, fmt.Sprintf("dropped %d blocks of vertical text", vertical))
+	}
+	if opts.KeyValues {
+		tableBBoxes := make([]models.BBox, len(tableBlocks))
+		for i, t := range tableBlocks {
+			tableBBoxes[i] = t.BBox
+		}
+		page.KeyValues = ExtractKeyValues(raw, opts.Spacing, tableBBoxes)
+	}
+	return page, nil
+}
+
+// labelColumn gives block the band and column info was assigned, when asked
+// for.
+func labelColumn(block *models.Block, info *blockInfo, opts Options) {
+	if opts.ColumnLabels {
+		block.Band, block.Column = info.BandIdx+1, info.ColIdx
+	}
+}
+
+// scanFigure returns the index of the saved image a scanned page is made of,
+// or -1 if it is not one: a single figure covering nearly the whole page with
+// text, as from OCR, on top of it.
+func scanFigure(raw *bridge.RawPageData) int {
+	pageArea := raw.PageBounds.Width() * raw.PageBounds.Height()
+	if len(raw.Chars) == 0 || pageArea <= 0 {
+		return -1
+	}
+	scan := -1
+	for i, fig := range raw.Figures {
+		if fig.BBox.Width()*fig.BBox.Height() < pageArea*0.9 {
+			continue
+		}
+		if scan >= 0 || fig.Image == "" {
+			return -1
+		}
+		scan = i
+	}
+	return scan
+}
+
+// isFootnote reports whether a text block is a note at the foot of the page.
+// Under the first of rules over its column, the short line that sets notes apart from the text above,
+// it needs to open with a note marker or be smaller than body text, so notes
+// carried over from the page before count; above one it is not a note.
+// Without rules over its column it needs to be smaller than body text, in the
+// bottom third and open with a note marker.
+func isFootnote(info *blockInfo, bodySize float32, pageBounds bridge.Rect, rules []models.BBox) bool {
+	for _, r := range rules {
+		if info.BBox.X0() < r.X0()-bodySize || info.BBox.X0() >= r.X1() {
+			continue
+		}
+		if info.BBox.Y0() < r.Y0() {
+			return false
+		}
+		return info.AvgFontSize < bodySize*0.95 || noteNumber(info.Spans) != ""
+	}
+	if info.AvgFontSize >= bodySize*0.9 || info.BBox.Y0() < pageBounds.Y1-(pageBounds.Y1-pageBounds.Y0)/3 {
+		return false
+	}
+	return noteNumber(info.Spans) != ""
+}
+
+// footnoteRules finds the lines that set footnotes apart from the text above:
+// short horizontal rules in the lower part of the page, at most
+// h.FootnoteRuleWidth of its width, that run through no block, touch no
+// table and have text starting under their left end within a few lines.
+func footnoteRules(raw *bridge.RawPageData, blocks []*blockInfo, bodySize float32, h Heuristics) []models.BBox {
+	pageWidth, pageHeight := raw.PageBounds.Width(), raw.PageBounds.Height()
+	var rules []models.BBox
+	for _, e := range raw.Edges {
+		r := models.BBox{float32(e.X0), float32(e.Y0), float32(e.X1), float32(e.Y1)}
+		if e.Orientation != 'h' || r.Width() < 20 || r.Width() > pageWidth*h.FootnoteRuleWidth || r.Y0() < raw.PageBounds.Y0+pageHeight*0.4 {
+			continue
+		}
+		crossed, under := false, false
+		for _, b := range blocks {
+			across := b.BBox.X0() < r.X1() && b.BBox.X1() > r.X0()
+			switch {
+			case b.Type == models.BlockTable && across && r.Y0() >= b.BBox.Y0()-2 && r.Y0() <= b.BBox.Y1()+2:
+				crossed = true
+			case across && r.Y0() > b.BBox.Y0() && r.Y0() < b.BBox.Y1():
+				crossed = true
+			case b.Type == models.BlockText && b.BBox.Y0() >= r.Y0() && b.BBox.Y0()-r.Y0() < 3*bodySize && geometry.Abs32(b.BBox.X0()-r.X0()) < 2*bodySize:
+				under = true
+			}
+		}
+		if under && !crossed {
+			rules = append(rules, r)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Y0() < rules[j].Y0() })
+	return rules
+}
+
+// captionFigures sets the caption of each figure from the block just after or
+// just before it, if that opens like "Figure 3" and sits within a few lines of
+// the figure, overlapping it horizontally. The caption block itself stays.
+func captionFigures(blocks []models.Block) {
+	for i := range blocks {
+		fig := &blocks[i]
+		if fig.Type != models.BlockFigure {
+			continue
+		}
+		for _, j := range []int{i + 1, i - 1} {
+			if j < 0 || j >= len(blocks) {
+				continue
+			}
+			c := blocks[j]
+			if c.Type != models.BlockText && c.Type != models.BlockHeading && c.Type != models.BlockOther {
+				continue
+			}
+			txt := strings.Join(strings.Fields(spansText(c.Spans)), " ")
+			gap := max(c.BBox.Y0()-fig.BBox.Y1(), fig.BBox.Y0()-c.BBox.Y1())
+			overlap := min(c.BBox.X1(), fig.BBox.X1()) - max(c.BBox.X0(), fig.BBox.X0())
+			if text.IsCaption(txt) && gap <= 3*max(c.FontSize, 8) && overlap > 0 {
+				fig.Caption = txt
+				break
+			}
+		}
+	}
+}
+
+func clipBlocksToPage(blocks []models.Block, pageBounds bridge.Rect) {
+	page := models.BBox{pageBounds.X0, pageBounds.Y0, pageBounds.X1, pageBounds.Y1}
+	if page.IsEmpty() {
+		return
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		b.BBox = b.BBox.Intersect(page)
+		for r := range b.Rows {
+			b.Rows[r].BBox = b.Rows[r].BBox.Intersect(page)
+			for c := range b.Rows[r].Cells {
+				b.Rows[r].Cells[c].BBox = b.Rows[r].Cells[c].BBox.Intersect(page)
+			}
+		}
+	}
 }
 
 func sortBlocks(blocks []*blockInfo) {
 	sort.SliceStable(blocks, func(i, j int) bool {
 		bi, bj := blocks[i], blocks[j]
+		if bi.BandIdx != bj.BandIdx {
+			return bi.BandIdx < bj.BandIdx
+		}
 		if bi.ColIdx == bj.ColIdx {
 			if math.Abs(float64(bi.BBox.Y0()-bj.BBox.Y0())) > 2.0 {
 				return bi.BBox.Y0() < bj.BBox.Y0()
@@ -222,25 +822,42 @@ func sortBlocks(blocks []*blockInfo) {
 	})
 }
 
-func mergeListBlocks(blocks []*blockInfo, startIdx int) (*blockInfo, int) {
+func mergeListBlocks(blocks []*blockInfo, startIdx int, h Heuristics, keepMarkers bool) (*blockInfo, int) {
 	info := blocks[startIdx]
 	combinedBBox := info.BBox
 	var listItems []models.ListItem
 	var totalFontSize, totalBoldRatio float32
 	var totalLines int
 	var textParts []string
+	var lines []models.Line
+	var chars []models.Char
 	baseX, baseFontSize := info.BBox.X0(), info.AvgFontSize
 	if baseFontSize < 8.0 {
 		baseFontSize = 12.0
 	}
-	endIdx := startIdx
+	endIdx, markerX := startIdx, info.BBox.X0()
 	for j := startIdx; j < len(blocks); j++ {
 		next := blocks[j]
-		if next.Type != models.BlockList || next.ColIdx != info.ColIdx {
+		if next.ColIdx != info.ColIdx {
 			break
 		}
+		if next.Type != models.BlockList {
+			prev := blocks[j-1]
+			if len(listItems) == 0 || next.Type != models.BlockText || !isListContinuation(true, text.StartsWithBullet(next.Text), next.BBox.X0(), markerX) || next.BBox.Y0()-prev.BBox.Y1() > prev.AvgFontSize*h.ListItemGap {
+				break
+			}
+			appendToLastItem(listItems, textParts, strings.ReplaceAll(next.Text, "\n", " "))
+			combinedBBox = combinedBBox.Union(next.BBox)
+			totalFontSize += next.AvgFontSize
+			totalBoldRatio += next.BoldRatio
+			totalLines += next.LineCount
+			lines, chars = append(lines, next.Lines...), append(chars, next.Chars...)
+			endIdx = j
+			continue
+		}
+		markerX = next.BBox.X0()
 		if j > startIdx {
-			if gap := next.BBox.Y0() - blocks[j-1].BBox.Y1(); gap > blocks[j-1].AvgFontSize*2.5 && gap > 20.0 {
+			if gap := next.BBox.Y0() - blocks[j-1].BBox.Y1(); gap > blocks[j-1].AvgFontSize*h.ListBreakGap && gap > 20.0 {
 				break
 			}
 		}
@@ -248,75 +865,105 @@ func mergeListBlocks(blocks []*blockInfo, startIdx int) (*blockInfo, int) {
 		totalFontSize += next.AvgFontSize
 		totalBoldRatio += next.BoldRatio
 		totalLines += next.LineCount
+		lines = append(lines, next.Lines...)
 		for _, line := range strings.Split(next.Text, "\n") {
 			if line = strings.TrimSpace(line); line == "" {
 				continue
 			}
+			if len(listItems) > 0 && !text.StartsWithBullet(line) {
+				appendToLastItem(listItems, textParts, line)
+				continue
+			}
 			isNum, prefix := text.StartsWithNumber(line)
 			listType := "bulleted"
 			if isNum {
 				listType = "numbered"
 			}
 			indent := geometry.Clamp(int((next.BBox.X0()-baseX)/(baseFontSize*2)), 0, 6)
-			cleanedText := line
+			cleanedText, printed := line, prefix
 			if isNum {
 				cleanedText = strings.TrimPrefix(cleanedText, prefix)
 			} else if r := []rune(line); len(r) > 0 && text.IsBullet(r[0]) {
-				cleanedText = string(r[1:])
+				cleanedText, printed = string(r[1:]), string(r[0])
 			}
 			if cleanedText = strings.TrimSpace(cleanedText); cleanedText == "" {
 				continue
 			}
 			marker := "- "
-			if isNum {
-				marker = prefix + " "
+			if isNum || (keepMarkers && printed != "") {
+				marker = printed + " "
 			}
 			textParts = append(textParts, marker+cleanedText)
-			listItems = append(listItems, models.ListItem{Spans: []models.Span{{Text: marker + cleanedText}}, ListType: listType, Indent: indent, Prefix: prefix})
+			listItems = append(listItems, models.ListItem{Spans: []models.Span{{Text: marker + cleanedText}}, ListType: listType, Indent: indent, Prefix: prefix, Marker: printed})
 		}
 		endIdx = j
 	}
 	if len(listItems) > 0 {
 		txt := strings.Join(textParts, "\n")
-		info = &blockInfo{Type: models.BlockList, BBox: combinedBBox, AvgFontSize: totalFontSize / float32(endIdx-startIdx+1), BoldRatio: totalBoldRatio / float32(endIdx-startIdx+1), LineCount: totalLines, ColIdx: info.ColIdx, ListItems: listItems, Text: txt, TextChars: text.CountUnicodeChars(txt)}
+		info = &blockInfo{Type: models.BlockList, BBox: combinedBBox, AvgFontSize: totalFontSize / float32(endIdx-startIdx+1), BoldRatio: totalBoldRatio / float32(endIdx-startIdx+1), LineCount: totalLines, ColIdx: info.ColIdx, BandIdx: info.BandIdx, ListItems: listItems, Lines: lines, Chars: chars, Text: txt, TextChars: text.CountUnicodeChars(txt)}
 	}
 	return info, endIdx
 }
 
-func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, medianSize float32) []*blockInfo {
+func appendToLastItem(items []models.ListItem, textParts []string, continuation string) {
+	if continuation = strings.TrimSpace(continuation); continuation == "" {
+		return
+	}
+	last := &items[len(items)-1]
+	last.Spans[len(last.Spans)-1].Text += " " + continuation
+	textParts[len(textParts)-1] += " " + continuation
+}
+
+// spanStart marks where a span begins in a sub-block's text. Spans run back
+// to back, so each one ends where the next starts and the text is only built
+// once instead of being grown char by char per span.
+type spanStart struct {
+	offset int
+	style  models.TextStyle
+}
+
+func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, medianSize float32, opts Options) []*blockInfo {
 	var result []*blockInfo
 	lineIdx := 0
 	for lineIdx < rawBlock.LineCount {
 		var textStr strings.Builder
-		var spans []models.Span
+		var starts []spanStart
+		var lines []models.Line
+		var chars []models.Char
 		var subBBox models.BBox
 		var totalChars, boldChars, italicChars, monoChars int
 		var fontSizeSum, lastLineFontSize float32 = 0, -1
 		linesInSubBlock := 0
 		firstLine := &raw.Lines[rawBlock.LineStart+lineIdx]
 		subBlockIsList, firstLineIsBold := lineStartsWithBullet(raw, firstLine), rawLineIsBold(raw, firstLine)
+		markerX := firstLine.BBox.X0
 		for lineIdx < rawBlock.LineCount {
 			line := &raw.Lines[rawBlock.LineStart+lineIdx]
 			avgLineFontSize := computeLineFontSize(raw, line)
+			startsWithBullet := lineStartsWithBullet(raw, line)
 			if linesInSubBlock > 0 {
-				if lineStartsWithBullet(raw, line) != subBlockIsList {
+				continuation := isListContinuation(subBlockIsList, startsWithBullet, line.BBox.X0, markerX)
+				if startsWithBullet != subBlockIsList && !continuation {
 					break
 				}
 				prevLine := &raw.Lines[rawBlock.LineStart+lineIdx-1]
 				gap, currentIsBold := line.BBox.Y0-prevLine.BBox.Y1, rawLineIsBold(raw, line)
-				if (!firstLineIsBold && currentIsBold) || (firstLineIsBold && !currentIsBold && gap > avgLineFontSize*1.2) || (lastLineFontSize > 0 && math.Abs(float64(avgLineFontSize-lastLineFontSize)) > 0.5) || gap > avgLineFontSize*1.5 {
+				if (!firstLineIsBold && currentIsBold) || (firstLineIsBold && !currentIsBold && gap > avgLineFontSize*opts.Heuristics.BoldParagraphGap) || (lastLineFontSize > 0 && math.Abs(float64(avgLineFontSize-lastLineFontSize)) > 0.5) || gap > avgLineFontSize*opts.Heuristics.ParagraphGap {
 					break
 				}
 				sep := "\n"
-				if gap < avgLineFontSize*0.2 {
+				if gap < avgLineFontSize*opts.Spacing.LineJoin || continuation || (opts.Spacing.Reflow && softBreak(raw, rawBlock, prevLine, line, avgLineFontSize)) {
 					sep = " "
+					if last, _ := utf8.DecodeLastRuneInString(textStr.String()); text.JoinsWithoutSpace(last, firstRune(raw, line), opts.Spacing) {
+						sep = ""
+					}
 				}
 				textStr.WriteString(sep)
-				if len(spans) > 0 {
-					spans[len(spans)-1].Text += sep
-				}
 			}
 			lastLineFontSize = avgLineFontSize
+			if startsWithBullet {
+				markerX = line.BBox.X0
+			}
 			lb := models.BBox{line.BBox.X0, line.BBox.Y0, line.BBox.X1, line.BBox.Y1}
 			if linesInSubBlock == 0 {
 				subBBox = lb
@@ -324,11 +971,19 @@ func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, me
 				subBBox = subBBox.Union(lb)
 			}
 			linesInSubBlock++
+			if opts.Lines {
+				lines = append(lines, lineSummary(raw, line, lb))
+			}
+			var prev *bridge.RawChar
 			for ci := 0; ci < line.CharCount; ci++ {
 				ch := &raw.Chars[line.CharStart+ci]
 				if ch.Codepoint == 0 {
 					continue
 				}
+				if missingSpace(prev, ch, opts.Spacing) {
+					textStr.WriteByte(' ')
+				}
+				prev = ch
 				totalChars++
 				fontSizeSum += ch.Size
 				if ch.IsBold {
@@ -340,12 +995,13 @@ func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, me
 				if ch.IsMonospaced {
 					monoChars++
 				}
+				style := models.TextStyle{Bold: ch.IsBold, Italic: ch.IsItalic, Monospace: ch.IsMonospaced, Superscript: isSuperscript(ch, line, avgLineFontSize)}
+				if len(starts) == 0 || starts[len(starts)-1].style != style {
+					starts = append(starts, spanStart{textStr.Len(), style})
+				}
 				textStr.WriteRune(ch.Codepoint)
-				style := models.TextStyle{Bold: ch.IsBold, Italic: ch.IsItalic, Monospace: ch.IsMonospaced}
-				if len(spans) > 0 && spans[len(spans)-1].Style == style {
-					spans[len(spans)-1].Text += string(ch.Codepoint)
-				} else {
-					spans = append(spans, models.Span{Text: string(ch.Codepoint), Style: style})
+				if opts.Chars {
+					chars = append(chars, models.Char{Codepoint: ch.Codepoint, BBox: models.BBox{ch.BBox.X0, ch.BBox.Y0, ch.BBox.X1, ch.BBox.Y1}, Origin: [2]float32{ch.OriginX, ch.OriginY}, Size: ch.Size, Bold: ch.IsBold, Italic: ch.IsItalic, Monospace: ch.IsMonospaced})
 				}
 			}
 			lineIdx++
@@ -353,11 +1009,23 @@ func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, me
 		if totalChars == 0 {
 			continue
 		}
-		info := &blockInfo{Text: text.NormalizeText(textStr.String()), BBox: subBBox, LineCount: linesInSubBlock, AvgFontSize: fontSizeSum / float32(totalChars), BoldRatio: float32(boldChars) / float32(totalChars), ItalicRatio: float32(italicChars) / float32(totalChars), MonoRatio: float32(monoChars) / float32(totalChars)}
+		full := textStr.String()
+		spans := make([]models.Span, len(starts))
+		for i, st := range starts {
+			end := len(full)
+			if i+1 < len(starts) {
+				end = starts[i+1].offset
+			}
+			spans[i] = models.Span{Text: full[st.offset:end], Style: st.style}
+		}
+		info := &blockInfo{Text: text.NormalizeText(full), BBox: subBBox, LineCount: linesInSubBlock, Lines: lines, Chars: chars, AvgFontSize: fontSizeSum / float32(totalChars), BoldRatio: float32(boldChars) / float32(totalChars), ItalicRatio: float32(italicChars) / float32(totalChars), MonoRatio: float32(monoChars) / float32(totalChars)}
 		info.TextChars = text.CountUnicodeChars(info.Text)
-		classifyBlock(info, medianSize)
+		classifyBlock(info, medianSize, opts.Heuristics)
 		if info.MonoRatio >= 0.8 && info.Type == models.BlockText && info.LineCount >= 2 {
-			info.Type = models.BlockCode
+			info.Type, info.Confidence = models.BlockCode, info.MonoRatio
+		}
+		if opts.Classifier != nil {
+			reclassify(opts.Classifier, info, raw, medianSize)
 		}
 		if info.Spans = processSpans(spans); len(info.Spans) > 0 {
 			result = append(result, info)
@@ -366,6 +1034,66 @@ func splitAndProcessBlock(raw *bridge.RawPageData, rawBlock *bridge.RawBlock, me
 	return result
 }
 
+func firstRune(raw *bridge.RawPageData, line *bridge.RawLine) rune {
+	for ci := 0; ci < line.CharCount; ci++ {
+		if r := raw.Chars[line.CharStart+ci].Codepoint; r != 0 && !unicode.IsSpace(r) {
+			return r
+		}
+	}
+	return 0
+}
+
+// missingSpace reports whether two adjacent glyphs are far enough apart, pen to
+// pen, to be separate words even though no space char sits between them.
+func missingSpace(prev, ch *bridge.RawChar, sp text.Spacing) bool {
+	if prev == nil || prev.Advance <= 0 || ch.Advance <= 0 || unicode.IsSpace(prev.Codepoint) || unicode.IsSpace(ch.Codepoint) || text.JoinsWithoutSpace(prev.Codepoint, ch.Codepoint, sp) {
+		return false
+	}
+	return prev.Gap(ch) > ch.Size*0.5*sp.WordGap && geometry.Abs32(ch.OriginY-prev.OriginY) < ch.Size*sp.LineShift
+}
+
+// isSuperscript reports whether a char is set smaller than its line and raised
+// clear of the line's baseline, as note and citation markers are.
+func isSuperscript(ch *bridge.RawChar, line *bridge.RawLine, lineFontSize float32) bool {
+	return ch.Size < lineFontSize*0.85 && ch.BBox.Y1 < line.BBox.Y1-lineFontSize*0.15 && !unicode.IsSpace(ch.Codepoint)
+}
+
+// isListContinuation reports whether a line without a marker continues the
+// previous list item: wrapped item text is indented past the marker it follows.
+func isListContinuation(inList, startsWithBullet bool, lineX, markerX float32) bool {
+	return inList && !startsWithBullet && lineX > markerX+1.0
+}
+
+// lineSummary describes one RawLine for line-level output: its text and the
+// style most of its chars share.
+func lineSummary(raw *bridge.RawPageData, line *bridge.RawLine, bbox models.BBox) models.Line {
+	var buf strings.Builder
+	var size float32
+	count, bold, italic, mono := 0, 0, 0, 0
+	for ci := 0; ci < line.CharCount; ci++ {
+		ch := &raw.Chars[line.CharStart+ci]
+		if ch.Codepoint == 0 {
+			continue
+		}
+		buf.WriteRune(ch.Codepoint)
+		size += ch.Size
+		count++
+		if ch.IsBold {
+			bold++
+		}
+		if ch.IsItalic {
+			italic++
+		}
+		if ch.IsMonospaced {
+			mono++
+		}
+	}
+	if count == 0 {
+		return models.Line{BBox: bbox}
+	}
+	return models.Line{BBox: bbox, Text: strings.TrimSpace(text.NormalizeText(buf.String())), FontSize: size / float32(count), Bold: bold*2 > count, Italic: italic*2 > count, Monospace: mono*2 > count}
+}
+
 func computeLineFontSize(raw *bridge.RawPageData, line *bridge.RawLine) float32 {
 	var sum float32
 	count := 0
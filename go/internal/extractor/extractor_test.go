@@ -1,14 +1,24 @@
 package extractor
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/column"
+	"github.com/pymupdf4llm-c/go/internal/geometry"
 	"github.com/pymupdf4llm-c/go/internal/models"
 	"github.com/pymupdf4llm-c/go/internal/testutil"
+	"github.com/pymupdf4llm-c/go/internal/text"
 )
 
 func extractTestPDF(t *testing.T, pdfName string) []models.Page {
@@ -250,3 +260,1270 @@ func TestSpansHaveContent(t *testing.T) {
 	}
 	t.Logf("spans: %d total, %d empty (%.2f%%)", totalSpans, emptyCount, emptyRatio*100)
 }
+
+func TestMergeListBlocksAttachesContinuations(t *testing.T) {
+	blocks := []*blockInfo{
+		{Type: models.BlockList, Text: "• first point that wraps\nonto a second line\n• second point", BBox: models.BBox{72, 100, 400, 140}, AvgFontSize: 11, LineCount: 3},
+		{Type: models.BlockText, Text: "and keeps going here", BBox: models.BBox{84, 142, 400, 154}, AvgFontSize: 11, LineCount: 1},
+		{Type: models.BlockText, Text: "A new paragraph", BBox: models.BBox{72, 170, 400, 182}, AvgFontSize: 11, LineCount: 1},
+	}
+	merged, end := mergeListBlocks(blocks, 0, DefaultHeuristics, false)
+	if end != 1 {
+		t.Fatalf("merged through block %d, want 1", end)
+	}
+	if len(merged.ListItems) != 2 {
+		t.Fatalf("got %d items, want 2", len(merged.ListItems))
+	}
+	if got := merged.ListItems[0].Spans[0].Text; got != "- first point that wraps onto a second line" {
+		t.Errorf("first item = %q", got)
+	}
+	if got := merged.ListItems[1].Spans[0].Text; got != "- second point and keeps going here" {
+		t.Errorf("second item = %q", got)
+	}
+}
+
+func TestMergeListBlocksKeepsMarkers(t *testing.T) {
+	blocks := []*blockInfo{
+		{Type: models.BlockList, Text: "▪ first point\n➢ second point\niv. third point", BBox: models.BBox{72, 100, 400, 140}, AvgFontSize: 11, LineCount: 3},
+	}
+	for _, keep := range []bool{false, true} {
+		merged, _ := mergeListBlocks(blocks, 0, DefaultHeuristics, keep)
+		want := []string{"- first point", "- second point", "iv. third point"}
+		if keep {
+			want[0], want[1] = "▪ first point", "➢ second point"
+		}
+		for i, item := range merged.ListItems {
+			if item.Spans[0].Text != want[i] || item.Marker != []string{"▪", "➢", "iv."}[i] {
+				t.Errorf("keep=%v: item %d = %q marked %q", keep, i, item.Spans[0].Text, item.Marker)
+			}
+		}
+		if len(merged.ListItems) != 3 || merged.ListItems[2].Prefix != "iv." || merged.ListItems[2].ListType != "numbered" {
+			t.Errorf("keep=%v: items = %+v", keep, merged.ListItems)
+		}
+	}
+}
+
+func TestJoinAcrossPages(t *testing.T) {
+	pages := []models.Page{
+		{Number: 1, Data: []models.Block{
+			{Type: models.BlockHeading, FontSize: 14, BBox: models.BBox{72, 72, 300, 90}, Spans: []models.Span{{Text: "Intro"}}},
+			{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 680, 540, 720}, Length: 28, Spans: []models.Span{{Text: "The method runs in two sepa-"}}},
+		}},
+		{Number: 2, Data: []models.Block{
+			{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 72, 540, 100}, Length: 27, Spans: []models.Span{{Text: "rate passes over the input."}}},
+			{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 110, 540, 140}, Spans: []models.Span{{Text: "Next paragraph and"}}},
+		}},
+		{Number: 3, Data: []models.Block{
+			{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 72, 540, 100}, Spans: []models.Span{{Text: "a note in italics.", Style: models.TextStyle{Italic: true}}}},
+			{Type: models.BlockList, FontSize: 10, BBox: models.BBox{72, 600, 540, 720}, Items: []models.ListItem{{ListType: "bulleted", Spans: []models.Span{{Text: "first"}}}}},
+		}},
+		{Number: 4, Data: []models.Block{
+			{Type: models.BlockList, FontSize: 10, BBox: models.BBox{72, 72, 540, 100}, Items: []models.ListItem{{ListType: "numbered", Prefix: "1.", Spans: []models.Span{{Text: "second"}}}}},
+		}},
+	}
+	JoinAcrossPages(pages, text.DefaultSpacing)
+
+	if len(pages[1].Data) != 1 || len(pages[2].Data) != 2 || len(pages[3].Data) != 1 {
+		t.Fatalf("unexpected block counts: pages 2 to 4 have %d, %d and %d", len(pages[1].Data), len(pages[2].Data), len(pages[3].Data))
+	}
+	joined := pages[0].Data[1]
+	if got := joined.Spans; len(got) != 1 || got[0].Text != "The method runs in two separate passes over the input." {
+		t.Errorf("joined spans = %+v", got)
+	}
+	if joined.Length != 54 || joined.ContinuedBBox != (models.BBox{72, 72, 540, 100}) || joined.BBox != (models.BBox{72, 680, 540, 720}) {
+		t.Errorf("joined length %d, bbox %v, continued %v", joined.Length, joined.BBox, joined.ContinuedBBox)
+	}
+
+	cjk := func() []models.Page {
+		return []models.Page{
+			{Number: 1, Data: []models.Block{{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 680, 540, 720}, Length: 4, Spans: []models.Span{{Text: "使用する"}}}}},
+			{Number: 2, Data: []models.Block{{Type: models.BlockText, FontSize: 10, BBox: models.BBox{72, 72, 540, 100}, Length: 5, Spans: []models.Span{{Text: "tools"}}}}},
+		}
+	}
+	tight := text.DefaultSpacing
+	tight.CJKLatinSpace = false
+	for _, c := range []struct {
+		sp   text.Spacing
+		want string
+	}{{text.DefaultSpacing, "使用する tools"}, {tight, "使用するtools"}} {
+		pages := cjk()
+		JoinAcrossPages(pages, c.sp)
+		if got := spansText(pages[0].Data[0].Spans); got != c.want || pages[0].Data[0].Length != len([]rune(c.want)) {
+			t.Errorf("CJKLatinSpace %v: joined %q of length %d, want %q", c.sp.CJKLatinSpace, got, pages[0].Data[0].Length, c.want)
+		}
+	}
+}
+
+func TestStructureReferences(t *testing.T) {
+	pages := []models.Page{
+		{Number: 9, Data: []models.Block{
+			{Type: models.BlockText, FontSize: 10, Spans: []models.Span{{Text: "Results are in Table 2."}}},
+			{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "7 References"}}},
+			{Type: models.BlockText, FontSize: 9, Lines: 4, Spans: []models.Span{{Text: "[1] A. Smith. Layout analysis, pp. 2-3. [2] B. Jones. Tables "}, {Text: "revisited", Style: models.TextStyle{Italic: true}}, {Text: ". In Proc. [7] of ICDAR, "}}},
+		}},
+		{Number: 10, Data: []models.Block{
+			{Type: models.BlockText, FontSize: 9, Lines: 1, Spans: []models.Span{{Text: "2019."}}},
+			{Type: models.BlockList, FontSize: 9, Items: []models.ListItem{{Spans: []models.Span{{Text: "[3] C. Lee. Reading order."}}}}},
+			{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "Appendix"}}},
+			{Type: models.BlockText, FontSize: 10, Spans: []models.Span{{Text: "[4] is not a reference."}}},
+		}},
+	}
+	StructureReferences(pages, text.DefaultSpacing)
+
+	if len(pages[0].Data) != 3 || pages[0].Data[2].Type != models.BlockReferences {
+		t.Fatalf("page 9 blocks = %+v", pages[0].Data)
+	}
+	first := pages[0].Data[2].Items
+	if len(first) != 2 || first[0].Prefix != "[1]" || first[1].Prefix != "[2]" {
+		t.Fatalf("page 9 entries = %+v", first)
+	}
+	if got := spansText(first[0].Spans); got != "A. Smith. Layout analysis, pp. 2-3." {
+		t.Errorf("entry 1 = %q", got)
+	}
+	if got := spansText(first[1].Spans); got != "B. Jones. Tables revisited. In Proc. [7] of ICDAR, 2019." {
+		t.Errorf("entry 2 = %q", got)
+	}
+	second := pages[1].Data
+	if len(second) != 3 || second[0].Type != models.BlockReferences || second[2].Type != models.BlockText {
+		t.Fatalf("page 10 blocks = %+v", second)
+	}
+	if items := second[0].Items; len(items) != 1 || items[0].Prefix != "[3]" || spansText(items[0].Spans) != "C. Lee. Reading order." {
+		t.Errorf("page 10 entries = %+v", items)
+	}
+
+	pages = []models.Page{
+		{Number: 1, Data: []models.Block{
+			{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "References"}}},
+			{Type: models.BlockText, FontSize: 9, Lines: 1, BBox: models.BBox{72, 600, 540, 700}, Spans: []models.Span{{Text: "[1] A. Smith. Layout"}}},
+		}},
+		{Number: 2, Data: []models.Block{
+			{Type: models.BlockText, FontSize: 9, Lines: 1, BBox: models.BBox{72, 72, 540, 90}, Spans: []models.Span{{Text: "analysis, 2019."}}},
+		}},
+	}
+	StructureReferences(pages, text.DefaultSpacing)
+	if len(pages[1].Data) != 0 {
+		t.Fatalf("a page of continuations has blocks %+v", pages[1].Data)
+	}
+	refs := pages[0].Data[1]
+	if refs.BBox != (models.BBox{72, 600, 540, 700}) || refs.ContinuedBBox != (models.BBox{72, 72, 540, 90}) || refs.Length != len("[1] A. Smith. Layout analysis, 2019.") || refs.Lines != 2 {
+		t.Errorf("continued references block = %+v", refs)
+	}
+}
+
+func TestLinkCitations(t *testing.T) {
+	sup := models.TextStyle{Superscript: true}
+	pages := []models.Page{
+		{Number: 1, Data: []models.Block{
+			{Type: models.BlockText, Spans: []models.Span{{Text: "Prior work"}, {Text: "1", Style: sup}, {Text: " disagrees"}, {Text: "2,3", Style: sup}, {Text: "."}}},
+			{Type: models.BlockFootnote, Spans: []models.Span{{Text: "1", Style: sup}, {Text: " See the appendix."}}},
+		}},
+		{Number: 2, Data: []models.Block{
+			{Type: models.BlockReferences, Items: []models.ListItem{{Prefix: "[2]"}, {Prefix: "[3]"}}},
+		}},
+	}
+	LinkCitations(pages)
+
+	spans := pages[0].Data[0].Spans
+	if spans[1].Ref != "fn-1-1" || spans[3].Ref != "ref-2,ref-3" || spans[0].Ref != "" {
+		t.Errorf("refs = %q, %q, %q", spans[0].Ref, spans[1].Ref, spans[3].Ref)
+	}
+	if id := pages[0].Data[1].ID; id != "fn-1-1" {
+		t.Errorf("footnote id = %q", id)
+	}
+	if pages[0].Data[1].Spans[0].Ref != "" {
+		t.Error("footnote marker should not link to itself")
+	}
+	if items := pages[1].Data[0].Items; items[0].ID != "ref-2" || items[1].ID != "ref-3" {
+		t.Errorf("reference ids = %q, %q", items[0].ID, items[1].ID)
+	}
+}
+
+func TestDetectPaperMetadata(t *testing.T) {
+	block := func(typ models.BlockType, size float32, bbox models.BBox, txt string) models.Block {
+		return models.Block{Type: typ, FontSize: size, BBox: bbox, Length: len(txt), Spans: []models.Span{{Text: txt}}}
+	}
+	page := models.Page{Number: 1, Data: []models.Block{
+		block(models.BlockText, 8, models.BBox{72, 40, 200, 50}, "Preprint. Under review."),
+		block(models.BlockHeading, 17, models.BBox{120, 80, 492, 100}, "Reading Order Recovery for"),
+		block(models.BlockHeading, 17, models.BBox{160, 102, 452, 122}, "Multi-Column Documents"),
+		block(models.BlockText, 11, models.BBox{220, 140, 392, 152}, "Ada Smith, Bo Chen"),
+		block(models.BlockText, 10, models.BBox{230, 154, 382, 166}, "University of Somewhere"),
+		block(models.BlockHeading, 12, models.BBox{280, 190, 332, 202}, "Abstract"),
+		block(models.BlockText, 10, models.BBox{100, 206, 512, 260}, "We present a method\nfor ordering blocks."),
+		block(models.BlockHeading, 12, models.BBox{72, 280, 200, 292}, "1 Introduction"),
+		block(models.BlockText, 10, models.BBox{72, 296, 540, 700}, "Documents are hard."),
+	}}
+	meta := DetectPaperMetadata(&page)
+	if meta == nil {
+		t.Fatal("no metadata detected")
+	}
+	if meta.Title != "Reading Order Recovery for Multi-Column Documents" {
+		t.Errorf("title = %q", meta.Title)
+	}
+	if meta.Authors != "Ada Smith, Bo Chen\nUniversity of Somewhere" {
+		t.Errorf("authors = %q", meta.Authors)
+	}
+	if meta.Abstract != "We present a method for ordering blocks." {
+		t.Errorf("abstract = %q", meta.Abstract)
+	}
+
+	page.Data = append(page.Data[:5:5], page.Data[7:]...) // no abstract
+	if meta := DetectPaperMetadata(&page); meta == nil || meta.Authors != "Ada Smith, Bo Chen\nUniversity of Somewhere" {
+		t.Errorf("with an affiliation but no abstract: %+v", meta)
+	}
+	invoice := models.Page{Number: 1, Data: []models.Block{
+		block(models.BlockHeading, 24, models.BBox{250, 60, 362, 90}, "INVOICE"),
+		block(models.BlockText, 11, models.BBox{240, 100, 372, 112}, "ACME Supplies Ltd"),
+		block(models.BlockText, 10, models.BBox{72, 150, 540, 400}, "Item Qty Price"),
+	}}
+	if meta := DetectPaperMetadata(&invoice); meta != nil {
+		t.Errorf("invoice has paper metadata %+v", meta)
+	}
+}
+
+func TestExtractBatesNumbers(t *testing.T) {
+	page := func(num int, stamp string) models.Page {
+		return models.Page{Number: num, Bounds: models.BBox{0, 0, 612, 792}, Data: []models.Block{
+			{Type: models.BlockText, BBox: models.BBox{72, 72, 540, 700}, Length: 40, Lines: 20, Spans: []models.Span{{Text: "Body text referring to ABC0000001."}}},
+			{Type: models.BlockText, BBox: models.BBox{480, 760, 560, 772}, Length: len(stamp), Lines: 1, Spans: []models.Span{{Text: stamp}}},
+		}}
+	}
+	pages := []models.Page{page(1, "ABC0000101"), page(2, "ABC0000102"), page(3, "ABC0000103")}
+	ExtractBatesNumbers(pages)
+	for i, p := range pages {
+		if want := "ABC000010" + string(rune('1'+i)); p.Bates != want {
+			t.Errorf("page %d: bates = %q, want %q", p.Number, p.Bates, want)
+		}
+		if len(p.Data) != 1 {
+			t.Errorf("page %d: stamp block not removed", p.Number)
+		}
+	}
+
+	unordered := []models.Page{page(1, "ABC0000105"), page(2, "ABC0000102")}
+	ExtractBatesNumbers(unordered)
+	if unordered[0].Bates != "" || len(unordered[0].Data) != 2 {
+		t.Error("non-increasing stamps should be left alone")
+	}
+}
+
+func TestExtractRunningHeads(t *testing.T) {
+	block := func(y float32, s string) models.Block {
+		return models.Block{Type: models.BlockText, BBox: models.BBox{72, y, 540, y + 12}, Length: len(s), Lines: 1, Spans: []models.Span{{Text: s}}}
+	}
+	page := func(num int, header, footer string) models.Page {
+		return models.Page{Number: num, Bounds: models.BBox{0, 0, 612, 792}, Data: []models.Block{
+			block(30, header),
+			{Type: models.BlockText, BBox: models.BBox{72, 72, 540, 700}, Length: 40, Lines: 20, Spans: []models.Span{{Text: "Body text."}}},
+			block(760, footer),
+		}}
+	}
+	pages := []models.Page{
+		page(1, "Chapter 2: Methods", "Report 2024-03-01"),
+		page(2, "Chapter 2: Methods", "Report 2024-03-02"),
+		page(3, "Chapter 2: Methods", "Report 2024-03-03"),
+		page(4, "Results in brief", "Report 2024-03-04"),
+	}
+	opts := DefaultOptions
+	opts.KeepSuppressed = true
+	ExtractRunningHeads(pages, opts)
+	for i, p := range pages {
+		if want := fmt.Sprintf("Report 2024-03-0%d", i+1); p.FooterText != want {
+			t.Errorf("page %d: footer_text = %q, want %q", p.Number, p.FooterText, want)
+		}
+		if len(p.Suppressed) == 0 || p.Suppressed[len(p.Suppressed)-1].Suppressed != "running_foot" {
+			t.Errorf("page %d: footer not kept as suppressed: %+v", p.Number, p.Suppressed)
+		}
+	}
+	if pages[0].HeaderText != "Chapter 2: Methods" || len(pages[0].Data) != 1 {
+		t.Errorf("page 1: header_text = %q with %d blocks left, want the chapter and the body", pages[0].HeaderText, len(pages[0].Data))
+	}
+	if pages[3].HeaderText != "" || len(pages[3].Data) != 2 {
+		t.Errorf("page 4: text in the top margin on only one page taken for a running head: %q", pages[3].HeaderText)
+	}
+
+	// on two pages, or as a heading or caption, it is content
+	pages = []models.Page{page(1, "", "Figure 1: Layout"), page(2, "", "Figure 1: Layout"), page(3, "", "Figure 1: Layout")}
+	for i := range pages {
+		pages[i].Data[0].Type = models.BlockHeading
+		pages[i].Data[0].Spans[0].Text = "Introduction"
+	}
+	pages = append(pages, page(4, "Draft", "Figure 1: Layout"), page(5, "Draft", "Figure 1: Layout"))
+	ExtractRunningHeads(pages, opts)
+	for _, p := range pages {
+		if p.HeaderText != "" || p.FooterText != "" || len(p.Data) != 3 {
+			t.Errorf("page %d: header_text = %q, footer_text = %q with %d blocks left, want nothing taken", p.Number, p.HeaderText, p.FooterText, len(p.Data))
+		}
+	}
+}
+
+func TestTopMarginHeadingNotHeaderText(t *testing.T) {
+	raw := textBlockPage(3, 4)
+	line := bridge.RawLine{BBox: bridge.Rect{X0: 72, Y0: 30, X1: 156, Y1: 42}, CharStart: len(raw.Chars)}
+	for i, r := range "INTRODUCTION" {
+		x := 72 + float32(i)*7
+		raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 12, IsBold: true, BBox: bridge.Rect{X0: x, Y0: 30, X1: x + 7, Y1: 42}, OriginX: x, OriginY: 40, Advance: 7})
+	}
+	line.CharCount = len(raw.Chars) - line.CharStart
+	raw.Blocks = append([]bridge.RawBlock{{BBox: line.BBox, LineStart: len(raw.Lines), LineCount: 1}}, raw.Blocks...)
+	raw.Lines = append(raw.Lines, line)
+	pages := []models.Page{ExtractPageFromRawWithOptions(raw, DefaultOptions)}
+	ExtractRunningHeads(pages, DefaultOptions)
+	if pages[0].HeaderText != "" {
+		t.Errorf("heading on one page taken for a running head: header_text = %q", pages[0].HeaderText)
+	}
+}
+
+func TestLineSummary(t *testing.T) {
+	raw := &bridge.RawPageData{Chars: []bridge.RawChar{
+		{Codepoint: 'H', Size: 10, IsBold: true},
+		{Codepoint: 'i', Size: 10, IsBold: true},
+		{Codepoint: ' ', Size: 10},
+		{Codepoint: 'x', Size: 12, IsBold: true, IsItalic: true},
+	}}
+	line := &bridge.RawLine{CharStart: 0, CharCount: 4}
+	got := lineSummary(raw, line, models.BBox{1, 2, 3, 4})
+	if got.Text != "Hi x" || got.FontSize != 10.5 || !got.Bold || got.Italic || got.BBox != (models.BBox{1, 2, 3, 4}) {
+		t.Errorf("lineSummary = %+v", got)
+	}
+}
+
+func TestMissingSpace(t *testing.T) {
+	a := &bridge.RawChar{Codepoint: 'a', Size: 10, OriginX: 0, Advance: 5}
+	tight := &bridge.RawChar{Codepoint: 'b', Size: 10, OriginX: 5.5, Advance: 5}
+	apart := &bridge.RawChar{Codepoint: 'b', Size: 10, OriginX: 9, Advance: 5}
+	space := &bridge.RawChar{Codepoint: ' ', Size: 10, OriginX: 9, Advance: 2.5}
+	if missingSpace(a, tight, text.DefaultSpacing) {
+		t.Error("kerned glyphs should not be split")
+	}
+	if !missingSpace(a, apart, text.DefaultSpacing) {
+		t.Error("glyphs 4pt apart should be separate words")
+	}
+	if missingSpace(a, space, text.DefaultSpacing) || missingSpace(nil, a, text.DefaultSpacing) {
+		t.Error("no space needed next to an existing space or at line start")
+	}
+}
+
+func TestAnnotateSentences(t *testing.T) {
+	pages := []models.Page{{Data: []models.Block{
+		{Type: models.BlockText, Spans: []models.Span{{Text: "First "}, {Text: "one.", Style: models.TextStyle{Bold: true}}, {Text: " Second one."}}},
+		{Type: models.BlockTable},
+	}}}
+	AnnotateSentences(pages)
+	if got := pages[0].Data[0].Sentences; len(got) != 2 || got[0] != [2]int{0, 10} || got[1] != [2]int{11, 22} {
+		t.Errorf("sentences = %v", got)
+	}
+	if pages[0].Data[1].Sentences != nil {
+		t.Error("tables should not get sentences")
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	para := func(s string) models.Block {
+		return models.Block{Type: models.BlockText, Spans: []models.Span{{Text: s}}}
+	}
+	text := "The parties agree that the supplier shall deliver the goods within thirty days of the order date and the buyer shall pay within sixty days of delivery."
+	a := []models.Page{{Data: []models.Block{para(text)}}}
+	reflowed := []models.Page{{Data: []models.Block{para(strings.ToUpper(text[:60])), para("  " + text[60:] + "\n")}}}
+	edited := []models.Page{{Data: []models.Block{para(strings.Replace(text, "thirty", "forty", 1))}}}
+	docA, docReflowed := Fingerprints(a), Fingerprints(reflowed)
+	Fingerprints(edited)
+
+	if a[0].Fingerprint.Hash != reflowed[0].Fingerprint.Hash || docA.Hash != docReflowed.Hash {
+		t.Error("layout and case changes should not change the hash")
+	}
+	if a[0].Fingerprint.Hash == edited[0].Fingerprint.Hash {
+		t.Error("edited text should hash differently")
+	}
+	d, err := SimhashDistance(a[0].Fingerprint.Simhash, edited[0].Fingerprint.Simhash)
+	if err != nil || d > 12 {
+		t.Errorf("one-word edit moved simhash by %d bits (%v)", d, err)
+	}
+}
+
+func TestExtractPageFromRawContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExtractPageFromRawContext(ctx, textBlockPage(3, 4), DefaultOptions); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	page, err := ExtractPageFromRawContext(context.Background(), textBlockPage(3, 4), DefaultOptions)
+	if err != nil || len(page.Data) == 0 {
+		t.Fatalf("uncancelled extraction: %d blocks, err %v", len(page.Data), err)
+	}
+}
+
+// textBlockPage is a page with one raw text block of the given number of
+// lines, each a run of words with every third word in bold.
+func textBlockPage(lines, wordsPerLine int) *bridge.RawPageData {
+	raw := &bridge.RawPageData{PageBounds: bridge.Rect{X1: 612, Y1: 792}}
+	for l := 0; l < lines; l++ {
+		y := 72 + float32(l)*11
+		line := bridge.RawLine{BBox: bridge.Rect{X0: 72, Y0: y, X1: 540, Y1: y + 10}, CharStart: len(raw.Chars)}
+		x := float32(72)
+		for w := 0; w < wordsPerLine; w++ {
+			word := "word "
+			if w == wordsPerLine-1 {
+				word = "word"
+			}
+			for _, r := range word {
+				raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: y, X1: x + 5, Y1: y + 10}, OriginX: x, OriginY: y + 8, Advance: 5, IsBold: w%3 == 0})
+				x += 5
+			}
+		}
+		line.CharCount = len(raw.Chars) - line.CharStart
+		raw.Lines = append(raw.Lines, line)
+	}
+	raw.Blocks = []bridge.RawBlock{{BBox: bridge.Rect{X0: 72, Y0: 72, X1: 540, Y1: 72 + float32(lines)*11}, LineCount: lines}}
+	return raw
+}
+
+func TestSplitAndProcessBlockSpans(t *testing.T) {
+	raw := textBlockPage(2, 4)
+	blocks := splitAndProcessBlock(raw, &raw.Blocks[0], 10, DefaultOptions)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	var got []string
+	for _, s := range blocks[0].Spans {
+		got = append(got, fmt.Sprintf("%q bold=%v", s.Text, s.Style.Bold))
+	}
+	want := []string{`"word" bold=true`, `" word word " bold=false`, `"word word" bold=true`, `" word word " bold=false`, `"word" bold=true`}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("spans = %v\nwant %v", got, want)
+	}
+	if blocks[0].Text != "word word word word word word word word" {
+		t.Errorf("text = %q", blocks[0].Text)
+	}
+}
+
+func TestSplitAndProcessBlockChars(t *testing.T) {
+	raw := textBlockPage(2, 2)
+	opts := DefaultOptions
+	opts.Chars = true
+	blocks := splitAndProcessBlock(raw, &raw.Blocks[0], 10, opts)
+	if len(blocks) != 1 || len(blocks[0].Chars) != len(raw.Chars) {
+		t.Fatalf("got %d blocks, want 1 with all %d chars", len(blocks), len(raw.Chars))
+	}
+	c := blocks[0].Chars[5]
+	if c.Codepoint != 'w' || c.BBox != (models.BBox{97, 72, 102, 82}) || c.Origin != [2]float32{97, 80} || c.Size != 10 || c.Bold {
+		t.Errorf("char 5 = %+v", c)
+	}
+	if blocks := splitAndProcessBlock(raw, &raw.Blocks[0], 10, DefaultOptions); blocks[0].Chars != nil {
+		t.Error("chars kept without Options.Chars")
+	}
+}
+
+func TestWithoutZones(t *testing.T) {
+	raw := textBlockPage(3, 4)
+	raw.Edges = []bridge.Edge{{X0: 72, Y0: 88, X1: 540, Y1: 88, Orientation: 'h'}, {X0: 72, Y0: 110, X1: 540, Y1: 110, Orientation: 'h'}}
+	opts := DefaultOptions
+	opts.IgnoreZones = map[int][]geometry.Rect{
+		0: {{X0: 0, Y0: 82, X1: 612, Y1: 94}}, // the whole second line
+		1: {{X0: 70, Y0: 70, X1: 97, Y1: 82}}, // the first word
+	}
+	got := withoutZones(raw, opts.ignoreZones(1))
+	if len(got.Blocks) != 1 || len(got.Lines) != 2 || len(got.Edges) != 1 {
+		t.Fatalf("got %d blocks, %d lines, %d edges; want 1, 2, 1", len(got.Blocks), len(got.Lines), len(got.Edges))
+	}
+	first := got.Chars[got.Lines[0].CharStart : got.Lines[0].CharStart+got.Lines[0].CharCount]
+	if len(first) != 14 || first[0].Codepoint != 'w' || got.Lines[0].BBox.X0 != 97 {
+		t.Errorf("first line has %d chars from x %v, want 14 from 97", len(first), got.Lines[0].BBox.X0)
+	}
+	if b := got.Blocks[0].BBox; b.Y0 != 72 || b.Y1 != 104 || b.X0 != 72 {
+		t.Errorf("block bbox = %+v", b)
+	}
+	if len(raw.Chars) != 57 || len(raw.Lines) != 3 {
+		t.Error("raw page modified")
+	}
+	if zones := opts.ignoreZones(2); len(zones) != 1 {
+		t.Errorf("page 2 zones = %v, want the one for every page", zones)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	raw := textBlockPage(3, 4)
+	raw.Redactions = []bridge.Rect{{X0: 70, Y0: 82, X1: 120, Y1: 94}} // the second line's first two words
+	text := func(page models.Page) string {
+		var parts []string
+		for _, b := range page.Data {
+			parts = append(parts, b.Text())
+		}
+		return strings.Join(parts, " ")
+	}
+	page := ExtractPageFromRawWithOptions(raw, DefaultOptions)
+	if got := strings.Count(text(page), "word"); got != 10 {
+		t.Errorf("%d words left, want 10 of 12: %q", got, text(page))
+	}
+	if len(page.Warnings) != 1 || !strings.HasPrefix(page.Warnings[0], "left out 10 characters under redaction") {
+		t.Errorf("warnings = %q", page.Warnings)
+	}
+	opts := DefaultOptions
+	opts.KeepRedacted = true
+	page = ExtractPageFromRawWithOptions(raw, opts)
+	if got := strings.Count(text(page), "word"); got != 12 {
+		t.Errorf("kept %d words, want all 12", got)
+	}
+	if len(page.Warnings) != 1 || !strings.HasPrefix(page.Warnings[0], "kept 10 characters") {
+		t.Errorf("warnings = %q", page.Warnings)
+	}
+}
+
+// twoColumnPage is a page with a block of text in each of two columns above
+// y 200 and below y 400, each block repeating its letter.
+func twoColumnPage() *bridge.RawPageData {
+	raw := &bridge.RawPageData{PageBounds: bridge.Rect{X1: 612, Y1: 792}}
+	for i, at := range [][2]float32{{72, 72}, {330, 72}, {72, 400}, {330, 400}} {
+		start := len(raw.Lines)
+		for l := 0; l < 10; l++ {
+			x, y := at[0], at[1]+float32(l)*12
+			line := bridge.RawLine{BBox: bridge.Rect{X0: x, Y0: y, X1: x + 200, Y1: y + 10}, CharStart: len(raw.Chars)}
+			for c := 0; c < 40; c++ {
+				r := rune('a' + i)
+				if c%5 == 4 {
+					r = ' '
+				}
+				raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: y, X1: x + 5, Y1: y + 10}, OriginX: x, OriginY: y + 8, Advance: 5})
+				x += 5
+			}
+			line.CharCount = len(raw.Chars) - line.CharStart
+			raw.Lines = append(raw.Lines, line)
+		}
+		raw.Blocks = append(raw.Blocks, bridge.RawBlock{BBox: bridge.Rect{X0: at[0], Y0: at[1], X1: at[0] + 200, Y1: at[1] + 120}, LineStart: start, LineCount: 10})
+	}
+	return raw
+}
+
+func TestFullWidthElementsSplitColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*bridge.RawPageData)
+		want string
+	}{
+		{"no divider", func(*bridge.RawPageData) {}, "acbd"},
+		{"figure", func(raw *bridge.RawPageData) {
+			raw.Figures = []bridge.RawFigure{{BBox: bridge.Rect{X0: 72, Y0: 210, X1: 530, Y1: 390}}}
+		}, "abcd"},
+		{"figure left out", func(raw *bridge.RawPageData) {
+			raw.Figures = []bridge.RawFigure{{BBox: bridge.Rect{X0: 72, Y0: 210, X1: 530, Y1: 390}}}
+		}, "abcd"},
+		{"rule", func(raw *bridge.RawPageData) {
+			raw.Edges = []bridge.Edge{{X0: 72, Y0: 300, X1: 530, Y1: 300, Orientation: 'h'}}
+		}, "abcd"},
+		{"short rule", func(raw *bridge.RawPageData) {
+			raw.Edges = []bridge.Edge{{X0: 72, Y0: 300, X1: 272, Y1: 300, Orientation: 'h'}}
+		}, "acbd"},
+	}
+	for _, tc := range tests {
+		raw := twoColumnPage()
+		tc.edit(raw)
+		opts := DefaultOptions
+		if tc.name == "figure left out" {
+			opts.Images.MinArea = 1e6
+		}
+		var got strings.Builder
+		for _, b := range ExtractPageFromRawWithOptions(raw, opts).Data {
+			if b.Type != models.BlockFigure {
+				got.WriteString(b.Text()[:1])
+			}
+		}
+		if got.String() != tc.want {
+			t.Errorf("%s: read %s, want %s", tc.name, got.String(), tc.want)
+		}
+	}
+}
+
+func TestFootnoteRules(t *testing.T) {
+	raw := &bridge.RawPageData{PageBounds: bridge.Rect{X1: 612, Y1: 792}, Edges: []bridge.Edge{
+		{X0: 72, Y0: 650, X1: 216, Y1: 650, Orientation: 'h'}, // above the notes
+		{X0: 72, Y0: 200, X1: 216, Y1: 200, Orientation: 'h'}, // too high up
+		{X0: 72, Y0: 600, X1: 540, Y1: 600, Orientation: 'h'}, // too wide
+		{X0: 72, Y0: 505, X1: 216, Y1: 505, Orientation: 'h'}, // an underline
+	}}
+	body := &blockInfo{Type: models.BlockText, BBox: models.BBox{72, 300, 540, 640}, AvgFontSize: 10, Spans: []models.Span{{Text: "1 body text"}}}
+	note := &blockInfo{Type: models.BlockText, BBox: models.BBox{72, 656, 540, 680}, AvgFontSize: 8, Spans: []models.Span{{Text: "carried over from the page before"}}}
+	rules := footnoteRules(raw, []*blockInfo{body, note}, 10, DefaultHeuristics)
+	if len(rules) != 1 || rules[0] != (models.BBox{72, 650, 216, 650}) {
+		t.Fatalf("rules = %v, want the one above the notes", rules)
+	}
+	if !isFootnote(note, 10, raw.PageBounds, rules) {
+		t.Error("unnumbered note under the rule is not a footnote")
+	}
+	small := *body
+	small.AvgFontSize = 8
+	small.BBox[1] = 560 // in the bottom third, numbered and small, but above the rule
+	if isFootnote(&small, 10, raw.PageBounds, rules) {
+		t.Error("text above the rule is a footnote")
+	}
+	if isFootnote(note, 10, raw.PageBounds, nil) {
+		t.Error("unnumbered note is a footnote without the rule")
+	}
+	h := DefaultHeuristics
+	h.FootnoteRuleWidth = 0
+	if rules := footnoteRules(raw, []*blockInfo{body, note}, 10, h); rules != nil {
+		t.Errorf("rules = %v with footnote_rule_width 0", rules)
+	}
+}
+
+func TestMergeDropCaps(t *testing.T) {
+	newBlocks := func() []*blockInfo {
+		return []*blockInfo{
+			{Type: models.BlockHeading, Text: "O", BBox: models.BBox{72, 100, 100, 134}, AvgFontSize: 36, Spans: []models.Span{{Text: "O"}}},
+			{Type: models.BlockText, Text: "nce upon a time", BBox: models.BBox{104, 102, 540, 160}, AvgFontSize: 10, Spans: []models.Span{{Text: "nce upon a time"}}, Lines: []models.Line{{Text: "nce upon"}}},
+			{Type: models.BlockText, Text: "there was a page.", BBox: models.BBox{72, 162, 540, 200}, AvgFontSize: 10},
+		}
+	}
+	got := mergeDropCaps(newBlocks(), 10)
+	if len(got) != 2 {
+		t.Fatalf("got %d blocks, want the drop cap merged", len(got))
+	}
+	p := got[0]
+	if p.Text != "Once upon a time" || p.Spans[0].Text != "Once upon a time" || p.Lines[0].Text != "Once upon" || p.TextChars != 16 || p.BBox != (models.BBox{72, 100, 540, 160}) {
+		t.Errorf("paragraph = %q %q %q %d %v", p.Text, p.Spans[0].Text, p.Lines[0].Text, p.TextChars, p.BBox)
+	}
+
+	blocks := newBlocks()
+	blocks[0].AvgFontSize = 14 // a letter barely larger than the text
+	blocks[1].BBox[0] = 300    // far from the letter
+	if got := mergeDropCaps(blocks, 10); len(got) != 3 {
+		t.Errorf("got %d blocks, want none merged", len(got))
+	}
+}
+
+func TestPageTimings(t *testing.T) {
+	raw := textBlockPage(12, 12)
+	if page := ExtractPageFromRawWithOptions(raw, DefaultOptions); page.Timings != nil {
+		t.Errorf("timings without PageTimings: %+v", page.Timings)
+	}
+	opts := DefaultOptions
+	opts.PageTimings = true
+	page := ExtractPageFromRawWithOptions(raw, opts)
+	if page.Timings == nil || page.Timings.Classify < 0 || page.Timings.Read != 0 || page.Timings.Serialize != 0 {
+		t.Errorf("timings = %+v, want only tables and classification", page.Timings)
+	}
+}
+
+func TestDocumentFonts(t *testing.T) {
+	// A page that is mostly small print, with a line of body text below it.
+	raw := textBlockPage(12, 12)
+	for i := range raw.Chars {
+		raw.Chars[i].Size, raw.Chars[i].IsBold = 7, false
+	}
+	line := bridge.RawLine{BBox: bridge.Rect{X0: 72, Y0: 220, X1: 150, Y1: 232}, CharStart: len(raw.Chars)}
+	for i, r := range "Results above" {
+		x := 72 + float32(i)*6
+		raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: 220, X1: x + 6, Y1: 232}, OriginX: x, OriginY: 230, Advance: 6})
+	}
+	line.CharCount = len(raw.Chars) - line.CharStart
+	raw.Blocks = append(raw.Blocks, bridge.RawBlock{BBox: line.BBox, LineStart: len(raw.Lines), LineCount: 1})
+	raw.Lines = append(raw.Lines, line)
+
+	lastType := func(opts Options) models.BlockType {
+		page := ExtractPageFromRawWithOptions(raw, opts)
+		if len(page.Data) != 2 {
+			t.Fatalf("got %d blocks, want 2", len(page.Data))
+		}
+		return page.Data[1].Type
+	}
+	if got := lastType(DefaultOptions); got != models.BlockHeading {
+		t.Errorf("by the page's own sizes: %v, want a heading", got)
+	}
+	var tally FontTally
+	tally.Add(raw)
+	rest := &bridge.RawPageData{Chars: make([]bridge.RawChar, 3000)} // the rest of the document
+	for i := range rest.Chars {
+		rest.Chars[i].Size = 10
+	}
+	tally.Add(rest)
+	sizes, ok := tally.Sizes()
+	if !ok || sizes.Body != 10 {
+		t.Fatalf("sizes = %v %v, want a body size of 10", sizes, ok)
+	}
+	opts := DefaultOptions
+	opts.Fonts = &sizes
+	if got := lastType(opts); got != models.BlockText {
+		t.Errorf("by the document's sizes: %v, want text", got)
+	}
+}
+
+func TestOrderConfidence(t *testing.T) {
+	two := [][]column.Range{nil, {{X0: 72, X1: 290}, {X0: 320, X1: 540}}}
+	heading := &blockInfo{BBox: models.BBox{72, 72, 540, 100}}
+	left := &blockInfo{BBox: models.BBox{72, 110, 290, 400}, BandIdx: 1, ColIdx: 1}
+	right := &blockInfo{BBox: models.BBox{320, 110, 540, 400}, BandIdx: 1, ColIdx: 2}
+	if got := orderConfidence([]*blockInfo{heading, left, right}, two); got != 1 {
+		t.Errorf("clean columns = %v, want 1", got)
+	}
+	straddling := &blockInfo{BBox: models.BBox{200, 410, 400, 440}, BandIdx: 1}
+	if got := orderConfidence([]*blockInfo{heading, left, right, straddling}, two); got != 0.67 {
+		t.Errorf("with a block across columns = %v, want 0.67", got)
+	}
+	heading.BBox[3] = 130 // runs into the top of both columns
+	if got := orderConfidence([]*blockInfo{heading, left, right}, two); got != 0 {
+		t.Errorf("with an overlapping heading = %v, want 0", got)
+	}
+	if got := orderConfidence([]*blockInfo{heading}, [][]column.Range{nil}); got != 1 {
+		t.Errorf("single column = %v, want 1", got)
+	}
+}
+
+func TestRankTopDown(t *testing.T) {
+	blocks := []models.Block{
+		{BBox: models.BBox{72, 72, 540, 100}},
+		{BBox: models.BBox{72, 110, 290, 400}},
+		{BBox: models.BBox{72, 410, 290, 500}},
+		{BBox: models.BBox{320, 111, 540, 300}},
+	}
+	rankTopDown(blocks)
+	var got []int
+	for _, b := range blocks {
+		got = append(got, b.TopDown)
+	}
+	if fmt.Sprint(got) != "[1 2 4 3]" {
+		t.Errorf("top_down = %v, want [1 2 4 3]", got)
+	}
+}
+
+func BenchmarkSplitAndProcessBlock(b *testing.B) {
+	raw := textBlockPage(60, 14)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		splitAndProcessBlock(raw, &raw.Blocks[0], 10, DefaultOptions)
+	}
+}
+
+// tablePage is textBlockPage(3, 4) with a ruled 3x3 table of single letters
+// below the text.
+func tablePage() *bridge.RawPageData {
+	raw := textBlockPage(3, 4)
+	for _, y := range []float64{400, 420, 440, 460} {
+		raw.Edges = append(raw.Edges, bridge.Edge{X0: 72, Y0: y, X1: 432, Y1: y, Orientation: 'h'})
+	}
+	for _, x := range []float64{72, 192, 312, 432} {
+		raw.Edges = append(raw.Edges, bridge.Edge{X0: x, Y0: 400, X1: x, Y1: 460, Orientation: 'v'})
+	}
+	for i, x := range []float32{80, 200, 320, 80, 200, 320, 80, 200, 320} {
+		y := float32(405 + i/3*20)
+		raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: rune('a' + i), Size: 10, BBox: bridge.Rect{X0: x, Y0: y, X1: x + 5, Y1: y + 10}, OriginX: x, OriginY: y + 8, Advance: 5})
+	}
+	return raw
+}
+
+func TestExtractPageWithTableAndText(t *testing.T) {
+	page := ExtractPageFromRawWithOptions(tablePage(), DefaultOptions)
+	var types []string
+	for _, b := range page.Data {
+		types = append(types, string(b.Type))
+	}
+	if len(page.Data) != 2 || page.Data[0].Type != models.BlockText || page.Data[1].Type != models.BlockTable {
+		t.Fatalf("block types = %v, want text then table", types)
+	}
+	if rows := page.Data[1].Rows; len(rows) != 3 || len(rows[0].Cells) != 3 {
+		t.Errorf("table rows = %+v", rows)
+	}
+}
+
+func TestDisableTables(t *testing.T) {
+	opts := DefaultOptions
+	opts.DisableTables = true
+	for _, b := range ExtractPageFromRawWithOptions(tablePage(), opts).Data {
+		if b.Type == models.BlockTable {
+			t.Error("table detected with DisableTables set")
+		}
+	}
+}
+
+func TestFilterBlocks(t *testing.T) {
+	newPages := func() []models.Page {
+		return []models.Page{{Data: []models.Block{{Type: models.BlockHeading}, {Type: models.BlockText}, {Type: models.BlockTable}, {Type: models.BlockOther}}}}
+	}
+	types := func(p []models.Page) (out []models.BlockType) {
+		for _, b := range p[0].Data {
+			out = append(out, b.Type)
+		}
+		return out
+	}
+	pages := newPages()
+	FilterBlocks(pages, []models.BlockType{models.BlockHeading, models.BlockTable}, nil)
+	if got := types(pages); len(got) != 2 || got[0] != models.BlockHeading || got[1] != models.BlockTable {
+		t.Errorf("only heading,table: %v", got)
+	}
+	pages = newPages()
+	FilterBlocks(pages, nil, []models.BlockType{models.BlockOther, models.BlockText})
+	if got := types(pages); len(got) != 2 || got[0] != models.BlockHeading || got[1] != models.BlockTable {
+		t.Errorf("exclude other,text: %v", got)
+	}
+}
+
+func TestMarginsForPageSize(t *testing.T) {
+	a4 := text.Margins{Top: text.Margin{Value: 10, Percent: true}}
+	opts := DefaultOptions
+	opts.PageMargins = []PageMargins{{Width: 595, Height: 842, Margins: a4}}
+	if got := opts.marginsFor(bridge.Rect{X1: 842, Y1: 595.5}); got != a4 {
+		t.Errorf("landscape A4 got %+v", got)
+	}
+	if got := opts.marginsFor(bridge.Rect{X1: 612, Y1: 792}); got != text.DefaultMargins {
+		t.Errorf("letter got %+v", got)
+	}
+}
+
+func TestClassifierOverridesHeuristics(t *testing.T) {
+	opts := DefaultOptions
+	var seen []Features
+	opts.Classifier = ClassifierFunc(func(f Features, typ models.BlockType, level int) (models.BlockType, int) {
+		seen = append(seen, f)
+		if typ == models.BlockText {
+			return models.BlockHeading, 9
+		}
+		return typ, level
+	})
+	raw := textBlockPage(2, 4)
+	raw.PageNumber = 3
+	page := ExtractPageFromRawWithOptions(raw, opts)
+	if len(page.Data) != 1 || page.Data[0].Type != models.BlockHeading || page.Data[0].Level != 6 {
+		t.Fatalf("blocks = %+v, want one heading clamped to level 6", page.Data)
+	}
+	if len(seen) != 1 || seen[0].Page != 3 || seen[0].Lines != 2 || seen[0].MedianFontSize != 10 || seen[0].PageBounds[3] != 792 {
+		t.Errorf("features = %+v", seen)
+	}
+
+	opts.Classifier = ClassifierFunc(func(Features, models.BlockType, int) (models.BlockType, int) { return models.BlockTable, 0 })
+	if page := ExtractPageFromRawWithOptions(textBlockPage(2, 4), opts); len(page.Data) != 1 || page.Data[0].Type != models.BlockText {
+		t.Errorf("text block turned into a table: %+v", page.Data)
+	}
+}
+
+func TestClassifyConfidence(t *testing.T) {
+	long := strings.Repeat("plain body text that goes on ", 8)
+	tests := []struct {
+		name string
+		info blockInfo
+		typ  models.BlockType
+	}{
+		{"numbered large bold heading", blockInfo{Text: "1. Introduction", AvgFontSize: 18, BoldRatio: 1, LineCount: 1}, models.BlockHeading},
+		{"heading by size alone", blockInfo{Text: "Introduction", AvgFontSize: 13, LineCount: 1}, models.BlockHeading},
+		{"bold line", blockInfo{Text: "Introduction", AvgFontSize: 10, BoldRatio: 0.8, LineCount: 1}, models.BlockHeading},
+		{"body text", blockInfo{Text: long, AvgFontSize: 10, LineCount: 3}, models.BlockText},
+		{"short text near heading size", blockInfo{Text: "A short line.", AvgFontSize: 12, LineCount: 1}, models.BlockText},
+	}
+	var prev float32
+	for i, tt := range tests {
+		info := tt.info
+		info.TextChars = len([]rune(info.Text))
+		classifyBlock(&info, 10, DefaultHeuristics)
+		if info.Type != tt.typ {
+			t.Fatalf("%s: type %s, want %s", tt.name, info.Type, tt.typ)
+		}
+		if info.Confidence < 0.5 || info.Confidence > 1 {
+			t.Errorf("%s: confidence %v out of range", tt.name, info.Confidence)
+		}
+		// Within each type the cases go from clearest to most borderline.
+		if i > 0 && tt.typ == tests[i-1].typ && info.Confidence >= prev {
+			t.Errorf("%s: confidence %v, want less than %v for %s", tt.name, info.Confidence, prev, tests[i-1].name)
+		}
+		prev = info.Confidence
+	}
+}
+
+func TestConfidenceOption(t *testing.T) {
+	if page := ExtractPageFromRawWithOptions(textBlockPage(2, 4), DefaultOptions); page.Data[0].Confidence != 0 {
+		t.Errorf("confidence %v reported without the option", page.Data[0].Confidence)
+	}
+	opts := DefaultOptions
+	opts.Confidence = true
+	page := ExtractPageFromRawWithOptions(textBlockPage(2, 4), opts)
+	if c := page.Data[0].Confidence; c < 0.5 || c > 1 || c*100 != float32(int(c*100)) {
+		t.Errorf("confidence = %v, want two decimals between 0.5 and 1", c)
+	}
+}
+
+func TestCaptionFigures(t *testing.T) {
+	span := func(s string) []models.Span { return []models.Span{{Text: s}} }
+	blocks := []models.Block{
+		{Type: models.BlockText, BBox: models.BBox{72, 80, 540, 100}, FontSize: 10, Spans: span("As Figure 2 shows, sales rose.")},
+		{Type: models.BlockFigure, BBox: models.BBox{100, 110, 500, 400}},
+		{Type: models.BlockText, BBox: models.BBox{100, 408, 500, 420}, FontSize: 9, Spans: span("Figure 2:  Quarterly\nsales")},
+		{Type: models.BlockText, BBox: models.BBox{72, 440, 540, 460}, FontSize: 10, Spans: span("Fig. 3 is further down.")},
+		{Type: models.BlockFigure, BBox: models.BBox{100, 600, 500, 700}},
+		{Type: models.BlockText, BBox: models.BBox{72, 720, 540, 740}, FontSize: 10, Spans: span("Unrelated text.")},
+	}
+	captionFigures(blocks)
+	if got := blocks[1].Caption; got != "Figure 2: Quarterly sales" {
+		t.Errorf("caption = %q", got)
+	}
+	if got := blocks[4].Caption; got != "" {
+		t.Errorf("caption taken from %q, too far above the figure", got)
+	}
+	if len(blocks) != 6 || blocks[2].Type != models.BlockText {
+		t.Error("caption block was changed")
+	}
+}
+
+func TestImageFilter(t *testing.T) {
+	raw := &bridge.RawPageData{PageBounds: bridge.Rect{X1: 612, Y1: 792}, Figures: []bridge.RawFigure{
+		{BBox: bridge.Rect{X0: 72, Y0: 72, X1: 80, Y1: 80}},
+		{BBox: bridge.Rect{X0: 72, Y0: 100, X1: 540, Y1: 101}},
+		{BBox: bridge.Rect{X0: 72, Y0: 200, X1: 300, Y1: 400}},
+	}}
+	opts := DefaultOptions
+	opts.Images = ImageFilter{MinHeight: 4, MinArea: 100}
+	page := ExtractPageFromRawWithOptions(raw, opts)
+	if len(page.Data) != 1 || page.Data[0].BBox != (models.BBox{72, 200, 300, 400}) {
+		t.Errorf("kept %+v, want only the large figure", page.Data)
+	}
+}
+
+func TestDedupImages(t *testing.T) {
+	dir := t.TempDir()
+	save := func(name string, w, h int, shade func(x, y int) uint8) string {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetGray(x, y, color.Gray{Y: shade(x*100/w, y*100/h)})
+			}
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	logo := func(x, y int) uint8 { return uint8((x*7 + y*3) % 256) }
+	photo := func(x, y int) uint8 { return uint8(255 - x*2) }
+	first := save("page_001_img_01.png", 120, 40, logo)
+	rescaled := save("page_002_img_01.png", 90, 30, logo)
+	other := save("page_002_img_02.png", 120, 40, photo)
+	pages := []models.Page{
+		{Number: 1, Data: []models.Block{{Type: models.BlockFigure, Image: first}}},
+		{Number: 2, Data: []models.Block{{Type: models.BlockFigure, Image: rescaled}, {Type: models.BlockFigure, Image: other}, {Type: models.BlockFigure}}},
+	}
+	DedupImages(pages)
+	if got := pages[1].Data[0].Image; got != first {
+		t.Errorf("repeated logo points at %q, want %q", got, first)
+	}
+	if got := pages[1].Data[1].Image; got != other {
+		t.Errorf("distinct image points at %q, want its own file", got)
+	}
+	if pages[1].Data[2].Image != "" {
+		t.Error("figure without an image should stay without one")
+	}
+}
+
+func TestScanImages(t *testing.T) {
+	raw := textBlockPage(3, 6)
+	raw.Figures = []bridge.RawFigure{{BBox: bridge.Rect{X0: 0, Y0: 0, X1: 612, Y1: 792}, Image: "page_001_img_01.png"}}
+	opts := DefaultOptions
+	opts.ScanImages = true
+	page := ExtractPageFromRawWithOptions(raw, opts)
+	if page.Scan != "page_001_img_01.png" {
+		t.Errorf("scan = %q, want the full-page image", page.Scan)
+	}
+	for _, b := range page.Data {
+		if b.Type == models.BlockFigure {
+			t.Error("the scan should not also be a figure")
+		}
+	}
+
+	raw.Figures[0].BBox = bridge.Rect{X0: 72, Y0: 300, X1: 540, Y1: 700}
+	if page := ExtractPageFromRawWithOptions(raw, opts); page.Scan != "" {
+		t.Errorf("a figure on part of the page taken for a scan")
+	}
+}
+
+func TestDroppedContentWarnings(t *testing.T) {
+	raw := textBlockPage(2, 4)
+	if page := ExtractPageFromRawWithOptions(raw, DefaultOptions); len(page.Warnings) != 0 {
+		t.Errorf("warnings on an ordinary page: %q", page.Warnings)
+	}
+	raw.DroppedChars, raw.DroppedEdges = 2_500_000, 400_000
+	page := ExtractPageFromRawWithOptions(raw, DefaultOptions)
+	if len(page.Warnings) != 2 || !strings.Contains(page.Warnings[0], "2500000") || !strings.Contains(page.Warnings[1], "table detection") {
+		t.Errorf("warnings = %q", page.Warnings)
+	}
+}
+
+func TestKeepSuppressed(t *testing.T) {
+	raw := textBlockPage(2, 4)
+	line := bridge.RawLine{BBox: bridge.Rect{X0: 300, Y0: 750, X1: 310, Y1: 760}, CharStart: len(raw.Chars), CharCount: 2}
+	for i, r := range "12" {
+		x := 300 + float32(i)*5
+		raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: 750, X1: x + 5, Y1: 760}, OriginX: x, OriginY: 758, Advance: 5})
+	}
+	raw.Lines = append(raw.Lines, line)
+	raw.Blocks = append(raw.Blocks, bridge.RawBlock{BBox: line.BBox, LineStart: 2, LineCount: 1})
+	page := ExtractPageFromRawWithOptions(raw, DefaultOptions)
+	if len(page.Data) != 1 || len(page.Suppressed) != 0 {
+		t.Fatalf("got %d blocks and %d suppressed, want the page number dropped", len(page.Data), len(page.Suppressed))
+	}
+	opts := DefaultOptions
+	opts.KeepSuppressed = true
+	page = ExtractPageFromRawWithOptions(raw, opts)
+	if len(page.Data) != 1 || len(page.Suppressed) != 1 {
+		t.Fatalf("got %d blocks and %d suppressed, want 1 and 1", len(page.Data), len(page.Suppressed))
+	}
+	if b := page.Suppressed[0]; b.Text() != "12" || b.Suppressed != "page_number" {
+		t.Errorf("suppressed %q for %q, want \"12\" for page_number", b.Text(), b.Suppressed)
+	}
+}
+
+func TestReportFonts(t *testing.T) {
+	if got := fontName("ABCDEF+Calibri-Bold"); got != "Calibri-Bold" {
+		t.Errorf("fontName = %q", got)
+	}
+	if got := fontName("Helvetica+Light"); got != "Helvetica+Light" {
+		t.Errorf("fontName without a subset tag = %q", got)
+	}
+	pages := make([]models.Page, 3)
+	for i, fonts := range [][]bridge.RawFont{
+		{{Name: "ABCDEF+Calibri", Embedded: true}, {Name: "Garamond", Substituted: true}},
+		{{Name: "GHIJKL+Calibri", Embedded: true}},
+		{{Name: "Garamond", Substituted: true}},
+	} {
+		pages[i].Fonts = pageFonts(&bridge.RawPageData{PageNumber: i + 1, Fonts: fonts})
+	}
+	want := []models.Font{{Name: "Calibri", Embedded: true, Pages: []int{1, 2}}, {Name: "Garamond", Substituted: true, Pages: []int{1, 3}}}
+	if got := ReportFonts(pages); !reflect.DeepEqual(got, want) {
+		t.Errorf("fonts = %+v, want %+v", got, want)
+	}
+}
+
+func TestTextWarnings(t *testing.T) {
+	raw := textBlockPage(2, 4)
+	for i := range raw.Chars {
+		if i%3 == 0 && raw.Chars[i].Codepoint != ' ' {
+			raw.Chars[i].Codepoint = '\ue012' // a glyph of a font without a ToUnicode map
+		}
+	}
+	raw.Figures = []bridge.RawFigure{{BBox: bridge.Rect{X1: 612, Y1: 792}, Image: "scan.png"}}
+	warnings := textWarnings(raw, DefaultBulletGlyphs)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "no Unicode mapping") || !strings.Contains(warnings[1], "from OCR") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	raw.Chars = nil
+	if warnings := textWarnings(raw, DefaultBulletGlyphs); len(warnings) != 1 || !strings.Contains(warnings[0], "needs OCR") {
+		t.Errorf("without text: warnings = %q", warnings)
+	}
+	raw.Figures = nil
+	raw.Fonts = []bridge.RawFont{{Name: "ABCDEF+Calibri", Embedded: true}, {Name: "Garamond", Substituted: true}}
+	if warnings := textWarnings(raw, DefaultBulletGlyphs); len(warnings) != 1 || !strings.Contains(warnings[0], "substitutes (Garamond)") {
+		t.Errorf("with a substituted font: warnings = %q", warnings)
+	}
+}
+
+func TestMergeParagraphBlocks(t *testing.T) {
+	block := func(y0, y1, x0 float32, text string, bold float32) *blockInfo {
+		return &blockInfo{Type: models.BlockText, BBox: models.BBox{x0, y0, 500, y1}, AvgFontSize: 10, BoldRatio: bold, LineCount: 2, Text: text, TextChars: len(text), Spans: []models.Span{{Text: text}}}
+	}
+	blocks := []*blockInfo{
+		block(100, 120, 72, "A paragraph split by MuPDF", 0),
+		block(122, 142, 72, "into two blocks.", 0),
+		block(144, 164, 72, "Bold text after it", 1),
+		block(180, 200, 72, "Far below", 0),
+		block(201, 221, 90, "Indented", 0),
+	}
+	merged, end := mergeParagraphBlocks(blocks, 0, DefaultHeuristics, text.DefaultSpacing)
+	if end != 1 || merged.Text != "A paragraph split by MuPDF into two blocks." || merged.LineCount != 4 || merged.BBox != (models.BBox{72, 100, 500, 142}) {
+		t.Errorf("merged to %d: %+v", end, merged)
+	}
+	if blocks[0].Text != "A paragraph split by MuPDF" {
+		t.Error("the first block was modified")
+	}
+	for _, start := range []int{2, 3} {
+		if _, end := mergeParagraphBlocks(blocks, start, DefaultHeuristics, text.DefaultSpacing); end != start {
+			t.Errorf("block %d merged through %d", start, end)
+		}
+	}
+	off := DefaultHeuristics
+	off.ParagraphMergeGap = 0
+	if _, end := mergeParagraphBlocks(blocks, 0, off, text.DefaultSpacing); end != 0 {
+		t.Error("merged with paragraph_merge_gap 0")
+	}
+
+	indented := block(122, 142, 72, "indented first line", 0)
+	indented.Lines = []models.Line{{BBox: models.BBox{90, 122, 500, 132}}, {BBox: models.BBox{72, 132, 400, 142}}}
+	for _, pair := range [][]*blockInfo{
+		{block(100, 120, 72, "Ends a sentence.", 0), block(122, 142, 72, "another paragraph", 0)},
+		{block(100, 120, 72, "Ends mid sentence", 0), indented},
+	} {
+		if _, end := mergeParagraphBlocks(pair, 0, DefaultHeuristics, text.DefaultSpacing); end != 0 {
+			t.Errorf("%q merged into %q", pair[1].Text, pair[0].Text)
+		}
+	}
+}
+
+func TestSoftBreak(t *testing.T) {
+	raw := &bridge.RawPageData{}
+	line := func(x0 float32, s string) *bridge.RawLine {
+		l := &bridge.RawLine{CharStart: len(raw.Chars)}
+		for i, r := range s {
+			x := x0 + float32(i)*5
+			raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, X1: x + 5}})
+		}
+		l.CharCount = len(raw.Chars) - l.CharStart
+		l.BBox = bridge.Rect{X0: x0, X1: x0 + float32(l.CharCount)*5}
+		return l
+	}
+	block := &bridge.RawBlock{BBox: bridge.Rect{X0: 72, X1: 540}}
+	next := line(72, "word and more")
+	for _, c := range []struct {
+		prev *bridge.RawLine
+		want bool
+	}{
+		{line(440, "wrapped at the edge"), true}, // ends at 535, "word" would not fit
+		{line(72, "12 Main Street"), false},      // an address line, far from the edge
+		{line(440, "as follows here:"), false},
+		{line(72, "a hyphen-"), true},
+	} {
+		if got := softBreak(raw, block, c.prev, next, 10); got != c.want {
+			t.Errorf("after %q: softBreak = %v, want %v", lineText(raw, c.prev), got, c.want)
+		}
+	}
+}
+
+func lineText(raw *bridge.RawPageData, l *bridge.RawLine) string {
+	var b strings.Builder
+	for _, ch := range raw.Chars[l.CharStart : l.CharStart+l.CharCount] {
+		b.WriteRune(ch.Codepoint)
+	}
+	return b.String()
+}
+
+func TestConvertBrokenBullets(t *testing.T) {
+	mono := models.TextStyle{Monospace: true}
+	para := func(spans ...models.Span) models.Block {
+		return models.Block{Type: models.BlockText, Spans: spans}
+	}
+	// as MuPDF reads bullets set in Courier New, Symbol and Wingdings without a
+	// usable ToUnicode map
+	blocks := []models.Block{
+		para(models.Span{Text: "Intro"}),
+		para(models.Span{Text: "o", Style: mono}, models.Span{Text: "Courier bullet"}),
+		para(models.Span{Text: "· Symbol bullet"}),
+		para(models.Span{Text: "\uF0A7"}, models.Span{Text: " Wingdings square"}),
+		para(models.Span{Text: "§ 12 of the Act"}),
+		para(models.Span{Text: "o", Style: mono}, models.Span{Text: " = 5"}),
+		para(models.Span{Text: "Ø"}, models.Span{Text: "Arrow"}),
+	}
+	got := CleanupPage(blocks)
+	if len(got) != 5 {
+		t.Fatalf("got %d blocks, want 5: %+v", len(got), got)
+	}
+	list := got[1]
+	if list.Type != models.BlockList || len(list.Items) != 3 {
+		t.Fatalf("block 1 = %+v, want a list of three items", list)
+	}
+	for i, want := range []string{"Courier bullet", "Symbol bullet", "Wingdings square"} {
+		if text := spansText(list.Items[i].Spans); text != want {
+			t.Errorf("item %d = %q, want %q", i, text, want)
+		}
+	}
+	if got[2].Type != models.BlockText || got[3].Type != models.BlockText {
+		t.Errorf("section sign before a number and monospace o before code became list items")
+	}
+	if got[4].Type != models.BlockList || spansText(got[4].Items[0].Spans) != "Arrow" {
+		t.Errorf("block 4 = %+v, want a list", got[4])
+	}
+
+	opts := DefaultCleanup
+	opts.BrokenBullets = false
+	if got := CleanupPageWithOptions([]models.Block{para(models.Span{Text: "· item"})}, opts); got[0].Type != models.BlockText {
+		t.Error("converted with BrokenBullets off")
+	}
+}
+
+func TestDemoteInlineBold(t *testing.T) {
+	block := func(bbox models.BBox, text string, bold bool) *blockInfo {
+		info := &blockInfo{BBox: bbox, AvgFontSize: 10, LineCount: 1, Text: text, TextChars: len(text)}
+		if bold {
+			info.BoldRatio = 1
+		}
+		classifyBlock(info, 10, DefaultHeuristics)
+		return info
+	}
+	tests := []struct {
+		name   string
+		blocks []*blockInfo
+	}{
+		{"beside text on its line", []*blockInfo{
+			block(models.BBox{72, 100, 130, 112}, "FibrumPDF", true),
+			block(models.BBox{133, 100, 500, 112}, "converts documents to JSON", false),
+		}},
+		{"after a sentence cut short", []*blockInfo{
+			block(models.BBox{72, 100, 500, 124}, "The tool is called", false),
+			block(models.BBox{72, 126, 130, 138}, "FibrumPDF", true),
+		}},
+		{"before a lowercase continuation", []*blockInfo{
+			block(models.BBox{72, 100, 130, 112}, "FibrumPDF", true),
+			block(models.BBox{72, 114, 500, 138}, "converts documents to JSON.", false),
+		}},
+		{"indented off-centre", []*blockInfo{
+			block(models.BBox{110, 100, 170, 112}, "Remember", true),
+			block(models.BBox{72, 114, 500, 138}, "That this is body text.", false),
+		}},
+	}
+	for _, tt := range tests {
+		bold := tt.blocks[0]
+		if bold.BoldRatio == 0 {
+			bold = tt.blocks[1]
+		}
+		if bold.Type != models.BlockHeading {
+			t.Fatalf("%s: not a heading to begin with", tt.name)
+		}
+		demoteInlineBold(tt.blocks, DefaultHeuristics)
+		if bold.Type != models.BlockText {
+			t.Errorf("%s: still a heading", tt.name)
+		}
+	}
+
+	heading := []*blockInfo{
+		block(models.BBox{72, 80, 500, 104}, "The section before ends here.", false),
+		block(models.BBox{72, 120, 140, 132}, "Installation", true),
+		block(models.BBox{72, 140, 500, 164}, "Run the installer for your platform.", false),
+	}
+	demoteInlineBold(heading, DefaultHeuristics)
+	if heading[1].Type != models.BlockHeading {
+		t.Error("a standalone bold heading was demoted")
+	}
+	off := DefaultHeuristics
+	off.BoldHeadingContext = 0
+	inline := []*blockInfo{block(models.BBox{72, 100, 130, 112}, "FibrumPDF", true), block(models.BBox{133, 100, 500, 112}, "converts documents", false)}
+	if demoteInlineBold(inline, off); inline[0].Type != models.BlockHeading {
+		t.Error("demoted with bold_heading_context 0")
+	}
+}
+
+func TestResolveSoftHyphens(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"infor\u00admation"}, []string{"information"}},
+		{[]string{"infor\u00ad\nmation age"}, []string{"information age"}},
+		{[]string{"infor\u00ad ", "mation"}, []string{"infor", "mation"}},
+		{[]string{"the infor\u00ad"}, []string{"the infor-"}},
+		{[]string{"ISO\u00ad 9001"}, []string{"ISO 9001"}},
+		{[]string{"a\u00adb\u00adc"}, []string{"abc"}},
+	}
+	for _, tc := range tests {
+		spans := make([]models.Span, len(tc.in))
+		for i, s := range tc.in {
+			spans[i].Text = s
+		}
+		resolveSoftHyphens(spans)
+		var got []string
+		for _, s := range spans {
+			got = append(got, s.Text)
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	blocks := CleanupPageWithOptions([]models.Block{{Type: models.BlockText, Spans: []models.Span{{Text: "infor\u00admation"}}}}, CleanupOpts{})
+	if blocks[0].Spans[0].Text != "infor\u00admation" {
+		t.Errorf("soft hyphen resolved without SoftHyphens: %q", blocks[0].Spans[0].Text)
+	}
+}
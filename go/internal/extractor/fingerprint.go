@@ -0,0 +1,94 @@
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+const shingleSize = 3
+
+// Fingerprints sets a fingerprint on every page and returns the fingerprint of
+// the whole document. Both cover only the words, lowercased and stripped of
+// punctuation, so reflowed, re-paginated or re-typeset copies of the same text
+// hash alike.
+func Fingerprints(pages []models.Page) *models.Fingerprint {
+	var all []string
+	for p := range pages {
+		words := pageWords(pages[p])
+		pages[p].Fingerprint = fingerprintOf(words)
+		all = append(all, words...)
+	}
+	return fingerprintOf(all)
+}
+
+// SimhashDistance returns how many bits two Simhash values differ in; copies
+// with small edits stay within about 3 of each other.
+func SimhashDistance(a, b string) (int, error) {
+	var x, y uint64
+	if _, err := fmt.Sscanf(a, "%x", &x); err != nil {
+		return 0, err
+	}
+	if _, err := fmt.Sscanf(b, "%x", &y); err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
+
+func pageWords(page models.Page) []string {
+	var words []string
+	add := func(spans []models.Span) {
+		words = append(words, strings.FieldsFunc(strings.ToLower(spansText(spans)), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	for _, b := range page.Data {
+		add(b.Spans)
+		for _, item := range b.Items {
+			add(item.Spans)
+		}
+		for _, row := range b.Rows {
+			for _, cell := range row.Cells {
+				add(cell.Spans)
+			}
+		}
+	}
+	return words
+}
+
+func fingerprintOf(words []string) *models.Fingerprint {
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return &models.Fingerprint{Hash: hex.EncodeToString(sum[:]), Simhash: fmt.Sprintf("%016x", simhash(words))}
+}
+
+// simhash folds the hashes of overlapping word shingles into 64 bits, each set
+// where most shingles have it set.
+func simhash(words []string) uint64 {
+	var weights [64]int
+	n := max(len(words)-shingleSize+1, 1)
+	for i := 0; i < n && i < len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingleSize, len(words))], " ")))
+		v := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if v&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var out uint64
+	for bit, w := range weights {
+		if w > 0 {
+			out |= 1 << bit
+		}
+	}
+	return out
+}
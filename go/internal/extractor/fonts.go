@@ -0,0 +1,54 @@
+package extractor
+
+import (
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// fontName is name without the ABCDEF+ prefix that marks a subset.
+func fontName(name string) string {
+	if len(name) > 7 && name[6] == '+' && strings.ToUpper(name[:6]) == name[:6] {
+		return name[7:]
+	}
+	return name
+}
+
+// pageFonts lists the fonts of raw's text for ReportFonts, each on raw's page.
+func pageFonts(raw *bridge.RawPageData) []models.Font {
+	var fonts []models.Font
+	for _, f := range raw.Fonts {
+		fonts = append(fonts, models.Font{Name: fontName(f.Name), Embedded: f.Embedded, Substituted: f.Substituted, Pages: []int{raw.PageNumber}})
+	}
+	return fonts
+}
+
+// ReportFonts gathers the fonts each page lists for its own text into one
+// report of which fonts the document's text is in, whether they are embedded
+// or were substituted, and on which pages. A font embedded as subsets on
+// several pages is listed once.
+func ReportFonts(pages []models.Page) []models.Font {
+	type fontKey struct {
+		name                  string
+		embedded, substituted bool
+	}
+	var report []models.Font
+	index := map[fontKey]int{}
+	for p := range pages {
+		for _, f := range pages[p].Fonts {
+			key := fontKey{f.Name, f.Embedded, f.Substituted}
+			i, ok := index[key]
+			if !ok {
+				i, index[key] = len(report), len(report)
+				report = append(report, models.Font{Name: f.Name, Embedded: f.Embedded, Substituted: f.Substituted})
+			}
+			for _, n := range f.Pages {
+				if ps := report[i].Pages; len(ps) == 0 || ps[len(ps)-1] != n {
+					report[i].Pages = append(report[i].Pages, n)
+				}
+			}
+		}
+	}
+	return report
+}
@@ -0,0 +1,110 @@
+package extractor
+
+import (
+	"image"
+	"image/color"
+	_ "image/png"
+	"math/bits"
+	"os"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// ImageFilter drops figures too small to carry content, such as rules, bullets
+// and spacer images. Sizes are as drawn on the page, in points; zero keeps all.
+type ImageFilter struct {
+	MinWidth  float32
+	MinHeight float32
+	MinArea   float32
+	Dedup     bool // point repeats of an image at its first occurrence, see DedupImages
+}
+
+func (f ImageFilter) keeps(r bridge.Rect) bool {
+	return r.Width() >= f.MinWidth && r.Height() >= f.MinHeight && r.Width()*r.Height() >= f.MinArea
+}
+
+// imageHashDistance is how many bits two image hashes may differ in for the
+// images to count as the same; re-encoded or slightly rescaled copies of a
+// logo stay well within it.
+const imageHashDistance = 4
+
+// DedupImages points every figure whose image looks like one seen earlier in
+// the document at that earlier file, so a logo repeated on every page is kept
+// once and referenced from each page. Images are compared by a perceptual
+// hash, not their bytes. Figures without a saved image, or whose image cannot
+// be decoded, are left alone; no files are removed.
+func DedupImages(pages []models.Page) {
+	type seen struct {
+		hash uint64
+		path string
+	}
+	var unique []seen
+	for p := range pages {
+		for b := range pages[p].Data {
+			block := &pages[p].Data[b]
+			if block.Type != models.BlockFigure || block.Image == "" {
+				continue
+			}
+			hash, err := imageHash(block.Image)
+			if err != nil {
+				Logger.Debug("could not hash image", "image", block.Image, "err", err)
+				continue
+			}
+			found := false
+			for _, u := range unique {
+				if bits.OnesCount64(hash^u.hash) <= imageHashDistance {
+					block.Image, found = u.path, true
+					break
+				}
+			}
+			if !found {
+				unique = append(unique, seen{hash, block.Image})
+			}
+		}
+	}
+}
+
+func imageHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return dHash(img), nil
+}
+
+// dHash is the difference hash of img: shrunk to 9x8 grey cells, one bit per
+// pair of horizontal neighbours, set where the left cell is brighter.
+func dHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	var cells [h][w]float64
+	r := img.Bounds()
+	for y := 0; y < h; y++ {
+		y0, y1 := r.Min.Y+y*r.Dy()/h, r.Min.Y+(y+1)*r.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := r.Min.X+x*r.Dx()/w, r.Min.X+(x+1)*r.Dx()/w
+			var sum, n float64
+			for py := y0; py < max(y1, y0+1); py++ {
+				for px := x0; px < max(x1, x0+1); px++ {
+					sum += float64(color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y)
+					n++
+				}
+			}
+			cells[y][x] = sum / n
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x+1 < w; x++ {
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1 << (y*(w-1) + x)
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,255 @@
+package extractor
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+type glyph struct {
+	r    rune
+	bbox models.BBox
+}
+
+// segment is a run of a line's text without a wide gap in it. Forms and
+// receipts set labels apart from their values with such gaps, so they split
+// a line into its fields.
+type segment struct {
+	glyphs []glyph
+	bbox   models.BBox
+	size   float32
+	used   bool
+}
+
+func (s *segment) text() string { return glyphText(s.glyphs) }
+
+func glyphText(glyphs []glyph) string {
+	var b strings.Builder
+	for _, g := range glyphs {
+		b.WriteRune(g.r)
+	}
+	return strings.TrimSpace(text.NormalizeText(b.String()))
+}
+
+func glyphBBox(glyphs []glyph) models.BBox {
+	var bbox models.BBox
+	first := true
+	for _, g := range glyphs {
+		if unicode.IsSpace(g.r) {
+			continue
+		}
+		if first {
+			bbox, first = g.bbox, false
+		} else {
+			bbox = bbox.Union(g.bbox)
+		}
+	}
+	return bbox
+}
+
+// lineSegments splits every line of the page at horizontal gaps wider than
+// twice the font size, leaving out lines within skip, the page's tables.
+func lineSegments(raw *bridge.RawPageData, sp text.Spacing, skip []models.BBox) []*segment {
+	var segs []*segment
+	for li := range raw.Lines {
+		line := &raw.Lines[li]
+		cx, cy := (line.BBox.X0+line.BBox.X1)/2, (line.BBox.Y0+line.BBox.Y1)/2
+		inTable := false
+		for _, t := range skip {
+			if cx >= t.X0() && cx <= t.X1() && cy >= t.Y0() && cy <= t.Y1() {
+				inTable = true
+				break
+			}
+		}
+		if inTable {
+			continue
+		}
+		var cur *segment
+		var prev, lastInk *bridge.RawChar
+		flush := func() {
+			for cur != nil && len(cur.glyphs) > 0 && unicode.IsSpace(cur.glyphs[len(cur.glyphs)-1].r) {
+				cur.glyphs = cur.glyphs[:len(cur.glyphs)-1]
+			}
+			if cur != nil && cur.text() != "" {
+				cur.bbox = glyphBBox(cur.glyphs)
+				segs = append(segs, cur)
+			}
+			cur = nil
+		}
+		for ci := 0; ci < line.CharCount; ci++ {
+			ch := &raw.Chars[line.CharStart+ci]
+			if ch.Codepoint == 0 {
+				continue
+			}
+			if !unicode.IsSpace(ch.Codepoint) {
+				if lastInk != nil && ch.BBox.X0-lastInk.BBox.X1 > 2*ch.Size {
+					flush()
+					prev = nil
+				}
+				lastInk = ch
+			}
+			if cur == nil {
+				if unicode.IsSpace(ch.Codepoint) {
+					continue
+				}
+				cur = &segment{size: ch.Size}
+			}
+			if missingSpace(prev, ch, sp) {
+				cur.glyphs = append(cur.glyphs, glyph{' ', models.BBox{}})
+			}
+			prev = ch
+			cur.glyphs = append(cur.glyphs, glyph{ch.Codepoint, models.BBox{ch.BBox.X0, ch.BBox.Y0, ch.BBox.X1, ch.BBox.Y1}})
+		}
+		flush()
+	}
+	sort.SliceStable(segs, func(i, j int) bool {
+		if a, b := segs[i].bbox, segs[j].bbox; !sameRow(a, b) {
+			return a.Y0() < b.Y0()
+		}
+		return segs[i].bbox.X0() < segs[j].bbox.X0()
+	})
+	return segs
+}
+
+// sameRow reports whether two boxes overlap vertically by at least half the
+// height of the shorter one.
+func sameRow(a, b models.BBox) bool {
+	overlap := min(a.Y1(), b.Y1()) - max(a.Y0(), b.Y0())
+	return overlap >= min(a.Height(), b.Height())/2
+}
+
+// labelKey returns the label a segment opens with, up to a colon, and where
+// the colon is. Labels are short, contain a letter and don't end in a digit,
+// which keeps times like 10:30 and URLs out.
+func labelKey(glyphs []glyph) (string, int) {
+	for i, g := range glyphs {
+		if g.r != ':' && g.r != '：' {
+			continue
+		}
+		key := glyphText(glyphs[:i])
+		if i+2 < len(glyphs) && glyphs[i+1].r == '/' && glyphs[i+2].r == '/' {
+			return "", -1
+		}
+		if isShortLabel(key, 6) {
+			return key, i
+		}
+		return "", -1
+	}
+	return "", -1
+}
+
+func isShortLabel(s string, maxWords int) bool {
+	if s == "" || utf8.RuneCountInString(s) > 40 || len(strings.Fields(s)) > maxWords {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0 && !unicode.IsDigit(last)
+}
+
+// isAmount reports whether s is a number, optionally with a currency, sign,
+// percent or parentheses, as totals on receipts are.
+func isAmount(s string) bool {
+	s = strings.Trim(s, " ()+-−%$€£¥")
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(s), "USD"), "EUR"))
+	digits := 0
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case r == ',' || r == '.' || r == ' ' || r == '\'':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+const maxValueChars = 60
+
+// ExtractKeyValues pairs labels with their values on a form-like page. A label
+// is a short text ending in a colon, with its value after the colon on the
+// same line, else the nearest text to its right on the same row, else the text
+// just below it and aligned with it. A short label without a colon is paired
+// with an amount on its right, as on receipts. Text within tables is left out.
+func ExtractKeyValues(raw *bridge.RawPageData, sp text.Spacing, tables []models.BBox) []models.KeyValue {
+	segs := lineSegments(raw, sp, tables)
+	var out []models.KeyValue
+	isLabel := func(s *segment) bool {
+		key, colon := labelKey(s.glyphs)
+		return key != "" && glyphText(s.glyphs[colon+1:]) == ""
+	}
+	for _, s := range segs {
+		if s.used {
+			continue
+		}
+		key, colon := labelKey(s.glyphs)
+		if value := s.glyphs[colon+1:]; key != "" && glyphText(value) != "" {
+			if v := glyphText(value); utf8.RuneCountInString(v) <= maxValueChars {
+				s.used = true
+				out = append(out, models.KeyValue{Key: key, Value: v, KeyBBox: glyphBBox(s.glyphs[:colon+1]), ValueBBox: glyphBBox(value)})
+			}
+			continue
+		}
+		var value *segment
+		if key != "" {
+			value = rightOf(segs, s, isLabel)
+			if value == nil {
+				value = below(segs, s, isLabel)
+			}
+		} else if txt := s.text(); isShortLabel(txt, 4) && !isAmount(txt) {
+			if v := rightOf(segs, s, isLabel); v != nil && isAmount(v.text()) {
+				key, value = txt, v
+			}
+		}
+		if value == nil || utf8.RuneCountInString(value.text()) > maxValueChars {
+			continue
+		}
+		s.used, value.used = true, true
+		out = append(out, models.KeyValue{Key: key, Value: value.text(), KeyBBox: s.bbox, ValueBBox: value.bbox})
+	}
+	return out
+}
+
+// rightOf returns the nearest unused segment to the right of label on its row
+// that isn't a label itself.
+func rightOf(segs []*segment, label *segment, isLabel func(*segment) bool) *segment {
+	var best *segment
+	for _, s := range segs {
+		if s == label || s.used || s.bbox.X0() < label.bbox.X1()-1 || !sameRow(s.bbox, label.bbox) {
+			continue
+		}
+		if best == nil || s.bbox.X0() < best.bbox.X0() {
+			best = s
+		}
+	}
+	if best == nil || isLabel(best) {
+		return nil
+	}
+	return best
+}
+
+// below returns the unused segment on the next line down, starting within a
+// font size of label's left edge, unless it is a label itself.
+func below(segs []*segment, label *segment, isLabel func(*segment) bool) *segment {
+	var best *segment
+	for _, s := range segs {
+		if s == label || s.used || s.bbox.Y0() < label.bbox.Y1()-1 || s.bbox.Y0()-label.bbox.Y1() > label.bbox.Height()*1.5 {
+			continue
+		}
+		if d := s.bbox.X0() - label.bbox.X0(); d < -label.size || d > label.size {
+			continue
+		}
+		if best == nil || s.bbox.Y0() < best.bbox.Y0() {
+			best = s
+		}
+	}
+	if best == nil || isLabel(best) {
+		return nil
+	}
+	return best
+}
@@ -0,0 +1,79 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+type field struct {
+	x    float32
+	text string
+}
+
+// formPage lays out one line per row, each made of fields starting at their x,
+// in 10pt glyphs 5pt wide.
+func formPage(rows map[float32][]field) *bridge.RawPageData {
+	raw := &bridge.RawPageData{PageBounds: bridge.Rect{X1: 612, Y1: 792}}
+	for y := float32(0); y < 792; y++ {
+		fields, ok := rows[y]
+		if !ok {
+			continue
+		}
+		line := bridge.RawLine{CharStart: len(raw.Chars)}
+		for _, f := range fields {
+			x := f.x
+			for _, r := range f.text {
+				raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: y, X1: x + 5, Y1: y + 10}, OriginX: x, OriginY: y + 8, Advance: 5})
+				x += 5
+			}
+		}
+		first, last := raw.Chars[line.CharStart], raw.Chars[len(raw.Chars)-1]
+		line.BBox = bridge.Rect{X0: first.BBox.X0, Y0: y, X1: last.BBox.X1, Y1: y + 10}
+		line.CharCount = len(raw.Chars) - line.CharStart
+		raw.Lines = append(raw.Lines, line)
+	}
+	return raw
+}
+
+func TestExtractKeyValues(t *testing.T) {
+	raw := formPage(map[float32][]field{
+		100: {{72, "Invoice No: 12345"}},
+		120: {{72, "Date:"}, {200, "2024-03-01"}},
+		140: {{72, "Bill To:"}},
+		152: {{72, "ACME Corp"}},
+		180: {{72, "Meeting at 10:30 today"}},
+		200: {{72, "Ship To:"}, {300, "Terms:"}, {400, "Net 30"}},
+		220: {{72, "Widgets"}, {300, "Blue"}},
+		240: {{72, "Total"}, {400, "$1,234.50"}},
+	})
+	got := map[string]string{}
+	for _, kv := range ExtractKeyValues(raw, text.DefaultSpacing, nil) {
+		got[kv.Key] = kv.Value
+	}
+	want := map[string]string{
+		"Invoice No": "12345",
+		"Date":       "2024-03-01",
+		"Bill To":    "ACME Corp",
+		"Terms":      "Net 30",
+		"Ship To":    "Widgets",
+		"Total":      "$1,234.50",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestExtractKeyValuesBBoxes(t *testing.T) {
+	raw := formPage(map[float32][]field{100: {{72, "Date: 2024"}}, 120: {{72, "Total:"}, {300, "9.99"}}})
+	kvs := ExtractKeyValues(raw, text.DefaultSpacing, []models.BBox{{60, 115, 400, 135}})
+	if len(kvs) != 1 {
+		t.Fatalf("got %+v, want only the pair outside the table", kvs)
+	}
+	if kvs[0].KeyBBox != (models.BBox{72, 100, 97, 110}) || kvs[0].ValueBBox != (models.BBox{102, 100, 122, 110}) {
+		t.Errorf("bboxes = %v %v", kvs[0].KeyBBox, kvs[0].ValueBBox)
+	}
+}
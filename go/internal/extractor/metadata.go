@@ -0,0 +1,119 @@
+package extractor
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// DetectPaperMetadata looks for a paper's title (the largest centred text in
+// the top half of the page), the author block under it and the abstract, and
+// returns nil when the page has no recognisable title or does not look like a
+// paper: it needs an "Abstract" label, or an email address or affiliation in
+// the author block, so invoices, slides and title pages get none.
+func DetectPaperMetadata(page *models.Page) *models.PaperMetadata {
+	var extent models.BBox
+	for _, b := range page.Data {
+		extent = extent.Union(b.BBox)
+	}
+	if extent.IsEmpty() {
+		return nil
+	}
+	centre, half := (extent.X0()+extent.X1())/2, extent.Y0()+extent.Height()/2
+	centred := func(b models.Block) bool {
+		return geometry.Abs32((b.BBox.X0()+b.BBox.X1())/2-centre) < extent.Width()*0.1
+	}
+	title := -1
+	for i, b := range page.Data {
+		if (b.Type != models.BlockHeading && b.Type != models.BlockText) || b.BBox.Y0() > half || !centred(b) || b.Length < 3 || b.Length > 300 {
+			continue
+		}
+		if title < 0 || b.FontSize > page.Data[title].FontSize+0.5 || (geometry.Abs32(b.FontSize-page.Data[title].FontSize) <= 0.5 && b.BBox.Y0() < page.Data[title].BBox.Y0()) {
+			title = i
+		}
+	}
+	if title < 0 {
+		return nil
+	}
+	meta := &models.PaperMetadata{Title: spansText(page.Data[title].Spans)}
+	end := page.Data[title].BBox.Y1()
+	// a title set over several blocks continues in the next one at the same size
+	for i := title + 1; i < len(page.Data); i++ {
+		b := page.Data[i]
+		if geometry.Abs32(b.FontSize-page.Data[title].FontSize) > 0.5 || b.BBox.Y0()-end > b.FontSize*1.5 {
+			break
+		}
+		meta.Title += " " + spansText(b.Spans)
+		end, title = b.BBox.Y1(), i
+	}
+	meta.Title = strings.Join(strings.Fields(meta.Title), " ")
+
+	var authors []string
+	collecting, abstract := true, false
+	for i := title + 1; i < len(page.Data); i++ {
+		b := page.Data[i]
+		txt := strings.TrimSpace(spansText(b.Spans))
+		if body, ok := abstractText(txt); ok {
+			meta.Abstract, abstract = body, true
+			if body == "" {
+				meta.Abstract = followingText(page.Data[i+1:])
+			}
+			break
+		}
+		// authors and affiliations sit centred and narrower than the body text
+		collecting = collecting && b.Type == models.BlockText && centred(b) && b.BBox.Width() < extent.Width()*0.8 && b.BBox.Y0() >= end
+		if collecting && len(authors) < 4 {
+			authors = append(authors, txt)
+		}
+	}
+	if !abstract && !slices.ContainsFunc(authors, isAffiliation) {
+		return nil
+	}
+	meta.Authors = strings.Join(authors, "\n")
+	return meta
+}
+
+var affiliationWords = []string{
+	"university", "universität", "université", "universidad", "università", "universidade",
+	"institute", "institut", "instituto", "department", "dept.", "laboratory", "laboratories",
+	"college", "school of", "faculty of", "research center", "research centre",
+}
+
+// isAffiliation reports whether a line of an author block holds an email
+// address or names an institution.
+func isAffiliation(line string) bool {
+	for _, f := range strings.Fields(line) {
+		if at := strings.IndexByte(f, '@'); at > 0 && strings.Contains(f[at:], ".") {
+			return true
+		}
+	}
+	line = strings.ToLower(line)
+	return slices.ContainsFunc(affiliationWords, func(w string) bool { return strings.Contains(line, w) })
+}
+
+// abstractText reports whether txt opens the abstract, returning any text that
+// follows the label on the same block ("Abstract—We present...").
+func abstractText(txt string) (string, bool) {
+	if len(txt) < 8 || !strings.EqualFold(txt[:8], "abstract") {
+		return "", false
+	}
+	if r, _ := utf8.DecodeRuneInString(txt[8:]); unicode.IsLetter(r) {
+		return "", false
+	}
+	return strings.Join(strings.Fields(strings.TrimLeft(txt[8:], " .:-—–\n")), " "), true
+}
+
+func followingText(blocks []models.Block) string {
+	var parts []string
+	for _, b := range blocks {
+		if b.Type != models.BlockText {
+			break
+		}
+		parts = append(parts, strings.Join(strings.Fields(spansText(b.Spans)), " "))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,86 @@
+package extractor
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/column"
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// bandBreaks are the middles of full-width elements that are not among
+// blocks: rules across the page and images left out of the output, such as
+// those too small for the image filter. Columns must not be read across them
+// any more than across a full-width figure that is a block; the scanned image
+// a page is made of is not one.
+func bandBreaks(raw *bridge.RawPageData, blocks []*blockInfo, scan int, images ImageFilter) []float32 {
+	if len(blocks) == 0 {
+		return nil
+	}
+	minX, maxX := blocks[0].BBox.X0(), blocks[0].BBox.X1()
+	for _, b := range blocks[1:] {
+		minX, maxX = min(minX, b.BBox.X0()), max(maxX, b.BBox.X1())
+	}
+	wide := func(x0, x1 float32) bool { return min(x1, maxX)-max(x0, minX) > (maxX-minX)*0.5 }
+	var breaks []float32
+	for _, e := range raw.Edges {
+		if e.Orientation == 'h' && wide(float32(e.X0), float32(e.X1)) {
+			breaks = append(breaks, float32(e.Y0+e.Y1)/2)
+		}
+	}
+	for i, fig := range raw.Figures {
+		if i != scan && !images.keeps(fig.BBox) && wide(fig.BBox.X0, fig.BBox.X1) {
+			breaks = append(breaks, (fig.BBox.Y0+fig.BBox.Y1)/2)
+		}
+	}
+	return breaks
+}
+
+// orderConfidence says how clearly columns settled the reading order of
+// blocks, from 0 to 1: the share of blocks in bands of several columns that
+// neither straddle columns nor sit beside a block of another band, such as a
+// full-width block overlapping the top of a column. Pages without columns read
+// top to bottom either way and score 1.
+func orderConfidence(blocks []*blockInfo, columns [][]column.Range) float32 {
+	var inColumns, ambiguous int
+	for _, b := range blocks {
+		if b.BandIdx >= len(columns) || len(columns[b.BandIdx]) < 2 {
+			continue
+		}
+		inColumns++
+		if b.ColIdx == 0 {
+			ambiguous++
+			continue
+		}
+		for _, other := range blocks {
+			if in := b.BBox.Intersect(other.BBox); other.BandIdx != b.BandIdx && !in.IsEmpty() && in.Height() > 2 {
+				ambiguous++
+				break
+			}
+		}
+	}
+	if inColumns == 0 {
+		return 1
+	}
+	return float32(math.Round(float64(inColumns-ambiguous)/float64(inColumns)*100) / 100)
+}
+
+// rankTopDown numbers blocks from 1 in plain top-to-bottom order, left to
+// right along a line, whatever order they are in.
+func rankTopDown(blocks []models.Block) {
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		bi, bj := blocks[order[i]].BBox, blocks[order[j]].BBox
+		if math.Abs(float64(bi.Y0()-bj.Y0())) > 2.0 {
+			return bi.Y0() < bj.Y0()
+		}
+		return bi.X0() < bj.X0()
+	})
+	for rank, i := range order {
+		blocks[i].TopDown = rank + 1
+	}
+}
@@ -0,0 +1,119 @@
+package extractor
+
+import (
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+// mergeParagraphBlocks joins the text block at startIdx with the text blocks
+// after it that continue the same paragraph, as MuPDF splits a paragraph into
+// several blocks where its line spacing varies a little. It returns the joined
+// block and the index of the last block taken.
+func mergeParagraphBlocks(blocks []*blockInfo, startIdx int, h Heuristics, sp text.Spacing) (*blockInfo, int) {
+	endIdx := startIdx
+	for endIdx+1 < len(blocks) && continuesParagraph(blocks[startIdx], blocks[endIdx], blocks[endIdx+1], h) {
+		endIdx++
+	}
+	if endIdx == startIdx {
+		return blocks[startIdx], startIdx
+	}
+	merged := *blocks[startIdx]
+	merged.Spans = append([]models.Span(nil), merged.Spans...)
+	var chars float32
+	for _, next := range blocks[startIdx : endIdx+1] {
+		chars += float32(next.TextChars)
+	}
+	if chars == 0 {
+		return blocks[startIdx], startIdx
+	}
+	merged.AvgFontSize, merged.BoldRatio, merged.ItalicRatio, merged.MonoRatio = 0, 0, 0, 0
+	for j, next := range blocks[startIdx : endIdx+1] {
+		weight := float32(next.TextChars) / chars
+		merged.AvgFontSize += next.AvgFontSize * weight
+		merged.BoldRatio += next.BoldRatio * weight
+		merged.ItalicRatio += next.ItalicRatio * weight
+		merged.MonoRatio += next.MonoRatio * weight
+		if j == 0 {
+			continue
+		}
+		merged.Spans, _ = appendContinuation(merged.Spans, next.Spans, sp)
+		merged.BBox = merged.BBox.Union(next.BBox)
+		merged.LineCount += next.LineCount
+		merged.Lines, merged.Chars = append(merged.Lines, next.Lines...), append(merged.Chars, next.Chars...)
+		merged.Confidence = min(merged.Confidence, next.Confidence)
+	}
+	merged.Text = text.NormalizeText(spansText(merged.Spans))
+	merged.TextChars = text.CountUnicodeChars(merged.Text)
+	return &merged, endIdx
+}
+
+// continuesParagraph reports whether next carries on the paragraph that
+// started with first and so far ends with prev: both text in the same column,
+// set in the same size and style as first, starting at its left edge and less
+// than h.ParagraphMergeGap font sizes below prev. Paragraphs set without a gap
+// between them are told apart by prev ending a sentence or next's first line
+// being indented, so either keeps them apart.
+func continuesParagraph(first, prev, next *blockInfo, h Heuristics) bool {
+	if h.ParagraphMergeGap <= 0 || next.Type != models.BlockText || prev.Type != models.BlockText || next.ColIdx != first.ColIdx || next.BandIdx != first.BandIdx {
+		return false
+	}
+	size := first.AvgFontSize
+	if text.EndsWithPunctuation(prev.Text) || (len(next.Lines) > 0 && next.Lines[0].BBox.X0()-next.BBox.X0() > size/2) {
+		return false
+	}
+	if geometry.Abs32(next.AvgFontSize-size) > 0.5 || geometry.Abs32(next.BoldRatio-first.BoldRatio) > 0.5 || geometry.Abs32(next.ItalicRatio-first.ItalicRatio) > 0.5 || geometry.Abs32(next.MonoRatio-first.MonoRatio) > 0.5 {
+		return false
+	}
+	gap := next.BBox.Y0() - prev.BBox.Y1()
+	return gap > -size/2 && gap < size*h.ParagraphMergeGap && geometry.Abs32(next.BBox.X0()-first.BBox.X0()) < size/2
+}
+
+// softBreak reports whether the text only wrapped between prev and line, so
+// they join with a space rather than a newline: prev stops short of the right
+// edge of block by less than the first word of line would take, so that word
+// went onto the next line for want of room, or prev ends in a hyphen before a
+// lowercase letter. The lines of an address or a poem end well short of the
+// edge, and a line ending in a colon introduces what follows, so they keep
+// their breaks.
+func softBreak(raw *bridge.RawPageData, block *bridge.RawBlock, prev, line *bridge.RawLine, fontSize float32) bool {
+	switch last, first := lastRune(raw, prev), firstRune(raw, line); {
+	case last == ':':
+		return false
+	case last == '-' && unicode.IsLower(first):
+		return true
+	}
+	return block.BBox.X1-prev.BBox.X1 < firstWordWidth(raw, line)+fontSize/2
+}
+
+func lastRune(raw *bridge.RawPageData, line *bridge.RawLine) rune {
+	for ci := line.CharCount - 1; ci >= 0; ci-- {
+		if r := raw.Chars[line.CharStart+ci].Codepoint; r != 0 && !unicode.IsSpace(r) {
+			return r
+		}
+	}
+	return 0
+}
+
+// firstWordWidth is the width of line up to its first space.
+func firstWordWidth(raw *bridge.RawPageData, line *bridge.RawLine) float32 {
+	var x0, x1 float32
+	started := false
+	for ci := 0; ci < line.CharCount; ci++ {
+		ch := &raw.Chars[line.CharStart+ci]
+		if ch.Codepoint == 0 || unicode.IsSpace(ch.Codepoint) {
+			if started {
+				break
+			}
+			continue
+		}
+		if !started {
+			x0, started = ch.BBox.X0, true
+		}
+		x1 = ch.BBox.X1
+	}
+	return x1 - x0
+}
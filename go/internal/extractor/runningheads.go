@@ -0,0 +1,119 @@
+package extractor
+
+import (
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
+)
+
+type marginHit struct {
+	page, block int
+}
+
+// ExtractRunningHeads finds the running headers and footers of a document:
+// short text in the top or bottom margin that recurs on three pages or more
+// and on at least a quarter of them, such as a chapter title or a date, with
+// any numbers in it allowed to change. Headings and figure captions are never
+// taken for one, however often a section title or "Figure 1" comes back. It
+// takes them out of each page's content, into its Suppressed with
+// KeepSuppressed, and adds their text to the page's HeaderText and
+// FooterText, a line each.
+func ExtractRunningHeads(pages []models.Page, opts Options) {
+	minPages := max(3, (len(pages)+3)/4)
+	if len(pages) < minPages {
+		return
+	}
+	groups := map[string][]marginHit{}
+	for p := range pages {
+		if pages[p].Bounds.IsEmpty() {
+			continue
+		}
+		bounds := pages[p].Bounds
+		margins, page := opts.marginsFor(bridge.Rect{X0: bounds[0], Y0: bounds[1], X1: bounds[2], Y1: bounds[3]}), [4]float32(bounds)
+		seen := map[string]bool{}
+		for b, block := range pages[p].Data {
+			switch {
+			case block.Type == models.BlockTable, block.Type == models.BlockFigure, block.Type == models.BlockHeading:
+				continue
+			case block.Lines > 2 || block.Length >= 200 || text.IsCaption(block.Text()):
+				continue
+			}
+			zone := ""
+			switch {
+			case margins.InTop(block.BBox, page):
+				zone = "top"
+			case margins.InBottom(block.BBox, page):
+				zone = "bottom"
+			default:
+				continue
+			}
+			key := zone + "|" + runningKey(block.Text())
+			if !strings.HasSuffix(key, "|") && !seen[key] {
+				seen[key] = true
+				groups[key] = append(groups[key], marginHit{p, b})
+			}
+		}
+	}
+	drop := map[marginHit]string{}
+	for key, hits := range groups {
+		if len(hits) < minPages {
+			continue
+		}
+		reason := suppressedRunningHead
+		if strings.HasPrefix(key, "bottom|") {
+			reason = suppressedRunningFoot
+		}
+		for _, hit := range hits {
+			drop[hit] = reason
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	Logger.Debug("found running heads", "blocks", len(drop))
+	for p := range pages {
+		page := &pages[p]
+		kept := page.Data[:0]
+		for b, block := range page.Data {
+			reason, ok := drop[marginHit{p, b}]
+			if !ok {
+				kept = append(kept, block)
+				continue
+			}
+			field := &page.HeaderText
+			if reason == suppressedRunningFoot {
+				field = &page.FooterText
+			}
+			*field = strings.TrimPrefix(*field+"\n"+strings.TrimSpace(block.Text()), "\n")
+			if opts.KeepSuppressed {
+				block.Suppressed = reason
+				page.Suppressed = append(page.Suppressed, block)
+			}
+		}
+		page.Data = kept
+	}
+}
+
+// runningKey is what text has in common with the same running head on
+// other pages: its words in lower case, with every run of digits as #.
+func runningKey(s string) string {
+	var b strings.Builder
+	digits := false
+	for _, r := range strings.ToLower(strings.Join(strings.Fields(s), " ")) {
+		if r >= '0' && r <= '9' {
+			if !digits {
+				b.WriteByte('#')
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		b.WriteRune(r)
+	}
+	if !text.HasVisibleContent(b.String()) || strings.Trim(b.String(), "# ") == "" {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package extractor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+)
+
+// unmappedShare is the share of a page's characters without a Unicode
+// mapping above which its text is reported as garbled.
+const unmappedShare = 0.05
+
+// textWarnings notes what is wrong with the text layer of raw: characters
+// whose font has no usable Unicode mapping, which come out as U+FFFD or in the
+// private use area and make garbled text; a page that is an image with no text
+// to extract, which needs OCR; and text that is the OCR layer of such an image,
+// which may hold recognition errors; and fonts MuPDF substituted, whose
+// glyph widths make for wrong spacing. Bullet glyphs left in the private use
+// area are expected and not counted.
+func textWarnings(raw *bridge.RawPageData, bullets BulletGlyphs) []string {
+	var warnings []string
+	unmapped, total := 0, 0
+	for _, ch := range raw.Chars {
+		if ch.Codepoint == 0 || unicode.IsSpace(ch.Codepoint) {
+			continue
+		}
+		total++
+		if ch.Codepoint == unicode.ReplacementChar || (unicode.Is(unicode.Co, ch.Codepoint) && !slices.Contains(bullets.Glyphs, string(ch.Codepoint))) {
+			unmapped++
+		}
+	}
+	if unmapped > 0 && float64(unmapped) > float64(total)*unmappedShare {
+		warnings = append(warnings, fmt.Sprintf("%d of %d characters have no Unicode mapping in their font: the text may be garbled", unmapped, total))
+	}
+	pageArea := raw.PageBounds.Width() * raw.PageBounds.Height()
+	for _, fig := range raw.Figures {
+		if pageArea <= 0 || fig.BBox.Width()*fig.BBox.Height() < pageArea*0.9 {
+			continue
+		}
+		if total == 0 {
+			warnings = append(warnings, "page is an image with no text layer: no text was extracted, it needs OCR")
+		} else {
+			warnings = append(warnings, "page is an image with a text layer over it: the text is from OCR and may hold recognition errors")
+		}
+		break
+	}
+	var substituted []string
+	for _, f := range raw.Fonts {
+		if f.Substituted {
+			substituted = append(substituted, fontName(f.Name))
+		}
+	}
+	if len(substituted) > 0 {
+		warnings = append(warnings, fmt.Sprintf("text in fonts the PDF does not embed, drawn with substitutes (%s): its spacing and any tables may be off", strings.Join(substituted, ", ")))
+	}
+	return warnings
+}
@@ -0,0 +1,113 @@
+package extractor
+
+import (
+	"fmt"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+)
+
+// ignoreZones are the IgnoreZones for every page followed by those for page,
+// in a slice of their own.
+func (o Options) ignoreZones(page int) []geometry.Rect {
+	return append(append([]geometry.Rect(nil), o.IgnoreZones[0]...), o.IgnoreZones[page]...)
+}
+
+// withoutZones copies raw leaving out the chars, ruling lines, links and
+// figures centred in any of zones, so nothing there reaches the output. Lines
+// and blocks shrink to the chars they keep and go if none are left.
+func withoutZones(raw *bridge.RawPageData, zones []geometry.Rect) *bridge.RawPageData {
+	in := func(r bridge.Rect) bool {
+		cx, cy := (r.X0+r.X1)/2, (r.Y0+r.Y1)/2
+		for _, z := range zones {
+			if cx >= z.X0 && cx <= z.X1 && cy >= z.Y0 && cy <= z.Y1 {
+				return true
+			}
+		}
+		return false
+	}
+	out := *raw
+	out.Blocks, out.Lines, out.Chars, out.Edges, out.Links, out.Figures = nil, nil, nil, nil, nil, nil
+	for _, block := range raw.Blocks {
+		if block.Type != 0 {
+			if !in(block.BBox) {
+				out.Blocks = append(out.Blocks, block)
+			}
+			continue
+		}
+		kept := bridge.RawBlock{Type: block.Type, LineStart: len(out.Lines)}
+		for _, line := range raw.Lines[block.LineStart : block.LineStart+block.LineCount] {
+			newLine := bridge.RawLine{CharStart: len(out.Chars)}
+			for _, ch := range raw.Chars[line.CharStart : line.CharStart+line.CharCount] {
+				if in(ch.BBox) {
+					continue
+				}
+				if newLine.CharCount == 0 {
+					newLine.BBox = ch.BBox
+				} else {
+					newLine.BBox = unionRect(newLine.BBox, ch.BBox)
+				}
+				out.Chars = append(out.Chars, ch)
+				newLine.CharCount++
+			}
+			if newLine.CharCount == len(raw.Chars[line.CharStart:line.CharStart+line.CharCount]) {
+				newLine.BBox = line.BBox // untouched
+			}
+			if newLine.CharCount == 0 {
+				continue
+			}
+			if kept.LineCount == 0 {
+				kept.BBox = newLine.BBox
+			} else {
+				kept.BBox = unionRect(kept.BBox, newLine.BBox)
+			}
+			out.Lines = append(out.Lines, newLine)
+			kept.LineCount++
+		}
+		if kept.LineCount > 0 {
+			out.Blocks = append(out.Blocks, kept)
+		}
+	}
+	for _, e := range raw.Edges {
+		if !in(bridge.Rect{X0: float32(e.X0), Y0: float32(e.Y0), X1: float32(e.X1), Y1: float32(e.Y1)}) {
+			out.Edges = append(out.Edges, e)
+		}
+	}
+	for _, l := range raw.Links {
+		if !in(l.Rect) {
+			out.Links = append(out.Links, l)
+		}
+	}
+	for _, f := range raw.Figures {
+		if !in(f.BBox) {
+			out.Figures = append(out.Figures, f)
+		}
+	}
+	return &out
+}
+
+// redact leaves out the content under raw's redaction annotations, which the
+// PDF still holds until they are applied, unless keep is set. The warning says
+// how many characters were under them, and whether they were kept.
+func redact(raw *bridge.RawPageData, keep bool) (*bridge.RawPageData, string) {
+	if len(raw.Redactions) == 0 {
+		return raw, ""
+	}
+	zones := make([]geometry.Rect, len(raw.Redactions))
+	for i, r := range raw.Redactions {
+		zones[i] = geometry.Rect{X0: r.X0, Y0: r.Y0, X1: r.X1, Y1: r.Y1}
+	}
+	redacted := withoutZones(raw, zones)
+	under := len(raw.Chars) - len(redacted.Chars) + raw.RedactedChars
+	switch {
+	case under == 0:
+		return redacted, ""
+	case keep:
+		return raw, fmt.Sprintf("kept %d characters under redaction annotations that were never applied", under)
+	}
+	return redacted, fmt.Sprintf("left out %d characters under redaction annotations that were never applied", under)
+}
+
+func unionRect(a, b bridge.Rect) bridge.Rect {
+	return bridge.Rect{X0: min(a.X0, b.X0), Y0: min(a.Y0, b.Y0), X1: max(a.X1, b.X1), Y1: max(a.Y1, b.Y1)}
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"strconv"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 var rootLogger *slog.Logger
@@ -24,23 +26,10 @@ const (
 )
 
 func init() {
-	var fileHandler *customHandler
-
-	logPath := filepath.Join(tempDir, "pymupdf4llm_c.log")
-	
-	fmt.Printf("writing all logs to: %s\n", logPath)
-
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-
-		fmt.Fprintf(os.Stderr, "%s[logger warning]%s Could not open app.log for writing: %v. Logging to stdout only.\n", colorYellow, colorReset, err)
-	} else {
-		fileHandler = &customHandler{
-			w:          file,
-			level:      slog.LevelDebug,
-			withColors: false,
-		}
-
+	fileHandler := &customHandler{
+		w:          &lazyFile{path: filepath.Join(tempDir, "pymupdf4llm_c.log")},
+		level:      slog.LevelDebug,
+		withColors: false,
 	}
 
 	var stdoutLevel slog.Level
@@ -58,21 +47,56 @@ func init() {
 		withColors: true,
 	}
 
-	var mh multiHandler
-	if fileHandler != nil {
-		mh = multiHandler{
-			file:   fileHandler,
-			stdout: colorHandler,
-		}
-	} else {
+	rootLogger = slog.New(&multiHandler{
+		file:   fileHandler,
+		stdout: colorHandler,
+	})
+}
 
-		mh = multiHandler{
-			file:   nil,
-			stdout: colorHandler,
+// lazyFile opens the log file on the first record written to it, so a process
+// whose records all go to a sink never creates it. If the file cannot be
+// opened, that is reported once and records go to stdout only.
+type lazyFile struct {
+	path string
+	once sync.Once
+	file *os.File
+}
+
+func (l *lazyFile) Write(p []byte) (int, error) {
+	l.once.Do(func() {
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s[logger warning]%s Could not open %s for writing: %v. Logging to stdout only.\n", colorYellow, colorReset, l.path, err)
+			return
 		}
+		l.file = file
+	})
+	if l.file == nil {
+		return len(p), nil
 	}
+	return l.file.Write(p)
+}
+
+// Sink receives log records in place of stdout and the log file: the level,
+// the module that logged it and the message with its attributes appended.
+type Sink func(level slog.Level, module, message string)
 
-	rootLogger = slog.New(&mh)
+type installedSink struct {
+	fn    Sink
+	level slog.Level
+}
+
+var sink atomic.Pointer[installedSink]
+
+// SetSink sends records at level and above to fn, and nothing to stdout or the
+// log file, for embedders with logging of their own. A nil fn restores the
+// default output. Safe to call while logging.
+func SetSink(fn Sink, level slog.Level) {
+	if fn == nil {
+		sink.Store(nil)
+		return
+	}
+	sink.Store(&installedSink{fn, level})
 }
 
 func GetLogger(prefix string) *slog.Logger {
@@ -116,42 +140,7 @@ func (h *customHandler) Handle(_ context.Context, record slog.Record) error {
 
 	timeStr := record.Time.Format("15:04:05")
 
-	var modulePrefix string
-	var argsStr string
-	hasOtherAttrs := false
-
-	for _, a := range h.attrs {
-		if a.Key == "module" {
-			modulePrefix = fmt.Sprintf("%v", a.Value)
-		} else {
-			if !hasOtherAttrs {
-				argsStr = " ("
-				hasOtherAttrs = true
-			} else {
-				argsStr += ", "
-			}
-			argsStr += fmt.Sprintf("%s=%v", a.Key, a.Value)
-		}
-	}
-
-	record.Attrs(func(a slog.Attr) bool {
-		if a.Key == "module" {
-			modulePrefix = fmt.Sprintf("%v", a.Value)
-		} else {
-			if !hasOtherAttrs {
-				argsStr = " ("
-				hasOtherAttrs = true
-			} else {
-				argsStr += ", "
-			}
-			argsStr += fmt.Sprintf("%s=%v", a.Key, a.Value)
-		}
-		return true
-	})
-
-	if hasOtherAttrs {
-		argsStr += ")"
-	}
+	modulePrefix, message := h.describe(record)
 
 	var prefix string
 	if modulePrefix != "" {
@@ -163,24 +152,51 @@ func (h *customHandler) Handle(_ context.Context, record slog.Record) error {
 	}
 
 	if h.withColors {
-		_, err := fmt.Fprintf(h.w, "%s%s%s%s: %s%s [%s]\n",
+		_, err := fmt.Fprintf(h.w, "%s%s%s%s: %s [%s]\n",
 			prefix,
 			color, levelStr, colorReset,
-			record.Message,
-			argsStr,
+			message,
 			timeStr)
 		return err
 	} else {
-		_, err := fmt.Fprintf(h.w, "%s%s: %s%s [%s]\n",
+		_, err := fmt.Fprintf(h.w, "%s%s: %s [%s]\n",
 			prefix,
 			levelStr,
-			record.Message,
-			argsStr,
+			message,
 			timeStr)
 		return err
 	}
 }
 
+// describe splits the module attribute off record and appends the others to
+// its message, as "message (key=value, ...)".
+func (h *customHandler) describe(record slog.Record) (module, message string) {
+	var argsStr string
+	hasOtherAttrs := false
+	add := func(a slog.Attr) bool {
+		if a.Key == "module" {
+			module = fmt.Sprintf("%v", a.Value)
+		} else {
+			if !hasOtherAttrs {
+				argsStr = " ("
+				hasOtherAttrs = true
+			} else {
+				argsStr += ", "
+			}
+			argsStr += fmt.Sprintf("%s=%v", a.Key, a.Value)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	record.Attrs(add)
+	if hasOtherAttrs {
+		argsStr += ")"
+	}
+	return module, record.Message + argsStr
+}
+
 func (h *customHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	newAttrs := make([]slog.Attr, len(h.attrs)+len(attrs))
 	copy(newAttrs, h.attrs)
@@ -212,11 +228,21 @@ type multiHandler struct {
 }
 
 func (mh *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return mh.file.Enabled(ctx, level) || mh.stdout.Enabled(ctx, level)
+	if s := sink.Load(); s != nil {
+		return level >= s.level
+	}
+	return (mh.file != nil && mh.file.Enabled(ctx, level)) || mh.stdout.Enabled(ctx, level)
 }
 
 func (mh *multiHandler) Handle(ctx context.Context, record slog.Record) error {
-	if mh.file.Enabled(ctx, record.Level) {
+	if s := sink.Load(); s != nil {
+		if record.Level >= s.level {
+			module, message := mh.stdout.(*customHandler).describe(record)
+			s.fn(record.Level, module, message)
+		}
+		return nil
+	}
+	if mh.file != nil && mh.file.Enabled(ctx, record.Level) {
 		if err := mh.file.Handle(ctx, record); err != nil {
 			return err
 		}
@@ -232,15 +258,17 @@ func (mh *multiHandler) Handle(ctx context.Context, record slog.Record) error {
 }
 
 func (mh *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &multiHandler{
-		file:   mh.file.WithAttrs(attrs),
-		stdout: mh.stdout.WithAttrs(attrs),
+	next := &multiHandler{stdout: mh.stdout.WithAttrs(attrs)}
+	if mh.file != nil {
+		next.file = mh.file.WithAttrs(attrs)
 	}
+	return next
 }
 
 func (mh *multiHandler) WithGroup(name string) slog.Handler {
-	return &multiHandler{
-		file:   mh.file.WithGroup(name),
-		stdout: mh.stdout.WithGroup(name),
+	next := &multiHandler{stdout: mh.stdout.WithGroup(name)}
+	if mh.file != nil {
+		next.file = mh.file.WithGroup(name)
 	}
+	return next
 }
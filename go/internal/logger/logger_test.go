@@ -0,0 +1,27 @@
+package logger
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestSetSink(t *testing.T) {
+	type entry struct {
+		level           slog.Level
+		module, message string
+	}
+	var got []entry
+	SetSink(func(level slog.Level, module, message string) {
+		got = append(got, entry{level, module, message})
+	}, slog.LevelInfo)
+	defer SetSink(nil, 0)
+
+	log := GetLogger("test")
+	log.Debug("dropped")
+	log.Warn("kept", "page", 3)
+
+	want := []entry{{slog.LevelWarn, "test", "kept (page=3)"}}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("sink got %v, want %v", got, want)
+	}
+}
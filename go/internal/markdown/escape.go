@@ -0,0 +1,159 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Text from a PDF is not Markdown, so characters it would take as syntax are
+// escaped where they would be, and only there, to keep the output readable:
+// a * or ` anywhere, a _ or ~ that could open or close emphasis, a ] that
+// would end a link, a < that would start an HTML tag and an & that would start
+// an entity, and at the start of a line a #, > or + that would make it a
+// heading, quote or list item, the . or ) after a number that would make it
+// an ordered one, or a line of - or = that would underline the one before it.
+// Lines indented four spaces or more, which would be code, lose the indent.
+// Bullets stay list items, as normalizeBullets makes them.
+
+var (
+	entity      = regexp.MustCompile(`^&(#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	atxHeading  = regexp.MustCompile(`^#{1,6}(\s|$)`)
+	underline   = regexp.MustCompile(`^(-+|=+)\s*$`)
+	orderedItem = regexp.MustCompile(`^(\d{1,9})([.)])(\s|$)`)
+	closingHash = regexp.MustCompile(`(^|\s)(#+)\s*$`)
+)
+
+// escaping says what escapeInline escapes besides what it always does.
+type escaping int
+
+const (
+	escapeBrackets escaping = 1 << iota // every [ and ], for link text and image alt text
+	escapePipes                         // every |, for table cells
+)
+
+// escapeInline escapes the characters of s, text inside a line, that Markdown
+// would take as inline syntax.
+func escapeInline(s string, extra escaping) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		var prev, next rune // 0 at the ends of s
+		if i > 0 {
+			prev = rs[i-1]
+		}
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+		switch {
+		case r == '*' || r == '`':
+			b.WriteByte('\\')
+		case r == '\\' && (next == 0 || isASCIIPunct(next)):
+			b.WriteByte('\\')
+		case r == '_' && (!isWordRune(prev) || !isWordRune(next)):
+			b.WriteByte('\\')
+		case r == '~' && next != 0 && !unicode.IsSpace(next):
+			b.WriteByte('\\')
+		case r == '[' && extra&escapeBrackets != 0:
+			b.WriteByte('\\')
+		case r == ']' && (extra&escapeBrackets != 0 || next == '(' || next == '[' || next == ':'):
+			b.WriteByte('\\')
+		case r == '|' && extra&escapePipes != 0:
+			b.WriteByte('\\')
+		case r == '<' && (unicode.IsLetter(next) || next == '/' || next == '!' || next == '?'):
+			b.WriteString("&lt;")
+			continue
+		case r == '&' && entity.MatchString(string(rs[i:])):
+			b.WriteString("&amp;")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeLines escapes the starts of the lines of s, inline text already
+// escaped, that Markdown would take as a block of their own.
+func escapeLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, ln := range lines {
+		trimmed := strings.TrimLeft(ln, " \t")
+		indent := ln[:len(ln)-len(trimmed)]
+		if width := len(indent) + 3*strings.Count(indent, "\t"); width >= 4 {
+			indent = ""
+		}
+		lines[i] = indent + trimmed
+		switch {
+		case atxHeading.MatchString(trimmed), strings.HasPrefix(trimmed, ">"), strings.HasPrefix(trimmed, "+ "), trimmed == "+":
+			lines[i] = indent + `\` + trimmed
+		case underline.MatchString(trimmed):
+			lines[i] = indent + `\` + trimmed
+		case orderedItem.MatchString(trimmed):
+			n := orderedItem.FindStringSubmatchIndex(trimmed)[3]
+			lines[i] = indent + trimmed[:n] + `\` + trimmed[n:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeHeading keeps the escaped text s of a heading on its one line, and
+// its trailing #s from being taken for a closing sequence.
+func escapeHeading(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if m := closingHash.FindStringSubmatchIndex(s); m != nil {
+		s = s[:m[4]] + `\` + s[m[4]:]
+	}
+	return s
+}
+
+// codeSpan puts s in backticks, more of them than any run in s.
+func codeSpan(s string) string {
+	run, longest := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// plainText undoes the styling and escaping joinSpans gives text, for where
+// it is needed as it reads, such as a heading's anchor.
+func plainText(md string) string {
+	var b strings.Builder
+	for i := 0; i < len(md); i++ {
+		switch c := md[i]; {
+		case c == '\\' && i+1 < len(md) && isASCIIPunct(rune(md[i+1])):
+			i++
+			b.WriteByte(md[i])
+		case strings.HasPrefix(md[i:], "&lt;"):
+			b.WriteByte('<')
+			i += 3
+		case strings.HasPrefix(md[i:], "&amp;"):
+			b.WriteByte('&')
+			i += 4
+		case c == '*' || c == '`' || c == '^' || strings.HasPrefix(md[i:], "~~"):
+			if c == '~' {
+				i++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isASCIIPunct(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsPunct(r) || strings.ContainsRune("$+<=>^`|~", r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
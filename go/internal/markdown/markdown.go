@@ -0,0 +1,416 @@
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// Rendering mirrors fibrum_pdf/_block_converter.py so the CLI and the Python
+// package produce the same Markdown for the same blocks.
+
+const (
+	bullets = "•‣⁃⁌⁍∙▪▫●○◦■□▶▸◆◇♦➤\uf0b7\ufffd"
+	punct   = " \n\t.,;:)]/\\-?!"
+)
+
+var (
+	fmtMarkers  = []string{"**", "*", "`", "~~"}
+	citeNumbers = regexp.MustCompile(`^\d+[,\s\d]*$`)
+)
+
+// Options control how blocks are rendered.
+type Options struct {
+	FigurePlaceholders bool // render figures as <!-- figure: caption --> comments instead of image links
+	TOC                bool // start documents with a table of contents of their headings, see TOC
+	KeepListMarkers    bool // start list items with their marker as printed, such as "▪" or "iv.", instead of "-" or their number
+	// ListMarkers gives the Markdown marker list items are rendered with, one
+	// of ListStyles, by their marker as printed, such as "➢", or by the form of
+	// their numbering: "1." for numbers, "a." and "A." for letters, "i." and
+	// "I." for roman numerals, each with "." or ")". It takes precedence over
+	// KeepListMarkers.
+	ListMarkers map[string]string
+	Tables      TableStyle // how tables are rendered, see TableStyle
+}
+
+// ListStyles are the markers ListMarkers can map to: the bullets of
+// unordered lists, and ordered lists numbered from 1 with either separator.
+var ListStyles = []string{"-", "*", "+", "1.", "1)"}
+
+var DefaultOptions = Options{}
+
+// Document joins the pages' Markdown with horizontal rules between pages.
+func Document(pages []models.Page) string {
+	return DocumentWithOptions(pages, DefaultOptions)
+}
+
+func DocumentWithOptions(pages []models.Page, opts Options) string {
+	var parts []string
+	if opts.TOC {
+		if toc := TOC(pages); toc != "" {
+			parts = append(parts, toc)
+		}
+	}
+	for _, p := range pages {
+		if md := PageWithOptions(p, opts); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	return strings.Join(parts, "\n---\n\n")
+}
+
+// TOC is a nested list of the headings of pages, indented by level, each
+// linking to the anchor GitHub and most Markdown renderers give the heading
+// when they render it, for documents whose PDF has no outline. It is "" if
+// there are no headings.
+func TOC(pages []models.Page) string {
+	type entry struct {
+		level      int
+		text, slug string
+	}
+	var entries []entry
+	seen := map[string]int{}
+	top := 0
+	for _, p := range pages {
+		for _, b := range p.Data {
+			if b.Type != models.BlockHeading {
+				continue
+			}
+			text := strings.Join(strings.Fields(plainText(normalizeBullets(joinSpans(b.Spans)))), " ")
+			if text == "" {
+				continue
+			}
+			level := max(b.Level, 1)
+			if top == 0 || level < top {
+				top = level
+			}
+			slug := anchor(text)
+			if n := seen[slug]; n > 0 {
+				seen[slug] = n + 1
+				slug += "-" + strconv.Itoa(n)
+			} else {
+				seen[slug] = 1
+			}
+			entries = append(entries, entry{level, text, slug})
+		}
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(strings.Repeat("  ", e.level-top) + "- [" + escapeInline(e.text, escapeBrackets) + "](#" + e.slug + ")\n")
+	}
+	return b.String()
+}
+
+// anchor is the id GitHub gives a heading: its text in lower case, with
+// spaces turned into hyphens and punctuation other than hyphens and
+// underscores left out.
+func anchor(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == ' ':
+			b.WriteByte('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func Page(p models.Page) string {
+	return PageWithOptions(p, DefaultOptions)
+}
+
+func PageWithOptions(p models.Page, opts Options) string {
+	var parts []string
+	for _, b := range p.Data {
+		if md := BlockWithOptions(b, opts); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Block renders one block, or "" for types with no Markdown form.
+func Block(b models.Block) string {
+	return BlockWithOptions(b, DefaultOptions)
+}
+
+func BlockWithOptions(b models.Block, opts Options) string {
+	text := normalizeBullets(joinSpans(b.Spans))
+	switch b.Type {
+	case models.BlockHeading:
+		if text == "" {
+			return ""
+		}
+		level := b.Level
+		if level == 0 {
+			level = 1
+		}
+		return strings.Repeat("#", level) + " " + escapeHeading(text) + "\n"
+	case models.BlockText:
+		if text == "" {
+			return ""
+		}
+		return escapeLines(text) + "\n"
+	case models.BlockTable:
+		return tableWithStyle(b.Rows, opts.Tables)
+	case models.BlockList, models.BlockReferences:
+		return list(b, text, opts)
+	case models.BlockFigure:
+		alt := b.Caption
+		if alt == "" {
+			alt = b.Alt
+		}
+		if opts.FigurePlaceholders {
+			if alt == "" {
+				return "<!-- figure -->\n"
+			}
+			for strings.Contains(alt, "--") {
+				alt = strings.ReplaceAll(alt, "--", "- -")
+			}
+			return "<!-- figure: " + alt + " -->\n"
+		}
+		if alt == "" {
+			alt = "Figure"
+		}
+		alt = escapeInline(alt, escapeBrackets)
+		src := b.Image
+		if src == "" {
+			src = "figure"
+		}
+		return "![" + alt + "](" + src + ")\n"
+	}
+	return ""
+}
+
+// Content is the block's Markdown, or its plain text for blocks that have no
+// Markdown form such as code and footnotes, without the trailing newline.
+func Content(b models.Block) string {
+	return ContentWithOptions(b, DefaultOptions)
+}
+
+func ContentWithOptions(b models.Block, opts Options) string {
+	if md := strings.TrimSpace(BlockWithOptions(b, opts)); md != "" {
+		return md
+	}
+	var text strings.Builder
+	for _, s := range b.Spans {
+		text.WriteString(s.Text)
+	}
+	return strings.TrimSpace(text.String())
+}
+
+func normalizeBullets(text string) string {
+	var b strings.Builder
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		if !strings.ContainsRune(bullets, rs[i]) {
+			b.WriteRune(rs[i])
+			continue
+		}
+		b.WriteString("- ")
+		for i+1 < len(rs) && (rs[i+1] == ' ' || rs[i+1] == '\t') {
+			i++
+		}
+	}
+	return b.String()
+}
+
+func styleSpan(s models.Span) string {
+	text := s.Text
+	if text == "" {
+		return ""
+	}
+	if s.Style.Superscript {
+		t := strings.TrimSpace(text)
+		if citeNumbers.MatchString(t) {
+			return "[" + t + "]"
+		}
+		return "^" + escapeInline(text, 0) + "^"
+	}
+	if s.Style.Monospace {
+		text = codeSpan(text)
+	} else {
+		text = escapeInline(text, 0)
+	}
+	if s.Style.Bold {
+		text = "**" + text + "**"
+	}
+	if s.Style.Italic {
+		text = "*" + text + "*"
+	}
+	return text
+}
+
+func hasMarker(s string, match func(s, m string) bool) bool {
+	for _, m := range fmtMarkers {
+		if match(s, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinSpans(spans []models.Span) string {
+	var parts []string
+	for i, span := range spans {
+		styled := styleSpan(span)
+		if styled == "" {
+			continue
+		}
+		// only styles wrap text in markers; plain text has its own escaped
+		wrapped := span.Style.Bold || span.Style.Italic || span.Style.Monospace
+		if len(parts) > 0 && wrapped && hasMarker(styled, strings.HasPrefix) {
+			prev := parts[len(parts)-1]
+			if !strings.ContainsAny(prev[len(prev)-1:], " \n\t([/") {
+				parts = append(parts, " ")
+			}
+		}
+		parts = append(parts, styled)
+		if i+1 < len(spans) {
+			if next := spans[i+1].Text; next != "" && wrapped && hasMarker(styled, strings.HasSuffix) && !strings.ContainsRune(punct, []rune(next)[0]) {
+				parts = append(parts, " ")
+			}
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func cellText(c models.TableCell) string {
+	texts := make([]string, len(c.Spans))
+	for i, s := range c.Spans {
+		texts[i] = s.Text
+	}
+	return strings.ReplaceAll(escapeInline(strings.TrimSpace(strings.Join(texts, " ")), escapePipes), "\n", " ")
+}
+
+// Cell is the text of c escaped to go in a Markdown pipe table, with its
+// pipes escaped and its line breaks as <br>.
+func Cell(c models.TableCell) string {
+	lines := cellLines(c)
+	for i, ln := range lines {
+		lines[i] = escapeInline(ln, escapePipes)
+	}
+	return strings.Join(lines, "<br>")
+}
+
+func rowCells(r models.TableRow) []string {
+	cells := make([]string, len(r.Cells))
+	for i, c := range r.Cells {
+		cells[i] = cellText(c)
+	}
+	return cells
+}
+
+func tableLine(cells []string) string { return "| " + strings.Join(cells, " | ") + " |" }
+
+func table(rows []models.TableRow) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	var lines []string
+	if header := rowCells(rows[0]); strings.Join(header, "") != "" {
+		sep := make([]string, len(header))
+		for i := range sep {
+			sep[i] = "---"
+		}
+		lines = append(lines, tableLine(header), tableLine(sep))
+	}
+	for _, r := range rows[1:] {
+		lines = append(lines, tableLine(rowCells(r)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func list(b models.Block, text string, opts Options) string {
+	var lines []string
+	if len(b.Items) > 0 {
+		counts := map[int]int{} // items so far at each indent, for ordered styles
+		for _, item := range b.Items {
+			for indent := range counts {
+				if indent > item.Indent {
+					delete(counts, indent)
+				}
+			}
+			counts[item.Indent]++
+			t := strings.TrimSpace(joinSpans(item.Spans))
+			if item.Marker != "" {
+				// the item's text starts with its marker, or "-" in its place
+				for _, m := range []string{item.Marker, escapeInline(item.Marker, 0), "-"} {
+					if rest, ok := strings.CutPrefix(t, m); ok {
+						t = strings.TrimSpace(rest)
+						break
+					}
+				}
+			}
+			if t == "" {
+				continue
+			}
+			mark := "-"
+			switch style := listStyle(item.Marker, opts.ListMarkers); {
+			case style == "1." || style == "1)":
+				mark = strconv.Itoa(counts[item.Indent]) + style[1:]
+			case style != "":
+				mark = style
+			case opts.KeepListMarkers && item.Marker != "":
+				mark = item.Marker
+			case item.Prefix != "":
+				mark = item.Prefix
+			}
+			lines = append(lines, strings.Repeat("  ", item.Indent)+mark+" "+escapeLines(t))
+		}
+	} else {
+		for _, ln := range strings.Split(text, "\n") {
+			if ln = strings.TrimSpace(ln); ln != "" {
+				lines = append(lines, "- "+escapeLines(ln))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// listStyle is the style styles give marker, looked up as printed and then
+// by the form of its numbering, or "". A lone i, v or x is tried as a roman
+// numeral before a letter.
+func listStyle(marker string, styles map[string]string) string {
+	if marker == "" || len(styles) == 0 {
+		return ""
+	}
+	if style, ok := styles[marker]; ok {
+		return style
+	}
+	num, sep := marker[:len(marker)-1], marker[len(marker)-1:]
+	if sep != "." && sep != ")" || num == "" {
+		return ""
+	}
+	var forms []string
+	switch lower := strings.ToLower(num); {
+	case strings.Trim(num, "0123456789") == "":
+		forms = []string{"1"}
+	case strings.Trim(lower, "ivx") == "" && len(num) > 1:
+		forms = []string{"i"}
+	case strings.Trim(lower, "ivx") == "":
+		forms = []string{"i", "a"}
+	case len(num) == 1:
+		forms = []string{"a"}
+	}
+	for _, form := range forms {
+		if num == strings.ToUpper(num) {
+			form = strings.ToUpper(form)
+		}
+		if style, ok := styles[form+sep]; ok {
+			return style
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestBlock(t *testing.T) {
+	tests := []struct {
+		name  string
+		block models.Block
+		want  string
+	}{
+		{"heading", models.Block{Type: models.BlockHeading, Level: 2, Spans: []models.Span{{Text: "Intro"}}}, "## Intro\n"},
+		{"styled text", models.Block{Type: models.BlockText, Spans: []models.Span{{Text: "see"}, {Text: "this", Style: models.TextStyle{Bold: true}}, {Text: " now"}}}, "see **this** now\n"},
+		{"citation", models.Block{Type: models.BlockText, Spans: []models.Span{{Text: "shown"}, {Text: "12", Style: models.TextStyle{Superscript: true}}}}, "shown[12]\n"},
+		{"bullets", models.Block{Type: models.BlockText, Spans: []models.Span{{Text: "• one"}}}, "- one\n"},
+		{"list", models.Block{Type: models.BlockList, Items: []models.ListItem{{Spans: []models.Span{{Text: "a"}}}, {Prefix: "2.", Indent: 1, Spans: []models.Span{{Text: "b"}}}}}, "- a\n  2. b\n"},
+		{"table", models.Block{Type: models.BlockTable, Rows: []models.TableRow{
+			{Cells: []models.TableCell{{Spans: []models.Span{{Text: "k"}}}, {Spans: []models.Span{{Text: "v"}}}}},
+			{Cells: []models.TableCell{{Spans: []models.Span{{Text: "a|b"}}}, {Spans: []models.Span{{Text: "1"}}}}},
+		}}, "| k | v |\n| --- | --- |\n| a\\|b | 1 |\n"},
+		{"figure", models.Block{Type: models.BlockFigure, Alt: "chart [1]", Image: "images/page_001_img_01.png"}, "![chart \\[1\\]](images/page_001_img_01.png)\n"},
+		{"captioned figure", models.Block{Type: models.BlockFigure, Alt: "chart", Caption: "Figure 3: Sales", Image: "images/page_003_img_02.png"}, "![Figure 3: Sales](images/page_003_img_02.png)\n"},
+		{"code skipped", models.Block{Type: models.BlockCode, Spans: []models.Span{{Text: "x := 1"}}}, ""},
+	}
+	for _, tt := range tests {
+		if got := Block(tt.block); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDocument(t *testing.T) {
+	pages := []models.Page{
+		{Data: []models.Block{{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "A"}}}, {Type: models.BlockText, Spans: []models.Span{{Text: "b"}}}}},
+		{},
+		{Data: []models.Block{{Type: models.BlockText, Spans: []models.Span{{Text: "c"}}}}},
+	}
+	if got, want := Document(pages), "# A\n\nb\n\n---\n\nc\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFigurePlaceholders(t *testing.T) {
+	opts := Options{FigurePlaceholders: true}
+	tests := []struct {
+		block models.Block
+		want  string
+	}{
+		{models.Block{Type: models.BlockFigure, Caption: "Figure 3: Sales", Image: "images/page_003_img_02.png"}, "<!-- figure: Figure 3: Sales -->\n"},
+		{models.Block{Type: models.BlockFigure, Alt: "a --> b ---"}, "<!-- figure: a - -> b - - - -->\n"},
+		{models.Block{Type: models.BlockFigure}, "<!-- figure -->\n"},
+	}
+	for _, tt := range tests {
+		if got := BlockWithOptions(tt.block, opts); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTOC(t *testing.T) {
+	heading := func(level int, spans ...models.Span) models.Block {
+		return models.Block{Type: models.BlockHeading, Level: level, Spans: spans}
+	}
+	pages := []models.Page{
+		{Data: []models.Block{heading(2, models.Span{Text: "Getting "}, models.Span{Text: "Started", Style: models.TextStyle{Bold: true}}), {Type: models.BlockText, Spans: []models.Span{{Text: "b"}}}}},
+		{Data: []models.Block{heading(3, models.Span{Text: "Step 1: [optional]"}), heading(2, models.Span{Text: "Getting Started"})}},
+	}
+	want := "- [Getting Started](#getting-started)\n  - [Step 1: \\[optional\\]](#step-1-optional)\n- [Getting Started](#getting-started-1)\n"
+	if got := TOC(pages); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := DocumentWithOptions(pages[:1], Options{TOC: true}); got != "- [Getting Started](#getting-started)\n\n---\n\n## Getting **Started**\n\nb\n" {
+		t.Errorf("document = %q", got)
+	}
+	if got := TOC([]models.Page{{}}); got != "" {
+		t.Errorf("without headings = %q", got)
+	}
+}
+
+func TestListMarkers(t *testing.T) {
+	item := func(text, marker, prefix string, indent int) models.ListItem {
+		return models.ListItem{Spans: []models.Span{{Text: text}}, Marker: marker, Prefix: prefix, Indent: indent}
+	}
+	b := models.Block{Type: models.BlockList, Items: []models.ListItem{
+		item("- one", "▪", "", 0),
+		item("ii. two", "ii.", "ii.", 1),
+		item("iii. three", "iii.", "iii.", 1),
+		item("➢ four", "➢", "", 0),
+		item("b) five", "b)", "b)", 1),
+	}}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"normalized", Options{}, "- one\n  ii. two\n  iii. three\n- four\n  b) five\n"},
+		{"kept", Options{KeepListMarkers: true}, "▪ one\n  ii. two\n  iii. three\n➢ four\n  b) five\n"},
+		{"mapped", Options{ListMarkers: map[string]string{"➢": "*", "i.": "1.", "a)": "+"}}, "- one\n  1. two\n  2. three\n* four\n  + five\n"},
+	}
+	for _, tt := range tests {
+		if got := BlockWithOptions(b, tt.opts); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTableStyles(t *testing.T) {
+	cell := func(row, col int, x0, y0, x1, y1 float32, text string) models.TableCell {
+		c := models.TableCell{Row: row, Col: col, BBox: models.BBox{x0, y0, x1, y1}}
+		if text != "" {
+			c.Spans = []models.Span{{Text: text}}
+		}
+		return c
+	}
+	// "Region" spans two rows and "Sales" two columns; the places they cover
+	// are placeholders with no bbox
+	merged := models.Block{Type: models.BlockTable, Rows: []models.TableRow{
+		{BBox: models.BBox{0, 0, 300, 20}, Cells: []models.TableCell{cell(0, 0, 0, 0, 100, 40, "Region"), cell(0, 1, 100, 0, 300, 20, "Sales"), {Row: 0, Col: 2}}},
+		{BBox: models.BBox{0, 20, 300, 40}, Cells: []models.TableCell{{Row: 1, Col: 0}, cell(1, 1, 100, 20, 200, 40, "2023"), cell(1, 2, 200, 20, 300, 40, "2024")}},
+		{BBox: models.BBox{0, 40, 300, 60}, Cells: []models.TableCell{cell(2, 0, 0, 40, 100, 60, "North\nEast"), cell(2, 1, 100, 40, 200, 60, "1|2"), cell(2, 2, 200, 40, 300, 60, "<3")}},
+	}}
+	simple := models.Block{Type: models.BlockTable, Rows: []models.TableRow{
+		{Cells: []models.TableCell{{Spans: []models.Span{{Text: "k"}}}, {Col: 1, Spans: []models.Span{{Text: "v"}}}}},
+		{Cells: []models.TableCell{{Row: 1, Spans: []models.Span{{Text: "a"}}}, {Row: 1, Col: 1, Spans: []models.Span{{Text: "1"}}}}},
+	}}
+	html := "<table>\n<thead>\n" +
+		"<tr><th rowspan=\"2\">Region</th><th colspan=\"2\">Sales</th></tr>\n" +
+		"</thead>\n<tbody>\n" +
+		"<tr><td>2023</td><td>2024</td></tr>\n" +
+		"<tr><td>North<br>East</td><td>1|2</td><td>&lt;3</td></tr>\n" +
+		"</tbody>\n</table>\n"
+	grid := "+--------+-------------+\n" +
+		"| Region | Sales       |\n" +
+		"|        +======+======+\n" +
+		"|        | 2023 | 2024 |\n" +
+		"+--------+------+------+\n" +
+		"| North  | 1\\|2 | <3   |\n" +
+		"| East   |      |      |\n" +
+		"+--------+------+------+\n"
+	tests := []struct {
+		name  string
+		block models.Block
+		style TableStyle
+		want  string
+	}{
+		{"pipe", merged, TablePipe, "| Region | Sales |  |\n| --- | --- | --- |\n|  | 2023 | 2024 |\n| North East | 1\\|2 | <3 |\n"},
+		{"html", merged, TableHTML, html},
+		{"grid", merged, TableGrid, grid},
+		{"auto merged", merged, TableAuto, html},
+		{"auto simple", simple, TableAuto, "| k | v |\n| --- | --- |\n| a | 1 |\n"},
+		{"grid simple", simple, TableGrid, "+-----+-----+\n| k   | v   |\n+=====+=====+\n| a   | 1   |\n+-----+-----+\n"},
+	}
+	for _, tt := range tests {
+		if got := BlockWithOptions(tt.block, Options{Tables: tt.style}); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+	for _, name := range []string{"pipe", "auto", "html", "grid"} {
+		if s, err := ParseTableStyle(name); err != nil || s.String() != name {
+			t.Errorf("ParseTableStyle(%q) = %v, %v", name, s, err)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	text := func(s string) models.Block {
+		return models.Block{Type: models.BlockText, Spans: []models.Span{{Text: s}}}
+	}
+	mono := func(s string) models.Block {
+		return models.Block{Type: models.BlockText, Spans: []models.Span{{Text: "run "}, {Text: s, Style: models.TextStyle{Monospace: true}}}}
+	}
+	tests := []struct {
+		name  string
+		block models.Block
+		want  string
+	}{
+		{"emphasis", text("Use *args, **kwargs and _private_ but not snake_case"), "Use \\*args, \\*\\*kwargs and \\_private\\_ but not snake_case\n"},
+		{"line starts", text("# not a heading\n> not a quote\n+ not a list\n---\ntotal = 5\n==="), "\\# not a heading\n\\> not a quote\n\\+ not a list\n\\---\ntotal = 5\n\\===\n"},
+		{"ordered list starts", text("1999. A good year\n3) third\n12.5 km\n1234567890. long\n42."), "1999\\. A good year\n3\\) third\n12.5 km\n1234567890. long\n42\\.\n"},
+		{"code indent", text("    indented\n\t# tabbed\n   kept"), "indented\n\\# tabbed\n   kept\n"},
+		{"html", text("<script>alert(1)</script> & &amp; a < b"), "&lt;script>alert(1)&lt;/script> & &amp;amp; a < b\n"},
+		{"links", text("[click](http://x) [1]: C:\\path\\"), "[click\\](http://x) [1\\]: C:\\path\\\\\n"},
+		{"strikethrough", text("~~gone~~ and ~ 5 km"), "\\~\\~gone\\~~ and ~ 5 km\n"},
+		{"backticks", text("a `b` c"), "a \\`b\\` c\n"},
+		{"code span", mono("a`b"), "run ``a`b``\n"},
+		{"code span edge", mono("`x`"), "run `` `x` ``\n"},
+		{"styled", models.Block{Type: models.BlockText, Spans: []models.Span{{Text: "2*3"}, {Text: "x_y*", Style: models.TextStyle{Bold: true}}}}, "2\\*3 **x_y\\***\n"},
+		{"heading", models.Block{Type: models.BlockHeading, Level: 2, Spans: []models.Span{{Text: "Using C#\nand F #"}}}, "## Using C# and F \\#\n"},
+		{"list item", models.Block{Type: models.BlockList, Items: []models.ListItem{{Marker: "*", Spans: []models.Span{{Text: "* # of items"}}}}}, "- \\# of items\n"},
+		{"table", models.Block{Type: models.BlockTable, Rows: []models.TableRow{
+			{Cells: []models.TableCell{{Spans: []models.Span{{Text: "<b>|</b>"}}}, {Col: 1, Spans: []models.Span{{Text: "*"}}}}},
+		}}, "| &lt;b>\\|&lt;/b> | \\* |\n| --- | --- |\n"},
+		{"figure", models.Block{Type: models.BlockFigure, Alt: "a*b [c]"}, "![a\\*b \\[c\\]](figure)\n"},
+	}
+	for _, tt := range tests {
+		if got := Block(tt.block); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	pages := []models.Page{{Data: []models.Block{{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "A *star* & <tag>"}}}}}}
+	if got, want := TOC(pages), "- [A \\*star\\* & &lt;tag>](#a-star--tag)\n"; got != want {
+		t.Errorf("TOC = %q, want %q", got, want)
+	}
+}
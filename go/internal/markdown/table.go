@@ -0,0 +1,304 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// TableStyle is how tables are rendered. Pipe tables are the most widely
+// understood but have no way to show a cell spanning several rows or columns,
+// or a line break in a cell; HTML and grid tables keep both.
+type TableStyle int
+
+const (
+	TablePipe TableStyle = iota // GitHub pipe tables, repeating nothing for merged cells and joining lines with spaces
+	TableAuto                   // pipe tables, and HTML for tables with merged or multi-line cells
+	TableHTML                   // <table> elements with rowspan and colspan, which Markdown passes through
+	TableGrid                   // Pandoc grid tables, drawn with +, -, = and |
+)
+
+func ParseTableStyle(name string) (TableStyle, error) {
+	switch name {
+	case "pipe":
+		return TablePipe, nil
+	case "auto":
+		return TableAuto, nil
+	case "html":
+		return TableHTML, nil
+	case "grid":
+		return TableGrid, nil
+	}
+	return 0, fmt.Errorf("unknown table style %q (want pipe, auto, html or grid)", name)
+}
+
+func (s TableStyle) String() string {
+	switch s {
+	case TableAuto:
+		return "auto"
+	case TableHTML:
+		return "html"
+	case TableGrid:
+		return "grid"
+	}
+	return "pipe"
+}
+
+// gridCell is a cell of a table laid out on its grid, covering rows Row to
+// Row+RowSpan-1 and columns Col to Col+ColSpan-1.
+type gridCell struct {
+	Row, Col, RowSpan, ColSpan int
+	Lines                      []string // of its text, unescaped
+}
+
+// layout places the cells of rows on the grid of their row and col indices,
+// filling the places no cell covers with empty ones. Tables have no merged
+// cells as such: a merged cell is one whose bbox reaches over the places
+// beside or below it that have no cell, or only a placeholder with no bbox.
+// Cells are returned row by row. The first row is the header unless it is
+// empty, when it is left out.
+func layout(rows []models.TableRow) (cells []gridCell, nrows, ncols int, header bool) {
+	if header = len(rows) > 0 && hasText(rows[0]); len(rows) > 0 && !header {
+		rows = rows[1:]
+	}
+	grid := make([][]*models.TableCell, len(rows))
+	colX0 := map[int]float32{} // left edge of each column, from the cells in it
+	for r := range rows {
+		for i := range rows[r].Cells {
+			c := &rows[r].Cells[i]
+			ncols = max(ncols, c.Col+1)
+			if c.BBox.IsEmpty() && len(c.Spans) == 0 {
+				continue
+			}
+			if x0, ok := colX0[c.Col]; !ok || c.BBox.X0() < x0 {
+				colX0[c.Col] = c.BBox.X0()
+			}
+		}
+	}
+	for r := range rows {
+		grid[r] = make([]*models.TableCell, ncols)
+		for i := range rows[r].Cells {
+			if c := &rows[r].Cells[i]; !c.BBox.IsEmpty() || len(c.Spans) > 0 {
+				grid[r][c.Col] = c
+			}
+		}
+	}
+	const tol = 1 // points a merged cell must reach into the place it covers
+	covered := make([][]bool, len(rows))
+	for r := range covered {
+		covered[r] = make([]bool, ncols)
+	}
+	for r := range rows {
+		for c := 0; c < ncols; c++ {
+			if covered[r][c] {
+				continue
+			}
+			cell := gridCell{Row: r, Col: c, RowSpan: 1, ColSpan: 1}
+			if tc := grid[r][c]; tc != nil {
+				cell.Lines = cellLines(*tc)
+				for c+cell.ColSpan < ncols && grid[r][c+cell.ColSpan] == nil && !covered[r][c+cell.ColSpan] && !tc.BBox.IsEmpty() && tc.BBox.X1() > colX0[c+cell.ColSpan]+tol {
+					cell.ColSpan++
+				}
+				for r+cell.RowSpan < len(rows) && !tc.BBox.IsEmpty() && tc.BBox.Y1() > rows[r+cell.RowSpan].BBox.Y0()+tol && free(grid[r+cell.RowSpan][c:c+cell.ColSpan], covered[r+cell.RowSpan][c:c+cell.ColSpan]) {
+					cell.RowSpan++
+				}
+			}
+			for i := r; i < r+cell.RowSpan; i++ {
+				for j := c; j < c+cell.ColSpan; j++ {
+					covered[i][j] = true
+				}
+			}
+			cells = append(cells, cell)
+		}
+	}
+	return cells, len(rows), ncols, header
+}
+
+// free reports whether none of the places of a row span has a cell of its
+// own or is covered by one.
+func free(places []*models.TableCell, covered []bool) bool {
+	for i := range places {
+		if places[i] != nil || covered[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func hasText(r models.TableRow) bool {
+	return strings.Join(rowCells(r), "") != ""
+}
+
+// cellLines is the text of c, a line per line of its spans.
+func cellLines(c models.TableCell) []string {
+	texts := make([]string, len(c.Spans))
+	for i, s := range c.Spans {
+		texts[i] = s.Text
+	}
+	var lines []string
+	for _, ln := range strings.Split(strings.TrimSpace(strings.Join(texts, " ")), "\n") {
+		lines = append(lines, strings.TrimSpace(ln))
+	}
+	return lines
+}
+
+// isComplex reports whether rows have a merged or multi-line cell, which pipe
+// tables cannot show.
+func isComplex(rows []models.TableRow) bool {
+	cells, _, _, _ := layout(rows)
+	for _, c := range cells {
+		if c.RowSpan > 1 || c.ColSpan > 1 || len(c.Lines) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func tableWithStyle(rows []models.TableRow, style TableStyle) string {
+	if style == TableAuto {
+		style = TablePipe
+		if isComplex(rows) {
+			style = TableHTML
+		}
+	}
+	switch style {
+	case TableHTML:
+		return htmlTable(rows)
+	case TableGrid:
+		return gridTable(rows)
+	}
+	return table(rows)
+}
+
+// htmlTable renders rows as an HTML table, with its first row as the header
+// unless it is empty.
+func htmlTable(rows []models.TableRow) string {
+	cells, nrows, _, header := layout(rows)
+	if nrows == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<table>\n")
+	i := 0
+	for r := 0; r < nrows; r++ {
+		tag := "td"
+		switch {
+		case r == 0 && header:
+			b.WriteString("<thead>\n")
+			tag = "th"
+		case r == 1 && header:
+			b.WriteString("</thead>\n<tbody>\n")
+		case r == 0:
+			b.WriteString("<tbody>\n")
+		}
+		b.WriteString("<tr>")
+		for ; i < len(cells) && cells[i].Row == r; i++ {
+			c := cells[i]
+			b.WriteString("<" + tag)
+			if c.RowSpan > 1 {
+				fmt.Fprintf(&b, ` rowspan="%d"`, c.RowSpan)
+			}
+			if c.ColSpan > 1 {
+				fmt.Fprintf(&b, ` colspan="%d"`, c.ColSpan)
+			}
+			lines := make([]string, len(c.Lines))
+			for j, ln := range c.Lines {
+				lines[j] = html.EscapeString(ln)
+			}
+			b.WriteString(">" + strings.Join(lines, "<br>") + "</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+	if header && nrows == 1 {
+		b.WriteString("</thead>\n</table>\n")
+	} else {
+		b.WriteString("</tbody>\n</table>\n")
+	}
+	return b.String()
+}
+
+// gridTable renders rows as a Pandoc grid table, with its first row as the
+// header unless it is empty. Merged cells have no borders inside them, and
+// each line of a cell is a line of the table.
+func gridTable(rows []models.TableRow) string {
+	cells, nrows, ncols, header := layout(rows)
+	if nrows == 0 || ncols == 0 {
+		return ""
+	}
+	for i := range cells {
+		for j, ln := range cells[i].Lines {
+			cells[i].Lines[j] = escapeInline(ln, escapePipes)
+		}
+	}
+	widths, heights := make([]int, ncols), make([]int, nrows)
+	for i := range widths {
+		widths[i] = 3
+	}
+	for i := range heights {
+		heights[i] = 1
+	}
+	// single cells first, then merged ones widen and heighten their last
+	// column and row as far as they still need
+	for _, merged := range []bool{false, true} {
+		for _, c := range cells {
+			if (c.RowSpan > 1 || c.ColSpan > 1) != merged {
+				continue
+			}
+			width := 0
+			for _, ln := range c.Lines {
+				width = max(width, len([]rune(ln)))
+			}
+			have := 3 * (c.ColSpan - 1)
+			for _, w := range widths[c.Col : c.Col+c.ColSpan] {
+				have += w
+			}
+			widths[c.Col+c.ColSpan-1] += max(width-have, 0)
+			have = c.RowSpan - 1
+			for _, h := range heights[c.Row : c.Row+c.RowSpan] {
+				have += h
+			}
+			heights[c.Row+c.RowSpan-1] += max(len(c.Lines)-have, 0)
+		}
+	}
+	xs, ys := make([]int, ncols+1), make([]int, nrows+1)
+	for i, w := range widths {
+		xs[i+1] = xs[i] + w + 3
+	}
+	for i, h := range heights {
+		ys[i+1] = ys[i] + h + 1
+	}
+	canvas := make([][]rune, ys[nrows]+1)
+	for y := range canvas {
+		canvas[y] = []rune(strings.Repeat(" ", xs[ncols]+1))
+	}
+	for _, c := range cells {
+		x0, x1, y0, y1 := xs[c.Col], xs[c.Col+c.ColSpan], ys[c.Row], ys[c.Row+c.RowSpan]
+		for x := x0 + 1; x < x1; x++ {
+			canvas[y0][x], canvas[y1][x] = '-', '-'
+		}
+		for y := y0 + 1; y < y1; y++ {
+			canvas[y][x0], canvas[y][x1] = '|', '|'
+		}
+		for j, ln := range c.Lines {
+			copy(canvas[y0+1+j][x0+2:], []rune(ln))
+		}
+	}
+	for _, c := range cells {
+		x0, x1, y0, y1 := xs[c.Col], xs[c.Col+c.ColSpan], ys[c.Row], ys[c.Row+c.RowSpan]
+		canvas[y0][x0], canvas[y0][x1], canvas[y1][x0], canvas[y1][x1] = '+', '+', '+', '+'
+	}
+	if header && nrows > 1 {
+		for x, r := range canvas[ys[1]] {
+			if r == '-' {
+				canvas[ys[1]][x] = '='
+			}
+		}
+	}
+	var b strings.Builder
+	for _, line := range canvas {
+		b.WriteString(strings.TrimRight(string(line), " ") + "\n")
+	}
+	return b.String()
+}
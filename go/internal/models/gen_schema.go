@@ -0,0 +1,24 @@
+//go:build ignore
+
+// gen_schema writes models.JSONSchema to the file named by -o.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func main() {
+	out := flag.String("o", "document.schema.json", "file to write the schema to")
+	flag.Parse()
+	schema, err := models.JSONSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, append(schema, '\n'), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
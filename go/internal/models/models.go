@@ -3,7 +3,10 @@ package models
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pymupdf4llm-c/go/internal/geometry"
 )
@@ -28,6 +31,14 @@ func (b BBox) Union(other BBox) BBox {
 	return BBox{geometry.Min32(b[0], other[0]), geometry.Min32(b[1], other[1]), geometry.Max32(b[2], other[2]), geometry.Max32(b[3], other[3])}
 }
 
+func (b BBox) Intersect(other BBox) BBox {
+	result := BBox{geometry.Max32(b[0], other[0]), geometry.Max32(b[1], other[1]), geometry.Min32(b[2], other[2]), geometry.Min32(b[3], other[3])}
+	if result.IsEmpty() {
+		return BBox{}
+	}
+	return result
+}
+
 func (b BBox) MarshalJSON() ([]byte, error) {
 	return []byte("[" +
 		strconv.FormatFloat(float64(b[0]), 'f', 2, 32) + "," +
@@ -39,29 +50,62 @@ func (b BBox) MarshalJSON() ([]byte, error) {
 type BlockType string
 
 const (
-	BlockText     BlockType = "text"
-	BlockHeading  BlockType = "heading"
-	BlockTable    BlockType = "table"
-	BlockList     BlockType = "list"
-	BlockCode     BlockType = "code"
-	BlockFootnote BlockType = "footnote"
-	BlockOther    BlockType = "other"
+	BlockText       BlockType = "text"
+	BlockHeading    BlockType = "heading"
+	BlockTable      BlockType = "table"
+	BlockList       BlockType = "list"
+	BlockCode       BlockType = "code"
+	BlockFootnote   BlockType = "footnote"
+	BlockFigure     BlockType = "figure"
+	BlockReferences BlockType = "references"
+	BlockOther      BlockType = "other"
 )
 
-type TextStyle struct{ Bold, Italic, Monospace bool }
+var BlockTypes = []BlockType{BlockText, BlockHeading, BlockTable, BlockList, BlockCode, BlockFootnote, BlockFigure, BlockReferences, BlockOther}
+
+// ParseBlockTypes parses a comma-separated list of block type names.
+func ParseBlockTypes(list string) ([]BlockType, error) {
+	var out []BlockType
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, t := range BlockTypes {
+			if known = string(t) == name; known {
+				out = append(out, t)
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown block type %q (want text, heading, table, list, code, footnote, figure, references or other)", name)
+		}
+	}
+	return out, nil
+}
+
+type TextStyle struct{ Bold, Italic, Monospace, Superscript bool }
 
 type Span struct {
 	Text  string
 	Style TextStyle
 	URI   string
+	Ref   string
 }
 
-func (s Span) MarshalJSON() ([]byte, error) {
-	link := any(false)
+func (s Span) MarshalJSON() ([]byte, error) { return json.Marshal(s.jsonShape()) }
+
+// jsonShape is the struct s is encoded as, which JSONSchema describes too.
+func (s Span) jsonShape() any {
+	link, ref := any(false), any(false)
 	if s.URI != "" {
 		link = s.URI
 	}
-	return json.Marshal(struct {
+	if s.Ref != "" {
+		ref = s.Ref
+	}
+	return struct {
 		Text        string  `json:"text"`
 		FontSize    float32 `json:"font_size"`
 		Bold        bool    `json:"bold"`
@@ -71,6 +115,7 @@ func (s Span) MarshalJSON() ([]byte, error) {
 		Superscript bool    `json:"superscript"`
 		Subscript   bool    `json:"subscript"`
 		Link        any     `json:"link"`
+		Ref         any     `json:"ref"`
 	}{
 		Text:        s.Text,
 		FontSize:    0,
@@ -78,10 +123,11 @@ func (s Span) MarshalJSON() ([]byte, error) {
 		Italic:      s.Style.Italic,
 		Monospace:   s.Style.Monospace,
 		Strikeout:   false,
-		Superscript: false,
+		Superscript: s.Style.Superscript,
 		Subscript:   false,
 		Link:        link,
-	})
+		Ref:         ref,
+	}
 }
 
 type ListItem struct {
@@ -89,9 +135,13 @@ type ListItem struct {
 	ListType string
 	Indent   int
 	Prefix   string
+	Marker   string // as printed: "•", "➢", "a.", "iv."; "" where the bullet font had no usable mapping
+	ID       string
 }
 
-func (li ListItem) MarshalJSON() ([]byte, error) {
+func (li ListItem) MarshalJSON() ([]byte, error) { return json.Marshal(li.jsonShape()) }
+
+func (li ListItem) jsonShape() any {
 	lt, ind, pre := any(false), any(false), any(false)
 	if li.ListType != "" {
 		lt = li.ListType
@@ -102,17 +152,48 @@ func (li ListItem) MarshalJSON() ([]byte, error) {
 	if li.Prefix != "" {
 		pre = li.Prefix
 	}
-	return json.Marshal(struct {
+	return struct {
 		Spans    []Span `json:"spans,omitempty"`
 		ListType any    `json:"list_type"`
 		Indent   any    `json:"indent"`
 		Prefix   any    `json:"prefix"`
-	}{li.Spans, lt, ind, pre})
+		Marker   string `json:"marker,omitempty"`
+		ID       string `json:"id,omitempty"`
+	}{li.Spans, lt, ind, pre, li.Marker, li.ID}
+}
+
+type Line struct {
+	BBox      BBox    `json:"bbox"`
+	Text      string  `json:"text"`
+	FontSize  float32 `json:"font_size"`
+	Bold      bool    `json:"bold"`
+	Italic    bool    `json:"italic"`
+	Monospace bool    `json:"monospace"`
 }
 
+// Char is one character of a block as MuPDF extracted it, for -include-chars.
+type Char struct {
+	Codepoint rune       `json:"codepoint"`
+	BBox      BBox       `json:"bbox"`
+	Origin    [2]float32 `json:"origin"` // of the glyph on the baseline
+	Size      float32    `json:"size"`
+	Bold      bool       `json:"bold"`
+	Italic    bool       `json:"italic"`
+	Monospace bool       `json:"monospace"`
+}
+
+// TableCell is one position of a table's grid. Every row has a cell for each
+// column; where the table has none, as under a merged cell or a missing
+// ruling, the cell is an empty gap with a zero BBox.
 type TableCell struct {
 	BBox  BBox   `json:"bbox"`
+	Row   int    `json:"row_index"` // of the cell's row in the table, from 0
+	Col   int    `json:"col_index"` // of its column, from 0
 	Spans []Span `json:"spans,omitempty"`
+	Value string `json:"value,omitempty"` // the number in the cell as a plain decimal, when asked for; see text.NormalizeNumber
+	// the cell's text as it goes in a Markdown table, when asked for; see
+	// markdown.Cell
+	Markdown string `json:"markdown,omitempty"`
 }
 
 type TableRow struct {
@@ -131,69 +212,346 @@ type Block struct {
 	Items                         []ListItem
 	RowCount, ColCount, CellCount int
 	Rows                          []TableRow
+	Alt                           string
+	Image                         string
+	Caption                       string // of a figure, from the "Figure N" text beside it
+	ID                            string
+	TextLines                     []Line
+	Chars                         []Char
+	Sentences                     [][2]int
+	Tokens                        int
+	Confidence                    float32 // of the block's type, when asked for; 0 when not known
+	Band, Column                  int     // 1-based section of the page and column within it, when asked for; Column is 0 across columns
+	TopDown                       int     // 1-based position in plain top-to-bottom order, when asked for
+	// where the block is in the document, set last so they match the output:
+	// the number of the page it came from, in its source file for merged
+	// documents, its index in the page's data from 0, and its ordinal among
+	// all the blocks of the document from 0
+	SourcePage, Index, Ordinal int
+	// of the text joined onto the block from the start of the next page, in
+	// that page's coordinates; see extractor.JoinAcrossPages
+	ContinuedBBox BBox
+	// why the block is not content, for the blocks of a page's Suppressed:
+	// "page_number", "running_head", "running_foot" or "vertical_text"
+	Suppressed string
+}
+
+// Text flattens the block to plain text: its spans, then list items one per
+// line with their prefix, then table rows with cells separated by " | ".
+func (b Block) Text() string {
+	var parts []string
+	if s := spansText(b.Spans); s != "" {
+		parts = append(parts, s)
+	}
+	for _, item := range b.Items {
+		parts = append(parts, strings.TrimSpace(item.Prefix+" "+spansText(item.Spans)))
+	}
+	for _, row := range b.Rows {
+		cells := make([]string, len(row.Cells))
+		for i, cell := range row.Cells {
+			cells[i] = spansText(cell.Spans)
+		}
+		parts = append(parts, strings.Join(cells, " | "))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func spansText(spans []Span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		b.WriteString(s.Text)
+	}
+	return b.String()
 }
 
 func (b Block) MarshalJSON() ([]byte, error) {
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	enc.SetEscapeHTML(false)
+	if err := enc.Encode(b.jsonShape()); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// jsonShape is the struct b is encoded as, which depends on its type.
+func (b Block) jsonShape() any {
 	switch b.Type {
 	case BlockText, BlockCode:
-		enc.Encode(struct {
-			Type     BlockType `json:"type"`
-			BBox     BBox      `json:"bbox"`
-			Length   int       `json:"length"`
-			Spans    []Span    `json:"spans,omitempty"`
-			FontSize float32   `json:"font_size"`
-			Lines    int       `json:"lines"`
-		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Lines})
+		return struct {
+			Type             BlockType `json:"type"`
+			BBox             BBox      `json:"bbox"`
+			Length           int       `json:"length"`
+			Spans            []Span    `json:"spans,omitempty"`
+			FontSize         float32   `json:"font_size"`
+			Tokens           int       `json:"tokens,omitempty"`
+			Band             int       `json:"band,omitempty"`
+			Column           int       `json:"column,omitempty"`
+			TopDown          int       `json:"top_down,omitempty"`
+			SourcePage       int       `json:"source_page"`
+			BlockIndex       int       `json:"block_index"`
+			Ordinal          int       `json:"ordinal"`
+			Confidence       float32   `json:"confidence,omitempty"`
+			Lines            int       `json:"lines"`
+			TextLines        []Line    `json:"text_lines,omitempty"`
+			Chars            []Char    `json:"chars,omitempty"`
+			Sentences        [][2]int  `json:"sentences,omitempty"`
+			ContinuedBBox    *BBox     `json:"continued_bbox,omitempty"`
+			Suppressed       bool      `json:"suppressed,omitempty"`
+			SuppressedReason string    `json:"suppressed_reason,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.Confidence, b.Lines, b.TextLines, b.Chars, b.Sentences, b.continuedBBox(), b.Suppressed != "", b.Suppressed}
 	case BlockHeading:
-		enc.Encode(struct {
-			Type     BlockType `json:"type"`
-			BBox     BBox      `json:"bbox"`
-			Length   int       `json:"length"`
-			Spans    []Span    `json:"spans,omitempty"`
-			FontSize float32   `json:"font_size"`
-			Level    int       `json:"level,omitempty"`
-		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Level})
-	case BlockList:
-		enc.Encode(struct {
-			Type     BlockType  `json:"type"`
-			BBox     BBox       `json:"bbox"`
-			Length   int        `json:"length"`
-			Spans    []Span     `json:"spans,omitempty"`
-			FontSize float32    `json:"font_size"`
-			Items    []ListItem `json:"items,omitempty"`
-		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Items})
+		return struct {
+			Type             BlockType `json:"type"`
+			BBox             BBox      `json:"bbox"`
+			Length           int       `json:"length"`
+			Spans            []Span    `json:"spans,omitempty"`
+			FontSize         float32   `json:"font_size"`
+			Tokens           int       `json:"tokens,omitempty"`
+			Band             int       `json:"band,omitempty"`
+			Column           int       `json:"column,omitempty"`
+			TopDown          int       `json:"top_down,omitempty"`
+			SourcePage       int       `json:"source_page"`
+			BlockIndex       int       `json:"block_index"`
+			Ordinal          int       `json:"ordinal"`
+			Confidence       float32   `json:"confidence,omitempty"`
+			Level            int       `json:"level,omitempty"`
+			TextLines        []Line    `json:"text_lines,omitempty"`
+			Chars            []Char    `json:"chars,omitempty"`
+			Sentences        [][2]int  `json:"sentences,omitempty"`
+			Suppressed       bool      `json:"suppressed,omitempty"`
+			SuppressedReason string    `json:"suppressed_reason,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.Confidence, b.Level, b.TextLines, b.Chars, b.Sentences, b.Suppressed != "", b.Suppressed}
+	case BlockList, BlockReferences:
+		return struct {
+			Type             BlockType  `json:"type"`
+			BBox             BBox       `json:"bbox"`
+			Length           int        `json:"length"`
+			Spans            []Span     `json:"spans,omitempty"`
+			FontSize         float32    `json:"font_size"`
+			Tokens           int        `json:"tokens,omitempty"`
+			Band             int        `json:"band,omitempty"`
+			Column           int        `json:"column,omitempty"`
+			TopDown          int        `json:"top_down,omitempty"`
+			SourcePage       int        `json:"source_page"`
+			BlockIndex       int        `json:"block_index"`
+			Ordinal          int        `json:"ordinal"`
+			Confidence       float32    `json:"confidence,omitempty"`
+			Items            []ListItem `json:"items,omitempty"`
+			TextLines        []Line     `json:"text_lines,omitempty"`
+			Chars            []Char     `json:"chars,omitempty"`
+			ContinuedBBox    *BBox      `json:"continued_bbox,omitempty"`
+			Suppressed       bool       `json:"suppressed,omitempty"`
+			SuppressedReason string     `json:"suppressed_reason,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.Confidence, b.Items, b.TextLines, b.Chars, b.continuedBBox(), b.Suppressed != "", b.Suppressed}
 	case BlockTable:
-		enc.Encode(struct {
-			Type      BlockType  `json:"type"`
-			BBox      BBox       `json:"bbox"`
-			Length    int        `json:"length"`
-			Spans     []Span     `json:"spans,omitempty"`
-			FontSize  float32    `json:"font_size"`
-			RowCount  int        `json:"row_count,omitempty"`
-			ColCount  int        `json:"col_count,omitempty"`
-			CellCount int        `json:"cell_count,omitempty"`
-			Rows      []TableRow `json:"rows,omitempty"`
-		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.RowCount, b.ColCount, b.CellCount, b.Rows})
+		return struct {
+			Type       BlockType  `json:"type"`
+			BBox       BBox       `json:"bbox"`
+			Length     int        `json:"length"`
+			Spans      []Span     `json:"spans,omitempty"`
+			FontSize   float32    `json:"font_size"`
+			Tokens     int        `json:"tokens,omitempty"`
+			Band       int        `json:"band,omitempty"`
+			Column     int        `json:"column,omitempty"`
+			TopDown    int        `json:"top_down,omitempty"`
+			SourcePage int        `json:"source_page"`
+			BlockIndex int        `json:"block_index"`
+			Ordinal    int        `json:"ordinal"`
+			RowCount   int        `json:"row_count,omitempty"`
+			ColCount   int        `json:"col_count,omitempty"`
+			CellCount  int        `json:"cell_count,omitempty"`
+			Rows       []TableRow `json:"rows,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.RowCount, b.ColCount, b.CellCount, b.Rows}
+	case BlockFigure:
+		alt := any(false)
+		if b.Alt != "" {
+			alt = b.Alt
+		}
+		return struct {
+			Type       BlockType `json:"type"`
+			BBox       BBox      `json:"bbox"`
+			Length     int       `json:"length"`
+			Spans      []Span    `json:"spans,omitempty"`
+			FontSize   float32   `json:"font_size"`
+			Tokens     int       `json:"tokens,omitempty"`
+			Band       int       `json:"band,omitempty"`
+			Column     int       `json:"column,omitempty"`
+			TopDown    int       `json:"top_down,omitempty"`
+			SourcePage int       `json:"source_page"`
+			BlockIndex int       `json:"block_index"`
+			Ordinal    int       `json:"ordinal"`
+			Alt        any       `json:"alt"`
+			Image      string    `json:"image,omitempty"`
+			Caption    string    `json:"caption,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, alt, b.Image, b.Caption}
+	case BlockFootnote:
+		return struct {
+			Type       BlockType `json:"type"`
+			BBox       BBox      `json:"bbox"`
+			Length     int       `json:"length"`
+			Spans      []Span    `json:"spans,omitempty"`
+			FontSize   float32   `json:"font_size"`
+			Tokens     int       `json:"tokens,omitempty"`
+			Band       int       `json:"band,omitempty"`
+			Column     int       `json:"column,omitempty"`
+			TopDown    int       `json:"top_down,omitempty"`
+			SourcePage int       `json:"source_page"`
+			BlockIndex int       `json:"block_index"`
+			Ordinal    int       `json:"ordinal"`
+			Confidence float32   `json:"confidence,omitempty"`
+			ID         string    `json:"id,omitempty"`
+			TextLines  []Line    `json:"text_lines,omitempty"`
+			Chars      []Char    `json:"chars,omitempty"`
+			Sentences  [][2]int  `json:"sentences,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.Confidence, b.ID, b.TextLines, b.Chars, b.Sentences}
 	default:
-		enc.Encode(struct {
-			Type     BlockType `json:"type"`
-			BBox     BBox      `json:"bbox"`
-			Length   int       `json:"length"`
-			Spans    []Span    `json:"spans,omitempty"`
-			FontSize float32   `json:"font_size"`
-		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize})
+		return struct {
+			Type             BlockType `json:"type"`
+			BBox             BBox      `json:"bbox"`
+			Length           int       `json:"length"`
+			Spans            []Span    `json:"spans,omitempty"`
+			FontSize         float32   `json:"font_size"`
+			Tokens           int       `json:"tokens,omitempty"`
+			Band             int       `json:"band,omitempty"`
+			Column           int       `json:"column,omitempty"`
+			TopDown          int       `json:"top_down,omitempty"`
+			SourcePage       int       `json:"source_page"`
+			BlockIndex       int       `json:"block_index"`
+			Ordinal          int       `json:"ordinal"`
+			Confidence       float32   `json:"confidence,omitempty"`
+			Chars            []Char    `json:"chars,omitempty"`
+			Suppressed       bool      `json:"suppressed,omitempty"`
+			SuppressedReason string    `json:"suppressed_reason,omitempty"`
+		}{b.Type, b.BBox, b.Length, b.Spans, b.FontSize, b.Tokens, b.Band, b.Column, b.TopDown, b.SourcePage, b.Index, b.Ordinal, b.Confidence, b.Chars, b.Suppressed != "", b.Suppressed}
 	}
-	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+func (b Block) continuedBBox() *BBox {
+	if b.ContinuedBBox == (BBox{}) {
+		return nil
+	}
+	return &b.ContinuedBBox
+}
+
+type PaperMetadata struct {
+	Title    string `json:"title,omitempty"`
+	Authors  string `json:"authors,omitempty"`
+	Abstract string `json:"abstract,omitempty"`
+}
+
+// Fingerprint identifies text regardless of layout: Hash matches only when the
+// words are identical, Simhash values a few bits apart mean near-duplicates.
+type Fingerprint struct {
+	Hash    string `json:"hash"`
+	Simhash string `json:"simhash"`
+}
+
+// Layer is an optional content group of the PDF, such as a language or a
+// watermark that viewers can turn on and off.
+type Layer struct {
+	Name    string `json:"name"`
+	Visible bool   `json:"visible"` // whether its content was extracted
+}
+
+// PageTimings is how long the parts of converting a page took, in
+// milliseconds, for tracking performance per page over a corpus.
+type PageTimings struct {
+	Read      float64 `json:"read"`      // reading the raw page extracted by MuPDF
+	Tables    float64 `json:"tables"`    // detecting its tables, alongside classification
+	Classify  float64 `json:"classify"`  // splitting its text into blocks and classifying them
+	Serialize float64 `json:"serialize"` // encoding it as JSON, without these timings
+}
+
+// Milliseconds is d in milliseconds to the microsecond, as timings are given.
+func Milliseconds(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+// KeyValue is a label paired with the value printed beside or below it, as on
+// invoices, receipts and forms.
+type KeyValue struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	KeyBBox   BBox   `json:"key_bbox"`
+	ValueBBox BBox   `json:"value_bbox"`
+}
+
+// Coordinates are in points from the top-left corner of the displayed page
+// box, y growing downwards; pages say so in their units and origin.
+const (
+	Units  = "pt"
+	Origin = "top-left"
+)
+
+// Column is one of the columns of a band, the section of a page between
+// blocks spanning the page width.
+type Column struct {
+	Band  int     `json:"band"`   // 1-based, as on blocks
+	Index int     `json:"column"` // 1-based, left to right
+	X0    float32 `json:"x0"`
+	X1    float32 `json:"x1"`
 }
 
 type Page struct {
-	Number int     `json:"page"`
-	Data   []Block `json:"data"`
+	Number          int          `json:"page"`
+	Label           string       `json:"label,omitempty"`
+	Source          string       `json:"source,omitempty"`      // file the page came from, in merged output
+	SourcePage      int          `json:"source_page,omitempty"` // its number in that file
+	Rotation        int          `json:"rotation"`
+	Skew            float32      `json:"skew,omitempty"` // degrees the page was turned back by to straighten it, when asked for
+	Width           float32      `json:"width"`          // of the page box as displayed, in Units; 0 if the page was given up on
+	Height          float32      `json:"height"`
+	Units           string       `json:"units"`  // of every coordinate on the page, see Units
+	Origin          string       `json:"origin"` // of every coordinate on the page, see Origin
+	Bates           string       `json:"bates,omitempty"`
+	HeaderText      string       `json:"header_text,omitempty"` // running headers taken out of data, a line each
+	FooterText      string       `json:"footer_text,omitempty"` // running footers, likewise
+	Fingerprint     *Fingerprint `json:"fingerprint,omitempty"`
+	Fonts           []Font       `json:"-"` // of the page's text, gathered into the document's by extractor.ReportFonts
+	KeyValues       []KeyValue   `json:"key_values,omitempty"`
+	Scan            string       `json:"scan,omitempty"`             // image of a scanned page, whose text is from its OCR layer
+	Error           string       `json:"error,omitempty"`            // why the page has no data, such as a timeout
+	Warnings        []string     `json:"warnings,omitempty"`         // non-fatal problems met extracting the page
+	Columns         []Column     `json:"columns,omitempty"`          // of each band with several, when asked for
+	OrderConfidence *float32     `json:"order_confidence,omitempty"` // how clearly columns settled the reading order, from 0 to 1, when asked for
+	Timings         *PageTimings `json:"timings_ms,omitempty"`       // when asked for
+	Markdown        string       `json:"markdown,omitempty"`         // the page rendered as Markdown, when asked for
+	Text            string       `json:"text,omitempty"`             // the page as plain text, when asked for
+	Data            []Block      `json:"data"`
+	Suppressed      []Block      `json:"suppressed,omitempty"` // page numbers, running heads and feet left out of data, when asked for
+	Bounds          BBox         `json:"-"`
+}
+
+// Source is a document merged into another, with the fields it had as a
+// document of its own. Its font pages are numbered as in the file.
+type Source struct {
+	File        string         `json:"file"`
+	FirstPage   int            `json:"first_page"` // of its pages in the merged document
+	PageCount   int            `json:"page_count"`
+	Metadata    *PaperMetadata `json:"metadata,omitempty"`
+	Fingerprint *Fingerprint   `json:"fingerprint,omitempty"`
+	Layers      []Layer        `json:"layers,omitempty"`
+	Fonts       []Font         `json:"fonts,omitempty"`
+	Repaired    bool           `json:"repaired,omitempty"`
 }
 
-type Document struct{ Pages []Page }
+// Font is a font the text of a document is in, as PDFs may leave out the
+// fonts they use for the reader to supply.
+type Font struct {
+	Name        string `json:"name"` // without the ABCDEF+ prefix of a subset
+	Embedded    bool   `json:"embedded"`
+	Substituted bool   `json:"substituted"` // neither embedded nor a standard font, so drawn with a generic one whose glyph widths throw off spacing and tables
+	Pages       []int  `json:"pages"`       // with text in it
+}
 
-func (d *Document) MarshalJSON() ([]byte, error) { return json.Marshal(d.Pages) }
+// Document is the JSON output: what holds for the document as a whole, then
+// its pages.
+type Document struct {
+	SchemaVersion int            `json:"schema_version"` // SchemaVersion
+	Metadata      *PaperMetadata `json:"metadata,omitempty"`
+	Fingerprint   *Fingerprint   `json:"fingerprint,omitempty"` // of the text of all the pages, when asked for
+	Layers        []Layer        `json:"layers,omitempty"`
+	Fonts         []Font         `json:"fonts,omitempty"`    // the text is in
+	Repaired      bool           `json:"repaired,omitempty"` // MuPDF repaired the damaged document, so its pages are a best effort
+	Sources       []Source       `json:"sources,omitempty"`  // the documents merged into this one, which then has none of the fields above but the version
+	Pages         []Page         `json:"pages"`              // always last, so writers can stream them
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON output, given as its
+// schema_version. It goes up when a field is removed, renamed or changes
+// meaning; fields being added leave it alone.
+const SchemaVersion = 1
+
+//go:generate go run gen_schema.go -o ../../../schema/document.schema.json
+
+// JSONSchema describes the JSON output, a Document, as a JSON Schema
+// (draft 2020-12). It is built from the structs the types are encoded as, so
+// it follows changes to them; go generate writes it to schema/.
+func JSONSchema() ([]byte, error) {
+	s := schemaBuilder{defs: map[string]any{}}
+	root := s.object(reflect.TypeOf(Document{}))
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "FibrumPDF document"
+	root["description"] = "A converted PDF and its pages, schema_version " + strconv.Itoa(SchemaVersion) + "."
+	root["$defs"] = s.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaBuilder collects the schemas of named types in defs, referring to
+// them by name.
+type schemaBuilder struct{ defs map[string]any }
+
+func (s *schemaBuilder) of(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeOf(BBox{}):
+		return s.ref(t, func() map[string]any {
+			return map[string]any{"description": "x0, y0, x1, y1 in points from the top-left of the page box", "type": "array", "items": map[string]any{"type": "number"}, "minItems": 4, "maxItems": 4}
+		})
+	case reflect.TypeOf(Span{}):
+		return s.ref(t, func() map[string]any { return s.of(reflect.TypeOf(Span{}.jsonShape())) })
+	case reflect.TypeOf(ListItem{}):
+		return s.ref(t, func() map[string]any { return s.of(reflect.TypeOf(ListItem{}.jsonShape())) })
+	case reflect.TypeOf(Block{}):
+		return s.ref(t, func() map[string]any {
+			variants := make([]any, len(BlockTypes))
+			for i, bt := range BlockTypes {
+				v := s.of(reflect.TypeOf(Block{Type: bt}.jsonShape()))
+				v["properties"].(map[string]any)["type"] = map[string]any{"const": string(bt)}
+				variants[i] = v
+			}
+			return map[string]any{"oneOf": variants}
+		})
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": s.of(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return s.ref(t, func() map[string]any { return s.object(t) })
+	}
+	// the fields written as false when unset and as their value otherwise
+	return map[string]any{"type": []string{"boolean", "string", "integer"}}
+}
+
+func (s *schemaBuilder) ref(t reflect.Type, build func() map[string]any) map[string]any {
+	if _, ok := s.defs[t.Name()]; !ok {
+		s.defs[t.Name()] = build()
+	}
+	return map[string]any{"$ref": "#/$defs/" + t.Name()}
+}
+
+// object describes a struct as encoding/json writes it: fields without
+// omitempty are always there.
+func (s *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties, required := map[string]any{}, []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = s.of(f.Type)
+		if opts != "omitempty" {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/testutil"
+)
+
+func TestJSONSchemaIsCurrent(t *testing.T) {
+	root := testutil.FindProjectRoot()
+	if root == "" {
+		t.Fatal("could not find project root")
+	}
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := os.ReadFile(filepath.Join(root, "schema", "document.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(schema, '\n'), published) {
+		t.Error("schema/document.schema.json is out of date, run go generate ./internal/models")
+	}
+}
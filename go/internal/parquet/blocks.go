@@ -0,0 +1,87 @@
+package parquet
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+// BlockColumns lays pages out as one row per block: the document and page it
+// came from, its index on the page and ordinal in the document, its type, bbox
+// and text, the share of its characters set in bold, italic and monospace, and
+// its heading level (0 for non-headings).
+func BlockColumns(doc string, pages []models.Page) []Column {
+	var (
+		docs, types, texts                      []string
+		pageNums, blockNums, ordinals, levels   []int32
+		x0, y0, x1, y1                          []float32
+		fontSizes, boldRatio, italicRatio, mono []float32
+	)
+	for _, page := range pages {
+		for i, b := range page.Data {
+			spans := blockSpans(b)
+			bold, italic, monospace := styleRatios(spans)
+			docs = append(docs, doc)
+			pageNums = append(pageNums, int32(page.Number))
+			blockNums = append(blockNums, int32(i))
+			ordinals = append(ordinals, int32(b.Ordinal))
+			types = append(types, string(b.Type))
+			x0, y0, x1, y1 = append(x0, b.BBox.X0()), append(y0, b.BBox.Y0()), append(x1, b.BBox.X1()), append(y1, b.BBox.Y1())
+			texts = append(texts, b.Text())
+			fontSizes = append(fontSizes, b.FontSize)
+			boldRatio, italicRatio, mono = append(boldRatio, bold), append(italicRatio, italic), append(mono, monospace)
+			levels = append(levels, int32(b.Level))
+		}
+	}
+	return []Column{
+		{"doc", nonNil(docs)}, {"page", nonNil(pageNums)}, {"block", nonNil(blockNums)}, {"ordinal", nonNil(ordinals)}, {"type", nonNil(types)},
+		{"x0", nonNil(x0)}, {"y0", nonNil(y0)}, {"x1", nonNil(x1)}, {"y1", nonNil(y1)},
+		{"text", nonNil(texts)}, {"font_size", nonNil(fontSizes)},
+		{"bold_ratio", nonNil(boldRatio)}, {"italic_ratio", nonNil(italicRatio)}, {"monospace_ratio", nonNil(mono)},
+		{"heading_level", nonNil(levels)},
+	}
+}
+
+// nonNil keeps the column's element type visible to encodePlain when a
+// document has no blocks.
+func nonNil[T any](v []T) []T {
+	if v == nil {
+		return []T{}
+	}
+	return v
+}
+
+func blockSpans(b models.Block) []models.Span {
+	spans := append([]models.Span(nil), b.Spans...)
+	for _, item := range b.Items {
+		spans = append(spans, item.Spans...)
+	}
+	for _, row := range b.Rows {
+		for _, cell := range row.Cells {
+			spans = append(spans, cell.Spans...)
+		}
+	}
+	return spans
+}
+
+func styleRatios(spans []models.Span) (bold, italic, monospace float32) {
+	var total, nb, ni, nm int
+	for _, s := range spans {
+		n := utf8.RuneCountInString(strings.TrimSpace(s.Text))
+		total += n
+		if s.Style.Bold {
+			nb += n
+		}
+		if s.Style.Italic {
+			ni += n
+		}
+		if s.Style.Monospace {
+			nm += n
+		}
+	}
+	if total == 0 {
+		return 0, 0, 0
+	}
+	return float32(nb) / float32(total), float32(ni) / float32(total), float32(nm) / float32(total)
+}
@@ -0,0 +1,235 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Column is one required, flat column. Values must be a []string, []int32 or
+// []float32 holding one entry per row.
+type Column struct {
+	Name   string
+	Values any
+}
+
+const (
+	typeInt32     = 1
+	typeFloat     = 4
+	typeByteArray = 6
+
+	convertedUTF8 = 0
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+var magic = []byte("PAR1")
+
+// Write encodes cols as a Parquet file with a single row group and one
+// uncompressed, PLAIN-encoded data page per column.
+func Write(out io.Writer, cols []Column) error {
+	rows := -1
+	var file bytes.Buffer
+	file.Write(magic)
+	chunks := make([]*thrift, len(cols))
+	types := make([]int32, len(cols))
+	for i, col := range cols {
+		typ, n, data, err := encodePlain(col.Values)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		types[i] = typ
+		if rows >= 0 && n != rows {
+			return fmt.Errorf("column %s has %d values, want %d", col.Name, n, rows)
+		}
+		rows = n
+
+		page := newThrift()
+		page.i32(1, 0) // DATA_PAGE
+		page.i32(2, int32(len(data)))
+		page.i32(3, int32(len(data)))
+		header := newThrift()
+		header.i32(1, int32(n))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.stop()
+		page.structField(5, header)
+		page.stop()
+
+		offset := int64(file.Len())
+		file.Write(page.buf.Bytes())
+		file.Write(data)
+		size := int64(page.buf.Len() + len(data))
+
+		meta := newThrift()
+		meta.i32(1, typ)
+		meta.listI32(2, []int32{encodingPlain, encodingRLE})
+		meta.listString(3, []string{col.Name})
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, int64(n))
+		meta.i64(6, size)
+		meta.i64(7, size)
+		meta.i64(9, offset)
+		meta.stop()
+		chunk := newThrift()
+		chunk.i64(2, offset)
+		chunk.structField(3, meta)
+		chunk.stop()
+		chunks[i] = chunk
+	}
+	if rows < 0 {
+		rows = 0
+	}
+
+	schema := make([]*thrift, 0, len(cols)+1)
+	root := newThrift()
+	root.binary(4, "schema")
+	root.i32(5, int32(len(cols)))
+	root.stop()
+	schema = append(schema, root)
+	for i, col := range cols {
+		el := newThrift()
+		el.i32(1, types[i])
+		el.i32(3, 0) // REQUIRED
+		el.binary(4, col.Name)
+		if types[i] == typeByteArray {
+			el.i32(6, convertedUTF8)
+		}
+		el.stop()
+		schema = append(schema, el)
+	}
+	group := newThrift()
+	group.listStruct(1, chunks)
+	group.i64(2, int64(file.Len()-len(magic)))
+	group.i64(3, int64(rows))
+	group.stop()
+
+	footer := newThrift()
+	footer.i32(1, 1)
+	footer.listStruct(2, schema)
+	footer.i64(3, int64(rows))
+	footer.listStruct(4, []*thrift{group})
+	footer.binary(6, "fibrum-pdf")
+	footer.stop()
+
+	file.Write(footer.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(footer.buf.Len()))
+	file.Write(magic)
+	_, err := out.Write(file.Bytes())
+	return err
+}
+
+func encodePlain(values any) (typ int32, n int, data []byte, err error) {
+	var buf bytes.Buffer
+	switch v := values.(type) {
+	case []string:
+		for _, s := range v {
+			binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		}
+		return typeByteArray, len(v), buf.Bytes(), nil
+	case []int32:
+		for _, x := range v {
+			binary.Write(&buf, binary.LittleEndian, x)
+		}
+		return typeInt32, len(v), buf.Bytes(), nil
+	case []float32:
+		for _, x := range v {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(x))
+		}
+		return typeFloat, len(v), buf.Bytes(), nil
+	}
+	return 0, 0, nil, fmt.Errorf("unsupported column type %T", values)
+}
+
+// thrift writes structs in Thrift's compact protocol, which Parquet uses for
+// all of its metadata. Fields must be added in increasing id order.
+type thrift struct {
+	buf  bytes.Buffer
+	last int16
+}
+
+const (
+	ctI32    = 5
+	ctI64    = 6
+	ctBinary = 8
+	ctList   = 9
+	ctStruct = 12
+)
+
+func newThrift() *thrift { return &thrift{} }
+
+func (t *thrift) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thrift) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thrift) zigzag(v int64) { t.varint(uint64(v<<1) ^ uint64(v>>63)) }
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, ctI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, ctI64)
+	t.zigzag(v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, ctBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thrift) structField(id int16, s *thrift) {
+	t.field(id, ctStruct)
+	t.buf.Write(s.buf.Bytes())
+}
+
+func (t *thrift) listHeader(id int16, elem byte, n int) {
+	t.field(id, ctList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xF0 | elem)
+	t.varint(uint64(n))
+}
+
+func (t *thrift) listI32(id int16, vs []int32) {
+	t.listHeader(id, ctI32, len(vs))
+	for _, v := range vs {
+		t.zigzag(int64(v))
+	}
+}
+
+func (t *thrift) listString(id int16, vs []string) {
+	t.listHeader(id, ctBinary, len(vs))
+	for _, v := range vs {
+		t.varint(uint64(len(v)))
+		t.buf.WriteString(v)
+	}
+}
+
+func (t *thrift) listStruct(id int16, vs []*thrift) {
+	t.listHeader(id, ctStruct, len(vs))
+	for _, v := range vs {
+		t.buf.Write(v.buf.Bytes())
+	}
+}
+
+func (t *thrift) stop() { t.buf.WriteByte(0) }
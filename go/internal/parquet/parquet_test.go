@@ -0,0 +1,199 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestWriteLayout(t *testing.T) {
+	var buf bytes.Buffer
+	cols := []Column{
+		{"name", []string{"alpha", "beta"}},
+		{"n", []int32{7, 9}},
+		{"x", []float32{1.5, 2.5}},
+	}
+	if err := Write(&buf, cols); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if !bytes.HasPrefix(out, magic) || !bytes.HasSuffix(out, magic) {
+		t.Fatalf("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(out[len(out)-8:]))
+	r := &thriftReader{b: out[len(out)-8-footerLen : len(out)-8]}
+	meta := r.structure()
+	if r.err != nil || len(r.b) != 0 {
+		t.Fatalf("footer: %v, %d bytes left over", r.err, len(r.b))
+	}
+	if meta[3] != int64(2) || string(meta[6].([]byte)) != "fibrum-pdf" {
+		t.Errorf("num_rows %v, created_by %q", meta[3], meta[6])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(cols)+1 || schema[0].(map[int16]any)[5] != int64(len(cols)) {
+		t.Fatalf("schema = %v", schema)
+	}
+	groups := meta[4].([]any)
+	if len(groups) != 1 || groups[0].(map[int16]any)[3] != int64(2) {
+		t.Fatalf("row groups = %v", groups)
+	}
+	chunks := groups[0].(map[int16]any)[1].([]any)
+	for i, col := range cols {
+		el := schema[i+1].(map[int16]any)
+		if string(el[4].([]byte)) != col.Name || el[3] != int64(0) {
+			t.Errorf("schema element %d = %v, want required %s", i, el, col.Name)
+		}
+		cm := chunks[i].(map[int16]any)[3].(map[int16]any)
+		if cm[1] != el[1] || cm[5] != int64(2) || cm[4] != int64(0) {
+			t.Errorf("column %s metadata = %v", col.Name, cm)
+		}
+		page := &thriftReader{b: out[cm[9].(int64):]}
+		header := page.structure()
+		data := page.b[:header[3].(int64)]
+		if page.err != nil || header[5].(map[int16]any)[1] != int64(2) {
+			t.Fatalf("column %s page header = %v, %v", col.Name, header, page.err)
+		}
+		var got any
+		switch col.Values.(type) {
+		case []string:
+			var vs []string
+			for len(data) >= 4 {
+				n := binary.LittleEndian.Uint32(data)
+				vs, data = append(vs, string(data[4:4+n])), data[4+n:]
+			}
+			got = vs
+		case []int32:
+			vs := make([]int32, len(data)/4)
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, vs)
+			got = vs
+		case []float32:
+			vs := make([]float32, len(data)/4)
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, vs)
+			got = vs
+		}
+		if !reflect.DeepEqual(got, col.Values) {
+			t.Errorf("column %s reads back as %v, want %v", col.Name, got, col.Values)
+		}
+	}
+}
+
+// thriftReader decodes the Thrift compact protocol as far as Write uses it,
+// giving structs as maps of field id to value: int64 for integers, []byte
+// for binaries, []any for lists and map[int16]any for structs.
+type thriftReader struct {
+	b   []byte
+	err error
+}
+
+func (r *thriftReader) next() byte {
+	if len(r.b) == 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case ctI32, ctI64:
+		return r.zigzag()
+	case ctBinary:
+		n := int(r.uvarint())
+		if n > len(r.b) {
+			r.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		v := r.b[:n]
+		r.b = r.b[n:]
+		return v
+	case ctList:
+		h := r.next()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		var vs []any
+		for i := 0; i < n && r.err == nil; i++ {
+			vs = append(vs, r.value(h&0x0f))
+		}
+		return vs
+	case ctStruct:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	m := map[int16]any{}
+	var last int16
+	for r.err == nil {
+		h := r.next()
+		if h == 0 {
+			break
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		m[id], last = r.value(h&0x0f), id
+	}
+	return m
+}
+
+func TestWriteRejectsRaggedColumns(t *testing.T) {
+	err := Write(&bytes.Buffer{}, []Column{{"a", []int32{1, 2}}, {"b", []int32{1}}})
+	if err == nil {
+		t.Fatal("expected error for columns of different length")
+	}
+}
+
+func TestBlockColumns(t *testing.T) {
+	pages := []models.Page{{Number: 3, Data: []models.Block{
+		{Type: models.BlockHeading, Level: 2, FontSize: 14, Spans: []models.Span{{Text: "Intro", Style: models.TextStyle{Bold: true}}}},
+		{Type: models.BlockText, FontSize: 10, Spans: []models.Span{{Text: "thin "}, {Text: "bold", Style: models.TextStyle{Bold: true}}}},
+		{Type: models.BlockList, Items: []models.ListItem{{Prefix: "-", Spans: []models.Span{{Text: "one"}}}, {Prefix: "-", Spans: []models.Span{{Text: "two"}}}}},
+	}}}
+	cols := BlockColumns("doc.pdf", pages)
+	byName := map[string]any{}
+	for _, c := range cols {
+		byName[c.Name] = c.Values
+	}
+	if got := byName["page"].([]int32); len(got) != 3 || got[0] != 3 {
+		t.Errorf("page = %v", got)
+	}
+	if got := byName["heading_level"].([]int32); got[0] != 2 || got[1] != 0 {
+		t.Errorf("heading_level = %v", got)
+	}
+	if got := byName["bold_ratio"].([]float32); got[0] != 1 || got[1] != 0.5 {
+		t.Errorf("bold_ratio = %v", got)
+	}
+	if got := byName["text"].([]string); got[2] != "- one\n- two" {
+		t.Errorf("list text = %q", got[2])
+	}
+	if err := Write(&bytes.Buffer{}, BlockColumns("empty.pdf", nil)); err != nil {
+		t.Errorf("empty document: %v", err)
+	}
+}
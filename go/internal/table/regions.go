@@ -0,0 +1,102 @@
+package table
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/pymupdf4llm-c/go/internal/bridge"
+	"github.com/pymupdf4llm-c/go/internal/geometry"
+)
+
+// regionTable lays a grid over a region known to hold a table. Ruling lines
+// across most of the region divide its rows and columns where there are any;
+// otherwise each line of text is a row and the columns are split where no row
+// has text for more than a font size.
+func regionTable(raw *bridge.RawPageData, region geometry.Rect) Table {
+	var chars []bridge.RawChar
+	var sizes float32
+	for _, ch := range raw.Chars {
+		cx, cy := (ch.BBox.X0+ch.BBox.X1)/2, (ch.BBox.Y0+ch.BBox.Y1)/2
+		if ch.Codepoint != 0 && !unicode.IsSpace(ch.Codepoint) && cx >= region.X0 && cx <= region.X1 && cy >= region.Y0 && cy <= region.Y1 {
+			chars = append(chars, ch)
+			sizes += ch.Size
+		}
+	}
+	tbl := Table{BBox: region}
+	if len(chars) == 0 {
+		return tbl
+	}
+	size := sizes / float32(len(chars))
+
+	var rowsAt, colsAt []float32
+	for _, e := range raw.Edges {
+		x0, y0, x1, y1 := float32(e.X0), float32(e.Y0), float32(e.X1), float32(e.Y1)
+		switch {
+		case e.Orientation == 'h' && y0 > region.Y0+size/2 && y0 < region.Y1-size/2 && geometry.Min32(x1, region.X1)-geometry.Max32(x0, region.X0) > region.Width()*0.8:
+			rowsAt = append(rowsAt, y0)
+		case e.Orientation == 'v' && x0 > region.X0+size/2 && x0 < region.X1-size/2 && geometry.Min32(y1, region.Y1)-geometry.Max32(y0, region.Y0) > region.Height()*0.8:
+			colsAt = append(colsAt, x0)
+		}
+	}
+	if len(rowsAt) == 0 {
+		rowsAt = gaps(chars, func(r bridge.Rect) (float32, float32) { return r.Y0, r.Y1 }, 0)
+	}
+	if len(colsAt) == 0 {
+		colsAt = gaps(chars, func(r bridge.Rect) (float32, float32) { return r.X0, r.X1 }, size)
+	}
+	ys := bounds(region.Y0, rowsAt, region.Y1, size/2)
+	xs := bounds(region.X0, colsAt, region.X1, size/2)
+	for r := 0; r+1 < len(ys); r++ {
+		row := Row{BBox: geometry.Rect{X0: region.X0, Y0: ys[r], X1: region.X1, Y1: ys[r+1]}}
+		for c := 0; c+1 < len(xs); c++ {
+			row.Cells = append(row.Cells, Cell{BBox: geometry.Rect{X0: xs[c], Y0: ys[r], X1: xs[c+1], Y1: ys[r+1]}})
+		}
+		tbl.Rows = append(tbl.Rows, row)
+	}
+	return tbl
+}
+
+// gaps returns the middle of each stretch wider than minGap that no char
+// covers along the axis extent gives.
+func gaps(chars []bridge.RawChar, extent func(bridge.Rect) (float32, float32), minGap float32) []float32 {
+	spans := make([][2]float32, len(chars))
+	for i, ch := range chars {
+		lo, hi := extent(ch.BBox)
+		// a char covers the middle of its box, so lines whose boxes touch
+		// stay apart
+		mid, half := (lo+hi)/2, (hi-lo)*0.3
+		spans[i] = [2]float32{mid - half, mid + half}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var at []float32
+	end := spans[0][1]
+	for _, s := range spans[1:] {
+		if s[0]-end > minGap {
+			at = append(at, (s[0]+end)/2)
+		}
+		end = geometry.Max32(end, s[1])
+	}
+	return at
+}
+
+// bounds sorts the dividers between lo and hi, merging those closer than
+// minDist, as double rules are, and returns them between lo and hi.
+func bounds(lo float32, inner []float32, hi, minDist float32) []float32 {
+	sort.Slice(inner, func(i, j int) bool { return inner[i] < inner[j] })
+	out := []float32{lo}
+	for _, v := range inner {
+		if v-out[len(out)-1] >= minDist && hi-v >= minDist {
+			out = append(out, v)
+		}
+	}
+	return append(out, hi)
+}
+
+func overlapsAny(r geometry.Rect, regions []geometry.Rect) bool {
+	for _, region := range regions {
+		if r.IntersectArea(region) > 0 {
+			return true
+		}
+	}
+	return false
+}
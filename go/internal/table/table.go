@@ -1,6 +1,8 @@
 package table
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"sort"
 	"strings"
@@ -9,23 +11,69 @@ import (
 	"github.com/pymupdf4llm-c/go/internal/geometry"
 	"github.com/pymupdf4llm-c/go/internal/logger"
 	"github.com/pymupdf4llm-c/go/internal/models"
+	"github.com/pymupdf4llm-c/go/internal/text"
 	"github.com/tidwall/rtree"
 )
 
 var Logger = logger.GetLogger("table")
 
-const (
-	snapTolRatio   = 0.005
-	joinTolRatio   = 0.005
-	minCellRatio   = 0.005
-	maxCellWRatio  = 0.95
-	maxCellHRatio  = 0.20
-	splitGapRatio  = 0.10
-	rowYTolRatio   = 0.015
-	colXTolRatio   = 0.003
-	intersectRatio = 0.0015
-	coordScale     = 1000.0
-)
+type Options struct {
+	Spacing    text.Spacing
+	Thresholds Thresholds
+	// leave out the empty gaps in rows where the grid has no cell, instead of
+	// giving every row a cell per column; col_index still places the rest
+	DropEmptyCells bool
+	Numbers        bool // set the Value of cells holding a number, see text.NormalizeNumber
+	DecimalMark    rune // the decimal mark of those numbers, '.' or ','; 0 tells from each number
+	// regions of the page known to hold a table, taken as tables without
+	// detection; detected tables overlapping them are dropped
+	Regions  []geometry.Rect
+	Warnings *[]string // where to note ruled tables rejected and detection skipped, if anywhere
+}
+
+var DefaultOptions = Options{
+	Spacing:    text.DefaultSpacing,
+	Thresholds: DefaultThresholds,
+}
+
+// Thresholds tune ruled table detection. The ratios are fractions of the page
+// width, height, shorter side or diagonal, as noted.
+type Thresholds struct {
+	SnapTol       float64 `json:"snap_tol"`        // of width: parallel ruling lines this close are merged
+	JoinTol       float64 `json:"join_tol"`        // of width: gaps this small in a ruling line are closed
+	Intersect     float64 `json:"intersect"`       // of diagonal: how close lines must come to cross
+	MinCell       float64 `json:"min_cell"`        // of the shorter side: smaller cells are ignored
+	MaxCellWidth  float64 `json:"max_cell_width"`  // of width
+	MaxCellHeight float64 `json:"max_cell_height"` // of height
+	SplitGap      float64 `json:"split_gap"`       // of height: a gap between rows this large starts a new table
+	RowTol        float64 `json:"row_tol"`         // of height: cells whose tops are this close share a row
+	ColTol        float64 `json:"col_tol"`         // of width: cell edges this close share a column boundary
+	MaxWidth      float64 `json:"max_width"`       // of width: wider tables are page frames, not tables
+	MaxHeight     float64 `json:"max_height"`      // of height
+
+	// Pages ruled more densely than this (plans, charts, CAD drawings) are not
+	// searched for tables, so they cannot stall a conversion.
+	MaxRulingEdges   int `json:"max_ruling_edges"`
+	MaxIntersections int `json:"max_intersections"`
+}
+
+var DefaultThresholds = Thresholds{
+	SnapTol:          0.005,
+	JoinTol:          0.005,
+	Intersect:        0.0015,
+	MinCell:          0.005,
+	MaxCellWidth:     0.95,
+	MaxCellHeight:    0.20,
+	SplitGap:         0.10,
+	RowTol:           0.015,
+	ColTol:           0.003,
+	MaxWidth:         0.98,
+	MaxHeight:        0.95,
+	MaxRulingEdges:   2000,
+	MaxIntersections: 20000,
+}
+
+const coordScale = 1000.0
 
 type Edge struct {
 	X0, Y0, X1, Y1 float64
@@ -51,14 +99,53 @@ type TableArray struct{ Tables []Table }
 
 func coordToInt(x float64) int { return int(x*coordScale + 0.5) }
 
-func hasEdge(edges []Edge, x0, y0, x1, y1, eps float64) bool {
-	for _, e := range edges {
+// edgeIndex finds the merged edge covering a segment. Edges are sorted by
+// where they cross the page (y for horizontal edges, x for vertical ones), so
+// a lookup only visits the edges on the segment's own line.
+type edgeIndex struct {
+	edges      []Edge
+	pos        []float64
+	horizontal bool
+}
+
+func newEdgeIndex(edges []Edge) edgeIndex {
+	ix := edgeIndex{edges: append([]Edge(nil), edges...)}
+	across := func(e Edge) float64 {
 		if e.Orientation == 'h' {
+			return e.Y0
+		}
+		return e.X0
+	}
+	sort.SliceStable(ix.edges, func(i, j int) bool { return across(ix.edges[i]) < across(ix.edges[j]) })
+	ix.pos = make([]float64, len(ix.edges))
+	for i, e := range ix.edges {
+		ix.pos[i] = across(e)
+	}
+	ix.horizontal = len(edges) > 0 && edges[0].Orientation == 'h'
+	return ix
+}
+
+// has reports whether a single edge runs from (x0, y0) to (x1, y1), give or
+// take eps.
+func (ix edgeIndex) has(x0, y0, x1, y1, eps float64) bool {
+	at := x0
+	if ix.horizontal {
+		at = y0
+	}
+	for i := sort.SearchFloat64s(ix.pos, at-eps); i < len(ix.edges); i++ {
+		e := ix.edges[i]
+		if ix.horizontal {
+			if e.Y0 >= y0+eps {
+				break
+			}
 			if math.Abs(e.Y0-y0) < eps && math.Abs(e.Y1-y1) < eps &&
 				e.X0-eps <= math.Min(x0, x1) && e.X1+eps >= math.Max(x0, x1) {
 				return true
 			}
 		} else {
+			if e.X0 >= x0+eps {
+				break
+			}
 			if math.Abs(e.X0-x0) < eps && math.Abs(e.X1-x1) < eps &&
 				e.Y0-eps <= math.Min(y0, y1) && e.Y1+eps >= math.Max(y0, y1) {
 				return true
@@ -68,64 +155,140 @@ func hasEdge(edges []Edge, x0, y0, x1, y1, eps float64) bool {
 	return false
 }
 
-func findCells(points []geometry.Point, tr *rtree.RTreeG[geometry.Point], pageRect geometry.Rect, hEdges, vEdges []Edge) []geometry.Rect {
-	if len(points) < 4 {
-		return nil
-	}
-	pw, ph := pageRect.Width(), pageRect.Height()
-	diag := float32(math.Sqrt(float64(pw*pw + ph*ph)))
-	minSize, maxW, maxH := geometry.Min32(pw, ph)*minCellRatio, pw*maxCellWRatio, ph*maxCellHRatio
-	snapDist, eps := pw*snapTolRatio, float64(diag*intersectRatio)
+// snapPoints merges points closer than dist on both axes into their average,
+// visiting them top to bottom and left to right.
+func snapPoints(points []geometry.Point, dist float32) []geometry.Point {
 	sorted := make([]geometry.Point, len(points))
 	copy(sorted, points)
-	sort.Slice(sorted, func(i, j int) bool {
+	sort.SliceStable(sorted, func(i, j int) bool {
 		if dy := sorted[i].Y - sorted[j].Y; math.Abs(float64(dy)) > 0.1 {
 			return dy < 0
 		}
 		return sorted[i].X < sorted[j].X
 	})
 	var snapped []geometry.Point
+	var tr rtree.RTreeG[int]
+	box := func(p geometry.Point, d float32) ([2]float64, [2]float64) {
+		return [2]float64{float64(p.X - d), float64(p.Y - d)}, [2]float64{float64(p.X + d), float64(p.Y + d)}
+	}
 	for _, p := range sorted {
-		merged := false
-		for i := range snapped {
-			if geometry.Abs32(p.X-snapped[i].X) < snapDist && geometry.Abs32(p.Y-snapped[i].Y) < snapDist {
-				snapped[i].X, snapped[i].Y = (snapped[i].X+p.X)/2, (snapped[i].Y+p.Y)/2
-				merged = true
+		target := -1
+		lo, hi := box(p, dist)
+		tr.Search(lo, hi, func(_, _ [2]float64, i int) bool {
+			if (target < 0 || i < target) && geometry.Abs32(p.X-snapped[i].X) < dist && geometry.Abs32(p.Y-snapped[i].Y) < dist {
+				target = i
+			}
+			return true
+		})
+		if target < 0 {
+			lo, hi = box(p, 0)
+			tr.Insert(lo, hi, len(snapped))
+			snapped = append(snapped, p)
+			continue
+		}
+		old := snapped[target]
+		lo, hi = box(old, 0)
+		tr.Delete(lo, hi, target)
+		snapped[target] = geometry.Point{X: (old.X + p.X) / 2, Y: (old.Y + p.Y) / 2}
+		lo, hi = box(snapped[target], 0)
+		tr.Insert(lo, hi, target)
+	}
+	return snapped
+}
+
+// lines groups points into lines along one axis: key gives a point's position
+// across the line and along it. Each line lists its points in order along it,
+// and at[i] is the line and place of point i.
+func lines(points []geometry.Point, eps float32, key func(geometry.Point) (across, along float32)) (groups [][]int, at [][2]int) {
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ai, _ := key(points[order[i]])
+		aj, _ := key(points[order[j]])
+		return ai < aj
+	})
+	at = make([][2]int, len(points))
+	for start := 0; start < len(order); {
+		first, _ := key(points[order[start]])
+		end := start + 1
+		for end < len(order) {
+			if a, _ := key(points[order[end]]); a-first > eps {
 				break
 			}
+			end++
 		}
-		if !merged {
-			snapped = append(snapped, p)
+		group := append([]int(nil), order[start:end]...)
+		sort.SliceStable(group, func(i, j int) bool {
+			_, ai := key(points[group[i]])
+			_, aj := key(points[group[j]])
+			return ai < aj
+		})
+		for k, i := range group {
+			at[i] = [2]int{len(groups), k}
 		}
+		groups = append(groups, group)
+		start = end
+	}
+	return groups, at
+}
+
+// findCells finds, for every intersection point, the smallest ruled cell that
+// has it as its top left corner: the first point below it and then the first
+// point to its right, each joined to it by a ruling line, whose opposite
+// corner is ruled too. Walking the rows and columns outwards and stopping at
+// the first gap in the ruling keeps this close to linear in the number of
+// points on ordinary grids.
+func findCells(points []geometry.Point, tr *rtree.RTreeG[geometry.Point], pageRect geometry.Rect, hEdges, vEdges []Edge, th Thresholds) []geometry.Rect {
+	if len(points) < 4 {
+		return nil
 	}
+	pw, ph := pageRect.Width(), pageRect.Height()
+	diag := float32(math.Sqrt(float64(pw*pw + ph*ph)))
+	minSize, maxW, maxH := geometry.Min32(pw, ph)*float32(th.MinCell), pw*float32(th.MaxCellWidth), ph*float32(th.MaxCellHeight)
+	snapDist, eps := pw*float32(th.SnapTol), float64(diag*float32(th.Intersect))
+	snapped := snapPoints(points, snapDist)
+	rows, rowAt := lines(snapped, float32(eps), func(p geometry.Point) (float32, float32) { return p.Y, p.X })
+	cols, colAt := lines(snapped, float32(eps), func(p geometry.Point) (float32, float32) { return p.X, p.Y })
+	hIdx, vIdx := newEdgeIndex(hEdges), newEdgeIndex(vEdges)
+
 	var cells []geometry.Rect
 	for i, p1 := range snapped {
-		for j := i + 1; j < len(snapped); j++ {
-			if float64(snapped[j].Y-p1.Y) > eps {
-				break
-			}
-			p2 := snapped[j]
-			if p2.X <= p1.X+minSize || !hasEdge(hEdges, float64(p1.X), float64(p1.Y), float64(p2.X), float64(p2.Y), eps) {
+		found := false
+		for _, k := range cols[colAt[i][0]][colAt[i][1]+1:] {
+			p3 := snapped[k]
+			if p3.Y <= p1.Y+minSize {
 				continue
 			}
-			for _, p3 := range snapped {
-				if p3.Y <= p1.Y+minSize || math.Abs(float64(p3.X-p1.X)) > eps || !hasEdge(vEdges, float64(p1.X), float64(p1.Y), float64(p3.X), float64(p3.Y), eps) {
+			if !vIdx.has(float64(p1.X), float64(p1.Y), float64(p3.X), float64(p3.Y), eps) {
+				break
+			}
+			for _, m := range rows[rowAt[i][0]][rowAt[i][1]+1:] {
+				p2 := snapped[m]
+				if p2.X <= p1.X+minSize {
 					continue
 				}
-				found := false
+				if !hIdx.has(float64(p1.X), float64(p1.Y), float64(p2.X), float64(p2.Y), eps) {
+					break
+				}
+				corner := false
 				tr.Search([2]float64{float64(p2.X) - eps, float64(p3.Y) - eps}, [2]float64{float64(p2.X) + eps, float64(p3.Y) + eps}, func(_, _ [2]float64, _ geometry.Point) bool {
-					if hasEdge(vEdges, float64(p2.X), float64(p2.Y), float64(p2.X), float64(p3.Y), eps) && hasEdge(hEdges, float64(p3.X), float64(p3.Y), float64(p2.X), float64(p3.Y), eps) {
-						found = true
-						return false
-					}
-					return true
+					corner = vIdx.has(float64(p2.X), float64(p2.Y), float64(p2.X), float64(p3.Y), eps) && hIdx.has(float64(p3.X), float64(p3.Y), float64(p2.X), float64(p3.Y), eps)
+					return false
 				})
-				if found {
-					cell := geometry.Rect{X0: p1.X, Y0: p1.Y, X1: p2.X, Y1: p3.Y}
-					if w, h := cell.Width(), cell.Height(); w > minSize && w < maxW && h > minSize && h < maxH {
-						cells = append(cells, cell)
-					}
+				if !corner {
+					continue
 				}
+				cell := geometry.Rect{X0: p1.X, Y0: p1.Y, X1: p2.X, Y1: p3.Y}
+				if w, h := cell.Width(), cell.Height(); w > minSize && w < maxW && h > minSize && h < maxH {
+					cells = append(cells, cell)
+					found = true
+					break
+				}
+			}
+			if found {
+				break
 			}
 		}
 	}
@@ -137,15 +300,26 @@ func deduplicateCells(cells []geometry.Rect) []geometry.Rect {
 		return cells
 	}
 	keep := make([]bool, len(cells))
-	for i := range keep {
+	var tr rtree.RTreeG[int]
+	for i, c := range cells {
 		keep[i] = true
+		tr.Insert([2]float64{float64(c.X0), float64(c.Y0)}, [2]float64{float64(c.X1), float64(c.Y1)}, i)
 	}
+	var overlapping []int
 	for i := 0; i < len(cells); i++ {
 		if !keep[i] {
 			continue
 		}
 		areaI := cells[i].Area()
-		for j := i + 1; j < len(cells); j++ {
+		overlapping = overlapping[:0]
+		tr.Search([2]float64{float64(cells[i].X0), float64(cells[i].Y0)}, [2]float64{float64(cells[i].X1), float64(cells[i].Y1)}, func(_, _ [2]float64, j int) bool {
+			if j > i {
+				overlapping = append(overlapping, j)
+			}
+			return true
+		})
+		sort.Ints(overlapping)
+		for _, j := range overlapping {
 			if !keep[j] {
 				continue
 			}
@@ -178,18 +352,18 @@ func deduplicateCells(cells []geometry.Rect) []geometry.Rect {
 	return result
 }
 
-func groupCellsIntoTables(cells []geometry.Rect, pageRect geometry.Rect) *TableArray {
+func groupCellsIntoTables(cells []geometry.Rect, pageRect geometry.Rect, th Thresholds, warnings *[]string) *TableArray {
 	if len(cells) == 0 {
 		return nil
 	}
-	splitGap := pageRect.Height() * splitGapRatio
+	splitGap := pageRect.Height() * float32(th.SplitGap)
 	var avgH float32
 	for _, c := range cells {
 		avgH += c.Height()
 	}
 	avgH /= float32(len(cells))
 	sortTol := avgH * 0.2
-	sort.Slice(cells, func(i, j int) bool {
+	sort.SliceStable(cells, func(i, j int) bool {
 		if dy := cells[i].Y0 - cells[j].Y0; geometry.Abs32(dy) > sortTol {
 			return dy < 0
 		}
@@ -199,7 +373,7 @@ func groupCellsIntoTables(cells []geometry.Rect, pageRect geometry.Rect) *TableA
 	var cur *Table
 	prevY1 := float32(-1000)
 	for i := 0; i < len(cells); {
-		rowY0, yTol := cells[i].Y0, pageRect.Height()*rowYTolRatio
+		rowY0, yTol := cells[i].Y0, pageRect.Height()*float32(th.RowTol)
 		j := i + 1
 		for j < len(cells) && math.Abs(float64(cells[j].Y0-rowY0)) <= float64(yTol) {
 			j++
@@ -219,7 +393,7 @@ func groupCellsIntoTables(cells []geometry.Rect, pageRect geometry.Rect) *TableA
 		for k := 0; k < j-i; k++ {
 			rowCells[k].BBox = cells[i+k]
 		}
-		sort.Slice(rowCells, func(k1, k2 int) bool { return rowCells[k1].BBox.X0 < rowCells[k2].BBox.X0 })
+		sort.SliceStable(rowCells, func(k1, k2 int) bool { return rowCells[k1].BBox.X0 < rowCells[k2].BBox.X0 })
 		row := Row{Cells: rowCells, BBox: rowCells[0].BBox}
 		for k := 1; k < len(rowCells); k++ {
 			row.BBox = row.BBox.Union(rowCells[k].BBox)
@@ -229,15 +403,15 @@ func groupCellsIntoTables(cells []geometry.Rect, pageRect geometry.Rect) *TableA
 		prevY1 = row.BBox.Y1
 		i = j
 	}
-	normalizeColumns(tables, pageRect)
-	filterValid(tables, pageRect)
+	normalizeColumns(tables, pageRect, th)
+	filterValid(tables, pageRect, th, warnings)
 	if len(tables.Tables) == 0 {
 		return nil
 	}
 	return tables
 }
 
-func normalizeColumns(tables *TableArray, pageRect geometry.Rect) {
+func normalizeColumns(tables *TableArray, pageRect geometry.Rect, th Thresholds) {
 	for ti := range tables.Tables {
 		tbl := &tables.Tables[ti]
 		xCoords := make(map[int]bool)
@@ -256,7 +430,7 @@ func normalizeColumns(tables *TableArray, pageRect geometry.Rect) {
 		sort.Ints(sortedX)
 		var cols [][2]float32
 		if len(sortedX) > 0 {
-			colTol := int(pageRect.Width() * colXTolRatio * coordScale)
+			colTol := int(pageRect.Width() * float32(th.ColTol) * coordScale)
 			if colTol < 2000 {
 				colTol = 2000
 			}
@@ -354,9 +528,14 @@ func pruneEmpty(tbl *Table) {
 	}
 }
 
-func filterValid(tables *TableArray, pageRect geometry.Rect) {
+// filterValid drops the tables that are not: grids of a single row or column,
+// page frames, and grids too irregular to be tables, which warnings note.
+func filterValid(tables *TableArray, pageRect geometry.Rect, th Thresholds, warnings *[]string) {
 	valid := tables.Tables[:0]
 	for _, t := range tables.Tables {
+		rejected := func(reason string) {
+			warn(warnings, "rejected the ruled table at [%.0f %.0f %.0f %.0f]: %s", t.BBox.X0, t.BBox.Y0, t.BBox.X1, t.BBox.Y1, reason)
+		}
 		pruneEmpty(&t)
 		if len(t.Rows) < 2 || len(t.Rows[0].Cells) < 2 {
 			colsDesc := "0"
@@ -367,7 +546,7 @@ func filterValid(tables *TableArray, pageRect geometry.Rect) {
 			continue
 		}
 		hRatio, wRatio := t.BBox.Height()/pageRect.Height(), t.BBox.Width()/pageRect.Width()
-		if hRatio > 0.95 || wRatio > 0.98 {
+		if hRatio > float32(th.MaxHeight) || wRatio > float32(th.MaxWidth) {
 			Logger.Debug("table rejected: too large", "hRatio", hRatio, "wRatio", wRatio)
 			continue
 		}
@@ -403,6 +582,7 @@ func filterValid(tables *TableArray, pageRect geometry.Rect) {
 			}
 			if ratio > threshold {
 				Logger.Debug("table rejected: garbage row", "rowIndex", ri, "minH", minH, "maxH", maxH)
+				rejected(fmt.Sprintf("cells of row %d differ in height %.0f-fold", ri+1, ratio))
 				garbage = true
 				break
 			}
@@ -420,6 +600,7 @@ func filterValid(tables *TableArray, pageRect geometry.Rect) {
 		}
 		if len(t.Rows) > 10 && totalCells < len(t.Rows)*2 {
 			Logger.Debug("table rejected: too sparse", "rows", len(t.Rows), "totalCells", totalCells)
+			rejected(fmt.Sprintf("only %d cells in %d rows", totalCells, len(t.Rows)))
 			continue
 		}
 		validRows, expectedCols, missingRows := 0, -1, 0
@@ -436,6 +617,7 @@ func filterValid(tables *TableArray, pageRect geometry.Rect) {
 		}
 		if validRows > 0 && float32(missingRows) > float32(validRows)*0.4 {
 			Logger.Debug("table rejected: too many missing rows", "missingRows", missingRows, "validRows", validRows)
+			rejected(fmt.Sprintf("%d of %d rows have fewer cells than the first", missingRows, validRows))
 			continue
 		}
 		if validRows >= 2 && expectedCols >= 2 {
@@ -499,14 +681,14 @@ func mergeEdges(edges []Edge, snapTol, joinTol float64) []Edge {
 	}
 	orientation := edges[0].Orientation
 	if orientation == 'h' {
-		sort.Slice(edges, func(i, j int) bool {
+		sort.SliceStable(edges, func(i, j int) bool {
 			if edges[i].Y0 != edges[j].Y0 {
 				return edges[i].Y0 < edges[j].Y0
 			}
 			return edges[i].X0 < edges[j].X0
 		})
 	} else {
-		sort.Slice(edges, func(i, j int) bool {
+		sort.SliceStable(edges, func(i, j int) bool {
 			if edges[i].X0 != edges[j].X0 {
 				return edges[i].X0 < edges[j].X0
 			}
@@ -570,7 +752,9 @@ func mergeEdges(edges []Edge, snapTol, joinTol float64) []Edge {
 	return result
 }
 
-func findIntersections(vEdges, hEdges []Edge, tr *rtree.RTreeG[geometry.Point], eps float64) {
+// findIntersections adds the points where vertical and horizontal edges cross
+// to tr. It gives up and returns false once there are more than max of them.
+func findIntersections(vEdges, hEdges []Edge, tr *rtree.RTreeG[geometry.Point], eps float64, max int) bool {
 	tolInt := coordToInt(eps)
 	for _, v := range vEdges {
 		vXInt, vY0Int, vY1Int := coordToInt(v.X0), coordToInt(v.Y0), coordToInt(v.Y1)
@@ -588,149 +772,258 @@ func findIntersections(vEdges, hEdges []Edge, tr *rtree.RTreeG[geometry.Point],
 					return false
 				})
 				if !exists {
+					if tr.Len() >= max {
+						return false
+					}
 					tr.Insert([2]float64{float64(p.X), float64(p.Y)}, [2]float64{float64(p.X), float64(p.Y)}, p)
 				}
 			}
 		}
 	}
+	return true
 }
 
 func isPunctOrDigit(r rune) bool {
 	return r == '.' || r == ',' || r == '$' || r == '%' || r == ':' || r == ';' || r == '\'' || r == '"' || r == '-' || r == '(' || r == ')' || (r >= '0' && r <= '9')
 }
 
-func extractTextInRect(raw *bridge.RawPageData, rect geometry.Rect) string {
+type fontKey struct {
+	size                    int // half points
+	bold, italic, monospace bool
+}
+
+func keyOf(ch *bridge.RawChar) fontKey {
+	return fontKey{int(ch.Size*2 + 0.5), ch.IsBold, ch.IsItalic, ch.IsMonospaced}
+}
+
+// averageAdvances returns the mean glyph advance of every font on the page, so
+// word gaps scale with how wide or condensed the font actually is.
+func averageAdvances(chars []bridge.RawChar) map[fontKey]float32 {
+	type acc struct {
+		sum float32
+		n   int
+	}
+	sums := map[fontKey]acc{}
+	for i := range chars {
+		ch := &chars[i]
+		w := ch.Advance
+		if w <= 0 {
+			w = ch.BBox.X1 - ch.BBox.X0
+		}
+		if w > 0 && ch.Codepoint > ' ' {
+			a := sums[keyOf(ch)]
+			sums[keyOf(ch)] = acc{a.sum + w, a.n + 1}
+		}
+	}
+	out := make(map[fontKey]float32, len(sums))
+	for k, a := range sums {
+		out[k] = a.sum / float32(a.n)
+	}
+	return out
+}
+
+// cellGapTolerances returns the gap after the previous glyph and the baseline
+// shift past which ch starts a new word in a cell. With the default spacing
+// they are fixed, in points; a spacing set by the caller scales them by the
+// average advance of ch's font instead.
+func cellGapTolerances(ch *bridge.RawChar, advances map[fontKey]float32, punct bool, sp text.Spacing) (xTol, yTol float64) {
+	def := text.DefaultSpacing
+	if sp.WordGap == def.WordGap && sp.PunctGap == def.PunctGap && sp.LineShift == def.LineShift && sp.PunctShift == def.PunctShift {
+		xTol, yTol = math.Max(float64(ch.Size*0.5), 3.0), math.Max(float64(ch.Size*0.3), 2.0)
+		if punct {
+			xTol, yTol = math.Max(xTol, 8.0), math.Max(yTol, 10.0)
+		}
+		return xTol, yTol
+	}
+	advance, ok := advances[keyOf(ch)]
+	if !ok {
+		advance = ch.Size * 0.5
+	}
+	xTol, yTol = math.Max(float64(advance*sp.WordGap), 1.0), math.Max(float64(ch.Size*sp.LineShift), 2.0)
+	if punct {
+		xTol, yTol = math.Max(float64(advance*sp.PunctGap), 1.0), math.Max(yTol, float64(ch.Size*sp.PunctShift))
+	}
+	return xTol, yTol
+}
+
+func extractTextInRect(raw *bridge.RawPageData, rect geometry.Rect, advances map[fontKey]float32, sp text.Spacing) string {
 	var buf strings.Builder
-	var prevX1, prevY0 float32 = -1000, -1000
-	var prevR rune
+	var prev *bridge.RawChar
 	for i := range raw.Chars {
 		ch := &raw.Chars[i]
 		cx, cy := (ch.BBox.X0+ch.BBox.X1)/2, (ch.BBox.Y0+ch.BBox.Y1)/2
-		if cx < rect.X0-2 || cx > rect.X1+2 || cy < rect.Y0-2 || cy > rect.Y1+2 || ch.Codepoint == 0 || ch.Codepoint == 0xFEFF {
+		if cx < rect.X0-2 || cx > rect.X1+2 || cy < rect.Y0-2 || cy > rect.Y1+2 || ch.Codepoint == 0 {
 			continue
 		}
-		if buf.Len() > 0 {
-			yDiff, xGap := math.Abs(float64(ch.BBox.Y0-prevY0)), float64(ch.BBox.X0-prevX1)
-			xTol, yTol := math.Max(float64(ch.Size*0.5), 3.0), math.Max(float64(ch.Size*0.3), 2.0)
-			if isPunctOrDigit(ch.Codepoint) || isPunctOrDigit(prevR) {
-				xTol, yTol = math.Max(xTol, 8.0), math.Max(yTol, 10.0)
+		if prev != nil {
+			yDiff, xGap := math.Abs(float64(ch.BBox.Y0-prev.BBox.Y0)), float64(prev.Gap(ch))
+			if prev.Advance > 0 && ch.Advance > 0 {
+				yDiff = math.Abs(float64(ch.OriginY - prev.OriginY))
 			}
-			if yDiff > yTol || xGap > xTol {
+			xTol, yTol := cellGapTolerances(ch, advances, isPunctOrDigit(ch.Codepoint) || isPunctOrDigit(prev.Codepoint), sp)
+			if (yDiff > yTol || xGap > xTol) && !text.JoinsWithoutSpace(prev.Codepoint, ch.Codepoint, sp) {
 				buf.WriteByte(' ')
 			}
 		}
 		buf.WriteRune(ch.Codepoint)
-		prevX1, prevY0, prevR = ch.BBox.X1, ch.BBox.Y0, ch.Codepoint
+		prev = ch
 	}
 	res := buf.String()
 	res = strings.TrimSpace(res)
 	res = strings.ReplaceAll(res, "\u00A0", " ")
-	var prev rune
+	var last rune
 	var cleaned strings.Builder
 	for _, r := range res {
-		if r == ' ' && prev == ' ' {
+		if r == ' ' && last == ' ' {
 			continue
 		}
 		cleaned.WriteRune(r)
-		prev = r
+		last = r
 	}
 	return cleaned.String()
 }
 
-func extractTextIntoCells(raw *bridge.RawPageData, tables *TableArray) {
+func extractTextIntoCells(ctx context.Context, raw *bridge.RawPageData, tables *TableArray, sp text.Spacing) error {
 	if tables == nil {
-		return
+		return nil
 	}
+	advances := averageAdvances(raw.Chars)
 	for ti := range tables.Tables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for ri := range tables.Tables[ti].Rows {
 			for ci := range tables.Tables[ti].Rows[ri].Cells {
-				tables.Tables[ti].Rows[ri].Cells[ci].Text = extractTextInRect(raw, tables.Tables[ti].Rows[ri].Cells[ci].BBox)
+				tables.Tables[ti].Rows[ri].Cells[ci].Text = extractTextInRect(raw, tables.Tables[ti].Rows[ri].Cells[ci].BBox, advances, sp)
 			}
 		}
 	}
+	return nil
 }
 
-func convertTableRows(tbl Table) ([]models.TableRow, int) {
+// convertTableRows returns the rows of tbl with text in any column, the number
+// of columns and how many rows have text. With opts.DropEmptyCells the gaps in
+// rows are left out, and the col_index of the cells places them.
+func convertTableRows(tbl Table, opts Options) ([]models.TableRow, int, int) {
 	var rows []models.TableRow
 	visibleRows := 0
 	for _, r := range tbl.Rows {
-		var cells []models.TableCell
-		hasVisible := false
-		for _, c := range r.Cells {
+		cells := make([]models.TableCell, len(r.Cells))
+		hasCell, hasVisible := false, false
+		for ci, c := range r.Cells {
+			cells[ci] = models.TableCell{Row: len(rows), Col: ci}
 			if c.BBox.IsEmpty() {
 				continue
 			}
-			var spans []models.Span
+			hasCell = true
+			cells[ci].BBox = models.BBox{c.BBox.X0, c.BBox.Y0, c.BBox.X1, c.BBox.Y1}
 			if trimmed := strings.TrimSpace(c.Text); trimmed != "" {
-				spans, hasVisible = append(spans, models.Span{Text: trimmed}), true
+				cells[ci].Spans, hasVisible = []models.Span{{Text: trimmed}}, true
+				if opts.Numbers {
+					cells[ci].Value, _ = text.NormalizeNumber(trimmed, opts.DecimalMark)
+				}
 			}
-			cells = append(cells, models.TableCell{BBox: models.BBox{c.BBox.X0, c.BBox.Y0, c.BBox.X1, c.BBox.Y1}, Spans: spans})
 		}
-		if len(cells) > 0 {
+		if hasCell {
 			rows = append(rows, models.TableRow{BBox: models.BBox{r.BBox.X0, r.BBox.Y0, r.BBox.X1, r.BBox.Y1}, Cells: cells})
 			if hasVisible {
 				visibleRows++
 			}
 		}
 	}
-	if len(rows) > 0 {
-		normalizeHeaderRow(&rows)
+	cols := dropEmptyColumns(rows)
+	if opts.DropEmptyCells {
+		for r := range rows {
+			cells := rows[r].Cells[:0]
+			for _, cell := range rows[r].Cells {
+				if !cell.BBox.IsEmpty() {
+					cells = append(cells, cell)
+				}
+			}
+			rows[r].Cells = cells
+		}
 	}
-	return rows, visibleRows
+	return rows, cols, visibleRows
 }
 
-func normalizeHeaderRow(rows *[]models.TableRow) {
-	if len(*rows) == 0 {
-		return
+// dropEmptyColumns removes the columns with no text in any row, numbering the
+// rest from 0 again, and returns how many are left. The rows all have the same
+// cells, one per column.
+func dropEmptyColumns(rows []models.TableRow) int {
+	if len(rows) == 0 {
+		return 0
 	}
-	header := &(*rows)[0]
-	nonEmpty := make([]models.TableCell, 0, len(header.Cells))
-	for _, cell := range header.Cells {
-		for _, span := range cell.Spans {
-			if strings.TrimSpace(span.Text) != "" {
-				nonEmpty = append(nonEmpty, cell)
-				break
-			}
+	keep := make([]bool, len(rows[0].Cells))
+	for _, row := range rows {
+		for ci, cell := range row.Cells {
+			keep[ci] = keep[ci] || len(cell.Spans) > 0
 		}
 	}
-	header.Cells = nonEmpty
-	colCount := len(nonEmpty)
-	for i := 1; i < len(*rows); i++ {
-		row := &(*rows)[i]
-		if len(row.Cells) > colCount {
-			row.Cells = row.Cells[:colCount]
-		} else if len(row.Cells) < colCount {
-			padded := make([]models.TableCell, colCount)
-			copy(padded, row.Cells)
-			row.Cells = padded
+	for r := range rows {
+		cells := rows[r].Cells[:0]
+		for ci, cell := range rows[r].Cells {
+			if keep[ci] {
+				cell.Col = len(cells)
+				cells = append(cells, cell)
+			}
 		}
+		rows[r].Cells = cells
 	}
+	return len(rows[0].Cells)
 }
 
 func ExtractAndConvertTables(raw *bridge.RawPageData) []models.Block {
-	if len(raw.Edges) == 0 {
+	return ExtractAndConvertTablesWithOptions(raw, DefaultOptions)
+}
+
+func ExtractAndConvertTablesWithOptions(raw *bridge.RawPageData, opts Options) []models.Block {
+	return ExtractAndConvertTablesContext(context.Background(), raw, opts)
+}
+
+// ExtractAndConvertTablesContext is ExtractAndConvertTablesWithOptions
+// returning nil as soon as it sees ctx done, between detecting the tables
+// and filling in each of them.
+func ExtractAndConvertTablesContext(ctx context.Context, raw *bridge.RawPageData, opts Options) []models.Block {
+	if len(raw.Edges) == 0 && len(opts.Regions) == 0 {
 		return nil
 	}
-	Logger.Debug("extracting tables", "page", raw.PageNumber, "edges", len(raw.Edges))
+	Logger.Debug("extracting tables", "page", raw.PageNumber, "edges", len(raw.Edges), "regions", len(opts.Regions))
 	pageRect := geometry.Rect{X0: raw.PageBounds.X0, Y0: raw.PageBounds.Y0, X1: raw.PageBounds.X1, Y1: raw.PageBounds.Y1}
-	tables := detectTables(raw.Edges, pageRect, raw.PageNumber)
-	if tables == nil || len(tables.Tables) == 0 {
+	tables := &TableArray{}
+	if detected := detectTables(raw.Edges, pageRect, raw.PageNumber, opts.Thresholds, opts.Warnings); detected != nil {
+		for _, t := range detected.Tables {
+			if !overlapsAny(t.BBox, opts.Regions) {
+				tables.Tables = append(tables.Tables, t)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if len(tables.Tables) > 0 {
+		ShrinkCellsToContent(tables, raw.Chars)
+	}
+	for _, region := range opts.Regions {
+		tables.Tables = append(tables.Tables, regionTable(raw, region))
+	}
+	if len(tables.Tables) == 0 {
 		Logger.Debug("no tables detected")
 		return nil
 	}
 	Logger.Debug("detected tables", "count", len(tables.Tables))
-	ShrinkCellsToContent(tables, raw.Chars)
-	extractTextIntoCells(raw, tables)
+	if extractTextIntoCells(ctx, raw, tables, opts.Spacing) != nil {
+		return nil
+	}
 	var blocks []models.Block
 	for _, tbl := range tables.Tables {
-		rows, visibleRows := convertTableRows(tbl)
-		if visibleRows > 0 && len(rows) > 0 && len(rows[0].Cells) > 0 {
+		rows, cols, visibleRows := convertTableRows(tbl, opts)
+		if visibleRows > 0 && cols > 0 {
 			blocks = append(blocks, models.Block{
 				Type:      models.BlockTable,
 				BBox:      models.BBox{tbl.BBox.X0, tbl.BBox.Y0, tbl.BBox.X1, tbl.BBox.Y1},
 				RowCount:  visibleRows,
-				ColCount:  len(rows[0].Cells),
-				CellCount: visibleRows * len(rows[0].Cells),
+				ColCount:  cols,
+				CellCount: visibleRows * cols,
 				Rows:      rows,
 			})
 		}
@@ -739,7 +1032,7 @@ func ExtractAndConvertTables(raw *bridge.RawPageData) []models.Block {
 	return blocks
 }
 
-func detectTables(bridgeEdges []bridge.Edge, pageRect geometry.Rect, pageNum int) *TableArray {
+func detectTables(bridgeEdges []bridge.Edge, pageRect geometry.Rect, pageNum int, th Thresholds, warnings *[]string) *TableArray {
 	if len(bridgeEdges) == 0 {
 		return nil
 	}
@@ -753,17 +1046,26 @@ func detectTables(bridgeEdges []bridge.Edge, pageRect geometry.Rect, pageNum int
 		}
 	}
 	pw := float64(pageRect.Width())
-	snapTol, joinTol := pw*snapTolRatio, pw*joinTolRatio
+	snapTol, joinTol := pw*th.SnapTol, pw*th.JoinTol
 	hEdges = mergeEdges(hEdges, snapTol, joinTol)
 	vEdges = mergeEdges(vEdges, snapTol, joinTol)
 	Logger.Debug("merged edges", "page", pageNum, "hEdges", len(hEdges), "vEdges", len(vEdges))
 	if len(hEdges) < 3 || len(vEdges) < 3 {
 		return nil
 	}
+	if len(hEdges) > th.MaxRulingEdges || len(vEdges) > th.MaxRulingEdges {
+		Logger.Info("too many ruling lines, skipping table detection", "page", pageNum, "hEdges", len(hEdges), "vEdges", len(vEdges))
+		warn(warnings, "page has too many ruling lines (%d across, %d down): skipped table detection", len(hEdges), len(vEdges))
+		return nil
+	}
 	ph := float64(pageRect.Height())
-	eps := math.Sqrt(pw*pw+ph*ph) * intersectRatio
+	eps := math.Sqrt(pw*pw+ph*ph) * th.Intersect
 	var tr rtree.RTreeG[geometry.Point]
-	findIntersections(vEdges, hEdges, &tr, eps)
+	if !findIntersections(vEdges, hEdges, &tr, eps, th.MaxIntersections) {
+		Logger.Info("too many ruling intersections, skipping table detection", "page", pageNum, "limit", th.MaxIntersections)
+		warn(warnings, "page has over %d crossings of ruling lines: skipped table detection", th.MaxIntersections)
+		return nil
+	}
 	var points []geometry.Point
 	tr.Scan(func(_, _ [2]float64, value geometry.Point) bool {
 		points = append(points, value)
@@ -773,7 +1075,7 @@ func detectTables(bridgeEdges []bridge.Edge, pageRect geometry.Rect, pageNum int
 	if len(points) < 4 {
 		return nil
 	}
-	cells := findCells(points, &tr, pageRect, hEdges, vEdges)
+	cells := findCells(points, &tr, pageRect, hEdges, vEdges, th)
 	Logger.Debug("found cells", "page", pageNum, "count", len(cells))
 	if len(cells) == 0 {
 		return nil
@@ -798,5 +1100,12 @@ func detectTables(bridgeEdges []bridge.Edge, pageRect geometry.Rect, pageNum int
 	}
 	valid = deduplicateCells(valid)
 	Logger.Debug("deduplicated cells", "page", pageNum, "validCells", len(valid))
-	return groupCellsIntoTables(valid, pageRect)
+	return groupCellsIntoTables(valid, pageRect, th, warnings)
+}
+
+// warn notes a problem with the page in warnings, if it is set.
+func warn(warnings *[]string, format string, args ...any) {
+	if warnings != nil {
+		*warnings = append(*warnings, fmt.Sprintf(format, args...))
+	}
 }
@@ -5,10 +5,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pymupdf4llm-c/go/internal/bridge"
 	"github.com/pymupdf4llm-c/go/internal/geometry"
 	"github.com/pymupdf4llm-c/go/internal/testutil"
+	"github.com/pymupdf4llm-c/go/internal/text"
 )
 
 func loadTestPDFPages(t *testing.T, pdfName string) []*bridge.RawPageData {
@@ -130,6 +132,64 @@ func TestDeduplicateCells(t *testing.T) {
 	}
 }
 
+func TestConvertTableRowsKeepsGrid(t *testing.T) {
+	cell := func(x0, y0 float32, text string) Cell {
+		return Cell{BBox: geometry.Rect{X0: x0, Y0: y0, X1: x0 + 100, Y1: y0 + 20}, Text: text}
+	}
+	// the header spans the first two columns, the middle row has no third
+	// cell and the last column is empty throughout
+	tbl := Table{Rows: []Row{
+		{Cells: []Cell{{BBox: geometry.Rect{X0: 0, Y0: 0, X1: 200, Y1: 20}, Text: "Merged"}, {}, cell(200, 0, "C"), cell(300, 0, "")}},
+		{Cells: []Cell{cell(0, 20, "a1"), cell(100, 20, "b1"), {}, cell(300, 20, "")}},
+		{Cells: []Cell{cell(0, 40, "a2"), cell(100, 40, "b2"), cell(200, 40, "c2"), cell(300, 40, "")}},
+	}}
+	rows, cols, visible := convertTableRows(tbl, DefaultOptions)
+	if visible != 3 || len(rows) != 3 || cols != 3 {
+		t.Fatalf("got %d rows, %d visible, %d columns", len(rows), visible, cols)
+	}
+	for r, row := range rows {
+		if len(row.Cells) != 3 {
+			t.Fatalf("row %d has %d cells, want 3", r, len(row.Cells))
+		}
+		for c, cell := range row.Cells {
+			if cell.Row != r || cell.Col != c {
+				t.Errorf("cell at %d,%d says %d,%d", r, c, cell.Row, cell.Col)
+			}
+		}
+	}
+	if gap := rows[0].Cells[1]; !gap.BBox.IsEmpty() || len(gap.Spans) != 0 {
+		t.Errorf("merged-over cell = %+v, want an empty gap", gap)
+	}
+	if gap := rows[1].Cells[2]; len(gap.Spans) != 0 || rows[2].Cells[2].Spans[0].Text != "c2" {
+		t.Errorf("missing cell shifted the row: %+v", rows[1].Cells)
+	}
+
+	rows, cols, _ = convertTableRows(tbl, Options{DropEmptyCells: true})
+	if cols != 3 || len(rows[0].Cells) != 2 || rows[0].Cells[1].Col != 2 || len(rows[2].Cells) != 3 {
+		t.Errorf("without empty cells: %d columns, rows %+v", cols, rows)
+	}
+}
+
+func TestConvertTableRowsNumbers(t *testing.T) {
+	cell := func(x0, y0 float32, text string) Cell {
+		return Cell{BBox: geometry.Rect{X0: x0, Y0: y0, X1: x0 + 100, Y1: y0 + 20}, Text: text}
+	}
+	tbl := Table{Rows: []Row{
+		{Cells: []Cell{cell(0, 0, "Revenue"), cell(100, 0, "(1.234,50)")}},
+		{Cells: []Cell{cell(0, 20, "Margin"), cell(100, 20, "12,5 %")}},
+	}}
+	rows, _, _ := convertTableRows(tbl, Options{Numbers: true, DecimalMark: ','})
+	if rows[0].Cells[0].Value != "" || rows[0].Cells[1].Value != "-1234.50" || rows[1].Cells[1].Value != "12.5" {
+		t.Errorf("values %+v", rows)
+	}
+	if rows[0].Cells[1].Spans[0].Text != "(1.234,50)" {
+		t.Error("the raw text was changed")
+	}
+	if rows, _, _ := convertTableRows(tbl, DefaultOptions); rows[0].Cells[1].Value != "" {
+		t.Error("values set without Numbers")
+	}
+}
+
 func TestGroupCellsIntoTables(t *testing.T) {
 	pageRect := geometry.Rect{X0: 0, Y0: 0, X1: 612, Y1: 792}
 	cells := []geometry.Rect{
@@ -139,7 +199,7 @@ func TestGroupCellsIntoTables(t *testing.T) {
 		{X0: 150, Y0: 130, X1: 250, Y1: 160},
 	}
 
-	tables := groupCellsIntoTables(cells, pageRect)
+	tables := groupCellsIntoTables(cells, pageRect, DefaultThresholds, nil)
 	if tables == nil || len(tables.Tables) == 0 {
 		t.Fatal("no tables grouped")
 	}
@@ -150,6 +210,23 @@ func TestGroupCellsIntoTables(t *testing.T) {
 	}
 }
 
+func TestFilterValidWarns(t *testing.T) {
+	pageRect := geometry.Rect{X1: 612, Y1: 792}
+	// a row of cells a line tall under a row ten times that
+	cells := []geometry.Rect{
+		{X0: 50, Y0: 100, X1: 150, Y1: 110}, {X0: 150, Y0: 100, X1: 250, Y1: 110},
+		{X0: 50, Y0: 110, X1: 150, Y1: 120}, {X0: 150, Y0: 110, X1: 250, Y1: 220},
+		{X0: 50, Y0: 220, X1: 150, Y1: 230}, {X0: 150, Y0: 220, X1: 250, Y1: 230},
+	}
+	var warnings []string
+	if tables := groupCellsIntoTables(cells, pageRect, DefaultThresholds, &warnings); tables != nil {
+		t.Fatalf("tables = %+v, want the grid rejected", tables)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "rejected the ruled table at [50 100 250 230]: cells of row") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
 func TestMergeEdges(t *testing.T) {
 	edges := []Edge{
 		{X0: 100, Y0: 50, X1: 200, Y1: 50, Orientation: 'h'},
@@ -187,3 +264,130 @@ func TestExtractTablesFromLargeDoc(t *testing.T) {
 
 	t.Logf("large doc: %d tables, %d total cells", totalTables, totalCells)
 }
+
+func TestExtractTextInRectScalesWithAdvance(t *testing.T) {
+	// a condensed font: 10pt glyphs only 3pt wide, words separated by 2pt
+	var chars []bridge.RawChar
+	x := float32(0)
+	for _, r := range "ab cd" {
+		if r == ' ' {
+			x += 2
+			continue
+		}
+		chars = append(chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: 0, X1: x + 3, Y1: 10}})
+		x += 3
+	}
+	raw := &bridge.RawPageData{Chars: chars}
+	rect := geometry.Rect{X0: 0, Y0: 0, X1: 100, Y1: 10}
+	if got := extractTextInRect(raw, rect, averageAdvances(raw.Chars), text.DefaultSpacing); got != "abcd" {
+		t.Errorf("default spacing, under the fixed 5pt word gap: got %q, want %q", got, "abcd")
+	}
+	tight := text.DefaultSpacing
+	tight.WordGap = 0.5
+	if got := extractTextInRect(raw, rect, averageAdvances(raw.Chars), tight); got != "ab cd" {
+		t.Errorf("condensed font: got %q, want %q", got, "ab cd")
+	}
+	loose := text.DefaultSpacing
+	loose.WordGap = 1.0
+	if got := extractTextInRect(raw, rect, averageAdvances(raw.Chars), loose); got != "abcd" {
+		t.Errorf("loose word gap: got %q, want %q", got, "abcd")
+	}
+}
+
+// ruledGrid returns the edges of a fully ruled grid with the given column and
+// row boundaries.
+func ruledGrid(xs, ys []float64) []bridge.Edge {
+	var edges []bridge.Edge
+	for _, y := range ys {
+		edges = append(edges, bridge.Edge{X0: xs[0], Y0: y, X1: xs[len(xs)-1], Y1: y, Orientation: 'h'})
+	}
+	for _, x := range xs {
+		edges = append(edges, bridge.Edge{X0: x, Y0: ys[0], X1: x, Y1: ys[len(ys)-1], Orientation: 'v'})
+	}
+	return edges
+}
+
+func steps(from, step float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = from + float64(i)*step
+	}
+	return out
+}
+
+func TestDetectTablesRuledGrid(t *testing.T) {
+	page := geometry.Rect{X1: 612, Y1: 792}
+	tables := detectTables(ruledGrid(steps(72, 120, 4), steps(100, 20, 5)), page, 1, DefaultThresholds, nil)
+	if tables == nil || len(tables.Tables) != 1 {
+		t.Fatalf("tables = %+v, want one", tables)
+	}
+	tbl := tables.Tables[0]
+	if len(tbl.Rows) != 4 || len(tbl.Rows[0].Cells) != 3 {
+		t.Errorf("got %d rows of %d cells, want 4 of 3", len(tbl.Rows), len(tbl.Rows[0].Cells))
+	}
+}
+
+func TestDetectTablesDensePage(t *testing.T) {
+	page := geometry.Rect{X1: 612, Y1: 792}
+	// A drawing ruled every few points, with more crossings than any table.
+	start := time.Now()
+	var warnings []string
+	if tables := detectTables(ruledGrid(steps(10, 3.2, 185), steps(10, 3.2, 240)), page, 1, DefaultThresholds, &warnings); tables != nil {
+		t.Errorf("found %d tables past the intersection limit", len(tables.Tables))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "skipped table detection") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	// Just under the limit the full search has to run.
+	detectTables(ruledGrid(steps(10, 4, 130), steps(10, 5, 150)), page, 1, DefaultThresholds, nil)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("dense pages took %v", elapsed)
+	}
+}
+
+func BenchmarkDetectTablesDenseGrid(b *testing.B) {
+	page := geometry.Rect{X1: 612, Y1: 792}
+	// 60 x 80 cells, each large enough to count
+	edges := ruledGrid(steps(20, 9.5, 61), steps(20, 9.5, 81))
+	for i := 0; i < b.N; i++ {
+		detectTables(edges, page, 1, DefaultThresholds, nil)
+	}
+}
+
+func TestTableRegions(t *testing.T) {
+	// an unruled statement: date, description and amount on each line
+	raw := &bridge.RawPageData{PageNumber: 1, PageBounds: bridge.Rect{X1: 612, Y1: 792}}
+	write := func(x, y float32, s string) {
+		for _, r := range s {
+			if r == ' ' {
+				x += 7 // a space wider than the 5pt word gap
+				continue
+			}
+			raw.Chars = append(raw.Chars, bridge.RawChar{Codepoint: r, Size: 10, BBox: bridge.Rect{X0: x, Y0: y, X1: x + 5, Y1: y + 10}})
+			x += 5
+		}
+	}
+	for i, line := range [][3]string{{"Date", "Description", "Amount"}, {"01/02", "Coffee shop", "-3.50"}, {"01/03", "Salary", "2,000.00"}} {
+		y := 100 + float32(i)*14
+		write(72, y, line[0])
+		write(150, y, line[1])
+		write(400, y, line[2])
+	}
+	write(72, 300, "Page 1 of 3")
+
+	if blocks := ExtractAndConvertTables(raw); len(blocks) != 0 {
+		t.Fatalf("detected %d tables without rulings", len(blocks))
+	}
+	opts := DefaultOptions
+	opts.Regions = []geometry.Rect{{X0: 60, Y0: 95, X1: 500, Y1: 145}}
+	blocks := ExtractAndConvertTablesWithOptions(raw, opts)
+	if len(blocks) != 1 || blocks[0].ColCount != 3 || len(blocks[0].Rows) != 3 {
+		t.Fatalf("got %+v, want one 3x3 table", blocks)
+	}
+	if got := blocks[0].Rows[2].Cells[1].Spans[0].Text; got != "Salary" {
+		t.Errorf("cell 2,1 = %q, want Salary", got)
+	}
+	if got := blocks[0].Rows[1].Cells[1].Spans[0].Text; got != "Coffee shop" {
+		t.Errorf("cell 1,1 = %q, want Coffee shop", got)
+	}
+}
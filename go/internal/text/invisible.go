@@ -0,0 +1,75 @@
+package text
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Invisible is what cleanup does with characters that take no room on the
+// page: zero-width spaces, joiners, directional marks and other format and
+// control characters. Soft hyphens have their own handling.
+type Invisible int
+
+const (
+	InvisibleKeep  Invisible = iota // leave them all in
+	InvisibleStrip                  // drop them all
+	InvisibleMap                    // zero-width spaces become spaces, joiners stay, the rest go
+)
+
+func ParseInvisible(name string) (Invisible, error) {
+	switch name {
+	case "keep":
+		return InvisibleKeep, nil
+	case "strip":
+		return InvisibleStrip, nil
+	case "map":
+		return InvisibleMap, nil
+	}
+	return 0, fmt.Errorf("unknown invisible character policy %q (want keep, strip or map)", name)
+}
+
+func (p Invisible) String() string {
+	switch p {
+	case InvisibleStrip:
+		return "strip"
+	case InvisibleMap:
+		return "map"
+	}
+	return "keep"
+}
+
+// SanitizeInvisible applies p to the invisible characters in s. Zero-width
+// spaces (U+200B) break words in scripts such as Thai, so mapping turns them
+// into spaces; zero-width joiners and non-joiners spell emoji sequences and
+// Persian and Indic words, so it keeps them; byte order marks, word joiners,
+// directional marks and other controls carry nothing for the text and go.
+// Tabs and line breaks are left to NormalizeText.
+func SanitizeInvisible(s string, p Invisible) string {
+	if p == InvisibleKeep || !strings.ContainsFunc(s, isInvisible) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case !isInvisible(r):
+			b.WriteRune(r)
+		case p == InvisibleMap && r == '\u200b':
+			b.WriteByte(' ')
+		case p == InvisibleMap && (r == '\u200c' || r == '\u200d'):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isInvisible(r rune) bool {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v' || r == '\u00ad':
+		return false
+	case unicode.Is(unicode.Cc, r):
+		return true
+	}
+	return unicode.Is(unicode.Cf, r) && !unicode.Is(unicode.Prepended_Concatenation_Mark, r)
+}
@@ -0,0 +1,93 @@
+package text
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Margin is a distance in from a page edge, in points or, with Percent set, as
+// a percentage of the page's height (top and bottom) or width (left and right).
+type Margin struct {
+	Value   float32
+	Percent bool
+}
+
+func (m Margin) points(size float32) float32 {
+	if m.Percent {
+		return size * m.Value / 100
+	}
+	return m.Value
+}
+
+func (m Margin) String() string {
+	s := strconv.FormatFloat(float64(m.Value), 'f', -1, 32)
+	if m.Percent {
+		s += "%"
+	}
+	return s
+}
+
+// Margins are the zones along the page edges where running headers, footers
+// and page numbers are looked for. A zero margin is no zone.
+type Margins struct {
+	Top, Bottom, Left, Right Margin
+}
+
+var DefaultMargins = Margins{Top: Margin{8, true}, Bottom: Margin{8, true}}
+
+// InTop reports whether bbox starts within the top margin of page.
+func (m Margins) InTop(bbox, page [4]float32) bool {
+	return m.Top.Value > 0 && bbox[1] < page[1]+m.Top.points(page[3]-page[1])
+}
+
+// InBottom reports whether bbox ends within the bottom margin of page.
+func (m Margins) InBottom(bbox, page [4]float32) bool {
+	return m.Bottom.Value > 0 && bbox[3] > page[3]-m.Bottom.points(page[3]-page[1])
+}
+
+// Contains reports whether bbox reaches into any of the margins of page.
+func (m Margins) Contains(bbox, page [4]float32) bool {
+	w := page[2] - page[0]
+	return m.InTop(bbox, page) || m.InBottom(bbox, page) ||
+		(m.Left.Value > 0 && bbox[0] < page[0]+m.Left.points(w)) ||
+		(m.Right.Value > 0 && bbox[2] > page[2]-m.Right.points(w))
+}
+
+func (m Margins) String() string {
+	return strings.Join([]string{m.Top.String(), m.Right.String(), m.Bottom.String(), m.Left.String()}, ",")
+}
+
+func (m Margins) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+func (m *Margins) UnmarshalText(b []byte) (err error) {
+	*m, err = ParseMargins(string(b))
+	return err
+}
+
+// ParseMargins reads one to four comma-separated margins in CSS order: one
+// value for all edges, two for top and bottom then left and right, or four for
+// top, right, bottom and left. Each is in points, or a percentage with "%".
+func ParseMargins(s string) (Margins, error) {
+	parts := strings.Split(s, ",")
+	vals := make([]Margin, len(parts))
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		m := Margin{Percent: strings.HasSuffix(p, "%")}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 32)
+		if err != nil || v < 0 {
+			return Margins{}, fmt.Errorf("invalid margin %q (want points or a percentage such as 8%%)", p)
+		}
+		m.Value = float32(v)
+		vals[i] = m
+	}
+	switch len(vals) {
+	case 1:
+		return Margins{vals[0], vals[0], vals[0], vals[0]}, nil
+	case 2:
+		return Margins{Top: vals[0], Bottom: vals[0], Left: vals[1], Right: vals[1]}, nil
+	case 4:
+		return Margins{Top: vals[0], Right: vals[1], Bottom: vals[2], Left: vals[3]}, nil
+	}
+	return Margins{}, fmt.Errorf("invalid margins %q (want 1, 2 or 4 values)", s)
+}
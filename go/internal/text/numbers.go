@@ -0,0 +1,121 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeNumber rewrites a number as printed, such as "(1.234,50)",
+// "−12 %", "1 234-" or "$ 3,000", as a plain decimal: "-1234.50", "-12",
+// "-1234", "3000". Parentheses, a trailing minus and the various dashes make
+// it negative; currency signs and a percent sign are dropped; spaces and
+// apostrophes group thousands. decimal is the mark before the decimals, '.'
+// or ','; 0 decides for each number, taking a lone mark before exactly three
+// digits to group thousands. ok is false unless s is one number.
+func NormalizeNumber(s string, decimal rune) (value string, ok bool) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg, s = true, s[1:len(s)-1]
+	}
+	body := []rune(s)
+	for trimmed := true; trimmed && len(body) > 0; {
+		trimmed = false
+		switch r := body[0]; {
+		case isGroupSpace(r) || unicode.Is(unicode.Sc, r) || r == '+':
+			body, trimmed = body[1:], true
+		case isMinus(r):
+			body, neg, trimmed = body[1:], !neg, true
+		}
+		if len(body) == 0 {
+			break
+		}
+		switch r := body[len(body)-1]; {
+		case isGroupSpace(r) || unicode.Is(unicode.Sc, r) || r == '%':
+			body, trimmed = body[:len(body)-1], true
+		case isMinus(r):
+			body, neg, trimmed = body[:len(body)-1], !neg, true
+		}
+	}
+	if len(body) == 0 || body[len(body)-1] < '0' || body[len(body)-1] > '9' {
+		return "", false
+	}
+
+	// the last '.' or ',' is the decimal mark unless it groups thousands
+	mark := -1
+	var points, commas int
+	for i, r := range body {
+		switch {
+		case r == '.' || r == ',':
+			if r == '.' {
+				points++
+			} else {
+				commas++
+			}
+			mark = i
+		case r >= '0' && r <= '9', isGroupSpace(r), r == '\'', r == '’':
+		default:
+			return "", false
+		}
+	}
+	if mark >= 0 {
+		last := body[mark]
+		switch {
+		case decimal != 0 && last != decimal:
+			mark = -1
+		case decimal == 0 && points > 0 && commas > 0:
+		case (last == '.' && points > 1) || (last == ',' && commas > 1):
+			mark = -1
+		case decimal == 0 && len(body)-mark-1 == 3 && mark > 0 && mark <= 3:
+			mark = -1
+		}
+	}
+
+	// groups of digits between separators hold three, or two in the Indian
+	// 1,00,000 ahead of the last one, so "1.2.3" and dates are no numbers
+	var whole, frac strings.Builder
+	groups := []int{0}
+	for i, r := range body {
+		switch {
+		case mark >= 0 && i > mark:
+			if r < '0' || r > '9' {
+				return "", false
+			}
+			frac.WriteRune(r)
+		case i == mark:
+		case r < '0' || r > '9':
+			groups = append(groups, 0)
+		default:
+			whole.WriteRune(r)
+			groups[len(groups)-1]++
+		}
+	}
+	for i, n := range groups {
+		switch {
+		case i == 0 && len(groups) > 1 && (n == 0 || n > 3):
+			return "", false
+		case i > 0 && i == len(groups)-1 && n != 3:
+			return "", false
+		case i > 0 && n != 2 && n != 3:
+			return "", false
+		}
+	}
+	if mark >= 0 && frac.Len() == 0 {
+		return "", false
+	}
+	value = strings.TrimLeft(whole.String(), "0")
+	if value == "" {
+		value = "0"
+	}
+	if frac.Len() > 0 {
+		value += "." + frac.String()
+	}
+	if neg {
+		value = "-" + value
+	}
+	return value, true
+}
+
+func isMinus(r rune) bool { return r == '-' || r == '−' || r == '–' || r == '‒' }
+
+func isGroupSpace(r rune) bool { return r == ' ' || r == ' ' || r == ' ' || r == ' ' }
@@ -0,0 +1,95 @@
+package text
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PageNumberPattern is a form of page number, such as "Page 3 of 10", given
+// as a template matched against the whole of a block's text regardless of
+// case: {n} stands for the page number, in up to 4 digits or a roman numeral
+// from i to xxxix, and {total} for the number of pages; the rest is a
+// regular expression, compiled as it is.
+type PageNumberPattern struct {
+	template string
+	re       *regexp.Regexp
+}
+
+var pageNumberTokens = func() *strings.Replacer {
+	numerals := make([]string, 0, len(romanNumerals))
+	for n := range romanNumerals {
+		numerals = append(numerals, n)
+	}
+	// longest first, so that xiv is not taken for xi
+	slices.SortFunc(numerals, func(a, b string) int { return len(b) - len(a) })
+	roman := strings.Join(numerals, "|")
+	return strings.NewReplacer(
+		"{n}", `(?:[0-9]{1,4}|(?-i:`+roman+`|`+strings.ToUpper(roman)+`))`,
+		"{total}", `[0-9]{1,5}`,
+	)
+}()
+
+func ParsePageNumberPattern(template string) (PageNumberPattern, error) {
+	if strings.TrimSpace(template) == "" {
+		return PageNumberPattern{}, fmt.Errorf("empty page number pattern")
+	}
+	re, err := regexp.Compile(`^(?i:` + pageNumberTokens.Replace(template) + `)$`)
+	if err != nil {
+		return PageNumberPattern{}, fmt.Errorf("invalid page number pattern %q: %w", template, err)
+	}
+	return PageNumberPattern{template, re}, nil
+}
+
+func (p PageNumberPattern) String() string { return p.template }
+
+func (p PageNumberPattern) MarshalText() ([]byte, error) { return []byte(p.template), nil }
+
+func (p *PageNumberPattern) UnmarshalText(b []byte) (err error) {
+	*p, err = ParsePageNumberPattern(string(b))
+	return err
+}
+
+// PageNumbers are the forms a block alone in a margin is taken for a page
+// number in, and dropped.
+type PageNumbers []PageNumberPattern
+
+// Match reports whether text, trimmed, is a page number in one of the forms.
+func (ps PageNumbers) Match(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, p := range ps {
+		if p.re != nil && p.re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPageNumbers are bare numbers, numbers between dashes or over the page
+// count, and "Page 3" or "Page 3 of 10" in English, German, French, Spanish,
+// Portuguese, Italian and Dutch, with any whitespace or none between the parts
+// as extraction leaves it.
+var DefaultPageNumbers = func() PageNumbers {
+	const (
+		page = `(?:page|p\.|pg\.?|seite|s\.|p[aá]gina|p[aá]g\.|blatt)`
+		of   = `(?:of|von|sur|de|di|van)`
+	)
+	var ps PageNumbers
+	for _, t := range []string{
+		`{n}`,
+		`[-–—] {n} [-–—]`,
+		`{n} / {total}`,
+		`{n} ` + of + ` {total}`,
+		page + ` {n}`,
+		page + ` {n} ` + of + ` {total}`,
+		page + ` {n} / {total}`,
+	} {
+		p, err := ParsePageNumberPattern(strings.ReplaceAll(t, " ", `\s*`))
+		if err != nil {
+			panic(err)
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}()
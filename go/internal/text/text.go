@@ -1,10 +1,44 @@
 package text
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// Spacing controls how gaps between glyphs are turned into spaces and line
+// breaks. Horizontal gaps are measured in average advance widths of the glyph's
+// font, vertical ones in font sizes.
+type Spacing struct {
+	WordGap    float32 // gap that starts a new word
+	PunctGap   float32 // gap that starts a new word next to punctuation or digits
+	LineShift  float32 // baseline shift that starts a new line
+	PunctShift float32 // baseline shift that starts a new line next to punctuation or digits
+	LineJoin   float32 // gap between lines below which they join with a space, not a newline
+
+	CJKLatinSpace bool // allow a space between CJK and Latin text when the gap calls for one
+	Reflow        bool // join lines that only wrapped with a space whatever their gap, keeping deliberate breaks
+}
+
+var DefaultSpacing = Spacing{
+	WordGap:    0.6,
+	PunctGap:   1.2,
+	LineShift:  0.3,
+	PunctShift: 1.0,
+	LineJoin:   0.2,
+
+	CJKLatinSpace: true,
+	Reflow:        true,
+}
+
+var ligatures = strings.NewReplacer("\uFB00", "ff", "\uFB01", "fi", "\uFB02", "fl", "\uFB03", "ffi", "\uFB04", "ffl", "\uFB05", "st", "\uFB06", "st")
+
+// ExpandLigatures replaces Latin ligature codepoints (ﬁ, ﬂ, ﬃ...) with the
+// letters they stand for.
+func ExpandLigatures(s string) string { return ligatures.Replace(s) }
+
 func IsBullet[T rune | string](v T) bool {
 	bulletRunes := map[rune]bool{
 		'•': true, '●': true, '○': true, '◦': true, '◯': true, '▪': true, '▫': true, '■': true, '□': true,
@@ -80,8 +114,27 @@ func EndsWithPunctuation(text string) bool {
 	if len(text) == 0 {
 		return false
 	}
-	last := rune(text[len(text)-1])
-	return last == '.' || last == ':' || last == ';' || last == '?' || last == '!'
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return last == '.' || last == ':' || last == ';' || last == '?' || last == '!' || last == '。' || last == '！' || last == '？' || last == '：' || last == '；'
+}
+
+// IsCJK reports whether r is a Chinese, Japanese or Korean character, CJK
+// punctuation, or a fullwidth form; text in these scripts is set without
+// spaces between characters.
+func IsCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F && r != 0x3000) || (r >= 0xFF01 && r <= 0xFFEF)
+}
+
+// JoinsWithoutSpace reports whether two adjacent characters must be joined
+// directly: within a CJK run always, and at a CJK/Latin boundary unless the
+// spacing allows a space there.
+func JoinsWithoutSpace(prev, next rune, sp Spacing) bool {
+	a, b := IsCJK(prev), IsCJK(next)
+	if a && b {
+		return true
+	}
+	return (a || b) && !sp.CJKLatinSpace && !unicode.IsSpace(prev) && !unicode.IsSpace(next)
 }
 
 func IsAllCaps(text string) bool {
@@ -97,6 +150,80 @@ func IsAllCaps(text string) bool {
 	return hasAlpha
 }
 
+// capsWords are words, by language, that are written in capitals wherever
+// they appear, such as legal forms, statutes and institutions, so a line of
+// them is no all-caps heading.
+var capsWords = map[string][]string{
+	"de": {"AG", "AO", "BGB", "BGH", "BDSG", "BVERFG", "DSGVO", "EU", "GG", "GMBH", "HGB", "KG", "NR", "STGB", "STPO", "USTG", "UWG", "ZPO"},
+	"en": {"CFR", "EU", "GDPR", "INC", "LLC", "LLP", "LTD", "PLC", "UK", "US", "USA", "USC"},
+	"fr": {"RGPD", "SA", "SARL", "SAS", "UE"},
+}
+
+// CapsHeading restricts which all-caps lines pass for headings.
+type CapsHeading struct {
+	MinLetters int    // capitals needed outside the language's capsWords
+	MaxWords   int    // longest heading in words
+	Language   string // whose capsWords are discounted, and "de" allows ß among capitals; "" for every language known
+}
+
+// IsCapsHeading reports whether text is set in capitals the way a heading is,
+// rather than being a run of acronyms or a line of figures: all its letters
+// are capitals, enough of them outside the capsWords of rule.Language, it has
+// no more than rule.MaxWords words, and at most half its other chars are
+// digits or punctuation.
+func IsCapsHeading(text string, rule CapsHeading) bool {
+	words := strings.Fields(text)
+	if len(words) == 0 || (rule.MaxWords > 0 && len(words) > rule.MaxWords) {
+		return false
+	}
+	letters, all, symbols := 0, 0, 0
+	for _, word := range words {
+		for _, r := range word {
+			switch {
+			case r == 'ß' && (rule.Language == "" || rule.Language == "de"):
+			case unicode.IsLetter(r):
+				if !unicode.IsUpper(r) {
+					return false
+				}
+			default:
+				symbols++
+			}
+		}
+		// "EU-DSGVO" is two words here
+		for _, part := range strings.FieldsFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			n := utf8.RuneCountInString(part)
+			if all += n; !isCapsWord(part, rule.Language) {
+				letters += n
+			}
+		}
+	}
+	return letters > 0 && letters >= rule.MinLetters && symbols <= all
+}
+
+// CapsLanguages lists the languages CapsHeading knows the capsWords of.
+func CapsLanguages() []string {
+	langs := make([]string, 0, len(capsWords))
+	for lang := range capsWords {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func isCapsWord(word, language string) bool {
+	for lang, list := range capsWords {
+		if language != "" && lang != language {
+			continue
+		}
+		for _, w := range list {
+			if strings.ToUpper(word) == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 var headingKeywords = []string{"appendix", "chapter", "section", "heading", "article", "part"}
 
 func StartsWithHeadingKeyword(text string) bool {
@@ -116,6 +243,30 @@ func StartsWithHeadingKeyword(text string) bool {
 	return false
 }
 
+var captionKeywords = []string{"figure", "fig.", "fig", "image", "chart", "diagram", "photo", "plate", "illustration", "exhibit", "graph"}
+
+// IsCaption reports whether text opens like a figure caption: a keyword such
+// as "Figure" or "Fig." followed by a number, optionally with a letter before
+// or after it ("Figure S1", "Fig. 2b").
+func IsCaption(text string) bool {
+	trimmed := strings.TrimLeft(text, " ")
+	lower := strings.ToLower(trimmed)
+	for _, kw := range captionKeywords {
+		if !strings.HasPrefix(lower, kw) {
+			continue
+		}
+		rest := strings.TrimLeft(trimmed[len(kw):], " ")
+		if rest == trimmed[len(kw):] && !strings.HasSuffix(kw, ".") && (rest == "" || rest[0] < '0' || rest[0] > '9') {
+			continue // "Figures", "Imagine"
+		}
+		if rest != "" && unicode.IsUpper(rune(rest[0])) {
+			rest = rest[1:]
+		}
+		return rest != "" && rest[0] >= '0' && rest[0] <= '9'
+	}
+	return false
+}
+
 func StartsWithNumericHeading(text string) bool {
 	text = strings.TrimLeft(text, " ")
 	if text == "" {
@@ -150,15 +301,19 @@ func StartsWithBullet(text string) bool {
 	if IsBullet(r[0]) {
 		return len(r) == 1 || unicode.IsSpace(r[1])
 	}
-	if isDigit(text[0]) || (len(text) >= 2 && isAlpha(text[0])) {
-		i := 0
-		for i < len(text) && isDigit(text[i]) {
-			i++
-		}
-		if i < len(text) && (text[i] == '.' || text[i] == ')') {
-			return i+1 >= len(text) || unicode.IsSpace(rune(text[i+1]))
+	i := 0
+	for i < len(text) && isDigit(text[i]) {
+		i++
+	}
+	if i == 0 && text[0] >= 'a' && text[0] <= 'z' {
+		// a. or iv., in lower case only, as "A. Smith" starts many a line
+		if i = romanLen(text); i == 0 {
+			i = 1
 		}
 	}
+	if i > 0 && i < len(text) && (text[i] == '.' || text[i] == ')') {
+		return i+1 >= len(text) || unicode.IsSpace(rune(text[i+1]))
+	}
 	return false
 }
 
@@ -177,9 +332,38 @@ func StartsWithNumber(text string) (bool, string) {
 	if len(text) >= 2 && isAlpha(text[0]) && (text[1] == '.' || text[1] == ')') && (len(text) == 2 || unicode.IsSpace(rune(text[2]))) {
 		return true, text[:2]
 	}
+	if i = romanLen(text); i > 0 && i < len(text) && (text[i] == '.' || text[i] == ')') && (i+1 == len(text) || unicode.IsSpace(rune(text[i+1]))) {
+		return true, text[:i+1]
+	}
 	return false, ""
 }
 
+var romanNumerals = func() map[string]bool {
+	m := map[string]bool{}
+	for _, tens := range []string{"", "x", "xx", "xxx"} {
+		for _, units := range []string{"", "i", "ii", "iii", "iv", "v", "vi", "vii", "viii", "ix"} {
+			if tens+units != "" {
+				m[tens+units] = true
+			}
+		}
+	}
+	return m
+}()
+
+// romanLen is the length of the roman numeral from i to xxxix, in lower or
+// upper case, that s starts with, or 0. Numerals with l, c, d or m are left
+// out as they mostly start words.
+func romanLen(s string) int {
+	i := 0
+	for i < len(s) && i < 6 && strings.IndexByte("ivxIVX", s[i]) >= 0 {
+		i++
+	}
+	if lower := strings.ToLower(s[:i]); i > 0 && (s[:i] == lower || s[:i] == strings.ToUpper(s[:i])) && romanNumerals[lower] {
+		return i
+	}
+	return 0
+}
+
 func IsLonePageNumber(text string) bool {
 	text = strings.TrimLeft(text, " \t")
 	digitCount := 0
@@ -190,6 +374,33 @@ func IsLonePageNumber(text string) bool {
 	return digitCount > 0 && digitCount <= 4 && text == ""
 }
 
+// ParseBates matches a Bates number such as "ABC0001234", "ABC-000123" or
+// "SMITH 00042" at the end of text, returning the number as printed, its
+// alphabetic prefix and numeric value. value is empty when there is no match.
+func ParseBates(text string) (value, prefix string, number int) {
+	text = strings.TrimRight(text, " \t\n")
+	i := len(text)
+	for i > 0 && isDigit(text[i-1]) {
+		i--
+	}
+	if digits := len(text) - i; digits < 4 || digits > 10 {
+		return "", "", 0
+	}
+	j := i
+	if j > 0 && (text[j-1] == '-' || text[j-1] == '_' || text[j-1] == ' ') {
+		j--
+	}
+	k := j
+	for k > 0 && ((text[k-1] >= 'A' && text[k-1] <= 'Z') || isDigit(text[k-1])) {
+		k--
+	}
+	if k == j || j-k > 12 || !isAlpha(text[k]) || (k > 0 && text[k-1] != ' ') {
+		return "", "", 0
+	}
+	number, _ = strconv.Atoi(text[i:])
+	return text[k:], text[k:j], number
+}
+
 func IsInMarginArea(bbox [4]float32, pageBBox [4]float32, thresholdPercent float32) bool {
 	threshold := (pageBBox[3] - pageBBox[1]) * thresholdPercent
 	return bbox[1] < pageBBox[1]+threshold || bbox[3] > pageBBox[3]-threshold
@@ -198,3 +409,84 @@ func IsInMarginArea(bbox [4]float32, pageBBox [4]float32, thresholdPercent float
 func CountUnicodeChars(text string) int { return len([]rune(text)) }
 func isDigit(b byte) bool               { return b >= '0' && b <= '9' }
 func isAlpha(b byte) bool               { return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') }
+
+var abbreviations = map[string]bool{
+	"al": true, "approx": true, "cf": true, "ch": true, "dept": true, "dr": true, "e.g": true, "eq": true,
+	"eqs": true, "etc": true, "fig": true, "figs": true, "i.e": true, "inc": true, "jr": true, "ltd": true,
+	"mr": true, "mrs": true, "ms": true, "no": true, "pp": true, "prof": true, "sec": true, "sr": true,
+	"st": true, "vol": true, "vs": true,
+}
+
+// SplitSentences returns the [start, end) rune offsets of each sentence in s.
+// A sentence ends at . ! ? followed by whitespace and a capital, digit or
+// opening quote, or at CJK full stops; periods after abbreviations, initials
+// and inside numbers don't end one.
+func SplitSentences(s string) [][2]int {
+	r := []rune(s)
+	var out [][2]int
+	start := 0
+	add := func(end int) {
+		from, to := start, end
+		for from < to && unicode.IsSpace(r[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(r[to-1]) {
+			to--
+		}
+		if from < to {
+			out = append(out, [2]int{from, to})
+		}
+		start = end
+	}
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		if c == '。' || c == '！' || c == '？' {
+			add(closingEnd(r, i+1))
+			continue
+		}
+		if c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		end := closingEnd(r, i+1)
+		if end >= len(r) {
+			break
+		}
+		if !unicode.IsSpace(r[end]) {
+			continue
+		}
+		next := end
+		for next < len(r) && unicode.IsSpace(r[next]) {
+			next++
+		}
+		if next < len(r) && !unicode.IsUpper(r[next]) && !unicode.IsDigit(r[next]) && !strings.ContainsRune("\"'“‘([", r[next]) {
+			continue
+		}
+		if c == '.' && isAbbreviation(r[start:i]) {
+			continue
+		}
+		add(end)
+		i = end - 1
+	}
+	add(len(r))
+	return out
+}
+
+// closingEnd skips closing quotes and brackets that belong to the sentence.
+func closingEnd(r []rune, i int) int {
+	for i < len(r) && strings.ContainsRune("\"'”’)]」』", r[i]) {
+		i++
+	}
+	return i
+}
+
+func isAbbreviation(before []rune) bool {
+	i := len(before)
+	for i > 0 && !unicode.IsSpace(before[i-1]) && before[i-1] != '(' {
+		i--
+	}
+	word := strings.ToLower(string(before[i:]))
+	if n := len([]rune(word)); n == 1 && unicode.IsLetter([]rune(word)[0]) {
+		return true
+	}
+	return abbreviations[word]
+}
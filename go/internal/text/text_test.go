@@ -1,6 +1,7 @@
 package text
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -36,6 +37,10 @@ func TestStartsWithBullet(t *testing.T) {
 		{"", false},
 		{"  • indented bullet", true},
 		{"10. numbered", true},
+		{"a. lettered", true},
+		{"iv. roman", true},
+		{"A. Smith wrote", false},
+		{"e.g. this", false},
 	}
 
 	for _, tc := range tests {
@@ -55,6 +60,9 @@ func TestStartsWithNumber(t *testing.T) {
 		{"1. text", true, "1."},
 		{"10) text", true, "10)"},
 		{"a. text", true, "a."},
+		{"iv. text", true, "iv."},
+		{"XII) text", true, "XII)"},
+		{"Ivy. text", false, ""},
 		{"• bullet", false, ""},
 		{"no number", false, ""},
 	}
@@ -107,6 +115,30 @@ func TestStartsWithHeadingKeyword(t *testing.T) {
 	}
 }
 
+func TestIsCaption(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"Figure 1: Results", true},
+		{"FIGURE 12. Layout", true},
+		{"Fig. 2b shows", true},
+		{"Figure1 Overview", true},
+		{"Photo S2", true},
+		{"Figures 1 and 2 show", false},
+		{"Imagine 3 cases", false},
+		{"Figure out the rest", false},
+		{"Chart A", false},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		if got := IsCaption(tc.input); got != tc.want {
+			t.Errorf("IsCaption(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
+
 func TestIsAllCaps(t *testing.T) {
 	tests := []struct {
 		input string
@@ -127,6 +159,36 @@ func TestIsAllCaps(t *testing.T) {
 	}
 }
 
+func TestIsCapsHeading(t *testing.T) {
+	rule := CapsHeading{MinLetters: 4, MaxWords: 12}
+	tests := []struct {
+		input string
+		lang  string
+		want  bool
+	}{
+		{"INTRODUCTION", "", true},
+		{"I. SCOPE OF WORK", "", true},
+		{"ALLGEMEINE GESCHÄFTSBEDINGUNGEN DER MUSTER GMBH", "de", true},
+		{"GROßE STRAßE", "de", true},
+		{"GROßE STRAßE", "en", false},
+		{"USA", "", false},
+		{"§ 433 BGB", "de", false},
+		{"EU-DSGVO UND BDSG", "de", false},
+		{"ACME INC.", "en", true},
+		{"DSGVO BGB HGB ZPO", "de", false},
+		{"DSGVO BGB HGB ZPO", "en", true},
+		{"FY 2023 12,345.67 (8.9%)", "", false},
+		{"THE PARTIES AGREE THAT THIS AGREEMENT SHALL BE GOVERNED BY THE LAWS OF", "", false},
+		{"Hello World", "", false},
+	}
+	for _, tc := range tests {
+		rule.Language = tc.lang
+		if got := IsCapsHeading(tc.input, rule); got != tc.want {
+			t.Errorf("IsCapsHeading(%q, %q) = %v, want %v", tc.input, tc.lang, got, tc.want)
+		}
+	}
+}
+
 func TestHasVisibleContent(t *testing.T) {
 	tests := []struct {
 		input string
@@ -156,6 +218,7 @@ func TestEndsWithPunctuation(t *testing.T) {
 		{"hello?", true},
 		{"hello!", true},
 		{"hello:", true},
+		{"完了。", true},
 		{"hello", false},
 		{"", false},
 	}
@@ -189,6 +252,106 @@ func TestIsLonePageNumber(t *testing.T) {
 	}
 }
 
+func TestPageNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  bool
+	}{
+		{"42", true},
+		{" 7 ", true},
+		{"12345", false},
+		{"Page 3", true},
+		{"Page 3 of 10", true},
+		{"3/10", true},
+		{"3 / 10", true},
+		{"- 3 -", true},
+		{"— 12 —", true},
+		{"xiv", true},
+		{"XIV", true},
+		{"xIV", false},
+		{"Seite 4 von 20", true},
+		{"Page 2 sur 9", true},
+		{"Página 5 de 12", true},
+		{"p. 17", true},
+		{"Chapter 3", false},
+		{"Page three", false},
+		{"", false},
+	} {
+		if got := DefaultPageNumbers.Match(tc.input); got != tc.want {
+			t.Errorf("DefaultPageNumbers.Match(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+	p, err := ParsePageNumberPattern("Folio {n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps := (PageNumbers{p}); !ps.Match("folio 12") || ps.Match("12") || ps.Match("folio12") || ps.Match("folio  12") {
+		t.Errorf("custom pattern %q matched wrongly", p)
+	}
+	if _, err := ParsePageNumberPattern("Page ({n}"); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestParseBates(t *testing.T) {
+	tests := []struct {
+		input, value, prefix string
+		number               int
+	}{
+		{"ABC0001234", "ABC0001234", "ABC", 1234},
+		{"CONFIDENTIAL DEF-000042", "DEF-000042", "DEF", 42},
+		{"SMITH 00017", "SMITH 00017", "SMITH", 17},
+		{"42", "", "", 0},
+		{"Page 12345", "", "", 0},
+		{"xABC0001234", "", "", 0},
+		{"ABC12", "", "", 0},
+	}
+
+	for _, tc := range tests {
+		value, prefix, number := ParseBates(tc.input)
+		if value != tc.value || prefix != tc.prefix || number != tc.number {
+			t.Errorf("ParseBates(%q) = %q, %q, %d, want %q, %q, %d", tc.input, value, prefix, number, tc.value, tc.prefix, tc.number)
+		}
+	}
+}
+
+func TestExpandLigatures(t *testing.T) {
+	tests := []struct{ input, want string }{
+		{"\uFB01nd the \uFB02ow", "find the flow"},
+		{"e\uFB03cient o\uFB00er", "efficient offer"},
+		{"plain", "plain"},
+	}
+
+	for _, tc := range tests {
+		if got := ExpandLigatures(tc.input); got != tc.want {
+			t.Errorf("ExpandLigatures(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestJoinsWithoutSpace(t *testing.T) {
+	noBoundary := DefaultSpacing
+	noBoundary.CJKLatinSpace = false
+	tests := []struct {
+		prev, next rune
+		sp         Spacing
+		want       bool
+	}{
+		{'中', '文', DefaultSpacing, true},
+		{'す', '。', DefaultSpacing, true},
+		{'Ａ', '１', DefaultSpacing, true},
+		{'中', 'A', DefaultSpacing, false},
+		{'中', 'A', noBoundary, true},
+		{'a', 'b', noBoundary, false},
+	}
+
+	for _, tc := range tests {
+		if got := JoinsWithoutSpace(tc.prev, tc.next, tc.sp); got != tc.want {
+			t.Errorf("JoinsWithoutSpace(%q, %q) = %v, want %v", tc.prev, tc.next, got, tc.want)
+		}
+	}
+}
+
 func TestIsBullet(t *testing.T) {
 	bullets := []rune{'•', '●', '○', '▪', '■', '-', '*', '+'}
 	for _, r := range bullets {
@@ -223,3 +386,120 @@ func TestIsInMarginArea(t *testing.T) {
 		t.Error("middle content should not be in margin")
 	}
 }
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"It works. See Fig. 3 for details! Done?", []string{"It works.", "See Fig. 3 for details!", "Done?"}},
+		{"J. Smith et al. reported 3.5% growth, e.g. in Q2. Next one.", []string{"J. Smith et al. reported 3.5% growth, e.g. in Q2.", "Next one."}},
+		{"He said \"stop.\" Then left.", []string{"He said \"stop.\"", "Then left."}},
+		{"これは文です。次の文。", []string{"これは文です。", "次の文。"}},
+		{"no terminator", []string{"no terminator"}},
+	}
+
+	for _, tc := range tests {
+		r := []rune(tc.input)
+		var got []string
+		for _, span := range SplitSentences(tc.input) {
+			got = append(got, string(r[span[0]:span[1]]))
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("SplitSentences(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestMargins(t *testing.T) {
+	m, err := ParseMargins("36, 5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Margins{Top: Margin{36, false}, Bottom: Margin{36, false}, Left: Margin{5, true}, Right: Margin{5, true}}); m != want {
+		t.Errorf("ParseMargins = %+v, want %+v", m, want)
+	}
+	page := [4]float32{0, 0, 600, 800}
+	for _, c := range []struct {
+		bbox [4]float32
+		want bool
+	}{
+		{[4]float32{100, 20, 300, 40}, true},   // top
+		{[4]float32{100, 770, 300, 790}, true}, // bottom
+		{[4]float32{10, 400, 25, 420}, true},   // left, within 30pt
+		{[4]float32{100, 400, 300, 420}, false},
+	} {
+		if got := m.Contains(c.bbox, page); got != c.want {
+			t.Errorf("Contains(%v) = %v", c.bbox, got)
+		}
+	}
+	if d, _ := ParseMargins(DefaultMargins.String()); d != DefaultMargins {
+		t.Errorf("default margins round trip to %+v", d)
+	}
+	for _, bad := range []string{"", "1,2,3", "-5", "x%"} {
+		if _, err := ParseMargins(bad); err == nil {
+			t.Errorf("ParseMargins(%q) should fail", bad)
+		}
+	}
+}
+
+func TestNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		input   string
+		decimal rune
+		want    string
+	}{
+		{"1,234.56", 0, "1234.56"},
+		{"1.234,56", 0, "1234.56"},
+		{"(1.234,50)", 0, "-1234.50"},
+		{"−12 %", 0, "-12"},
+		{"$ 3,000", 0, "3000"},
+		{"€1 234 567", 0, "1234567"},
+		{"1'234.5", 0, "1234.5"},
+		{"1 234-", 0, "-1234"},
+		{"– 7", 0, "-7"},
+		{"12,5", 0, "12.5"},
+		{"1,234", 0, "1234"},
+		{"1,234", ',', "1.234"},
+		{"1.234", ',', "1234"},
+		{"1,00,000", 0, "100000"},
+		{".5", 0, "0.5"},
+		{"007", 0, "7"},
+		{"1.2.3", 0, ""},
+		{"12.05.2023", 0, ""},
+		{"2023-2024", 0, ""},
+		{"N/A", 0, ""},
+		{"-", 0, ""},
+		{"12 apples", 0, ""},
+		{"1,234.5,6", 0, ""},
+	}
+	for _, tc := range tests {
+		got, ok := NormalizeNumber(tc.input, tc.decimal)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("NormalizeNumber(%q, %q) = %q, %v, want %q", tc.input, tc.decimal, got, ok, tc.want)
+		}
+	}
+}
+
+func TestSanitizeInvisible(t *testing.T) {
+	in := "\ufeffa\u200bb\u200dc\u200ed\u2066e\u2069\x01f\u00ad\tg"
+	tests := []struct {
+		policy Invisible
+		want   string
+	}{
+		{InvisibleKeep, in},
+		{InvisibleStrip, "abcdef\u00ad\tg"},
+		{InvisibleMap, "a b\u200dcdef\u00ad\tg"},
+	}
+	for _, tc := range tests {
+		if got := SanitizeInvisible(in, tc.policy); got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.policy, got, tc.want)
+		}
+	}
+	if got := SanitizeInvisible("\u0600\u0661", InvisibleStrip); got != "\u0600\u0661" {
+		t.Errorf("Arabic number sign dropped: %q", got)
+	}
+	if _, err := ParseInvisible("drop"); err == nil {
+		t.Error("ParseInvisible accepted drop")
+	}
+}
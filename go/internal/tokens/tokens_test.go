@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/pymupdf4llm-c/go/internal/models"
+)
+
+func TestApproxCL100K(t *testing.T) {
+	// reference counts from tiktoken's cl100k_base
+	tests := []struct {
+		text string
+		real int
+	}{
+		{"Hello world", 2},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"Revenue grew 12345 dollars in 2023.", 9},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got := ApproxCL100K(tt.text)
+		if d := got - tt.real; d < -2 || d > 2 {
+			t.Errorf("ApproxCL100K(%q) = %d, want about %d", tt.text, got, tt.real)
+		}
+	}
+	if got := ApproxCL100K("日本語"); got != 3 {
+		t.Errorf("CJK counted %d, want one per character", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if _, err := Lookup("nope"); err == nil {
+		t.Error("expected error for unknown tokenizer")
+	}
+	Register("words", CounterFunc(func(s string) int { return 42 }))
+	c, err := Lookup("words")
+	if err != nil || c.Count("x") != 42 {
+		t.Errorf("registered counter not returned: %v", err)
+	}
+}
+
+func TestAnnotateBlocks(t *testing.T) {
+	pages := []models.Page{{Data: []models.Block{
+		{Type: models.BlockHeading, Level: 1, Spans: []models.Span{{Text: "Intro"}}},
+		{Type: models.BlockCode, Spans: []models.Span{{Text: "x := 1"}}},
+	}}}
+	AnnotateBlocks(pages, CounterFunc(func(s string) int { return len(s) }))
+	if got := pages[0].Data[0].Tokens; got != len("# Intro") {
+		t.Errorf("heading tokens = %d", got)
+	}
+	if got := pages[0].Data[1].Tokens; got != len("x := 1") {
+		t.Errorf("code tokens = %d", got)
+	}
+}
+
+func TestRegisterWhileLookingUp(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			Register("words", CounterFunc(func(s string) int { return len(s) }))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := Lookup("cl100k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,58 @@
+"""tests for the python api, against a stand-in for libtomd."""
+
+from __future__ import annotations
+import shutil
+import tempfile
+import threading
+import unittest
+from pathlib import Path
+from unittest import mock
+
+from fibrum_pdf import api
+
+
+class _Lib:
+    """pdf_to_json_progress that waits for two conversions to be in it at once."""
+
+    def __init__(self) -> None:
+        self.both_in = threading.Barrier(2, timeout=10)
+
+    def pdf_to_json_progress(self, pdf, out, _opts, cb, user) -> int:  # noqa: D102
+        self.both_in.wait()
+        cb(1, 1, user)
+        Path(out.decode()).write_text('{"pages": []}', encoding="utf-8")
+        return 0
+
+
+class ToJsonTest(unittest.TestCase):
+    """to_json."""
+
+    def test_concurrent_conversions(self) -> None:
+        """two threads convert at the same time, each with its own progress."""
+        lib = _Lib()
+        progress: dict[str, list[tuple[int, int]]] = {"a": [], "b": []}
+        errors: list[BaseException] = []
+        d = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, d)
+
+        def convert(name: str) -> None:
+            pdf = Path(d, f"{name}.pdf")
+            pdf.write_bytes(b"%PDF-1.4\n")
+            try:
+                result = api.to_json(pdf, progress=lambda *p: progress[name].append(p))
+                self.assertEqual(len(result.collect()), 0)
+            except Exception as e:
+                errors.append(e)
+
+        with mock.patch.object(api, "_lib", lambda _path=None: lib):
+            threads = [threading.Thread(target=convert, args=(n,)) for n in progress]
+            for t in threads:
+                t.start()
+            for t in threads:
+                t.join()
+        self.assertEqual(errors, [], "conversions did not run at the same time")
+        self.assertEqual(progress, {"a": [(1, 1)], "b": [(1, 1)]})
+
+
+if __name__ == "__main__":
+    unittest.main()